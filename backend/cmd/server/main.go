@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"io/fs"
 	"log"
 	"net/http"
@@ -13,9 +15,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/kk-alert/backend/internal/auth"
+	"github.com/kk-alert/backend/internal/engine"
 	"github.com/kk-alert/backend/internal/handlers"
 	"github.com/kk-alert/backend/internal/inbound"
 	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/requestid"
 	"github.com/kk-alert/backend/internal/scheduler"
 	"github.com/kk-alert/backend/internal/store"
 	"golang.org/x/crypto/bcrypt"
@@ -42,24 +46,30 @@ func main() {
 
 	sched := scheduler.NewScheduler(db.DB)
 	sched.Start()
+	inbound.StartQueue()
 
 	go runRetentionCleanupLoop(db.DB)
-
-	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-		<-sigChan
-		log.Println("Shutting down...")
-		sched.Stop()
-		os.Exit(0)
-	}()
+	go runScheduledReportLoop(db.DB)
+	go runEngineStateCleanupLoop(db.DB)
+	go runDigestLoop(db.DB)
 
 	r := gin.Default()
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		// Only these proxies' X-Forwarded-For is honoured for the client IP (inbound allowlist, login limits).
+		if err := r.SetTrustedProxies(strings.Split(v, ",")); err != nil {
+			log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+		}
+	}
 	r.Use(gin.Recovery())
+	r.Use(requestid.Middleware())
 
 	// Public
 	r.POST("/api/v1/auth/login", wrapAuth(db.DB).Login)
-	r.GET("/api/v1/health", func(c *gin.Context) { c.JSON(200, gin.H{"ok": true}) })
+	oidc := &handlers.OIDCHandler{DB: db.DB}
+	r.GET("/api/v1/auth/oidc/login", oidc.Login)
+	r.GET("/api/v1/auth/oidc/callback", oidc.Callback)
+	health := &handlers.HealthHandler{DB: db.DB, Scheduler: sched}
+	r.GET("/api/v1/health", health.Health)
 
 	// Swagger: OpenAPI spec and UI (no auth); token via Authorize in Swagger UI
 	r.GET("/api/openapi.json", serveOpenAPI)
@@ -68,8 +78,9 @@ func main() {
 	r.GET("/swagger/", func(c *gin.Context) { c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerHTML) })
 	r.GET("/swagger/index.html", func(c *gin.Context) { c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerHTML) })
 
-	// Inbound webhooks (no auth for Alertmanager / VM / ES / Doris)
+	// Inbound webhooks (no auth for Alertmanager / VM / ES / Doris / Grafana / CloudWatch unless the datasource sets an ingest secret)
 	inboundGroup := r.Group("/api/v1/inbound")
+	inboundGroup.Use(inbound.LimitRequest(), inbound.AllowIPs(db.DB), inbound.VerifySignature(db.DB))
 	{
 		prom := &inbound.PrometheusHandler{DB: db.DB, SourceType: "prometheus"}
 		inboundGroup.POST("/prometheus", prom.Serve)
@@ -79,14 +90,23 @@ func main() {
 		inboundGroup.POST("/elasticsearch", elasticsearchHandler.Serve)
 		dorisHandler := &inbound.GenericHandler{DB: db.DB, SourceType: "doris"}
 		inboundGroup.POST("/doris", dorisHandler.Serve)
+		grafanaHandler := &inbound.GrafanaHandler{DB: db.DB}
+		inboundGroup.POST("/grafana", grafanaHandler.Serve)
+		snsHandler := &inbound.SNSHandler{DB: db.DB}
+		inboundGroup.POST("/cloudwatch", snsHandler.Serve)
+		mappedHandler := &inbound.MappedHandler{DB: db.DB}
+		inboundGroup.POST("/custom/:source_id", mappedHandler.Serve)
 	}
 
-	// Fill role from DB when JWT has no role (e.g. old tokens before role was added)
+	// Fill role from DB when JWT has no role (e.g. old tokens before role was added), and the caller's team
 	fillRole := fillRoleFromDB(db.DB)
+	fillTeam := fillTeamFromDB(db.DB)
 
-	// Protected API (all authenticated)
+	// Protected API (all authenticated; viewers are read-only)
+	canAck := auth.RequirePermission(auth.ActionAck)
+	canSilence := auth.RequirePermission(auth.ActionSilence)
 	api := r.Group("/api/v1")
-	api.Use(auth.RequireAuth(), fillRole)
+	api.Use(auth.RequireAuth(), fillRole, fillTeam)
 	{
 		api.POST("/auth/logout", wrapAuth(db.DB).Logout)
 		api.GET("/auth/me", wrapAuth(db.DB).Me)
@@ -98,11 +118,15 @@ func main() {
 		api.GET("/alerts", al.List)
 		api.GET("/alerts/export", al.Export)
 		api.GET("/alerts/notify-total", al.NotifyTotal)
+		api.GET("/notifications", (&handlers.NotificationHandler{DB: db.DB}).List)
 		api.GET("/alerts/:id", al.Get)
+		api.POST("/alerts/:id/assign", canAck, al.Assign)
+		api.POST("/alerts/:id/resolve", canAck, al.Resolve)
 		sil := &handlers.SilenceHandler{DB: db.DB}
-		api.POST("/alerts/:id/silence", sil.Create)
+		api.POST("/alerts/:id/silence", canSilence, sil.Create)
+		api.POST("/alerts/:id/snooze", canSilence, sil.Snooze)
 		api.GET("/silences", sil.List)
-		api.DELETE("/silences/:alert_id", sil.Delete)
+		api.DELETE("/silences/:alert_id", canSilence, sil.Delete)
 
 		rep := &handlers.ReportHandler{DB: db.DB}
 		api.GET("/reports/aggregate", rep.Aggregate)
@@ -112,6 +136,23 @@ func main() {
 
 		set := &handlers.SettingsHandler{DB: db.DB}
 		api.GET("/settings", set.Get)
+
+		meta := &handlers.MetaHandler{}
+		api.GET("/meta/query-languages", meta.QueryLanguages)
+		api.GET("/meta/channel-types", meta.ChannelTypes)
+	}
+
+	// Operators and admins: view rules and mute them without editing
+	rule := &handlers.RuleHandler{DB: db.DB, Scheduler: sched}
+	ops := r.Group("/api/v1")
+	ops.Use(auth.RequireAuth(), fillRole, fillTeam, auth.RequirePermission(auth.ActionMuteRules))
+	{
+		ops.GET("/rules", rule.List)
+		ops.GET("/rules/:id", rule.Get)
+		ops.POST("/rules/:id/silence", rule.Silence)
+		ops.DELETE("/rules/:id/silence", rule.Unsilence)
+		ops.POST("/rules/:id/pause", rule.Pause)
+		ops.POST("/rules/:id/resume", rule.Resume)
 	}
 
 	// Admin-only API
@@ -125,36 +166,64 @@ func main() {
 		admin.PUT("/datasources/:id", ds.Update)
 		admin.DELETE("/datasources/:id", ds.Delete)
 		admin.POST("/datasources/:id/test", ds.TestConnection)
+		admin.POST("/datasources/export", ds.Export)
+		admin.POST("/datasources/import", ds.Import)
 
 		ch := &handlers.ChannelHandler{DB: db.DB}
 		admin.GET("/channels", ch.List)
 		admin.GET("/channels/:id", ch.Get)
+		admin.GET("/channels/:id/stats", ch.Stats)
 		admin.POST("/channels", ch.Create)
 		admin.PUT("/channels/:id", ch.Update)
 		admin.DELETE("/channels/:id", ch.Delete)
 		admin.POST("/channels/:id/test", ch.TestSend)
+		admin.POST("/channels/export", ch.Export)
+		admin.POST("/channels/import", ch.Import)
 
 		tpl := &handlers.TemplateHandler{DB: db.DB}
 		admin.GET("/templates", tpl.List)
 		admin.GET("/templates/default", tpl.GetDefault)
 		admin.GET("/templates/:id", tpl.Get)
 		admin.POST("/templates", tpl.Create)
+		admin.POST("/templates/lint", tpl.Lint)
 		admin.PUT("/templates/:id/set-default", tpl.SetDefault)
 		admin.PUT("/templates/:id", tpl.Update)
 		admin.DELETE("/templates/:id", tpl.Delete)
 		admin.POST("/templates/:id/preview", tpl.Preview)
 
-		rule := &handlers.RuleHandler{DB: db.DB, Scheduler: sched}
-		admin.GET("/rules", rule.List)
-		admin.GET("/rules/:id", rule.Get)
+		admin.POST("/alerts/:id/replay", (&handlers.AlertHandler{DB: db.DB}).Replay)
+
+		nh := &handlers.NotificationHandler{DB: db.DB}
+		admin.GET("/notifications/failed", nh.ListFailed)
+		admin.POST("/notifications/:id/retry", nh.Retry)
+
+		admin.GET("/rules/deleted", rule.ListDeleted)
 		admin.POST("/rules", rule.Create)
 		admin.PUT("/rules/:id", rule.Update)
 		admin.DELETE("/rules/:id", rule.Delete)
 		admin.POST("/rules/batch", rule.Batch)
 		admin.POST("/rules/export", rule.Export)
 		admin.POST("/rules/import", rule.Import)
+		admin.POST("/rules/import-prometheus", rule.ImportPrometheus)
 		admin.POST("/rules/test-match", rule.TestMatch)
 		admin.POST("/rules/:id/trigger", rule.Trigger)
+		admin.POST("/rules/:id/restore", rule.Restore)
+		admin.GET("/rules/:id/revisions", rule.Revisions)
+		admin.GET("/rules/:id/series", rule.Series)
+		admin.POST("/rules/:id/revert/:revision_id", rule.Revert)
+
+		inh := &handlers.InhibitRuleHandler{DB: db.DB}
+		admin.GET("/inhibit-rules", inh.List)
+		admin.GET("/inhibit-rules/:id", inh.Get)
+		admin.POST("/inhibit-rules", inh.Create)
+		admin.PUT("/inhibit-rules/:id", inh.Update)
+		admin.DELETE("/inhibit-rules/:id", inh.Delete)
+
+		th := &handlers.TeamHandler{DB: db.DB}
+		admin.GET("/teams", th.List)
+		admin.POST("/teams", th.Create)
+		admin.PUT("/teams/:id", th.Update)
+		admin.DELETE("/teams/:id", th.Delete)
 
 		uh := &handlers.UserHandler{DB: db.DB}
 		admin.GET("/users", uh.List)
@@ -164,18 +233,55 @@ func main() {
 
 		set := &handlers.SettingsHandler{DB: db.DB}
 		admin.PUT("/settings", set.Update)
+		admin.PUT("/settings/maintenance", set.SetMaintenance)
+
+		rs := &handlers.ScheduledReportHandler{DB: db.DB}
+		admin.GET("/reports/schedules", rs.List)
+		admin.GET("/reports/schedules/:id", rs.Get)
+		admin.POST("/reports/schedules", rs.Create)
+		admin.PUT("/reports/schedules/:id", rs.Update)
+		admin.DELETE("/reports/schedules/:id", rs.Delete)
 	}
 
 	addr := os.Getenv("ADDR")
 	if addr == "" {
 		addr = ":8080"
 	}
+	srv := &http.Server{Addr: addr, Handler: r}
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		<-sigChan
+		log.Println("Shutting down...")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		// Stop taking requests (waits for in-flight handlers), stop evaluating rules, store queued inbound
+		// batches, then deliver what is queued.
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("http shutdown: %v", err)
+		}
+		sched.Stop()
+		if err := inbound.Drain(ctx); err != nil {
+			log.Printf("inbound drain: %v", err)
+		}
+		if err := engine.Drain(ctx); err != nil {
+			log.Printf("notification drain: %v", err)
+		}
+	}()
+
 	log.Println("Listening on", addr)
-	if err := r.Run(addr); err != nil {
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
+	<-shutdownDone
 }
 
+// shutdownTimeout bounds graceful shutdown (HTTP drain plus notification queue drain).
+const shutdownTimeout = 30 * time.Second
+
 func wrapAuth(db *gorm.DB) *handlers.AuthHandler {
 	return &handlers.AuthHandler{DB: db}
 }
@@ -205,6 +311,27 @@ func fillRoleFromDB(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// fillTeamFromDB sets team_id in context for non-admins that belong to a team. It is read per request (not
+// from the JWT) so moving a user between teams takes effect immediately.
+func fillTeamFromDB(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if role, _ := c.Get("role"); role == "admin" {
+			c.Next()
+			return
+		}
+		userID, ok := c.Get("user_id")
+		if !ok {
+			c.Next()
+			return
+		}
+		var u struct{ TeamID *uint }
+		if err := db.Table("users").Select("team_id").Where("id = ?", userID).First(&u).Error; err == nil && u.TeamID != nil {
+			c.Set("team_id", *u.TeamID)
+		}
+		c.Next()
+	}
+}
+
 func seedSettings(db *gorm.DB) {
 	var c int64
 	db.Model(&models.SystemConfig{}).Where("key = ?", "retention_days").Count(&c)
@@ -225,6 +352,34 @@ func runRetentionCleanupLoop(db *gorm.DB) {
 	}
 }
 
+func runScheduledReportLoop(db *gorm.DB) {
+	// Check every minute which scheduled reports are due
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		handlers.RunScheduledReports(db)
+	}
+}
+
+func runEngineStateCleanupLoop(db *gorm.DB) {
+	// Drop expired aggregation/suppression windows every 10 minutes
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		engine.CleanupState(db)
+	}
+}
+
+func runDigestLoop(db *gorm.DB) {
+	// Send due rule digests, and notifications held during quiet hours once the window ends
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		engine.FlushDigests(db)
+		engine.FlushQuietDigest(db)
+	}
+}
+
 func seedUser(db *gorm.DB) {
 	var c int64
 	db.Model(&models.User{}).Count(&c)
@@ -252,7 +407,8 @@ const defaultTemplateBody = `{{if .IsRecovery}}
 📌 告警ID: {{.AlertID}} 
 ⚠️ 严重程度: {{.Severity}} 
 ⏰ 发生时间: {{.StartAt}}{{if .ResolvedAt}} 
-🕐 恢复时间: {{.ResolvedAt}}{{end}}
+🕐 恢复时间: {{.ResolvedAt}}{{end}}{{if .ResolutionReason}}
+📝 处理说明: {{.ResolutionReason}}{{end}}
 ━━━━━━━━━━━━━━━━━━━━━
 此告警由 KK Alert 系统自动发送
 {{else}}
@@ -268,7 +424,8 @@ const defaultTemplateBody = `{{if .IsRecovery}}
 ━━━━━━━━━━━━━━━━━━━━━
 📌 告警ID: {{.AlertID}} 
 ⚠️ 严重程度: {{.Severity}} 
-⏰ 发生时间: {{.StartAt}}
+⏰ 发生时间: {{.StartAt}}{{if .RunbookURL}}
+📖 处理手册: {{.RunbookURL}}{{end}}
 ━━━━━━━━━━━━━━━━━━━━━
 此告警由 KK Alert 系统自动发送
 {{end}}`
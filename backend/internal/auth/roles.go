@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles, from least to most privileged.
+const (
+	RoleViewer   = "viewer"   // read-only
+	RoleUser     = "user"     // viewer plus acknowledging, resolving and silencing alerts
+	RoleOperator = "operator" // user plus silencing and pausing rules; cannot edit configuration
+	RoleAdmin    = "admin"    // everything
+)
+
+// Roles lists the valid roles in privilege order.
+var Roles = []string{RoleViewer, RoleUser, RoleOperator, RoleAdmin}
+
+// Action is something an endpoint needs permission for.
+type Action string
+
+const (
+	ActionView      Action = "view"       // read alerts, reports, dashboards and settings
+	ActionAck       Action = "ack"        // assign and resolve alerts
+	ActionSilence   Action = "silence"    // silence and snooze alerts, remove silences
+	ActionMuteRules Action = "mute_rules" // view rules, silence/unsilence and pause/resume them
+	ActionManage    Action = "manage"     // edit rules, channels, datasources, templates, users and settings
+)
+
+var rolePermissions = map[string]map[Action]bool{
+	RoleViewer:   {ActionView: true},
+	RoleUser:     {ActionView: true, ActionAck: true, ActionSilence: true},
+	RoleOperator: {ActionView: true, ActionAck: true, ActionSilence: true, ActionMuteRules: true},
+	RoleAdmin:    {ActionView: true, ActionAck: true, ActionSilence: true, ActionMuteRules: true, ActionManage: true},
+}
+
+// ValidRole reports whether role is one of Roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can reports whether role may perform action. An empty role is treated as user (tokens from before roles).
+func Can(role string, action Action) bool {
+	if role == "" {
+		role = RoleUser
+	}
+	return rolePermissions[role][action]
+}
+
+// RequirePermission aborts with 403 unless the user's role may perform action. Must be used after RequireAuth.
+func RequirePermission(action Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		r, _ := role.(string)
+		if !Can(r, action) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied: " + string(action)})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxAggEntries caps aggLastSent; beyond it the entries closest to expiry are evicted first (they are
+// also restored from aggregation_states on demand, so eviction never causes a duplicate send).
+const maxAggEntries = 10000
+
+// aggStateKey identifies an aggregated notification (rule + alert type). The type fingerprint holds every
+// label, so it is hashed to keep the key within the state_key column.
+func aggStateKey(ruleID uint, typeFP string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d_%s", ruleID, typeFP)))
+	return hex.EncodeToString(sum[:])
+}
+
+// aggSentWithin reports whether an aggregated notification for key is still inside its window. The
+// in-memory entry is authoritative; on a miss (e.g. after a restart) the persisted state is consulted.
+func aggSentWithin(db *gorm.DB, key string) bool {
+	now := time.Now()
+	aggMu.RLock()
+	until, ok := aggLastSent[key]
+	aggMu.RUnlock()
+	if ok {
+		return now.Before(until)
+	}
+	var st models.AggregationState
+	if db.Where("state_key = ? AND expires_at > ?", key, now).Limit(1).Find(&st); st.StateKey == "" {
+		return false
+	}
+	aggMu.Lock()
+	aggLastSent[key] = st.ExpiresAt
+	evictAggLocked()
+	aggMu.Unlock()
+	return true
+}
+
+// markAggSent records that an aggregated notification for key was sent and suppresses repeats for window.
+func markAggSent(db *gorm.DB, key string, ruleID uint, window time.Duration) {
+	now := time.Now()
+	until := now.Add(window)
+	aggMu.Lock()
+	aggLastSent[key] = until
+	evictAggLocked()
+	aggMu.Unlock()
+	st := models.AggregationState{StateKey: key, RuleID: ruleID, LastSentAt: now, ExpiresAt: until}
+	if err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&st).Error; err != nil {
+		traceLogf("", "persist aggregation state %s: %v", key, err)
+	}
+}
+
+// evictAggLocked drops entries beyond maxAggEntries, earliest expiry first. aggMu must be held.
+func evictAggLocked() {
+	for len(aggLastSent) > maxAggEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, t := range aggLastSent {
+			if oldestKey == "" || t.Before(oldest) {
+				oldestKey, oldest = k, t
+			}
+		}
+		delete(aggLastSent, oldestKey)
+	}
+}
+
+// CleanupState drops expired aggregation and suppression windows from memory and expired aggregation
+// state from the database. Run periodically.
+func CleanupState(db *gorm.DB) {
+	now := time.Now()
+	aggMu.Lock()
+	for k, until := range aggLastSent {
+		if !now.Before(until) {
+			delete(aggLastSent, k)
+		}
+	}
+	aggMu.Unlock()
+	suppressionMu.Lock()
+	for id, end := range suppressionWindows {
+		if now.After(end) {
+			delete(suppressionWindows, id)
+		}
+	}
+	suppressionMu.Unlock()
+	db.Where("expires_at <= ?", now).Delete(&models.AggregationState{})
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/sender"
+	"gorm.io/gorm"
+)
+
+// recordDelivery is recordSendReceipt for a message that was actually handed to the sender: a failed
+// delivery is also kept as a FailedNotification so it can be retried later.
+func recordDelivery(db *gorm.DB, traceID, alertID string, chID uint, kind string, msg sender.Message, rc sender.Receipt, err error) {
+	recordSendReceipt(db, traceID, alertID, chID, kind, rc, err)
+	if err != nil {
+		deadLetter(db, traceID, alertID, chID, kind, msg, err)
+	}
+}
+
+// deadLetter stores a notification whose delivery failed after the sender's retries.
+func deadLetter(db *gorm.DB, traceID, alertID string, chID uint, kind string, msg sender.Message, err error) {
+	labels, _ := json.Marshal(msg.Labels)
+	if msg.Labels == nil {
+		labels = []byte("{}")
+	}
+	fn := models.FailedNotification{
+		AlertID:    alertID,
+		ChannelID:  chID,
+		Kind:       kind,
+		Title:      msg.Title,
+		Body:       msg.Body,
+		IsRecovery: msg.IsRecovery,
+		Severity:   msg.Severity,
+		Labels:     string(labels),
+		Error:      err.Error(),
+		Status:     "pending",
+	}
+	if res := db.Create(&fn); res.Error != nil {
+		traceLogf(traceID, "store failed %s notification for alert %s: %v", kind, alertID, res.Error)
+	}
+}
+
+// Errors RetryFailedNotification returns instead of sending.
+var (
+	ErrAlreadyDelivered = errors.New("notification already delivered")
+	ErrRetryInProgress  = errors.New("notification is already being retried")
+	ErrSuperseded       = errors.New("notification superseded")
+	ErrMaintenance      = errors.New("maintenance mode is on")
+)
+
+// supersededReason reports why a dead letter about an alert should no longer be sent: the alert is gone, a
+// firing letter's alert has resolved since, the alert is silenced or snoozed, or its rule is muted.
+func supersededReason(db *gorm.DB, fn *models.FailedNotification) string {
+	var a models.Alert
+	if err := db.Where("id = ?", fn.AlertID).Limit(1).Find(&a).Error; err != nil || a.ID == "" {
+		return "alert no longer exists"
+	}
+	if !fn.IsRecovery && a.Status == "resolved" {
+		return "alert has resolved"
+	}
+	if IsSilenced(db, a.ID) {
+		return "alert is silenced"
+	}
+	if a.RuleID != 0 {
+		var r models.Rule
+		if db.Where("id = ?", a.RuleID).Limit(1).Find(&r); r.ID != 0 {
+			if reason, muted := ruleMuted(&r, time.Now()); muted {
+				return "rule " + reason
+			}
+		}
+	}
+	return ""
+}
+
+// RetryFailedNotification sends a dead-lettered notification to its channel again and records the attempt
+// (an AlertSendRecord of kind "retry", plus the dead letter's status, attempts and last error). Nothing is
+// sent during maintenance mode, and a letter about an alert that no longer needs it is marked superseded
+// (ErrSuperseded). Only one retry of a letter runs at a time; a concurrent one gets ErrRetryInProgress.
+func RetryFailedNotification(db *gorm.DB, fn *models.FailedNotification) error {
+	switch fn.Status {
+	case "delivered":
+		return ErrAlreadyDelivered
+	case "superseded":
+		return ErrSuperseded
+	}
+	if MaintenanceMode(db) {
+		return ErrMaintenance
+	}
+	if fn.AlertID != "" {
+		if reason := supersededReason(db, fn); reason != "" {
+			db.Model(&models.FailedNotification{}).Where("id = ? AND status = ?", fn.ID, "pending").Update("status", "superseded")
+			fn.Status = "superseded"
+			return fmt.Errorf("%w: %s", ErrSuperseded, reason)
+		}
+	}
+	var ch models.Channel
+	if err := db.First(&ch, fn.ChannelID).Error; err != nil || !ch.Enabled {
+		return errChannelUnavailable
+	}
+	// Claim the attempt: of two concurrent retries only one sees the letter still pending at this count.
+	res := db.Model(&models.FailedNotification{}).
+		Where("id = ? AND status = ? AND attempts = ?", fn.ID, "pending", fn.Attempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if res.Error != nil {
+		return fmt.Errorf("claim notification %d: %w", fn.ID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrRetryInProgress
+	}
+	fn.Attempts++
+
+	var labels map[string]string
+	_ = json.Unmarshal([]byte(fn.Labels), &labels)
+	msg := sender.Message{Title: fn.Title, Body: fn.Body, IsRecovery: fn.IsRecovery, Severity: fn.Severity, Labels: labels}
+	rc, err := sender.SendToChannelReceipt(ch.ID, ch.RateLimit, ch.Type, ch.Config, msg)
+	if fn.AlertID != "" {
+		recordSendReceipt(db, "", fn.AlertID, ch.ID, "retry", rc, err)
+	}
+	now := time.Now()
+	fn.RetriedAt = &now
+	if err != nil {
+		fn.Error = err.Error()
+	} else {
+		fn.Status = "delivered"
+	}
+	if res := db.Model(fn).Updates(map[string]interface{}{"retried_at": now, "error": fn.Error, "status": fn.Status}); res.Error != nil {
+		return fmt.Errorf("save notification %d: %w", fn.ID, res.Error)
+	}
+	return err
+}
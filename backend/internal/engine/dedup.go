@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// contentDedupWindow is how long an identical message (same channel, title and body) is not sent again,
+// e.g. when several rules match one alert and share a channel. Configure with NOTIFY_DEDUP_WINDOW (Go
+// duration, default 1m; 0 disables).
+var contentDedupWindow = func() time.Duration {
+	v := os.Getenv("NOTIFY_DEDUP_WINDOW")
+	if v == "" {
+		return time.Minute
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("[engine] invalid NOTIFY_DEDUP_WINDOW %q, using 1m", v)
+		return time.Minute
+	}
+	return d
+}()
+
+// contentClaim records which rule sent a message and when.
+type contentClaim struct {
+	ruleID uint
+	at     time.Time
+}
+
+var (
+	contentSentMu sync.Mutex
+	contentSent   = make(map[string]contentClaim) // content hash -> claim
+)
+
+func contentKey(chID uint, title, body string) string {
+	h := sha256.New()
+	_ = binary.Write(h, binary.BigEndian, uint64(chID))
+	h.Write([]byte(title))
+	h.Write([]byte{0})
+	h.Write([]byte(body))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// claimContent reports whether rule ruleID may send a message to chID, i.e. no other rule claimed an
+// identical one within contentDedupWindow, and claims it. A rule repeating its own message is left to its
+// send_interval. body must not include the per-send timestamp. Expired entries are swept on the way.
+func claimContent(ruleID, chID uint, title, body string) (key string, ok bool) {
+	if contentDedupWindow <= 0 {
+		return "", true
+	}
+	key = contentKey(chID, title, body)
+	now := time.Now()
+	contentSentMu.Lock()
+	defer contentSentMu.Unlock()
+	for k, c := range contentSent {
+		if now.Sub(c.at) >= contentDedupWindow {
+			delete(contentSent, k)
+		}
+	}
+	if c, dup := contentSent[key]; dup && c.ruleID != ruleID {
+		return key, false
+	}
+	contentSent[key] = contentClaim{ruleID: ruleID, at: now}
+	return key, true
+}
+
+// releaseContent drops a claim after a failed send so another rule may still deliver the message.
+func releaseContent(key string) {
+	if key == "" {
+		return
+	}
+	contentSentMu.Lock()
+	delete(contentSent, key)
+	contentSentMu.Unlock()
+}
+
+// recordSkip logs and stores a send that was skipped as a duplicate of a message just sent to the channel.
+func recordSkip(db *gorm.DB, traceID, alertID string, chID uint, kind string) {
+	traceLogf(traceID, "%s send alert %s to channel %d skipped: identical message sent within %s", kind, alertID, chID, contentDedupWindow)
+	db.Create(&models.AlertSendRecord{AlertID: alertID, ChannelID: chID, Skipped: true, Error: "duplicate content within " + contentDedupWindow.String()})
+}
@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/sender"
+	"gorm.io/gorm"
+)
+
+// digestKey identifies a per-rule digest buffer.
+type digestKey struct {
+	ruleID uint
+	chID   uint
+}
+
+var (
+	ruleDigestMu sync.Mutex
+	ruleDigests  = make(map[digestKey]*digestBuffer) // held in memory: pending digests are lost on restart
+)
+
+// digestInterval returns the rule's DigestInterval, or 0 when digest mode is off or the value is invalid.
+func digestInterval(r *models.Rule) time.Duration {
+	if r.DigestInterval == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(r.DigestInterval)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// digested reports whether a notification for a rule with DigestInterval set goes to the digest instead of
+// being sent: only info and warning are batched, criticals stay immediate.
+func digested(r *models.Rule, severity string) bool {
+	return digestInterval(r) > 0 && (severity == "info" || severity == "warning")
+}
+
+// queueDigest adds alert to the rule's digest for each channel. A digest is due DigestInterval after its first entry.
+func queueDigest(traceID string, r *models.Rule, alert *models.Alert, channelIDs []uint, isRecovery bool) {
+	e := digestEntry{AlertID: alert.ID, RuleID: r.ID, RuleName: r.Name, Title: stripSystemAlertPrefix(alert.Title), Severity: alert.Severity, Status: "firing", At: time.Now()}
+	if isRecovery {
+		e.Status = "resolved"
+	}
+	traceLogf(traceID, "alert %s (rule %d) queued for digest", alert.ID, r.ID)
+	ruleDigestMu.Lock()
+	defer ruleDigestMu.Unlock()
+	for _, chID := range channelIDs {
+		k := digestKey{ruleID: r.ID, chID: chID}
+		b := ruleDigests[k]
+		if b == nil {
+			b = &digestBuffer{due: e.At.Add(digestInterval(r))}
+			ruleDigests[k] = b
+		}
+		b.add(e)
+	}
+}
+
+// FlushDigests sends every rule digest that is due. Call periodically. Like single notifications, digests
+// that come due in maintenance mode or while their rule is paused or silenced are dropped.
+func FlushDigests(db *gorm.DB) {
+	now := time.Now()
+	due := make(map[digestKey]*digestBuffer)
+	ruleDigestMu.Lock()
+	for k, b := range ruleDigests {
+		if !now.Before(b.due) {
+			due[k] = b
+			delete(ruleDigests, k)
+		}
+	}
+	ruleDigestMu.Unlock()
+	if len(due) == 0 {
+		return
+	}
+	if MaintenanceMode(db) {
+		traceLogf("", "%d digest(s) not sent: maintenance mode is on", len(due))
+		return
+	}
+	muted := make(map[uint]bool)
+	for k, b := range due {
+		if digestRuleMuted(db, k.ruleID, muted) {
+			continue
+		}
+		sendDigest(db, k.chID, "Digest", b)
+	}
+}
+
+// digestRuleMuted reports whether the rule is paused or silenced now, logging it once per flush; cache holds
+// the answers already looked up.
+func digestRuleMuted(db *gorm.DB, ruleID uint, cache map[uint]bool) bool {
+	if muted, ok := cache[ruleID]; ok {
+		return muted
+	}
+	var r models.Rule
+	muted := false
+	if err := db.First(&r, ruleID).Error; err == nil {
+		var reason string
+		if reason, muted = ruleMuted(&r, time.Now()); muted {
+			traceLogf("", "digest for rule %d not sent: rule %s", ruleID, reason)
+		}
+	}
+	cache[ruleID] = muted
+	return muted
+}
+
+// digestEntry is one notification summarized in a digest.
+type digestEntry struct {
+	AlertID  string
+	RuleID   uint
+	RuleName string
+	Title    string
+	Severity string
+	Status   string
+	At       time.Time
+}
+
+// maxDigestEntries bounds the entries listed in one digest; further notifications are only counted.
+const maxDigestEntries = 200
+
+// digestBuffer accumulates the notifications for one digest.
+type digestBuffer struct {
+	entries []digestEntry
+	more    int       // notifications beyond maxDigestEntries
+	due     time.Time // when a rule digest is sent; unused for the quiet-hours digest
+}
+
+func (b *digestBuffer) add(e digestEntry) {
+	for _, x := range b.entries {
+		if x.AlertID == e.AlertID && x.Status == e.Status {
+			return // repeat notifications for the same alert are listed once
+		}
+	}
+	if len(b.entries) >= maxDigestEntries {
+		b.more++
+		return
+	}
+	b.entries = append(b.entries, e)
+}
+
+// sendDigest delivers one summary of b to chID and records it under each listed alert.
+func sendDigest(db *gorm.DB, chID uint, heading string, b *digestBuffer) {
+	if len(b.entries) == 0 {
+		return
+	}
+	var ch models.Channel
+	if err := db.First(&ch, chID).Error; err != nil || !ch.Enabled {
+		return
+	}
+	title := fmt.Sprintf("%s: %d alert(s)", heading, len(b.entries)+b.more)
+	var body strings.Builder
+	for _, e := range b.entries {
+		fmt.Fprintf(&body, "• [%s] %s (%s, %s, %s)\n", e.Severity, e.Title, e.RuleName, e.Status, formatSendTime(e.At))
+	}
+	if b.more > 0 {
+		fmt.Fprintf(&body, "... and %d more\n", b.more)
+	}
+	body.WriteString("\n发送时间: " + formatSendTime(time.Now()))
+	msg := sender.Message{Title: title, Body: body.String(), Severity: "info"}
+	err := sender.SendToChannel(ch.ID, ch.RateLimit, ch.Type, ch.Config, msg)
+	for _, e := range b.entries {
+		recordSend(db, "", e.AlertID, chID, "digest", err)
+	}
+	if err != nil {
+		deadLetter(db, "", "", chID, "digest", msg, err)
+	}
+}
@@ -1,17 +1,26 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/kk-alert/backend/internal/enrich"
 	"github.com/kk-alert/backend/internal/jira"
 	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/relabel"
 	"github.com/kk-alert/backend/internal/sender"
+	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm"
 )
 
@@ -20,7 +29,8 @@ import (
 var suppressionMu sync.RWMutex
 var suppressionWindows = make(map[uint]time.Time)
 
-// aggLastSent tracks last aggregated send time per (ruleID_typeFingerprint) so we send at most once per aggregate window.
+// aggLastSent tracks until when an aggregated send per (ruleID_typeFingerprint) suppresses repeats, so we send at
+// most once per aggregate window. Backed by aggregation_states so it survives restarts; see aggstate.go.
 var aggMu sync.RWMutex
 var aggLastSent = make(map[string]time.Time)
 
@@ -29,56 +39,119 @@ func stripSystemAlertPrefix(s string) string {
 	return strings.TrimSpace(strings.TrimPrefix(s, "【系统告警】"))
 }
 
-// IsSilenced returns true if alert_id has an active manual silence (no notifications until silence_until).
+// IsSilenced returns true if alert_id has an active manual silence (no notifications until silence_until)
+// or is snoozed until it resolves.
 func IsSilenced(db *gorm.DB, alertID string) bool {
 	var n int64
-	db.Model(&models.AlertSilence{}).Where("alert_id = ? AND silence_until > ?", alertID, time.Now()).Count(&n)
+	db.Model(&models.AlertSilence{}).Where("alert_id = ? AND (silence_until > ? OR until_resolved = ?)", alertID, time.Now(), true).Count(&n)
 	return n > 0
 }
 
+// ClearSnooze removes an until-resolved silence once its alert resolves, so the recovery is notified and
+// the next occurrence is not silenced.
+func ClearSnooze(db *gorm.DB, alertID string) {
+	db.Where("alert_id = ? AND until_resolved = ?", alertID, true).Delete(&models.AlertSilence{})
+}
+
 // alertJob represents a queued alert processing task.
 type alertJob struct {
-	db    *gorm.DB
-	alert models.Alert
+	db      *gorm.DB
+	alert   models.Alert
+	traceID string // request or evaluation ID that produced the alert, for logs
 }
 
 // Bounded notification worker pool (8 workers, 500-slot buffer).
 // Prevents unbounded goroutine spawning and controls Lark API pressure.
 var alertQueue = make(chan alertJob, 500)
 
+// queueMu guards queueClosed; workers tracks queue workers and overflow goroutines so Drain can wait for them.
+var (
+	queueMu     sync.RWMutex
+	queueClosed bool
+	workers     sync.WaitGroup
+)
+
 func init() {
 	const numWorkers = 8
 	for i := 0; i < numWorkers; i++ {
+		workers.Add(1)
 		go func() {
+			defer workers.Done()
 			for job := range alertQueue {
-				ProcessAlert(job.db, &job.alert)
+				ProcessAlertWithID(job.db, &job.alert, job.traceID)
 			}
 		}()
 	}
 }
 
+// Drain stops accepting queued work, then waits until every queued and in-flight alert has been processed
+// or ctx is done. Alerts submitted after Drain are processed synchronously by the caller. Returns ctx.Err()
+// when the wait was cut short.
+func Drain(ctx context.Context) error {
+	queueMu.Lock()
+	if !queueClosed {
+		queueClosed = true
+		close(alertQueue)
+	}
+	queueMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		log.Printf("[engine] drain timed out with %d alerts still queued", len(alertQueue))
+		return ctx.Err()
+	}
+}
+
+// QueueDepth returns the number of alerts waiting in the notification queue.
+func QueueDepth() int {
+	return len(alertQueue)
+}
+
 // ProcessAlertAsync queues ProcessAlert to run asynchronously so the caller
 // (scheduler) is not blocked by slow notification delivery (rate limiters, HTTP).
-func ProcessAlertAsync(db *gorm.DB, alert *models.Alert) {
+// traceID (request or evaluation ID) is carried to the worker and logged with every send.
+func ProcessAlertAsync(db *gorm.DB, alert *models.Alert, traceID string) {
 	// Copy the alert and create a fresh DB session to avoid data races
 	// with the caller's subsequent modifications and DB session sharing.
 	a := *alert
 	freshDB := db.Session(&gorm.Session{NewDB: true})
+	queueMu.RLock()
+	if queueClosed {
+		// shutting down — the queue is being drained, so process synchronously
+		queueMu.RUnlock()
+		ProcessAlertWithID(freshDB, &a, traceID)
+		return
+	}
+	defer queueMu.RUnlock()
 	select {
-	case alertQueue <- alertJob{db: freshDB, alert: a}:
+	case alertQueue <- alertJob{db: freshDB, alert: a, traceID: traceID}:
 		// queued successfully
 	default:
 		// queue full — run inline as fallback to avoid losing alerts
-		log.Printf("[engine] alert queue full, processing inline for %s", a.ID)
-		go ProcessAlert(freshDB, &a)
+		traceLogf(traceID, "alert queue full, processing inline for %s", a.ID)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			ProcessAlertWithID(freshDB, &a, traceID)
+		}()
 	}
 }
 
 // ProcessAlert loads enabled rules, matches the alert, applies duration threshold, and sends to channels via Telegram/Lark.
 func ProcessAlert(db *gorm.DB, alert *models.Alert) {
-	if IsSilenced(db, alert.ID) {
-		return
-	}
+	ProcessAlertWithID(db, alert, "")
+}
+
+// ProcessAlertWithID is ProcessAlert with the request or evaluation ID that produced the alert, which is
+// included in every send log line.
+func ProcessAlertWithID(db *gorm.DB, alert *models.Alert, traceID string) {
 	var rules []models.Rule
 	if err := db.Where("enabled = ?", true).Order("priority asc").Find(&rules).Error; err != nil {
 		return
@@ -88,21 +161,40 @@ func ProcessAlert(db *gorm.DB, alert *models.Alert) {
 	if labels == nil {
 		labels = make(map[string]string)
 	}
+	// The team is assigned even when nothing is sent, so silenced, inhibited and maintenance-time alerts
+	// stay visible to the team.
+	assignTeam(db, alert, rules, labels)
+	if IsSilenced(db, alert.ID) {
+		return
+	}
+	if MaintenanceMode(db) {
+		traceLogf(traceID, "alert %s (%s) not notified: maintenance mode is on", alert.ID, alert.Status)
+		return
+	}
+	if alert.Status == "firing" {
+		if ir, ok := Inhibited(db, alert, labels); ok {
+			traceLogf(traceID, "alert %s inhibited by inhibit rule %d (%s)", alert.ID, ir.ID, ir.Name)
+			return
+		}
+	}
+	quiet := LoadQuietHours(db)
 	for _, r := range rules {
+		// The rule's relabel config rewrites labels for this rule only (matching, routing, templates).
+		labels, keep := ruleLabels(&r, alert, labels)
+		if !keep {
+			continue
+		}
 		// If this alert matches suppression source condition, start or refresh the suppression window for this rule.
 		updateSuppressionWindow(&r, labels)
 
 		if !matchRule(&r, alert, labels) {
 			continue
 		}
-		// Determine channels: prefer per-threshold channels from annotations, fall back to rule-level channels.
-		var channelIDs []uint
-		if thChStr := annotationValue(alert, "threshold_channel_ids"); thChStr != "" {
-			_ = json.Unmarshal([]byte(thChStr), &channelIDs)
-		}
-		if len(channelIDs) == 0 {
-			_ = json.Unmarshal([]byte(r.ChannelIDs), &channelIDs)
+		if reason, muted := ruleMuted(&r, time.Now()); muted {
+			traceLogf(traceID, "alert %s not notified: rule %d %s", alert.ID, r.ID, reason)
+			continue
 		}
+		channelIDs, routed := ruleChannels(&r, alert, labels, traceID)
 		if len(channelIDs) == 0 {
 			continue
 		}
@@ -110,23 +202,46 @@ func ProcessAlert(db *gorm.DB, alert *models.Alert) {
 		// Recovery: when alert is resolved and rule has recovery notify, send by template only (no extra title).
 		// Deduplicate by (alert_id, channel_id): if another rule already sent recovery to this channel, skip to avoid duplicate notifications.
 		if alert.Status == "resolved" && r.RecoveryNotify {
+			if quiet.Holds(time.Now(), routed.Severity) {
+				quietHeld(quiet, traceID, &r, routed, channelIDs, true)
+				continue
+			}
+			if digested(&r, routed.Severity) {
+				queueDigest(traceID, &r, routed, channelIDs, true)
+				continue
+			}
 			title := ""
+			labels := notifyLabels(&r, labels)
 			sendAt := time.Now()
-			body := resolveBody(db, &r, alert, labels, true, sendAt) + "\n\n发送时间: " + formatSendTime(sendAt)
-			for _, chID := range channelIDs {
+			content := decorateBody(&r, resolveBody(db, &r, routed, labels, true, sendAt), true)
+			body := content + "\n\n发送时间: " + formatSendTime(sendAt)
+			msg := sender.Message{Title: title, Body: body, IsRecovery: true, Severity: routed.Severity, Labels: labels}
+			var tally deliveryTally
+			forEachChannel(channelIDs, func(chID uint) {
 				if recoveryAlreadySent(db, alert.ID, chID) {
-					continue
+					return
 				}
 				var ch models.Channel
 				if err := db.First(&ch, chID).Error; err != nil || !ch.Enabled {
-					continue
+					return
+				}
+				key, ok := claimContent(r.ID, chID, title, content)
+				if !ok {
+					recordSkip(db, traceID, alert.ID, chID, "recovery")
+					return
 				}
-				if err := sender.Send(ch.Type, ch.Config, title, body, true); err != nil {
-					log.Printf("[engine] recovery send alert %s to channel %d failed: %v", alert.ID, chID, err)
-					db.Create(&models.AlertSendRecord{AlertID: alert.ID, ChannelID: chID, Success: false, Error: err.Error()})
-				} else {
-					db.Create(&models.AlertSendRecord{AlertID: alert.ID, ChannelID: chID, Success: true})
+				m := msg
+				m.OriginalMessageID = lastMessageID(db, alert.ID, chID)
+				m.EditOriginal = r.EditOnRecovery
+				rc, err := sender.SendToChannelReceipt(ch.ID, ch.RateLimit, ch.Type, ch.Config, m)
+				if err != nil {
+					releaseContent(key)
 				}
+				tally.record(err)
+				recordDelivery(db, traceID, alert.ID, chID, "recovery", m, rc, err)
+			})
+			if tally.allFailed() {
+				sendFallback(db, &r, alert.ID, channelIDs, msg, traceID)
 			}
 			continue
 		}
@@ -143,37 +258,155 @@ func ProcessAlert(db *gorm.DB, alert *models.Alert) {
 		if suppressed(&r, labels) {
 			continue
 		}
+		if quiet.Holds(time.Now(), routed.Severity) {
+			quietHeld(quiet, traceID, &r, routed, channelIDs, false)
+			continue
+		}
+		if digested(&r, routed.Severity) {
+			queueDigest(traceID, &r, routed, channelIDs, false)
+			continue
+		}
+		alertLabels := labels // before resolve_instance adds hostname/ip, which differ per instance
+		labels = notifyLabels(&r, labels)
 		sendAt := time.Now()
-		body := resolveBody(db, &r, alert, labels, false, sendAt) + "\n\n发送时间: " + formatSendTime(sendAt)
+		content := decorateBody(&r, resolveBody(db, &r, routed, labels, false, sendAt), false)
+		body := content + "\n\n发送时间: " + formatSendTime(sendAt)
 		title := stripSystemAlertPrefix(alert.Title)
 		if title == "" {
 			title = "Alert"
 		}
-		tryCreateJiraTicket(db, &r, alert, title, body)
+		title = withPrefix(r.TitlePrefix, title)
+		tryCreateJiraTicket(db, &r, routed, title, body)
 		if r.AggregationEnabled && r.AggregateBy != "" && r.AggregateWindow != "" {
-			sendAggregated(db, &r, alert, labels, title, body, channelIDs)
+			sendAggregated(db, &r, routed, alertLabels, title, body, channelIDs, traceID)
 		} else {
-			for _, chID := range channelIDs {
+			msg := sender.Message{Title: title, Body: body, Severity: routed.Severity, Labels: labels}
+			var tally deliveryTally
+			forEachChannel(channelIDs, func(chID uint) {
 				if sendRateLimited(db, &r, alert.ID, chID) {
-					continue
+					return
 				}
 				var ch models.Channel
 				if err := db.First(&ch, chID).Error; err != nil || !ch.Enabled {
-					db.Create(&models.AlertSendRecord{AlertID: alert.ID, ChannelID: chID, Success: false, Error: "channel not found or disabled"})
-					continue
+					tally.record(errChannelUnavailable)
+					recordSend(db, traceID, alert.ID, chID, "alert", errChannelUnavailable)
+					return
+				}
+				key, ok := claimContent(r.ID, chID, title, content)
+				if !ok {
+					recordSkip(db, traceID, alert.ID, chID, "alert")
+					return
 				}
-				err := sender.Send(ch.Type, ch.Config, title, body, false)
+				rc, err := sender.SendToChannelReceipt(ch.ID, ch.RateLimit, ch.Type, ch.Config, msg)
 				if err != nil {
-					log.Printf("[engine] send alert %s to channel %d failed: %v", alert.ID, chID, err)
-					db.Create(&models.AlertSendRecord{AlertID: alert.ID, ChannelID: chID, Success: false, Error: err.Error()})
-					continue
+					releaseContent(key)
 				}
-				db.Create(&models.AlertSendRecord{AlertID: alert.ID, ChannelID: chID, Success: true})
+				tally.record(err)
+				recordDelivery(db, traceID, alert.ID, chID, "alert", msg, rc, err)
+			})
+			if tally.allFailed() {
+				sendFallback(db, &r, alert.ID, channelIDs, msg, traceID)
 			}
 		}
 	}
 }
 
+// ruleChannels returns the channels a notification of alert under r goes to, and the alert as notified
+// (route severity_override applied). The first matching route wins; otherwise per-threshold channels from
+// annotations, then the rule's channels for the alert's severity, falling back to rule-level channels (the
+// default route).
+func ruleChannels(r *models.Rule, alert *models.Alert, labels map[string]string, traceID string) ([]uint, *models.Alert) {
+	var channelIDs []uint
+	routed := alert
+	routes, err := ParseRoutes(r.Routes)
+	if err != nil {
+		traceLogf(traceID, "rule %d: %v", r.ID, err)
+	}
+	if route := MatchRoute(routes, labels); route != nil {
+		channelIDs = route.ChannelIDs
+		if route.SeverityOverride != "" {
+			cp := *alert
+			cp.Severity = route.SeverityOverride
+			routed = &cp
+		}
+	}
+	if len(channelIDs) == 0 {
+		if thChStr := annotationValue(alert, "threshold_channel_ids"); thChStr != "" {
+			_ = json.Unmarshal([]byte(thChStr), &channelIDs)
+		}
+	}
+	if len(channelIDs) == 0 {
+		bySeverity, err := ParseSeverityChannels(r.SeverityChannels)
+		if err != nil {
+			traceLogf(traceID, "rule %d: %v", r.ID, err)
+		}
+		channelIDs = bySeverity[routed.Severity]
+	}
+	if len(channelIDs) == 0 {
+		_ = json.Unmarshal([]byte(r.ChannelIDs), &channelIDs)
+	}
+	return channelIDs, routed
+}
+
+// maxParallelSends bounds concurrent channel deliveries for a single alert.
+const maxParallelSends = 4
+
+// forEachChannel runs send for every channel concurrently (bounded by maxParallelSends) and waits for all,
+// so a slow channel does not delay delivery to the others. Each send records its own AlertSendRecord.
+func forEachChannel(channelIDs []uint, send func(chID uint)) {
+	var g errgroup.Group
+	g.SetLimit(maxParallelSends)
+	seen := make(map[uint]bool, len(channelIDs))
+	for _, chID := range channelIDs {
+		if seen[chID] {
+			continue
+		}
+		seen[chID] = true
+		g.Go(func() error {
+			send(chID)
+			return nil
+		})
+	}
+	_ = g.Wait()
+}
+
+// errChannelUnavailable is recorded when a rule references a missing or disabled channel.
+var errChannelUnavailable = errors.New("channel not found or disabled")
+
+// traceLogf logs with the engine prefix and, when set, the request/evaluation ID that produced the alert.
+func traceLogf(traceID, format string, args ...interface{}) {
+	prefix := "[engine] "
+	if traceID != "" {
+		prefix += "[trace=" + traceID + "] "
+	}
+	log.Printf(prefix+format, args...)
+}
+
+// recordSend logs one delivery attempt (kind: alert, recovery, aggregated, flapping) and stores its AlertSendRecord.
+func recordSend(db *gorm.DB, traceID, alertID string, chID uint, kind string, err error) {
+	recordSendReceipt(db, traceID, alertID, chID, kind, sender.Receipt{}, err)
+}
+
+// recordSendReceipt is recordSend keeping what the channel reported back on the record.
+func recordSendReceipt(db *gorm.DB, traceID, alertID string, chID uint, kind string, rc sender.Receipt, err error) {
+	if err != nil {
+		traceLogf(traceID, "%s send alert %s to channel %d failed: %v", kind, alertID, chID, err)
+		db.Create(&models.AlertSendRecord{AlertID: alertID, ChannelID: chID, Success: false, Error: err.Error(), Detail: rc.Detail, MessageID: rc.MessageID})
+		return
+	}
+	if rc.Skipped {
+		traceLogf(traceID, "%s send alert %s to channel %d skipped: %s", kind, alertID, chID, rc.Detail)
+		db.Create(&models.AlertSendRecord{AlertID: alertID, ChannelID: chID, Skipped: true, Detail: rc.Detail})
+		return
+	}
+	if rc.Detail != "" {
+		traceLogf(traceID, "%s sent alert %s to channel %d (%s)", kind, alertID, chID, rc.Detail)
+	} else {
+		traceLogf(traceID, "%s sent alert %s to channel %d", kind, alertID, chID)
+	}
+	db.Create(&models.AlertSendRecord{AlertID: alertID, ChannelID: chID, Success: true, Detail: rc.Detail, MessageID: rc.MessageID})
+}
+
 func durationSatisfied(r *models.Rule, a *models.Alert) bool {
 	if r.Duration == "" || r.Duration == "0" {
 		return true
@@ -193,7 +426,9 @@ func formatSendTime(t time.Time) string {
 	return t.In(locCST).Format("2006-01-02 15:04:05")
 }
 
-func resolveBody(db *gorm.DB, r *models.Rule, alert *models.Alert, labels map[string]string, isRecovery bool, sendAt time.Time) string {
+// TemplateData builds the AlertTemplateData a notification for alert is rendered with. Template preview
+// uses it too so a preview of a real alert matches what was sent.
+func TemplateData(r *models.Rule, alert *models.Alert, labels map[string]string, isRecovery bool, sendAt time.Time) sender.AlertTemplateData {
 	data := sender.AlertTemplateData{
 		AlertID:         alert.ID,
 		Title:           stripSystemAlertPrefix(alert.Title),
@@ -204,6 +439,8 @@ func resolveBody(db *gorm.DB, r *models.Rule, alert *models.Alert, labels map[st
 		IsRecovery:      isRecovery,
 		RuleDescription: r.Description,
 		SentAt:          formatSendTime(sendAt),
+		RunbookURL:      r.RunbookURL,
+		AlertURL:        AlertURL(alert.ID),
 	}
 	if isRecovery && alert.ResolvedAt != nil {
 		data.ResolvedAt = alert.ResolvedAt.Format("2006-01-02 15:04:05")
@@ -220,12 +457,112 @@ func resolveBody(db *gorm.DB, r *models.Rule, alert *models.Alert, labels map[st
 			if v := ann["value"]; v != "" {
 				data.Value = v
 			}
+			if isRecovery {
+				data.ResolutionReason = ann["resolution_reason"]
+			}
 		}
 	}
 	// When alert has no description/summary, use rule description only (do not use alert title — it is already shown as 🔔 header)
 	if data.Description == "" && r.Description != "" {
 		data.Description = r.Description
 	}
+	if r.EnrichURL != "" {
+		data.Enrich = enrichFields(r.EnrichURL, labels)
+	}
+	return data
+}
+
+// notifyLabels returns the labels a notification of r is built from: labels, plus the hostname or IP of
+// the instance when the rule has ResolveInstance on.
+func notifyLabels(r *models.Rule, labels map[string]string) map[string]string {
+	if !r.ResolveInstance {
+		return labels
+	}
+	return enrich.Default.Instance(labels)
+}
+
+// ruleLabels applies r's relabel config to an alert's labels. An alert the rule produced itself was relabeled
+// by the scheduler before it was stored, so its labels are used as they are: relabeling again would apply
+// replace, hashmod or labelmap actions twice.
+func ruleLabels(r *models.Rule, alert *models.Alert, labels map[string]string) (map[string]string, bool) {
+	if alert.RuleID == r.ID {
+		return labels, true
+	}
+	return relabel.ParseAndApply(r.RelabelConfig, labels)
+}
+
+// ruleMuted reports whether the rule's notifications are off at now because it is paused or silenced.
+func ruleMuted(r *models.Rule, now time.Time) (reason string, muted bool) {
+	if r.Paused {
+		return "is paused", true
+	}
+	if r.SilencedUntil != nil && now.Before(*r.SilencedUntil) {
+		return "silenced until " + formatSendTime(*r.SilencedUntil), true
+	}
+	return "", false
+}
+
+// assignTeam gives an alert without a team the team of the first enabled rule (in priority order) that
+// matches it and has one; see inheritTeam.
+func assignTeam(db *gorm.DB, alert *models.Alert, rules []models.Rule, labels map[string]string) {
+	for i := range rules {
+		if alert.TeamID != nil {
+			return
+		}
+		r := &rules[i]
+		if r.TeamID == nil {
+			continue
+		}
+		if l, keep := ruleLabels(r, alert, labels); keep && matchRule(r, alert, l) {
+			inheritTeam(db, alert, r)
+		}
+	}
+}
+
+// inheritTeam gives an alert without a team the team of the first matching rule that has one (rules are
+// walked in priority order), so inbound alerts become visible to that team.
+func inheritTeam(db *gorm.DB, alert *models.Alert, r *models.Rule) {
+	if alert.TeamID != nil || r.TeamID == nil {
+		return
+	}
+	team := *r.TeamID
+	alert.TeamID = &team
+	db.Model(&models.Alert{}).Where("id = ? AND team_id IS NULL", alert.ID).UpdateColumn("team_id", team)
+}
+
+// uiBaseURL is UI_BASE_URL (e.g. https://kk-alert.example.com), used to link notifications back to the UI.
+var uiBaseURL = strings.TrimRight(os.Getenv("UI_BASE_URL"), "/")
+
+// AlertURL returns the UI detail link for an alert, or "" when UI_BASE_URL is unset.
+func AlertURL(alertID string) string {
+	if uiBaseURL == "" || alertID == "" {
+		return ""
+	}
+	return uiBaseURL + "/alerts/" + url.PathEscape(alertID)
+}
+
+// decorateBody appends the rule's BodyFooter to a rendered body. Recovery messages are template-only (no
+// title), so the rule's TitlePrefix goes at the start of the body there instead.
+func decorateBody(r *models.Rule, content string, isRecovery bool) string {
+	if isRecovery {
+		content = withPrefix(r.TitlePrefix, content)
+	}
+	if footer := strings.TrimSpace(r.BodyFooter); footer != "" {
+		content += "\n\n" + footer
+	}
+	return content
+}
+
+// withPrefix prepends prefix (e.g. "[PROD]") to s separated by a space.
+func withPrefix(prefix, s string) string {
+	if prefix = strings.TrimSpace(prefix); prefix == "" {
+		return s
+	}
+	return prefix + " " + s
+}
+
+func resolveBody(db *gorm.DB, r *models.Rule, alert *models.Alert, labels map[string]string, isRecovery bool, sendAt time.Time) string {
+	data := TemplateData(r, alert, labels, isRecovery, sendAt)
 	// Try rule's template first (use Find to avoid GORM logging "record not found" when template was deleted)
 	if r.TemplateID != nil && *r.TemplateID != 0 {
 		var t models.Template
@@ -286,17 +623,7 @@ func matchRule(r *models.Rule, a *models.Alert, labels map[string]string) bool {
 			}
 		}
 	}
-	if r.MatchLabels != "" {
-		var want map[string]string
-		if err := json.Unmarshal([]byte(r.MatchLabels), &want); err == nil && len(want) > 0 {
-			for k, v := range want {
-				if labels[k] != v {
-					return false
-				}
-			}
-		}
-	}
-	return true
+	return RuleLabelsMatch(r, labels)
 }
 
 // inExcludeWindow returns true if current time (local) falls inside any rule exclude window.
@@ -315,24 +642,25 @@ func inExcludeWindow(r *models.Rule) bool {
 	now := time.Now()
 	hm := now.Hour()*60 + now.Minute()
 	for _, w := range windows {
-		startMin := parseHM(w.Start)
-		endMin := parseHM(w.End)
-		if startMin < 0 || endMin < 0 {
-			continue
-		}
-		if startMin <= endMin {
-			if hm >= startMin && hm < endMin {
-				return true
-			}
-		} else {
-			if hm >= startMin || hm < endMin {
-				return true
-			}
+		if inWindow(hm, parseHM(w.Start), parseHM(w.End)) {
+			return true
 		}
 	}
 	return false
 }
 
+// inWindow reports whether minute-of-day hm is in [startMin, endMin); a window with endMin before startMin
+// spans midnight. Invalid bounds (-1) never match.
+func inWindow(hm, startMin, endMin int) bool {
+	if startMin < 0 || endMin < 0 {
+		return false
+	}
+	if startMin <= endMin {
+		return hm >= startMin && hm < endMin
+	}
+	return hm >= startMin || hm < endMin
+}
+
 func parseHM(s string) int {
 	var h, m int
 	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil {
@@ -422,6 +750,15 @@ func recoveryAlreadySent(db *gorm.DB, alertID string, chID uint) bool {
 	return count > 0
 }
 
+// lastMessageID returns the platform message ID of the latest notification of the alert delivered to the
+// channel, or "" when the channel reported none.
+func lastMessageID(db *gorm.DB, alertID string, chID uint) string {
+	var rec models.AlertSendRecord
+	db.Where("alert_id = ? AND channel_id = ? AND success = ? AND message_id <> ?", alertID, chID, true, "").
+		Order("id desc").Limit(1).Find(&rec)
+	return rec.MessageID
+}
+
 // sendRateLimited returns true if we already sent this alert (same alert_id) to this channel within rule's send_interval.
 // Interval is per alert only: different alerts matching the same rule can each send; the same alert is throttled.
 func sendRateLimited(db *gorm.DB, r *models.Rule, alertID string, chID uint) bool {
@@ -471,6 +808,24 @@ func tryCreateJiraTicket(db *gorm.DB, r *models.Rule, alert *models.Alert, title
 	}
 }
 
+// aggregationGroupBy returns the labels of a comma-separated AggregateBy such as "service,env": alerts with
+// equal values for all of them are merged into one notification whatever their other labels, and are listed
+// by host. Single values (hostname, ip, port or one label name) return nil and keep their meaning of "the
+// dimension that varies between otherwise identical alerts".
+func aggregationGroupBy(aggregateBy string) []string {
+	if !strings.Contains(aggregateBy, ",") {
+		return nil
+	}
+	var out []string
+	for _, k := range strings.Split(aggregateBy, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
 // aggregationDimensionKeys returns label keys to exclude when computing "same type" for the given dimension.
 func aggregationDimensionKeys(aggregateBy string) []string {
 	switch strings.ToLower(aggregateBy) {
@@ -487,6 +842,16 @@ func aggregationDimensionKeys(aggregateBy string) []string {
 
 // typeFingerprint returns a stable string for "same type" (labels minus aggregation dimension).
 func typeFingerprint(labels map[string]string, aggregateBy string) string {
+	if group := aggregationGroupBy(aggregateBy); group != nil {
+		var b strings.Builder
+		for _, k := range group {
+			b.WriteString(k)
+			b.WriteString("=")
+			b.WriteString(labels[k])
+			b.WriteString(";")
+		}
+		return b.String()
+	}
 	exclude := aggregationDimensionKeys(aggregateBy)
 	excl := make(map[string]bool)
 	for _, k := range exclude {
@@ -513,8 +878,76 @@ func typeFingerprint(labels map[string]string, aggregateBy string) string {
 	return b.String()
 }
 
+// aggValue is the latest trigger value seen for one aggregation key.
+type aggValue struct {
+	value string
+	at    time.Time
+}
+
+// aggregateSummary renders the aggregated body footer: merged alert count, the value range when values are
+// numeric, and each key with its latest value, e.g. "hostname list: web-1 (85.2), web-2 (97)".
+func aggregateSummary(dimName string, keys map[string]aggValue, merged int) string {
+	keyList := make([]string, 0, len(keys))
+	for k := range keys {
+		keyList = append(keyList, k)
+	}
+	sort.Strings(keyList)
+	var lo, hi float64
+	numeric := 0
+	items := make([]string, 0, len(keyList))
+	for _, k := range keyList {
+		v := keys[k].value
+		if v == "" {
+			items = append(items, k)
+			continue
+		}
+		items = append(items, k+" ("+v+")")
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			if numeric == 0 || f < lo {
+				lo = f
+			}
+			if numeric == 0 || f > hi {
+				hi = f
+			}
+			numeric++
+		}
+	}
+	out := fmt.Sprintf("merged alerts: %d", merged)
+	if numeric > 1 && lo != hi {
+		out += fmt.Sprintf("\nvalue range: %s–%s", strconv.FormatFloat(lo, 'f', -1, 64), strconv.FormatFloat(hi, 'f', -1, 64))
+	}
+	return out + "\n" + dimName + " list: " + strings.Join(items, ", ")
+}
+
+// splitInstance extracts host and port from an instance label: bare host:port, [ipv6]:port, a bare IPv6
+// address, or a URL such as http://host:9100/metrics. port is "" when absent.
+func splitInstance(instance string) (host, port string) {
+	instance = strings.TrimSpace(instance)
+	if instance == "" {
+		return "", ""
+	}
+	if strings.Contains(instance, "://") {
+		if u, err := url.Parse(instance); err == nil && u.Host != "" {
+			return u.Hostname(), u.Port()
+		}
+	}
+	if i := strings.IndexByte(instance, '/'); i >= 0 {
+		instance = instance[:i] // host:port/path without a scheme
+	}
+	if h, p, err := net.SplitHostPort(instance); err == nil {
+		return h, p
+	}
+	if strings.HasPrefix(instance, "[") && strings.HasSuffix(instance, "]") {
+		return instance[1 : len(instance)-1], ""
+	}
+	return instance, "" // plain hostname, or an IPv6 address without brackets
+}
+
 // aggregationKey extracts the dimension value from labels (e.g. hostname, ip, port).
 func aggregationKey(labels map[string]string, aggregateBy string) string {
+	if aggregationGroupBy(aggregateBy) != nil {
+		return aggregationKey(labels, "hostname")
+	}
 	switch strings.ToLower(aggregateBy) {
 	case "hostname":
 		if v := labels["hostname"]; v != "" {
@@ -523,25 +956,20 @@ func aggregationKey(labels map[string]string, aggregateBy string) string {
 		if v := labels["host"]; v != "" {
 			return v
 		}
-		if v := labels["instance"]; v != "" {
-			return strings.Split(v, ":")[0]
-		}
-		return labels["instance"]
+		host, _ := splitInstance(labels["instance"])
+		return host
 	case "ip":
 		if v := labels["ip"]; v != "" {
 			return v
 		}
-		return strings.Split(labels["instance"], ":")[0]
+		host, _ := splitInstance(labels["instance"])
+		return host
 	case "port":
 		if v := labels["port"]; v != "" {
 			return v
 		}
-		if inst := labels["instance"]; inst != "" {
-			if idx := strings.LastIndex(inst, ":"); idx >= 0 && idx < len(inst)-1 {
-				return inst[idx+1:]
-			}
-		}
-		return ""
+		_, port := splitInstance(labels["instance"])
+		return port
 	default:
 		return labels[aggregateBy]
 	}
@@ -549,6 +977,14 @@ func aggregationKey(labels map[string]string, aggregateBy string) string {
 
 // labelsSameType returns true if a and b match except for the aggregation dimension keys.
 func labelsSameType(a, b map[string]string, aggregateBy string) bool {
+	if group := aggregationGroupBy(aggregateBy); group != nil {
+		for _, k := range group {
+			if a[k] != b[k] {
+				return false
+			}
+		}
+		return true
+	}
 	exclude := aggregationDimensionKeys(aggregateBy)
 	excl := make(map[string]bool)
 	for _, k := range exclude {
@@ -574,7 +1010,9 @@ func labelsSameType(a, b map[string]string, aggregateBy string) bool {
 }
 
 // sendAggregated collects same-type alerts in the rule's aggregate window and sends one notification per (rule, type) per window.
-func sendAggregated(db *gorm.DB, r *models.Rule, alert *models.Alert, labels map[string]string, title, body string, channelIDs []uint) {
+// labels are the alert's labels before notifyLabels: the hostname/ip that resolve_instance derives differ per
+// instance and would keep aggregate_by ip or instance from merging anything. The message carries them.
+func sendAggregated(db *gorm.DB, r *models.Rule, alert *models.Alert, labels map[string]string, title, body string, channelIDs []uint, traceID string) {
 	d, err := time.ParseDuration(r.AggregateWindow)
 	if err != nil {
 		d = 5 * time.Minute
@@ -589,7 +1027,9 @@ func sendAggregated(db *gorm.DB, r *models.Rule, alert *models.Alert, labels map
 	if aggKey == "" {
 		aggKey = alert.ID
 	}
-	keysSeen := map[string]bool{aggKey: true}
+	// keysSeen holds the latest value per dimension key; the current alert is the latest for its own key.
+	keysSeen := map[string]aggValue{aggKey: {value: annotationValue(alert, "value"), at: time.Now()}}
+	merged := 1
 	for _, a := range candidates {
 		if a.ID == alert.ID {
 			continue
@@ -605,46 +1045,45 @@ func sendAggregated(db *gorm.DB, r *models.Rule, alert *models.Alert, labels map
 		if !labelsSameType(labels, la, r.AggregateBy) {
 			continue
 		}
+		merged++
 		k := aggregationKey(la, r.AggregateBy)
 		if k != "" {
-			keysSeen[k] = true
+			if prev, ok := keysSeen[k]; !ok || a.UpdatedAt.After(prev.at) {
+				keysSeen[k] = aggValue{value: annotationValue(&a, "value"), at: a.UpdatedAt}
+			}
 		}
 	}
-	aggStateKey := fmt.Sprintf("%d_%s", r.ID, typeFP)
-	aggMu.Lock()
-	lastSent := aggLastSent[aggStateKey]
-	aggMu.Unlock()
-	if !lastSent.IsZero() && time.Since(lastSent) < d {
+	stateKey := aggStateKey(r.ID, typeFP)
+	if aggSentWithin(db, stateKey) {
 		return // already sent in this window
 	}
 	dimName := r.AggregateBy
+	if aggregationGroupBy(dimName) != nil {
+		dimName = "hostname"
+	}
 	if dimName == "" {
 		dimName = "items"
 	}
 	aggTitle := fmt.Sprintf("%s (%d %s)", title, len(keysSeen), dimName)
-	keyList := make([]string, 0, len(keysSeen))
-	for k := range keysSeen {
-		keyList = append(keyList, k)
-	}
-	sort.Strings(keyList)
-	aggBody := body + "\n\n" + dimName + " list: " + strings.Join(keyList, ", ")
-	for _, chID := range channelIDs {
+	aggBody := body + "\n\n" + aggregateSummary(dimName, keysSeen, merged)
+	msg := sender.Message{Title: aggTitle, Body: aggBody, Severity: alert.Severity, Labels: notifyLabels(r, labels)}
+	var tally deliveryTally
+	forEachChannel(channelIDs, func(chID uint) {
 		if sendRateLimited(db, r, alert.ID, chID) {
-			continue
+			return
 		}
 		var ch models.Channel
 		if err := db.First(&ch, chID).Error; err != nil || !ch.Enabled {
-			db.Create(&models.AlertSendRecord{AlertID: alert.ID, ChannelID: chID, Success: false, Error: "channel not found or disabled"})
-			continue
-		}
-		if err := sender.Send(ch.Type, ch.Config, aggTitle, aggBody, false); err != nil {
-			log.Printf("[engine] aggregated send alert to channel %d failed: %v", chID, err)
-			db.Create(&models.AlertSendRecord{AlertID: alert.ID, ChannelID: chID, Success: false, Error: err.Error()})
-			continue
+			tally.record(errChannelUnavailable)
+			recordSend(db, traceID, alert.ID, chID, "aggregated", errChannelUnavailable)
+			return
 		}
-		db.Create(&models.AlertSendRecord{AlertID: alert.ID, ChannelID: chID, Success: true})
+		rc, err := sender.SendToChannelReceipt(ch.ID, ch.RateLimit, ch.Type, ch.Config, msg)
+		tally.record(err)
+		recordDelivery(db, traceID, alert.ID, chID, "aggregated", msg, rc, err)
+	})
+	if tally.allFailed() {
+		sendFallback(db, r, alert.ID, channelIDs, msg, traceID)
 	}
-	aggMu.Lock()
-	aggLastSent[aggStateKey] = time.Now()
-	aggMu.Unlock()
+	markAggSent(db, stateKey, r.ID, d)
 }
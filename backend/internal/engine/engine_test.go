@@ -1,10 +1,18 @@
 package engine
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/sender"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -52,6 +60,77 @@ func TestMatchRule(t *testing.T) {
 	}
 }
 
+func TestMatchRuleRegexAndNegation(t *testing.T) {
+	alert := &models.Alert{SourceID: 1, Severity: "warning"}
+	labels := map[string]string{"job": "api", "env": "prod-eu"}
+
+	cases := []struct {
+		matchLabels string
+		want        bool
+	}{
+		{`{"env":"~^prod-.*$"}`, true},
+		{`{"env":"~prod-.*"}`, true}, // anchored: whole value must match
+		{`{"env":"~prod"}`, false},
+		{`{"env":"=~prod-(eu|us)"}`, true},
+		{`{"env":"~^staging-.*$"}`, false},
+		{`{"env":"!~^staging-.*$"}`, true},
+		{`{"env":"!~^prod-.*$"}`, false},
+		{`{"env":"!=prod-us"}`, true},
+		{`{"env":"!=prod-eu"}`, false},
+		{`{"env":"=prod-eu"}`, true},
+		{`{"region":"!=eu"}`, true}, // missing label is empty
+		{`{"region":"~.+"}`, false}, // missing label is empty
+		{`{"env":"~(unclosed"}`, false},
+		{`{"job":"api","env":"~prod-.*"}`, true},
+		{`{"job":"!=api","env":"~prod-.*"}`, false},
+	}
+	for _, tc := range cases {
+		r := &models.Rule{MatchLabels: tc.matchLabels}
+		if got := matchRule(r, alert, labels); got != tc.want {
+			t.Errorf("match_labels %s: got %v, want %v", tc.matchLabels, got, tc.want)
+		}
+	}
+}
+
+func TestMatchRuleAnyLabels(t *testing.T) {
+	alert := &models.Alert{SourceID: 1, Severity: "warning"}
+	labels := map[string]string{"team": "db", "env": "prod"}
+
+	r := &models.Rule{MatchLabelsAny: `{"team":"db"}`}
+	if !matchRule(r, alert, labels) {
+		t.Error("expected match when the only any-pair matches")
+	}
+	r.MatchLabelsAny = `{"team":"infra","service":"~pg.*"}`
+	if matchRule(r, alert, labels) {
+		t.Error("expected no match when no any-pair matches")
+	}
+	r.MatchLabelsAny = `{"team":"infra","env":"prod"}`
+	if !matchRule(r, alert, labels) {
+		t.Error("expected match when one of several any-pairs matches")
+	}
+	// combined with AND labels
+	r.MatchLabels = `{"env":"staging"}`
+	if matchRule(r, alert, labels) {
+		t.Error("expected no match when match_labels fails even though an any-pair matches")
+	}
+	r.MatchLabels = `{"env":"prod"}`
+	r.MatchLabelsAny = `{"team":"~db|infra"}`
+	if !matchRule(r, alert, labels) {
+		t.Error("expected match when both AND and OR groups match")
+	}
+}
+
+func TestCachedRegexReused(t *testing.T) {
+	a := cachedRegex("prod-.*")
+	b := cachedRegex("prod-.*")
+	if a == nil || a != b {
+		t.Error("expected compiled regex to be cached")
+	}
+	if cachedRegex("(bad") != nil {
+		t.Error("expected nil for invalid regex")
+	}
+}
+
 func TestDurationSatisfied(t *testing.T) {
 	alert := &models.Alert{FiringAt: time.Now().Add(-10 * time.Minute)}
 	r := &models.Rule{}
@@ -156,3 +235,567 @@ func TestTypeFingerprintAndAggregationKey(t *testing.T) {
 		t.Error("expected same type for different hostname only")
 	}
 }
+
+func TestClaimContentAcrossRules(t *testing.T) {
+	// Claims live in a package-level table; drop this test's so it can run again (-count) or beside others.
+	t.Cleanup(func() {
+		releaseContent(contentKey(10, "disk full", "host web-1"))
+		releaseContent(contentKey(11, "disk full", "host web-1"))
+	})
+	key, ok := claimContent(1, 10, "disk full", "host web-1")
+	if !ok {
+		t.Fatal("first send should be allowed")
+	}
+	if _, ok := claimContent(2, 10, "disk full", "host web-1"); ok {
+		t.Error("identical message from another rule to the same channel should be skipped")
+	}
+	if _, ok := claimContent(1, 10, "disk full", "host web-1"); !ok {
+		t.Error("a rule repeating its own message is governed by send_interval, not dedup")
+	}
+	if _, ok := claimContent(2, 11, "disk full", "host web-1"); !ok {
+		t.Error("a different channel should not be deduplicated")
+	}
+	releaseContent(key)
+	if _, ok := claimContent(2, 10, "disk full", "host web-1"); !ok {
+		t.Error("released claim should allow the send")
+	}
+}
+
+func TestAggregationKeyInstanceParsing(t *testing.T) {
+	cases := []struct {
+		instance, host, port string
+	}{
+		{"10.0.0.1:9100", "10.0.0.1", "9100"},
+		{"[::1]:9100", "::1", "9100"},
+		{"https://host/path", "host", ""},
+		{"http://host:9100/metrics", "host", "9100"},
+		{"http://[2001:db8::1]:9100/metrics", "2001:db8::1", "9100"},
+		{"host:9100/metrics", "host", "9100"},
+		{"[::1]", "::1", ""},
+		{"2001:db8::1", "2001:db8::1", ""},
+		{"hostname", "hostname", ""},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		labels := map[string]string{"instance": c.instance}
+		if got := aggregationKey(labels, "hostname"); got != c.host {
+			t.Errorf("hostname(%q) = %q, want %q", c.instance, got, c.host)
+		}
+		if got := aggregationKey(labels, "ip"); got != c.host {
+			t.Errorf("ip(%q) = %q, want %q", c.instance, got, c.host)
+		}
+		if got := aggregationKey(labels, "port"); got != c.port {
+			t.Errorf("port(%q) = %q, want %q", c.instance, got, c.port)
+		}
+	}
+}
+
+func TestAggregationStateSurvivesRestart(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.AggregationState{}); err != nil {
+		t.Fatal(err)
+	}
+	key := aggStateKey(7, strings.Repeat("instance=10.0.0.1:9100,", 20))
+	if len(key) != 64 || key != aggStateKey(7, strings.Repeat("instance=10.0.0.1:9100,", 20)) {
+		t.Fatalf("state key should be a stable 64-char hash, got %q", key)
+	}
+	markAggSent(db, "7_fp", 7, time.Minute)
+	markAggSent(db, "8_fp", 8, -time.Second) // already expired
+	if !aggSentWithin(db, "7_fp") {
+		t.Fatal("expected send to be inside window")
+	}
+
+	// Simulate a restart: memory is empty, state comes back from the table.
+	aggMu.Lock()
+	aggLastSent = make(map[string]time.Time)
+	aggMu.Unlock()
+	if !aggSentWithin(db, "7_fp") {
+		t.Error("window should be restored from aggregation_states")
+	}
+	if aggSentWithin(db, "8_fp") {
+		t.Error("expired window should not suppress")
+	}
+
+	CleanupState(db)
+	var n int64
+	db.Model(&models.AggregationState{}).Count(&n)
+	if n != 1 {
+		t.Errorf("cleanup should delete only the expired row, %d left", n)
+	}
+}
+
+func TestAggregateSummary(t *testing.T) {
+	keys := map[string]aggValue{
+		"web-2": {value: "97"},
+		"web-1": {value: "85.5"},
+		"web-3": {},
+	}
+	got := aggregateSummary("hostname", keys, 5)
+	want := "merged alerts: 5\nvalue range: 85.5–97\nhostname list: web-1 (85.5), web-2 (97), web-3"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAggregateByLabelSet(t *testing.T) {
+	a := map[string]string{"service": "api", "env": "prod", "instance": "web-1:9100", "alertname": "HighCPU"}
+	b := map[string]string{"service": "api", "env": "prod", "instance": "web-2:9100", "alertname": "HighLatency"}
+	c := map[string]string{"service": "api", "env": "staging", "instance": "web-1:9100", "alertname": "HighCPU"}
+
+	if !labelsSameType(a, b, "service, env") {
+		t.Error("same service and env should group together regardless of other labels")
+	}
+	if labelsSameType(a, c, "service,env") {
+		t.Error("different env should not group")
+	}
+	if typeFingerprint(a, "env,service") != typeFingerprint(b, "service,env") {
+		t.Error("fingerprint should not depend on label order")
+	}
+	if got := aggregationKey(a, "service,env"); got != "web-1" {
+		t.Errorf("label-set aggregation should list by host, got %q", got)
+	}
+	// Single keywords keep their meaning.
+	if labelsSameType(a, b, "hostname") {
+		t.Error("hostname dimension: different alertname should not group")
+	}
+}
+
+func TestDecorateBody(t *testing.T) {
+	r := &models.Rule{TitlePrefix: "[PROD]", BodyFooter: "Runbook: https://wiki/cpu"}
+	if got := withPrefix(r.TitlePrefix, "HighCPU"); got != "[PROD] HighCPU" {
+		t.Errorf("title: got %q", got)
+	}
+	if got := decorateBody(r, "cpu high", false); got != "cpu high\n\nRunbook: https://wiki/cpu" {
+		t.Errorf("firing body: got %q", got)
+	}
+	if got := decorateBody(r, "recovered", true); got != "[PROD] recovered\n\nRunbook: https://wiki/cpu" {
+		t.Errorf("recovery body: got %q", got)
+	}
+	if got := decorateBody(&models.Rule{}, "plain", true); got != "plain" {
+		t.Errorf("undecorated: got %q", got)
+	}
+}
+
+func TestAlertURL(t *testing.T) {
+	defer func(old string) { uiBaseURL = old }(uiBaseURL)
+	uiBaseURL = ""
+	if got := AlertURL("abc"); got != "" {
+		t.Errorf("unset base: got %q, want empty", got)
+	}
+	uiBaseURL = "https://kk-alert.example.com"
+	if got := AlertURL("abc"); got != "https://kk-alert.example.com/alerts/abc" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.SystemConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if MaintenanceMode(db) {
+		t.Fatal("maintenance mode should default to off")
+	}
+	if err := SetMaintenanceMode(db, true); err != nil {
+		t.Fatal(err)
+	}
+	if !MaintenanceMode(db) {
+		t.Error("expected maintenance mode on")
+	}
+	if err := SetMaintenanceMode(db, false); err != nil {
+		t.Fatal(err)
+	}
+	if MaintenanceMode(db) {
+		t.Error("expected maintenance mode off")
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	q, err := ParseQuietHours(`{"enabled":true,"start":"22:00","end":"07:00","timezone":"UTC","exempt_severities":["critical"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	night := time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC)
+	day := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if !q.Holds(night, "warning") {
+		t.Error("warning at 23:30 should be held")
+	}
+	if q.Holds(night, "critical") {
+		t.Error("critical is exempt")
+	}
+	if q.Holds(day, "warning") {
+		t.Error("12:00 is outside quiet hours")
+	}
+	q.Enabled = false
+	if q.Holds(night, "warning") {
+		t.Error("disabled quiet hours should hold nothing")
+	}
+	if _, err := ParseQuietHours(`{"start":"25:00","end":"07:00"}`); err == nil {
+		t.Error("expected error for invalid start")
+	}
+	var nilQ *QuietHours
+	if nilQ.Holds(night, "warning") {
+		t.Error("unset quiet hours should hold nothing")
+	}
+}
+
+func TestQueueDigest(t *testing.T) {
+	r := &models.Rule{ID: 41, Name: "disk", DigestInterval: "15m"}
+	if !digested(r, "warning") || digested(r, "critical") {
+		t.Fatal("only info/warning should be digested")
+	}
+	if digested(&models.Rule{}, "warning") {
+		t.Fatal("digest is off without DigestInterval")
+	}
+	queueDigest("", r, &models.Alert{ID: "a1", Title: "disk 90%", Severity: "warning"}, []uint{1, 2}, false)
+	queueDigest("", r, &models.Alert{ID: "a1", Title: "disk 90%", Severity: "warning"}, []uint{1}, false)
+	queueDigest("", r, &models.Alert{ID: "a2", Title: "disk 95%", Severity: "warning"}, []uint{1}, false)
+	ruleDigestMu.Lock()
+	defer ruleDigestMu.Unlock()
+	b := ruleDigests[digestKey{ruleID: 41, chID: 1}]
+	if b == nil || len(b.entries) != 2 {
+		t.Fatalf("channel 1 digest: %+v", b)
+	}
+	if until := time.Until(b.due); until < 14*time.Minute || until > 15*time.Minute {
+		t.Errorf("digest due in %v, want ~15m", until)
+	}
+	if b := ruleDigests[digestKey{ruleID: 41, chID: 2}]; b == nil || len(b.entries) != 1 {
+		t.Errorf("channel 2 digest: %+v", b)
+	}
+	delete(ruleDigests, digestKey{ruleID: 41, chID: 1})
+	delete(ruleDigests, digestKey{ruleID: 41, chID: 2})
+}
+
+func TestTemplateDataResolutionReason(t *testing.T) {
+	a := &models.Alert{ID: "r1", Annotations: `{"resolution_reason":"false positive"}`}
+	if got := TemplateData(&models.Rule{}, a, nil, true, time.Now()).ResolutionReason; got != "false positive" {
+		t.Errorf("recovery: got %q", got)
+	}
+	if got := TemplateData(&models.Rule{}, a, nil, false, time.Now()).ResolutionReason; got != "" {
+		t.Errorf("firing notification should not carry a resolution reason, got %q", got)
+	}
+}
+
+func TestTemplateDataEnrich(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var labels map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&labels)
+		_, _ = w.Write([]byte(`{"owner":"team-` + labels["service"] + `","tier":1,"oncall":null}`))
+	}))
+	defer srv.Close()
+	r := &models.Rule{EnrichURL: srv.URL}
+	a := &models.Alert{ID: "e1"}
+	labels := map[string]string{"service": "api"}
+	data := TemplateData(r, a, labels, false, time.Now())
+	if data.Enrich["owner"] != "team-api" || data.Enrich["tier"] != "1" {
+		t.Fatalf("enrich = %v", data.Enrich)
+	}
+	if _, ok := data.Enrich["oncall"]; ok {
+		t.Error("null values should be dropped")
+	}
+	TemplateData(r, a, map[string]string{"service": "api"}, true, time.Now())
+	if calls != 1 {
+		t.Errorf("same labels should hit the cache, got %d lookups", calls)
+	}
+	TemplateData(r, a, map[string]string{"service": "db"}, false, time.Now())
+	if calls != 2 {
+		t.Errorf("different labels should look up again, got %d lookups", calls)
+	}
+
+	bad := &models.Rule{EnrichURL: "http://127.0.0.1:1/lookup"}
+	if got := TemplateData(bad, a, labels, false, time.Now()).Enrich; len(got) != 0 {
+		t.Errorf("failed lookup should yield no fields, got %v", got)
+	}
+}
+
+func TestDeliveryTally(t *testing.T) {
+	var tally deliveryTally
+	if tally.allFailed() {
+		t.Error("no attempts should not trigger fallback")
+	}
+	tally.record(errors.New("webhook 404"))
+	if !tally.allFailed() {
+		t.Error("single failed attempt should trigger fallback")
+	}
+	tally.record(nil)
+	if tally.allFailed() {
+		t.Error("one successful delivery should suppress fallback")
+	}
+	if ids, err := ParseFallbackChannelIDs("[3,4]"); err != nil || len(ids) != 2 {
+		t.Errorf("parse: %v %v", ids, err)
+	}
+	if _, err := ParseFallbackChannelIDs(`{"a":1}`); err == nil {
+		t.Error("expected error for non-array fallback_channel_ids")
+	}
+}
+
+func TestRuleNoticeFallsBack(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Channel{}, &models.AlertSendRecord{}, &models.FailedNotification{}, &models.Alert{},
+		&models.SystemConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	var posted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		posted = append(posted, body["text"])
+	}))
+	defer srv.Close()
+	primary := models.Channel{Name: "down", Type: "slack", Config: `{"webhook_url":"` + srv.URL + `"}`}
+	backup := models.Channel{Name: "backup", Type: "slack", Enabled: true, Config: `{"webhook_url":"` + srv.URL + `"}`}
+	db.Create(&primary)
+	db.Model(&primary).Update("enabled", false)
+	db.Create(&backup)
+	r := &models.Rule{ID: 7, ChannelIDs: fmt.Sprintf("[%d]", primary.ID), FallbackChannelIDs: fmt.Sprintf("[%d]", backup.ID)}
+
+	SendRuleNotice(db, r, "a1", "flapping", "Flapping", "HighCPU is flapping", "warning", "")
+	var rec models.AlertSendRecord
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if db.Where("channel_id = ?", backup.ID).Limit(1).Find(&rec); rec.ID != 0 {
+			break
+		}
+	}
+	if len(posted) != 1 || !strings.Contains(posted[0], "HighCPU is flapping") || !rec.Success {
+		t.Errorf("notice should go to the fallback channel: posted %q, record %+v", posted, rec)
+	}
+}
+
+func TestRuleMuted(t *testing.T) {
+	now := time.Now()
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+	cases := []struct {
+		rule models.Rule
+		want bool
+	}{
+		{models.Rule{}, false},
+		{models.Rule{Paused: true}, true},
+		{models.Rule{SilencedUntil: &later}, true},
+		{models.Rule{SilencedUntil: &earlier}, false},
+	}
+	for i, tc := range cases {
+		if _, got := ruleMuted(&tc.rule, now); got != tc.want {
+			t.Errorf("case %d: muted=%v, want %v", i, got, tc.want)
+		}
+	}
+}
+
+func TestInheritTeam(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Alert{}); err != nil {
+		t.Fatal(err)
+	}
+	alert := &models.Alert{ID: "a1", Status: "firing"}
+	db.Create(alert)
+	dbTeam, webTeam := uint(1), uint(2)
+
+	inheritTeam(db, alert, &models.Rule{})
+	if alert.TeamID != nil {
+		t.Fatal("rule without team must not set one")
+	}
+	inheritTeam(db, alert, &models.Rule{TeamID: &dbTeam})
+	inheritTeam(db, alert, &models.Rule{TeamID: &webTeam}) // lower-priority match keeps the first team
+	var stored models.Alert
+	db.First(&stored, "id = ?", "a1")
+	if stored.TeamID == nil || *stored.TeamID != dbTeam || *alert.TeamID != dbTeam {
+		t.Fatalf("team = %v, want %d", stored.TeamID, dbTeam)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Rule{}, &models.Alert{}, &models.AlertSilence{}, &models.InhibitRule{},
+		&models.SystemConfig{}, &models.Template{}, &models.AlertSendRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Rule{Name: "cpu", Enabled: true, Priority: 1, MatchLabels: `{"job":"node"}`, ChannelIDs: "[1]", TitlePrefix: "[PROD]"})
+	db.Create(&models.Rule{Name: "db", Enabled: true, Priority: 2, MatchLabels: `{"job":"mysql"}`, ChannelIDs: "[2]"})
+	db.Create(&models.Rule{Name: "paused", Enabled: true, Priority: 3, Paused: true, ChannelIDs: "[3]"})
+	alert := &models.Alert{ID: "r1", Title: "High CPU", Severity: "warning", Status: "firing", Labels: `{"job":"node"}`, FiringAt: time.Now()}
+	db.Create(alert)
+
+	res := Replay(db, alert)
+	if res.Reason != "" || len(res.Rules) != 3 {
+		t.Fatalf("replay = %+v", res)
+	}
+	cpu := res.Rules[0]
+	if !cpu.Matched || cpu.Outcome != "notify" || cpu.Title != "[PROD] High CPU" || len(cpu.ChannelIDs) != 1 || cpu.Body == "" {
+		t.Errorf("cpu rule: %+v", cpu)
+	}
+	if res.Rules[1].Matched || res.Rules[1].Outcome != "not matched" {
+		t.Errorf("db rule: %+v", res.Rules[1])
+	}
+	if res.Rules[2].Outcome != "muted: is paused" {
+		t.Errorf("paused rule: %+v", res.Rules[2])
+	}
+	var sends int64
+	db.Model(&models.AlertSendRecord{}).Count(&sends)
+	if sends != 0 {
+		t.Errorf("replay must not send, got %d send records", sends)
+	}
+
+	db.Create(&models.AlertSilence{AlertID: "r1", SilenceUntil: time.Now().Add(time.Hour)})
+	if res := Replay(db, alert); res.Reason != "alert is silenced" || len(res.Rules) != 0 {
+		t.Errorf("silenced replay = %+v", res)
+	}
+}
+
+func TestDeadLetterRetry(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Channel{}, &models.AlertSendRecord{}, &models.FailedNotification{}, &models.Alert{},
+		&models.Rule{}, &models.AlertSilence{}, &models.SystemConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Alert{ID: "a1", Status: "firing"})
+	var posted string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		posted = body["text"]
+	}))
+	defer srv.Close()
+	ch := models.Channel{Name: "ops", Type: "slack", Enabled: true, Config: `{"webhook_url":"` + srv.URL + `"}`}
+	db.Create(&ch)
+
+	msg := sender.Message{Title: "High CPU", Body: "cpu at 95%", Severity: "critical", Labels: map[string]string{"host": "a"}}
+	recordDelivery(db, "", "a1", ch.ID, "alert", msg, sender.Receipt{}, errors.New("webhook 503"))
+	var fn models.FailedNotification
+	if err := db.First(&fn).Error; err != nil {
+		t.Fatal(err)
+	}
+	if fn.Status != "pending" || fn.Title != "High CPU" || fn.Error != "webhook 503" || fn.Labels != `{"host":"a"}` {
+		t.Fatalf("dead letter: %+v", fn)
+	}
+
+	_ = SetMaintenanceMode(db, true)
+	if err := RetryFailedNotification(db, &fn); !errors.Is(err, ErrMaintenance) || posted != "" {
+		t.Fatalf("retry in maintenance mode: got %v, posted %q", err, posted)
+	}
+	_ = SetMaintenanceMode(db, false)
+	stale := fn
+	stale.Attempts = -1 // as seen by a concurrent retry that lost the claim
+	if err := RetryFailedNotification(db, &stale); !errors.Is(err, ErrRetryInProgress) || posted != "" {
+		t.Fatalf("concurrent retry: got %v, posted %q", err, posted)
+	}
+
+	if err := RetryFailedNotification(db, &fn); err != nil {
+		t.Fatal(err)
+	}
+	if fn.Status != "delivered" || fn.Attempts != 1 || posted == "" {
+		t.Errorf("after retry: %+v, posted %q", fn, posted)
+	}
+	var rec models.AlertSendRecord
+	db.Order("id desc").First(&rec)
+	if rec.AlertID != "a1" || !rec.Success {
+		t.Errorf("retry send record: %+v", rec)
+	}
+	if err := RetryFailedNotification(db, &fn); !errors.Is(err, ErrAlreadyDelivered) {
+		t.Errorf("second retry: got %v", err)
+	}
+
+	// A firing letter whose alert resolved in the meantime is superseded rather than sent.
+	posted = ""
+	db.Create(&models.Alert{ID: "a2", Status: "resolved"})
+	recordDelivery(db, "", "a2", ch.ID, "alert", msg, sender.Receipt{}, errors.New("webhook 503"))
+	var late models.FailedNotification
+	db.Where("alert_id = ?", "a2").First(&late)
+	if err := RetryFailedNotification(db, &late); !errors.Is(err, ErrSuperseded) || posted != "" {
+		t.Fatalf("retry of resolved alert: got %v, posted %q", err, posted)
+	}
+	db.First(&late, late.ID)
+	if late.Status != "superseded" {
+		t.Errorf("resolved alert's letter: status %q, want superseded", late.Status)
+	}
+}
+
+func TestRuleLabelsRelabelsOnce(t *testing.T) {
+	r := &models.Rule{ID: 4, RelabelConfig: `[{"source_label":"instance","target_label":"instance","regex":"(.+)","replacement":"node-$1"}]`}
+	labels := map[string]string{"instance": "db-1"}
+	got, keep := ruleLabels(r, &models.Alert{RuleID: 0}, labels)
+	if !keep || got["instance"] != "node-db-1" {
+		t.Errorf("inbound alert: got %v", got)
+	}
+	// The scheduler already relabeled the alerts of rule 4 when it stored them.
+	stored := map[string]string{"instance": "node-db-1"}
+	if got, _ := ruleLabels(r, &models.Alert{RuleID: 4}, stored); got["instance"] != "node-db-1" {
+		t.Errorf("own alert relabeled twice: got %v", got)
+	}
+	if got, _ := ruleLabels(r, &models.Alert{RuleID: 9}, stored); got["instance"] != "node-node-db-1" {
+		t.Errorf("another rule's alert: got %v", got)
+	}
+}
+
+func TestDigestFlushRespectsMaintenanceAndPausedRules(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Channel{}, &models.AlertSendRecord{}, &models.FailedNotification{}, &models.Rule{},
+		&models.SystemConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	var posted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		posted = append(posted, body["text"])
+	}))
+	defer srv.Close()
+	ch := models.Channel{Name: "ops", Type: "slack", Enabled: true, Config: `{"webhook_url":"` + srv.URL + `"}`}
+	db.Create(&ch)
+	active := models.Rule{ID: 61, Name: "disk", DigestInterval: "1m"}
+	paused := models.Rule{ID: 62, Name: "cpu", DigestInterval: "1m", Paused: true}
+	db.Create(&active)
+	db.Create(&paused)
+	queue := func() {
+		for _, r := range []*models.Rule{&active, &paused} {
+			queueDigest("", r, &models.Alert{ID: r.Name + "-1", Title: r.Name, Severity: "warning"}, []uint{ch.ID}, false)
+		}
+		ruleDigestMu.Lock()
+		for _, b := range ruleDigests {
+			b.due = time.Now().Add(-time.Second)
+		}
+		ruleDigestMu.Unlock()
+	}
+
+	_ = SetMaintenanceMode(db, true)
+	queue()
+	FlushDigests(db)
+	if len(posted) != 0 {
+		t.Fatalf("digest sent in maintenance mode: %q", posted)
+	}
+	_ = SetMaintenanceMode(db, false)
+	queue()
+	FlushDigests(db)
+	if len(posted) != 1 || !strings.Contains(posted[0], "disk") || strings.Contains(posted[0], "cpu") {
+		t.Fatalf("only the active rule's digest should be sent, got %q", posted)
+	}
+
+	posted = nil
+	quietHeld(&QuietHours{Digest: true}, "", &active, &models.Alert{ID: "disk-2", Title: "disk", Severity: "warning"}, []uint{ch.ID}, false)
+	quietHeld(&QuietHours{Digest: true}, "", &paused, &models.Alert{ID: "cpu-2", Title: "cpu", Severity: "warning"}, []uint{ch.ID}, false)
+	FlushQuietDigest(db)
+	if len(posted) != 1 || !strings.Contains(posted[0], "disk") || strings.Contains(posted[0], "cpu") {
+		t.Errorf("quiet digest should leave out the paused rule, got %q", posted)
+	}
+}
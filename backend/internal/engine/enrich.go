@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kk-alert/backend/internal/httpclient"
+)
+
+// enrichCacheTTL is how long a lookup answer is reused for the same URL and labels, so a burst of
+// notifications for one alert (channels, recovery, re-sends) costs one request.
+const enrichCacheTTL = time.Minute
+
+// enrichClient has a short timeout: the lookup runs before every notification of the rule.
+var enrichClient = httpclient.New(3 * time.Second)
+
+type enrichEntry struct {
+	fields map[string]string
+	at     time.Time
+}
+
+var (
+	enrichMu    sync.Mutex
+	enrichCache = make(map[string]enrichEntry) // url + sorted labels -> answer
+)
+
+func enrichKey(url string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(url)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+	}
+	return b.String()
+}
+
+// enrichFields POSTs labels as a JSON object to url and returns the fields of the JSON object it answers with,
+// for templates as {{.Enrich.owner}}. Non-string values are kept as their JSON text; nulls are dropped. A
+// failed lookup is logged and yields no fields (cached like an answer, so a down lookup service does not
+// slow every send).
+func enrichFields(url string, labels map[string]string) map[string]string {
+	key := enrichKey(url, labels)
+	now := time.Now()
+	enrichMu.Lock()
+	if e, ok := enrichCache[key]; ok && now.Sub(e.at) < enrichCacheTTL {
+		enrichMu.Unlock()
+		return e.fields
+	}
+	for k, e := range enrichCache {
+		if now.Sub(e.at) >= enrichCacheTTL {
+			delete(enrichCache, k)
+		}
+	}
+	enrichMu.Unlock()
+
+	fields, err := fetchEnrichment(url, labels)
+	if err != nil {
+		log.Printf("[engine] enrichment lookup %s failed: %v", url, err)
+	}
+	enrichMu.Lock()
+	enrichCache[key] = enrichEntry{fields: fields, at: now}
+	enrichMu.Unlock()
+	return fields
+}
+
+func fetchEnrichment(url string, labels map[string]string) (map[string]string, error) {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	b, _ := json.Marshal(labels)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := enrichClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bb, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(bb)))
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(bb, &raw); err != nil {
+		return nil, fmt.Errorf("response is not a JSON object: %v", err)
+	}
+	fields := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var s string
+		switch {
+		case string(v) == "null":
+		case json.Unmarshal(v, &s) == nil:
+			fields[k] = s
+		default:
+			fields[k] = string(v)
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/sender"
+	"gorm.io/gorm"
+)
+
+// ParseFallbackChannelIDs decodes a rule's FallbackChannelIDs JSON array. Empty input yields nil.
+func ParseFallbackChannelIDs(raw string) ([]uint, error) {
+	if raw == "" || raw == "[]" || raw == "null" {
+		return nil, nil
+	}
+	var ids []uint
+	if err := json.Unmarshal([]byte(raw), &ids); err != nil {
+		return nil, fmt.Errorf("invalid fallback_channel_ids: %w", err)
+	}
+	return ids, nil
+}
+
+// deliveryTally counts the outcomes of an alert's primary deliveries. Skipped sends (rate limit, dedup)
+// are not counted.
+type deliveryTally struct {
+	failed, delivered atomic.Int32
+}
+
+func (t *deliveryTally) record(err error) {
+	if err != nil {
+		t.failed.Add(1)
+	} else {
+		t.delivered.Add(1)
+	}
+}
+
+// allFailed reports whether at least one primary delivery was attempted and none succeeded.
+func (t *deliveryTally) allFailed() bool {
+	return t.failed.Load() > 0 && t.delivered.Load() == 0
+}
+
+// sendFallback delivers msg to the rule's fallback channels after every primary delivery failed, recording
+// each attempt with kind "fallback". Channels that were primaries are skipped, and fallback failures do not
+// cascade any further.
+func sendFallback(db *gorm.DB, r *models.Rule, alertID string, primary []uint, msg sender.Message, traceID string) {
+	ids, err := ParseFallbackChannelIDs(r.FallbackChannelIDs)
+	if err != nil {
+		traceLogf(traceID, "rule %d: %v", r.ID, err)
+		return
+	}
+	tried := make(map[uint]bool, len(primary)+len(ids))
+	for _, id := range primary {
+		tried[id] = true
+	}
+	var targets []uint
+	for _, id := range ids {
+		if !tried[id] {
+			tried[id] = true
+			targets = append(targets, id)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	traceLogf(traceID, "all deliveries of alert %s failed, trying %d fallback channel(s) of rule %d", alertID, len(targets), r.ID)
+	forEachChannel(targets, func(chID uint) {
+		var ch models.Channel
+		if err := db.First(&ch, chID).Error; err != nil || !ch.Enabled {
+			recordSend(db, traceID, alertID, chID, "fallback", errChannelUnavailable)
+			return
+		}
+		rc, err := sender.SendToChannelReceipt(ch.ID, ch.RateLimit, ch.Type, ch.Config, msg)
+		recordDelivery(db, traceID, alertID, chID, "fallback", msg, rc, err)
+	})
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ParseInhibitEqual decodes an InhibitRule's Equal JSON array. Empty input yields nil.
+func ParseInhibitEqual(raw string) ([]string, error) {
+	if raw == "" || raw == "[]" || raw == "null" {
+		return nil, nil
+	}
+	var equal []string
+	if err := json.Unmarshal([]byte(raw), &equal); err != nil {
+		return nil, fmt.Errorf("invalid equal: %w", err)
+	}
+	return equal, nil
+}
+
+// Inhibited reports whether an enabled inhibit rule suppresses alert: the alert matches the rule's target
+// matchers and another firing alert matches its source matchers with the same values for every Equal label.
+// Returns the inhibiting rule for logging.
+func Inhibited(db *gorm.DB, alert *models.Alert, labels map[string]string) (*models.InhibitRule, bool) {
+	var rules []models.InhibitRule
+	if err := db.Where("enabled = ?", true).Find(&rules).Error; err != nil || len(rules) == 0 {
+		return nil, false
+	}
+	for i := range rules {
+		ir := &rules[i]
+		target := parseMatchers(ir.TargetMatch)
+		if len(target) == 0 || !matchAll(target, labels) {
+			continue
+		}
+		source := parseMatchers(ir.SourceMatch)
+		if len(source) == 0 {
+			continue
+		}
+		equal, _ := ParseInhibitEqual(ir.Equal)
+		if hasInhibitingSource(db, alert.ID, source, equal, labels) {
+			return ir, true
+		}
+	}
+	return nil, false
+}
+
+// hasInhibitingSource looks for a firing alert (other than alertID) matching source whose Equal labels agree
+// with labels. Label values that must match exactly are pushed into the query as substring filters on the
+// stored labels JSON, so only plausible candidates are loaded. With the (status, labels) index the database
+// checks those filters on the index entries of firing alerts and reads only the rows that pass.
+func hasInhibitingSource(db *gorm.DB, alertID string, source map[string]string, equal []string, labels map[string]string) bool {
+	q := db.Model(&models.Alert{}).Where("status = ? AND id <> ?", "firing", alertID)
+	for k, m := range source {
+		if v, ok := exactMatcherValue(m); ok && v != "" {
+			q = likeLabel(q, k, v)
+		}
+	}
+	for _, k := range equal {
+		if v := labels[k]; v != "" {
+			q = likeLabel(q, k, v)
+		}
+	}
+	var candidates []models.Alert
+	if err := q.Select("id, labels").Limit(500).Find(&candidates).Error; err != nil {
+		return false
+	}
+	for _, c := range candidates {
+		var cl map[string]string
+		_ = json.Unmarshal([]byte(c.Labels), &cl)
+		if !matchAll(source, cl) {
+			continue
+		}
+		same := true
+		for _, k := range equal {
+			if cl[k] != labels[k] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
+
+// exactMatcherValue returns the value an equality matcher ("v" or "=v") requires.
+func exactMatcherValue(m string) (string, bool) {
+	if strings.HasPrefix(m, "!") || strings.HasPrefix(m, "~") || strings.HasPrefix(m, "=~") {
+		return "", false
+	}
+	return strings.TrimPrefix(m, "="), true
+}
+
+// likeLabel filters on the `"k":"v"` pair appearing in the labels JSON (stored via json.Marshal). Pairs
+// containing LIKE wildcards are left to the in-memory check.
+func likeLabel(q *gorm.DB, k, v string) *gorm.DB {
+	kb, _ := json.Marshal(k)
+	vb, _ := json.Marshal(v)
+	pair := string(kb) + ":" + string(vb)
+	if strings.ContainsAny(pair, `%_\`) {
+		return q
+	}
+	return q.Where("labels LIKE ?", "%"+pair+"%")
+}
@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestInhibited(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Alert{}, &models.InhibitRule{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.InhibitRule{Name: "dc down", SourceMatch: `{"alertname":"DatacenterDown"}`, TargetMatch: `{"alertname":"~Host.*"}`, Equal: `["dc"]`, Enabled: true})
+	db.Create(&models.Alert{ID: "src", Status: "firing", FiringAt: time.Now(), Labels: `{"alertname":"DatacenterDown","dc":"sh"}`})
+
+	target := &models.Alert{ID: "t1", Status: "firing"}
+	if ir, ok := Inhibited(db, target, map[string]string{"alertname": "HostDown", "dc": "sh"}); !ok || ir.Name != "dc down" {
+		t.Error("host alert in the down datacenter should be inhibited")
+	}
+	if _, ok := Inhibited(db, target, map[string]string{"alertname": "HostDown", "dc": "bj"}); ok {
+		t.Error("host alert in another datacenter should not be inhibited")
+	}
+	if _, ok := Inhibited(db, target, map[string]string{"alertname": "DiskFull", "dc": "sh"}); ok {
+		t.Error("alert not matching target_match should not be inhibited")
+	}
+
+	db.Model(&models.Alert{}).Where("id = ?", "src").Update("status", "resolved")
+	if _, ok := Inhibited(db, target, map[string]string{"alertname": "HostDown", "dc": "sh"}); ok {
+		t.Error("resolved source should not inhibit")
+	}
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/kk-alert/backend/internal/models"
+)
+
+// regexCache holds compiled label regexes keyed by pattern; a nil value marks an invalid pattern.
+var regexCache sync.Map // map[string]*regexp.Regexp
+
+// cachedRegex compiles pattern anchored like Prometheus (=~ matches the whole value) and caches it.
+func cachedRegex(pattern string) *regexp.Regexp {
+	if v, ok := regexCache.Load(pattern); ok {
+		return v.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		log.Printf("[engine] invalid label regex %q: %v", pattern, err)
+		re = nil
+	}
+	regexCache.Store(pattern, re)
+	return re
+}
+
+// MatchLabelValue reports whether a label value satisfies one MatchLabels matcher. The operator is an
+// optional prefix of the matcher: "v" or "=v" (equal), "!=v" (not equal), "~re" or "=~re" (regex),
+// "!~re" (negated regex). A missing label has the empty value, as in Prometheus. Invalid regexes never match.
+func MatchLabelValue(matcher, value string) bool {
+	switch {
+	case strings.HasPrefix(matcher, "!~"):
+		re := cachedRegex(matcher[2:])
+		return re != nil && !re.MatchString(value)
+	case strings.HasPrefix(matcher, "!="):
+		return value != matcher[2:]
+	case strings.HasPrefix(matcher, "=~"):
+		re := cachedRegex(matcher[2:])
+		return re != nil && re.MatchString(value)
+	case strings.HasPrefix(matcher, "~"):
+		re := cachedRegex(matcher[1:])
+		return re != nil && re.MatchString(value)
+	case strings.HasPrefix(matcher, "="):
+		return value == matcher[1:]
+	}
+	return value == matcher
+}
+
+// parseMatchers decodes a MatchLabels-style JSON object; empty or invalid JSON yields nil.
+func parseMatchers(matchLabelsJSON string) map[string]string {
+	if matchLabelsJSON == "" || matchLabelsJSON == "{}" {
+		return nil
+	}
+	var want map[string]string
+	if err := json.Unmarshal([]byte(matchLabelsJSON), &want); err != nil {
+		return nil
+	}
+	return want
+}
+
+// MatchLabels reports whether labels satisfy every matcher in the MatchLabels JSON object (AND).
+// Empty or invalid JSON matches everything.
+func MatchLabels(matchLabelsJSON string, labels map[string]string) bool {
+	return matchAll(parseMatchers(matchLabelsJSON), labels)
+}
+
+// matchAll reports whether labels satisfy every matcher (an empty set matches everything).
+func matchAll(matchers map[string]string, labels map[string]string) bool {
+	for k, m := range matchers {
+		if !MatchLabelValue(m, labels[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchLabelsAny reports whether labels satisfy at least one matcher in the JSON object (OR).
+// Empty or invalid JSON matches everything.
+func MatchLabelsAny(matchLabelsJSON string, labels map[string]string) bool {
+	want := parseMatchers(matchLabelsJSON)
+	if len(want) == 0 {
+		return true
+	}
+	for k, m := range want {
+		if MatchLabelValue(m, labels[k]) {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleLabelsMatch combines a rule's MatchLabels (all must match) and MatchLabelsAny (one must match).
+func RuleLabelsMatch(r *models.Rule, labels map[string]string) bool {
+	return MatchLabels(r.MatchLabels, labels) && MatchLabelsAny(r.MatchLabelsAny, labels)
+}
@@ -0,0 +1,25 @@
+package engine
+
+import (
+	"strconv"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ConfigKeyMaintenanceMode is the SystemConfig key of the global maintenance switch. While it is "true",
+// alerts are still stored and rules still evaluated, but no notifications are sent.
+const ConfigKeyMaintenanceMode = "maintenance_mode"
+
+// MaintenanceMode reports whether maintenance mode is on.
+func MaintenanceMode(db *gorm.DB) bool {
+	var cfg models.SystemConfig
+	db.Where("key = ?", ConfigKeyMaintenanceMode).Limit(1).Find(&cfg)
+	on, _ := strconv.ParseBool(cfg.Value)
+	return on
+}
+
+// SetMaintenanceMode turns maintenance mode on or off.
+func SetMaintenanceMode(db *gorm.DB, on bool) error {
+	return db.Save(&models.SystemConfig{Key: ConfigKeyMaintenanceMode, Value: strconv.FormatBool(on)}).Error
+}
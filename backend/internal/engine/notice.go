@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/sender"
+	"gorm.io/gorm"
+)
+
+// SendRuleNotice sends a one-off notice about alertID (e.g. "flapping detected") to the rule's channels in
+// the background. Templates, send intervals and aggregation do not apply; each delivery is recorded under
+// alertID with the given kind. When every delivery fails the rule's fallback channels are tried.
+func SendRuleNotice(db *gorm.DB, r *models.Rule, alertID, kind, title, body, severity, traceID string) {
+	var channelIDs []uint
+	_ = json.Unmarshal([]byte(r.ChannelIDs), &channelIDs)
+	if len(channelIDs) == 0 {
+		return
+	}
+	if MaintenanceMode(db) {
+		traceLogf(traceID, "%s notice for alert %s not sent: maintenance mode is on", kind, alertID)
+		return
+	}
+	if reason, muted := ruleMuted(r, time.Now()); muted {
+		traceLogf(traceID, "%s notice for alert %s not sent: rule %d %s", kind, alertID, r.ID, reason)
+		return
+	}
+	freshDB := db.Session(&gorm.Session{NewDB: true})
+	msg := sender.Message{Title: title, Body: body, Severity: severity}
+	send := func() {
+		var tally deliveryTally
+		forEachChannel(channelIDs, func(chID uint) {
+			var ch models.Channel
+			if err := freshDB.First(&ch, chID).Error; err != nil || !ch.Enabled {
+				tally.record(errChannelUnavailable)
+				recordSend(freshDB, traceID, alertID, chID, kind, errChannelUnavailable)
+				return
+			}
+			rc, err := sender.SendToChannelReceipt(ch.ID, ch.RateLimit, ch.Type, ch.Config, msg)
+			tally.record(err)
+			recordDelivery(freshDB, traceID, alertID, chID, kind, msg, rc, err)
+		})
+		if tally.allFailed() {
+			sendFallback(freshDB, r, alertID, channelIDs, msg, traceID)
+		}
+	}
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	if queueClosed {
+		send() // shutting down — Drain may already be waiting, so don't start new workers
+		return
+	}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		send()
+	}()
+}
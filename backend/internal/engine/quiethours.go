@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ConfigKeyQuietHours is the SystemConfig key holding the global QuietHours JSON.
+const ConfigKeyQuietHours = "quiet_hours"
+
+// QuietHours is a daily window during which notifications are held back for every rule (on top of each
+// rule's exclude windows). Alerts are still stored. Severities in ExemptSeverities (e.g. critical) are sent
+// as usual; with Digest on, held-back notifications are summarized per channel once the window ends.
+type QuietHours struct {
+	Enabled          bool     `json:"enabled"`
+	Start            string   `json:"start"`              // HH:MM
+	End              string   `json:"end"`                // HH:MM; before Start means the window spans midnight
+	Timezone         string   `json:"timezone,omitempty"` // IANA name, e.g. Asia/Shanghai; empty = Asia/Shanghai
+	ExemptSeverities []string `json:"exempt_severities,omitempty"`
+	Digest           bool     `json:"digest"`
+}
+
+// ParseQuietHours decodes and validates QuietHours JSON. Empty input yields nil (no quiet hours).
+func ParseQuietHours(raw string) (*QuietHours, error) {
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+	var q QuietHours
+	if err := json.Unmarshal([]byte(raw), &q); err != nil {
+		return nil, fmt.Errorf("invalid quiet_hours: %w", err)
+	}
+	return &q, q.Validate()
+}
+
+// Validate checks the window times and timezone.
+func (q *QuietHours) Validate() error {
+	if parseHM(q.Start) < 0 || parseHM(q.End) < 0 {
+		return fmt.Errorf("quiet_hours start and end must be HH:MM")
+	}
+	if q.Timezone != "" {
+		if _, err := time.LoadLocation(q.Timezone); err != nil {
+			return fmt.Errorf("invalid quiet_hours timezone %q", q.Timezone)
+		}
+	}
+	return nil
+}
+
+// LoadQuietHours returns the configured quiet hours, or nil when unset or invalid.
+func LoadQuietHours(db *gorm.DB) *QuietHours {
+	var cfg models.SystemConfig
+	db.Where("key = ?", ConfigKeyQuietHours).Limit(1).Find(&cfg)
+	q, err := ParseQuietHours(cfg.Value)
+	if err != nil {
+		return nil
+	}
+	return q
+}
+
+// Active reports whether now falls inside the quiet window.
+func (q *QuietHours) Active(now time.Time) bool {
+	if q == nil || !q.Enabled {
+		return false
+	}
+	loc := locCST
+	if q.Timezone != "" {
+		if l, err := time.LoadLocation(q.Timezone); err == nil {
+			loc = l
+		}
+	}
+	now = now.In(loc)
+	return inWindow(now.Hour()*60+now.Minute(), parseHM(q.Start), parseHM(q.End))
+}
+
+// Holds reports whether a notification of the given severity is held back at now.
+func (q *QuietHours) Holds(now time.Time, severity string) bool {
+	if !q.Active(now) {
+		return false
+	}
+	for _, s := range q.ExemptSeverities {
+		if strings.EqualFold(s, severity) {
+			return false
+		}
+	}
+	return true
+}
+
+// quietHeld records a notification held back by quiet hours and, when the digest is on, queues it for the
+// channels it would have gone to.
+func quietHeld(q *QuietHours, traceID string, r *models.Rule, alert *models.Alert, channelIDs []uint, isRecovery bool) {
+	traceLogf(traceID, "alert %s (rule %d, %s) not notified: quiet hours", alert.ID, r.ID, alert.Severity)
+	if !q.Digest {
+		return
+	}
+	e := digestEntry{AlertID: alert.ID, RuleID: r.ID, RuleName: r.Name, Title: stripSystemAlertPrefix(alert.Title), Severity: alert.Severity, Status: "firing", At: time.Now()}
+	if isRecovery {
+		e.Status = "resolved"
+	}
+	quietDigestMu.Lock()
+	defer quietDigestMu.Unlock()
+	for _, chID := range channelIDs {
+		b := quietDigest[chID]
+		if b == nil {
+			b = &digestBuffer{}
+			quietDigest[chID] = b
+		}
+		b.add(e)
+	}
+}
+
+var (
+	quietDigestMu sync.Mutex
+	quietDigest   = make(map[uint]*digestBuffer) // channel ID -> notifications held during quiet hours
+)
+
+// FlushQuietDigest sends the quiet-hours digest to each channel once quiet hours are over. Call periodically.
+// The digest is dropped in maintenance mode, and entries of rules paused or silenced by then are left out.
+func FlushQuietDigest(db *gorm.DB) {
+	if LoadQuietHours(db).Active(time.Now()) {
+		return
+	}
+	quietDigestMu.Lock()
+	pending := quietDigest
+	quietDigest = make(map[uint]*digestBuffer)
+	quietDigestMu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	if MaintenanceMode(db) {
+		traceLogf("", "quiet hours digest not sent: maintenance mode is on")
+		return
+	}
+	muted := make(map[uint]bool)
+	for chID, b := range pending {
+		kept := b.entries[:0]
+		for _, e := range b.entries {
+			if !digestRuleMuted(db, e.RuleID, muted) {
+				kept = append(kept, e)
+			}
+		}
+		b.entries = kept
+		sendDigest(db, chID, "Quiet hours digest", b)
+	}
+}
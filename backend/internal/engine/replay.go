@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ReplayResult is how the current rules would handle a stored alert. Reason is set when the alert would
+// not reach any rule (silenced, maintenance mode, inhibited).
+type ReplayResult struct {
+	AlertID string       `json:"alert_id"`
+	Status  string       `json:"status"`
+	Reason  string       `json:"reason,omitempty"`
+	Rules   []ReplayRule `json:"rules"`
+}
+
+// ReplayRule is one enabled rule's verdict. Outcome is "notify" when the rule would send Title/Body to
+// ChannelIDs now, or says why it would not (e.g. "not matched", "muted: is paused", "held by quiet hours").
+type ReplayRule struct {
+	RuleID     uint   `json:"rule_id"`
+	RuleName   string `json:"rule_name"`
+	Matched    bool   `json:"matched"`
+	Outcome    string `json:"outcome"`
+	Severity   string `json:"severity,omitempty"` // as notified, after a route's severity_override
+	ChannelIDs []uint `json:"channel_ids,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Body       string `json:"body,omitempty"`
+}
+
+// Replay runs alert through the enabled rules the way ProcessAlert would now, without sending, recording
+// or changing anything, so rule changes can be checked against past incidents. Per-channel send intervals
+// and content dedup depend on send history and are not evaluated.
+func Replay(db *gorm.DB, alert *models.Alert) ReplayResult {
+	res := ReplayResult{AlertID: alert.ID, Status: alert.Status, Rules: []ReplayRule{}}
+	if IsSilenced(db, alert.ID) {
+		res.Reason = "alert is silenced"
+		return res
+	}
+	if MaintenanceMode(db) {
+		res.Reason = "maintenance mode is on"
+		return res
+	}
+	var labels map[string]string
+	_ = json.Unmarshal([]byte(alert.Labels), &labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	if alert.Status == "firing" {
+		if ir, ok := Inhibited(db, alert, labels); ok {
+			res.Reason = "inhibited by inhibit rule " + ir.Name
+			return res
+		}
+	}
+	var rules []models.Rule
+	db.Where("enabled = ?", true).Order("priority asc").Find(&rules)
+	quiet := LoadQuietHours(db)
+	now := time.Now()
+	for _, r := range rules {
+		res.Rules = append(res.Rules, replayRule(db, &r, alert, labels, quiet, now))
+	}
+	return res
+}
+
+func replayRule(db *gorm.DB, r *models.Rule, alert *models.Alert, labels map[string]string, quiet *QuietHours, now time.Time) ReplayRule {
+	out := ReplayRule{RuleID: r.ID, RuleName: r.Name}
+	labels, keep := ruleLabels(r, alert, labels)
+	if !keep {
+		out.Outcome = "dropped by relabel_config"
+		return out
+	}
+	if !matchRule(r, alert, labels) {
+		out.Outcome = "not matched"
+		return out
+	}
+	out.Matched = true
+	if reason, muted := ruleMuted(r, now); muted {
+		out.Outcome = "muted: " + reason
+		return out
+	}
+	channelIDs, routed := ruleChannels(r, alert, labels, "")
+	out.Severity = routed.Severity
+	if len(channelIDs) == 0 {
+		out.Outcome = "no channels"
+		return out
+	}
+	out.ChannelIDs = channelIDs
+	isRecovery := alert.Status == "resolved"
+	switch {
+	case isRecovery && !r.RecoveryNotify:
+		out.Outcome = "resolved; recovery_notify is off"
+		return out
+	case !isRecovery && alert.Status != "firing":
+		out.Outcome = "status " + alert.Status + " is not notified"
+		return out
+	case !isRecovery && !durationSatisfied(r, alert):
+		out.Outcome = "held: duration " + r.Duration + " not reached"
+		return out
+	case !isRecovery && inExcludeWindow(r):
+		out.Outcome = "held: in exclude window"
+		return out
+	case !isRecovery && suppressed(r, labels):
+		out.Outcome = "held: suppressed"
+		return out
+	case quiet.Holds(now, routed.Severity):
+		out.Outcome = "held by quiet hours"
+		return out
+	case digested(r, routed.Severity):
+		out.Outcome = "queued for digest every " + r.DigestInterval
+		return out
+	}
+	labels = notifyLabels(r, labels)
+	out.Body = decorateBody(r, resolveBody(db, r, routed, labels, isRecovery, now), isRecovery)
+	if !isRecovery {
+		title := stripSystemAlertPrefix(alert.Title)
+		if title == "" {
+			title = "Alert"
+		}
+		out.Title = withPrefix(r.TitlePrefix, title)
+	}
+	out.Outcome = "notify"
+	return out
+}
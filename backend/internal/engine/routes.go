@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Route is one entry of Rule.Routes. Routes are evaluated in order after the rule matches; the first route
+// whose MatchLabels match (same matcher syntax as Rule.MatchLabels) sends to its channels instead of the
+// rule's, optionally with a different severity. When no route matches, the rule's channels are used.
+type Route struct {
+	MatchLabels      map[string]string `json:"match_labels"`
+	ChannelIDs       []uint            `json:"channel_ids"`
+	SeverityOverride string            `json:"severity_override,omitempty"`
+}
+
+// ParseRoutes decodes a rule's Routes JSON. Empty input yields no routes.
+func ParseRoutes(raw string) ([]Route, error) {
+	if raw == "" || raw == "[]" || raw == "null" {
+		return nil, nil
+	}
+	var routes []Route
+	if err := json.Unmarshal([]byte(raw), &routes); err != nil {
+		return nil, fmt.Errorf("invalid routes: %w", err)
+	}
+	for i, rt := range routes {
+		if len(rt.ChannelIDs) == 0 {
+			return nil, fmt.Errorf("invalid routes: route %d has no channel_ids", i)
+		}
+	}
+	return routes, nil
+}
+
+// MatchRoute returns the first route whose label matchers all match, or nil. A route without matchers
+// matches everything.
+func MatchRoute(routes []Route, labels map[string]string) *Route {
+	for i := range routes {
+		if matchAll(routes[i].MatchLabels, labels) {
+			return &routes[i]
+		}
+	}
+	return nil
+}
+
+// ParseSeverityChannels decodes a rule's SeverityChannels JSON (severity -> channel IDs). Empty input yields nil.
+func ParseSeverityChannels(raw string) (map[string][]uint, error) {
+	if raw == "" || raw == "{}" || raw == "null" {
+		return nil, nil
+	}
+	var m map[string][]uint
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return nil, fmt.Errorf("invalid severity_channels: %w", err)
+	}
+	return m, nil
+}
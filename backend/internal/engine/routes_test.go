@@ -0,0 +1,56 @@
+package engine
+
+import "testing"
+
+func TestMatchRoute(t *testing.T) {
+	routes, err := ParseRoutes(`[
+		{"match_labels":{"team":"db"},"channel_ids":[1]},
+		{"match_labels":{"env":"~prod-.*"},"channel_ids":[2,3],"severity_override":"critical"},
+		{"match_labels":{},"channel_ids":[4]}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		labels map[string]string
+		want   uint
+	}{
+		{map[string]string{"team": "db", "env": "prod-eu"}, 1}, // first match wins
+		{map[string]string{"team": "web", "env": "prod-eu"}, 2},
+		{map[string]string{"team": "web", "env": "staging"}, 4}, // catch-all route
+	}
+	for _, tc := range cases {
+		rt := MatchRoute(routes, tc.labels)
+		if rt == nil || rt.ChannelIDs[0] != tc.want {
+			t.Errorf("labels %v: got route %+v, want channel %d", tc.labels, rt, tc.want)
+		}
+	}
+	if rt := MatchRoute(routes[:2], map[string]string{"team": "web"}); rt != nil {
+		t.Errorf("expected no route (rule default), got %+v", rt)
+	}
+}
+
+func TestParseRoutesValidation(t *testing.T) {
+	if routes, err := ParseRoutes(""); err != nil || routes != nil {
+		t.Errorf("empty routes: got %v, %v", routes, err)
+	}
+	if _, err := ParseRoutes(`[{"match_labels":{"team":"db"}}]`); err == nil {
+		t.Error("expected error for route without channel_ids")
+	}
+	if _, err := ParseRoutes(`{"bad":`); err == nil {
+		t.Error("expected error for invalid json")
+	}
+}
+
+func TestParseSeverityChannels(t *testing.T) {
+	m, err := ParseSeverityChannels(`{"critical":[1,2],"warning":[3]}`)
+	if err != nil || len(m["critical"]) != 2 || m["warning"][0] != 3 || m["info"] != nil {
+		t.Errorf("got %v, %v", m, err)
+	}
+	if m, err := ParseSeverityChannels(""); err != nil || m != nil {
+		t.Errorf("empty: got %v, %v", m, err)
+	}
+	if _, err := ParseSeverityChannels(`{"critical":"1"}`); err == nil {
+		t.Error("expected error for non-array channel list")
+	}
+}
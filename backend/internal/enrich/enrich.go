@@ -0,0 +1,126 @@
+// Package enrich adds labels derived from an alert's own labels before it is notified, such as the hostname
+// behind an instance IP.
+package enrich
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver does reverse (IP -> hostname) and forward (hostname -> IP) DNS lookups. Each lookup is bounded
+// by a short timeout and its answer, including a failure, is cached, so a slow or missing DNS record costs
+// at most one timeout per TTL instead of delaying every notification.
+type Resolver struct {
+	timeout time.Duration
+	ttl     time.Duration
+
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	value string // empty when the lookup failed
+	at    time.Time
+}
+
+// maxCached bounds the cache; expired entries are dropped when it is reached.
+const maxCached = 4096
+
+// NewResolver returns a Resolver using the system resolver.
+func NewResolver(timeout, ttl time.Duration) *Resolver {
+	return &Resolver{
+		timeout:    timeout,
+		ttl:        ttl,
+		lookupAddr: net.DefaultResolver.LookupAddr,
+		lookupHost: net.DefaultResolver.LookupHost,
+		cache:      make(map[string]cached),
+	}
+}
+
+// Default is used by the engine for rules with instance resolution on.
+var Default = NewResolver(500*time.Millisecond, 10*time.Minute)
+
+// Hostname returns the name an IP reverse-resolves to (without the trailing dot), or "" when it has none.
+func (r *Resolver) Hostname(ip string) string {
+	return r.lookup("ptr:"+ip, func(ctx context.Context) string {
+		names, err := r.lookupAddr(ctx, ip)
+		if err != nil || len(names) == 0 {
+			return ""
+		}
+		return strings.TrimSuffix(names[0], ".")
+	})
+}
+
+// IP returns the first address a hostname resolves to, or "" when it does not resolve.
+func (r *Resolver) IP(host string) string {
+	return r.lookup("a:"+host, func(ctx context.Context) string {
+		addrs, err := r.lookupHost(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			return ""
+		}
+		return addrs[0]
+	})
+}
+
+func (r *Resolver) lookup(key string, resolve func(ctx context.Context) string) string {
+	now := time.Now()
+	r.mu.Lock()
+	if c, ok := r.cache[key]; ok && now.Sub(c.at) < r.ttl {
+		r.mu.Unlock()
+		return c.value
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	v := resolve(ctx)
+	cancel()
+
+	r.mu.Lock()
+	if len(r.cache) >= maxCached {
+		for k, c := range r.cache {
+			if now.Sub(c.at) >= r.ttl {
+				delete(r.cache, k)
+			}
+		}
+	}
+	r.cache[key] = cached{value: v, at: now}
+	r.mu.Unlock()
+	return v
+}
+
+// Instance returns labels with the other half of the instance label's host added: "hostname" when the
+// instance is an IP (e.g. 10.0.0.5:9100), "ip" when it is a name. Existing labels are never overwritten and
+// labels is returned unchanged when there is nothing to add or the lookup fails.
+func (r *Resolver) Instance(labels map[string]string) map[string]string {
+	host := labels["instance"]
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" {
+		return labels
+	}
+	key, value := "ip", ""
+	if net.ParseIP(host) != nil {
+		key = "hostname"
+		if labels[key] == "" {
+			value = r.Hostname(host)
+		}
+	} else if labels[key] == "" {
+		value = r.IP(host)
+	}
+	if value == "" {
+		return labels
+	}
+	out := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
@@ -0,0 +1,50 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInstance(t *testing.T) {
+	calls := 0
+	r := NewResolver(time.Second, time.Minute)
+	r.lookupAddr = func(_ context.Context, addr string) ([]string, error) {
+		calls++
+		if addr == "10.0.0.5" {
+			return []string{"web-1.example.com."}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	r.lookupHost = func(_ context.Context, host string) ([]string, error) {
+		if host == "db-1" {
+			return []string{"10.0.0.9"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	got := r.Instance(map[string]string{"instance": "10.0.0.5:9100"})
+	if got["hostname"] != "web-1.example.com" {
+		t.Errorf("reverse lookup: got %v", got)
+	}
+	r.Instance(map[string]string{"instance": "10.0.0.5:9100"})
+	if calls != 1 {
+		t.Errorf("second lookup should be cached, got %d lookups", calls)
+	}
+	if got := r.Instance(map[string]string{"instance": "db-1:5432"}); got["ip"] != "10.0.0.9" {
+		t.Errorf("forward lookup: got %v", got)
+	}
+	if got := r.Instance(map[string]string{"instance": "10.0.0.5", "hostname": "keep"}); got["hostname"] != "keep" {
+		t.Errorf("existing label overwritten: got %v", got)
+	}
+
+	in := map[string]string{"instance": "10.0.0.7:9100"}
+	if got := r.Instance(in); len(got) != 1 {
+		t.Errorf("failed lookup should add nothing, got %v", got)
+	}
+	r.Instance(in)
+	if calls != 2 {
+		t.Errorf("failed lookup should be cached too, got %d lookups", calls)
+	}
+}
@@ -3,13 +3,17 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/engine"
 	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/requestid"
 	"github.com/xuri/excelize/v2"
 	"gorm.io/gorm"
 )
@@ -22,8 +26,9 @@ type AlertHandler struct {
 // AlertListItem is an alert with notification send counts for list API.
 type AlertListItem struct {
 	models.Alert
-	NotifySuccessCount int `json:"notify_success_count"`
-	NotifyFailCount    int `json:"notify_fail_count"`
+	NotifySuccessCount int    `json:"notify_success_count"`
+	NotifyFailCount    int    `json:"notify_fail_count"`
+	AssigneeUsername   string `json:"assignee_username,omitempty"`
 }
 
 // List alerts with filters and pagination.
@@ -76,7 +81,7 @@ func (h *AlertHandler) List(c *gin.Context) {
 		}
 		h.DB.Model(&models.AlertSendRecord{}).
 			Select("alert_id, success, count(*) as count").
-			Where("alert_id in ?", ids).
+			Where("alert_id in ? AND skipped = ?", ids, false).
 			Group("alert_id, success").
 			Scan(&recs)
 		for _, r := range recs {
@@ -90,14 +95,19 @@ func (h *AlertHandler) List(c *gin.Context) {
 		}
 	}
 
+	assignees := assigneeUsernames(h.DB, list)
 	items := make([]AlertListItem, 0, len(list))
 	for _, a := range list {
 		c := notifyCounts[a.ID]
-		items = append(items, AlertListItem{
+		item := AlertListItem{
 			Alert:              a,
 			NotifySuccessCount: c.Success,
 			NotifyFailCount:    c.Fail,
-		})
+		}
+		if a.AssignedTo != nil {
+			item.AssigneeUsername = assignees[*a.AssignedTo]
+		}
+		items = append(items, item)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -108,10 +118,10 @@ func (h *AlertHandler) List(c *gin.Context) {
 	})
 }
 
-// NotifyTotal returns total count of notification send records (all channels, success + fail).
+// NotifyTotal returns total count of notification send records (all channels, success + fail; skipped duplicates excluded).
 func (h *AlertHandler) NotifyTotal(c *gin.Context) {
 	var n int64
-	if err := h.DB.Model(&models.AlertSendRecord{}).Count(&n).Error; err != nil {
+	if err := h.DB.Model(&models.AlertSendRecord{}).Where("skipped = ?", false).Count(&n).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -147,6 +157,10 @@ func (h *AlertHandler) Export(c *gin.Context) {
 
 // applyAlertFilters applies common alert query filters from request params.
 func applyAlertFilters(q *gorm.DB, c *gin.Context) *gorm.DB {
+	q = scopeTeam(q, c)
+	if team := c.Query("team_id"); team != "" {
+		q = q.Where("team_id = ?", team)
+	}
 	if id := c.Query("alert_id"); id != "" {
 		q = q.Where("id LIKE ?", "%"+strings.TrimSpace(id)+"%")
 	}
@@ -156,12 +170,26 @@ func applyAlertFilters(q *gorm.DB, c *gin.Context) *gorm.DB {
 	if ds := c.Query("datasource_id"); ds != "" {
 		q = q.Where("source_id = ?", ds)
 	}
+	if rid := c.Query("rule_id"); rid != "" {
+		q = q.Where("rule_id = ?", rid)
+	}
 	if sev := c.Query("severity"); sev != "" {
 		q = q.Where("severity = ?", sev)
 	}
 	if st := c.Query("status"); st != "" {
 		q = q.Where("status = ?", st)
 	}
+	// assigned_to: "me" (current user), "none" (unassigned) or a user ID
+	switch at := c.Query("assigned_to"); at {
+	case "":
+	case "me":
+		uid, _ := c.Get("user_id")
+		q = q.Where("assigned_to = ?", uid)
+	case "none":
+		q = q.Where("assigned_to IS NULL")
+	default:
+		q = q.Where("assigned_to = ?", at)
+	}
 	return q
 }
 
@@ -172,7 +200,7 @@ func writeAlertExportExcel(list []models.Alert) (*excelize.File, error) {
 	idx, _ := f.NewSheet(sheet)
 	f.DeleteSheet("Sheet1")
 
-	headers := []string{"告警ID", "数据源ID", "数据源类型", "标题", "告警值", "严重程度", "状态", "标签", "告警时间", "恢复时间", "影响时长", "创建时间"}
+	headers := []string{"告警ID", "数据源ID", "数据源类型", "标题", "告警值", "严重程度", "状态", "标签", "告警时间", "恢复时间", "影响时长", "创建时间", "规则ID"}
 	for i, h := range headers {
 		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
 		_ = f.SetCellValue(sheet, cell, h)
@@ -271,6 +299,7 @@ func writeAlertExportExcel(list []models.Alert) (*excelize.File, error) {
 		_ = f.SetCellValue(sheet, fmt.Sprintf("J%d", r), resolvedAt)
 		_ = f.SetCellValue(sheet, fmt.Sprintf("K%d", r), fmtDuration(a))
 		_ = f.SetCellValue(sheet, fmt.Sprintf("L%d", r), fmtTime(a.CreatedAt))
+		_ = f.SetCellValue(sheet, fmt.Sprintf("M%d", r), a.RuleID)
 	}
 
 	f.SetColWidth(sheet, "A", "A", 38)
@@ -293,14 +322,132 @@ func writeAlertExportExcel(list []models.Alert) (*excelize.File, error) {
 func (h *AlertHandler) Get(c *gin.Context) {
 	id := c.Param("id")
 	var a models.Alert
-	if err := h.DB.First(&a, "id = ?", id).Error; err != nil {
+	if err := scopeTeam(h.DB, c).First(&a, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
 	var records []models.AlertSendRecord
 	h.DB.Where("alert_id = ?", id).Find(&records)
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"alert":  a,
 		"sends":  records,
-	})
+	}
+	if a.AssignedTo != nil {
+		resp["assignee_username"] = assigneeUsernames(h.DB, []models.Alert{a})[*a.AssignedTo]
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Replay runs a stored alert through the current rules (POST /api/v1/alerts/:id/replay, admin) and returns
+// each rule's verdict without sending anything. With ?send=true the alert is also processed for real, so
+// the notifications the verdicts show are sent (subject to send intervals and dedup as usual).
+func (h *AlertHandler) Replay(c *gin.Context) {
+	var a models.Alert
+	if err := h.DB.First(&a, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	res := engine.Replay(h.DB, &a)
+	send := c.Query("send") == "true"
+	if send {
+		engine.ProcessAlertWithID(h.DB, &a, requestid.Get(c))
+	}
+	c.JSON(http.StatusOK, gin.H{"replay": res, "sent": send})
+}
+
+// AssignRequest body for POST /api/v1/alerts/:id/assign. A null or omitted user_id unassigns.
+type AssignRequest struct {
+	UserID *uint `json:"user_id"`
+}
+
+// Assign sets or clears the user handling an alert.
+func (h *AlertHandler) Assign(c *gin.Context) {
+	var a models.Alert
+	if err := scopeTeam(h.DB, c).First(&a, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var req AssignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username := ""
+	if req.UserID != nil {
+		var u models.User
+		if err := h.DB.First(&u, *req.UserID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
+			return
+		}
+		username = u.Username
+	}
+	if err := h.DB.Model(&a).Update("assigned_to", req.UserID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alert_id": a.ID, "assigned_to": req.UserID, "assignee_username": username})
+}
+
+// ResolveRequest is the optional body for manually resolving an alert.
+type ResolveRequest struct {
+	Reason string `json:"reason"` // e.g. "false positive"; stored as the resolution_reason annotation, {{.ResolutionReason}} in templates
+}
+
+// Resolve marks a firing alert resolved by hand and sends recovery notifications for rules with recovery_notify.
+func (h *AlertHandler) Resolve(c *gin.Context) {
+	var a models.Alert
+	if err := scopeTeam(h.DB, c).First(&a, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if a.Status != "firing" {
+		c.JSON(http.StatusConflict, gin.H{"error": "alert is not firing"})
+		return
+	}
+	var req ResolveRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var ann map[string]string
+	_ = json.Unmarshal([]byte(a.Annotations), &ann)
+	if ann == nil {
+		ann = make(map[string]string)
+	}
+	ann["resolved_by"] = actingUsername(c)
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		ann["resolution_reason"] = reason
+	}
+	annJSON, _ := json.Marshal(ann)
+	now := time.Now()
+	a.Status = "resolved"
+	a.ResolvedAt = &now
+	a.Annotations = string(annJSON)
+	if err := h.DB.Save(&a).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	engine.ClearSnooze(h.DB, a.ID)
+	engine.ProcessAlertAsync(h.DB, &a, requestid.Get(c))
+	c.JSON(http.StatusOK, a)
+}
+
+// assigneeUsernames maps the assignee IDs of alerts to usernames in one query.
+func assigneeUsernames(db *gorm.DB, alerts []models.Alert) map[uint]string {
+	out := make(map[uint]string)
+	var ids []uint
+	for _, a := range alerts {
+		if a.AssignedTo != nil {
+			ids = append(ids, *a.AssignedTo)
+		}
+	}
+	if len(ids) == 0 {
+		return out
+	}
+	var users []models.User
+	db.Select("id, username").Where("id IN ?", ids).Find(&users)
+	for _, u := range users {
+		out[u.ID] = u.Username
+	}
+	return out
 }
@@ -2,6 +2,9 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kk-alert/backend/internal/auth"
@@ -37,24 +40,55 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
+	// Throttle brute-forcing per client IP and per username
+	limitKeys := []string{"ip:" + c.ClientIP(), "user:" + strings.ToLower(req.Username)}
+	if wait := loginLimit.blocked(limitKeys...); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts, try again later"})
+		return
+	}
+	if ldapConf.enabled() && h.ldapLogin(c, req, limitKeys) {
+		return
+	}
 	var user struct {
-		ID           uint
-		Username     string
-		PasswordHash string
-		Role         string
+		ID               uint
+		Username         string
+		PasswordHash     string
+		Role             string
+		FailedLoginCount int
+		LockedUntil      *time.Time
 	}
 	if err := h.DB.Table("users").Where("username = ?", req.Username).First(&user).Error; err != nil {
+		loginLimit.fail(limitKeys...)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 	if user.Role == "" {
 		user.Role = "user"
 	}
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		respondLocked(c, *user.LockedUntil)
+		return
+	}
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		loginLimit.fail(limitKeys...)
+		if lockedUntil := recordFailedLogin(h.DB, user.ID); !lockedUntil.IsZero() {
+			respondLocked(c, lockedUntil)
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
-	token, err := auth.IssueToken(user.ID, user.Username, user.Role)
+	loginLimit.reset(limitKeys...)
+	if user.FailedLoginCount > 0 || user.LockedUntil != nil {
+		h.DB.Table("users").Where("id = ?", user.ID).Updates(map[string]interface{}{"failed_login_count": 0, "locked_until": nil})
+	}
+	respondLogin(c, user.ID, user.Username, user.Role)
+}
+
+// respondLogin issues a JWT and writes the LoginResponse.
+func respondLogin(c *gin.Context, id uint, username, role string) {
+	token, err := auth.IssueToken(id, username, role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue token"})
 		return
@@ -65,10 +99,56 @@ func (h *AuthHandler) Login(c *gin.Context) {
 			ID       uint   `json:"id"`
 			Username string `json:"username"`
 			Role     string `json:"role"`
-		}{ID: user.ID, Username: user.Username, Role: user.Role},
+		}{ID: id, Username: username, Role: role},
 	})
 }
 
+// Account lockout: after lockoutThreshold consecutive bad passwords (LOGIN_LOCKOUT_THRESHOLD, default 5) the
+// account is locked for lockoutBase (LOGIN_LOCKOUT_DURATION, default 15m), doubling for every further failure
+// after the lock expires, up to 24h.
+var (
+	lockoutThreshold = envInt("LOGIN_LOCKOUT_THRESHOLD", 5)
+	lockoutBase      = envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+)
+
+const maxLockout = 24 * time.Hour
+
+// lockoutDuration returns how long to lock after the given number of consecutive failures (>= lockoutThreshold).
+func lockoutDuration(failures int) time.Duration {
+	d := lockoutBase
+	for i := lockoutThreshold; i < failures && d < maxLockout; i++ {
+		d *= 2
+	}
+	if d > maxLockout {
+		d = maxLockout
+	}
+	return d
+}
+
+// recordFailedLogin counts a bad password for the user and locks the account once the count reaches
+// lockoutThreshold, returning the lock's end (zero when not locked). The counter is incremented in SQL so
+// concurrent attempts are all counted.
+func recordFailedLogin(db *gorm.DB, userID uint) time.Time {
+	if err := db.Table("users").Where("id = ?", userID).UpdateColumn("failed_login_count", gorm.Expr("failed_login_count + 1")).Error; err != nil {
+		return time.Time{}
+	}
+	var count int
+	if err := db.Table("users").Where("id = ?", userID).Select("failed_login_count").Scan(&count).Error; err != nil {
+		return time.Time{}
+	}
+	if count < lockoutThreshold {
+		return time.Time{}
+	}
+	lockedUntil := time.Now().Add(lockoutDuration(count))
+	db.Table("users").Where("id = ?", userID).UpdateColumn("locked_until", lockedUntil)
+	return lockedUntil
+}
+
+// respondLocked refuses a login to a locked account.
+func respondLocked(c *gin.Context, until time.Time) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "account locked", "locked_until": until.Format(time.RFC3339)})
+}
+
 // Logout is handled client-side (discard token). Optional: blacklist token if needed.
 func (h *AuthHandler) Logout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true})
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newAuthTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	db.Create(&models.User{Username: "alice", PasswordHash: string(hash), Role: "user"})
+	// Keep the IP/username rate limiter out of the way of lockout tests.
+	loginLimit = newLoginLimiter(1000, time.Minute)
+	return db
+}
+
+func login(h *AuthHandler, password string) int {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"username":"alice","password":"`+password+`"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.Login(c)
+	return w.Code
+}
+
+func TestLoginLocksAccountAfterThreshold(t *testing.T) {
+	db := newAuthTestDB(t)
+	h := &AuthHandler{DB: db}
+
+	for i := 1; i < lockoutThreshold; i++ {
+		if code := login(h, "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got %d, want 401", i, code)
+		}
+	}
+	if code := login(h, "wrong"); code != http.StatusForbidden {
+		t.Fatalf("threshold attempt: got %d, want 403", code)
+	}
+	// Correct password is refused while locked
+	if code := login(h, "secret"); code != http.StatusForbidden {
+		t.Fatalf("login while locked: got %d, want 403", code)
+	}
+	var u models.User
+	db.First(&u, "username = ?", "alice")
+	if u.LockedUntil == nil || !u.LockedUntil.After(time.Now()) {
+		t.Fatalf("expected locked_until in the future, got %v", u.LockedUntil)
+	}
+}
+
+func TestLoginAutoUnlocksAfterExpiry(t *testing.T) {
+	db := newAuthTestDB(t)
+	h := &AuthHandler{DB: db}
+	past := time.Now().Add(-time.Minute)
+	db.Model(&models.User{}).Where("username = ?", "alice").Updates(map[string]interface{}{"failed_login_count": lockoutThreshold, "locked_until": past})
+
+	if code := login(h, "secret"); code != http.StatusOK {
+		t.Fatalf("login after lock expiry: got %d, want 200", code)
+	}
+	var u models.User
+	db.First(&u, "username = ?", "alice")
+	if u.FailedLoginCount != 0 || u.LockedUntil != nil {
+		t.Errorf("expected lockout state reset, got count=%d locked_until=%v", u.FailedLoginCount, u.LockedUntil)
+	}
+}
+
+func TestLockedAccountReply(t *testing.T) {
+	db := newAuthTestDB(t)
+	h := &AuthHandler{DB: db}
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+	db.Model(&models.User{}).Where("username = ?", "alice").Updates(map[string]interface{}{"failed_login_count": lockoutThreshold, "locked_until": future})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"username":"alice","password":"secret"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.Login(c)
+	var resp map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusForbidden || resp["error"] != "account locked" || resp["locked_until"] != future.Format(time.RFC3339) {
+		t.Errorf("got %d %s, want 403 account locked until %s", w.Code, w.Body.String(), future.Format(time.RFC3339))
+	}
+}
+
+func TestRecordFailedLoginLocksAtThreshold(t *testing.T) {
+	db := newAuthTestDB(t)
+	var u models.User
+	db.First(&u, "username = ?", "alice")
+	for i := 0; i < lockoutThreshold; i++ {
+		recordFailedLogin(db, u.ID)
+	}
+	db.First(&u, u.ID)
+	if u.FailedLoginCount != lockoutThreshold || u.LockedUntil == nil || !u.LockedUntil.After(time.Now()) {
+		t.Errorf("after %d failures: count=%d locked_until=%v", lockoutThreshold, u.FailedLoginCount, u.LockedUntil)
+	}
+}
+
+func TestLockoutDurationGrows(t *testing.T) {
+	first := lockoutDuration(lockoutThreshold)
+	second := lockoutDuration(lockoutThreshold + 1)
+	if second != 2*first {
+		t.Errorf("expected doubling, got %v then %v", first, second)
+	}
+	if d := lockoutDuration(lockoutThreshold + 100); d != maxLockout {
+		t.Errorf("expected cap %v, got %v", maxLockout, d)
+	}
+}
+
+func TestLDAPLoginSharesLockout(t *testing.T) {
+	db := newAuthTestDB(t)
+	h := &AuthHandler{DB: db}
+	origConf, origAuth := ldapConf, ldapAuthenticate
+	t.Cleanup(func() { ldapConf, ldapAuthenticate = origConf, origAuth })
+	ldapConf.URL = "ldap://directory.invalid"
+	calls := 0
+	ldapAuthenticate = func(username, password string) (*ldapIdentity, error) {
+		calls++
+		if password != "secret" {
+			return nil, errors.New("invalid credentials")
+		}
+		return &ldapIdentity{}, nil
+	}
+
+	for i := 1; i < lockoutThreshold; i++ {
+		if code := login(h, "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got %d, want 401", i, code)
+		}
+	}
+	if code := login(h, "wrong"); code != http.StatusForbidden {
+		t.Fatalf("threshold attempt: got %d, want 403", code)
+	}
+	// Locked: the directory is not asked and the right password is refused.
+	if code := login(h, "secret"); code != http.StatusForbidden || calls != lockoutThreshold {
+		t.Fatalf("login while locked: got %d after %d directory calls", code, calls)
+	}
+	db.Model(&models.User{}).Where("username = ?", "alice").Update("locked_until", time.Now().Add(-time.Minute))
+	if code := login(h, "secret"); code != http.StatusOK {
+		t.Fatalf("login after lock expiry: got %d, want 200", code)
+	}
+	var u models.User
+	db.First(&u, "username = ?", "alice")
+	if u.FailedLoginCount != 0 || u.LockedUntil != nil {
+		t.Errorf("expected lockout state reset, got count=%d locked_until=%v", u.FailedLoginCount, u.LockedUntil)
+	}
+}
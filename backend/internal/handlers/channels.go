@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kk-alert/backend/internal/models"
@@ -25,13 +29,18 @@ func (h *ChannelHandler) List(c *gin.Context) {
 	// Don't send Config (secrets) in list
 	out := make([]map[string]interface{}, len(list))
 	for i := range list {
+		state, failures := sender.BreakerState(list[i].Type, list[i].Config)
 		out[i] = map[string]interface{}{
-			"id":         list[i].ID,
-			"name":       list[i].Name,
-			"type":       list[i].Type,
-			"enabled":    list[i].Enabled,
-			"created_at": list[i].CreatedAt,
-			"updated_at": list[i].UpdatedAt,
+			"id":                   list[i].ID,
+			"name":                 list[i].Name,
+			"type":                 list[i].Type,
+			"enabled":              list[i].Enabled,
+			"rate_limit":           list[i].RateLimit,
+			"team_id":              list[i].TeamID,
+			"created_at":           list[i].CreatedAt,
+			"updated_at":           list[i].UpdatedAt,
+			"circuit_state":        state,
+			"consecutive_failures": failures,
 		}
 	}
 	c.JSON(http.StatusOK, out)
@@ -49,6 +58,8 @@ func (h *ChannelHandler) Get(c *gin.Context) {
 		"name":       ch.Name,
 		"type":       ch.Type,
 		"enabled":    ch.Enabled,
+		"rate_limit": ch.RateLimit,
+		"team_id":    ch.TeamID,
 		"created_at": ch.CreatedAt,
 		"updated_at": ch.UpdatedAt,
 		"config_set": ch.Config != "",
@@ -58,21 +69,35 @@ func (h *ChannelHandler) Get(c *gin.Context) {
 // Create channel.
 func (h *ChannelHandler) Create(c *gin.Context) {
 	var body struct {
-		Name    string `json:"name" binding:"required"`
-		Type    string `json:"type" binding:"required"`
-		Config  string `json:"config"`
-		Enabled bool   `json:"enabled"`
+		Name      string `json:"name" binding:"required"`
+		Type      string `json:"type" binding:"required"`
+		Config    string `json:"config"`
+		Enabled   bool   `json:"enabled"`
+		RateLimit int    `json:"rate_limit"` // messages per minute; 0 = unlimited
+		TeamID    *uint  `json:"team_id"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	ch := models.Channel{Name: body.Name, Type: body.Type, Config: body.Config, Enabled: body.Enabled}
+	if body.RateLimit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rate_limit must be >= 0"})
+		return
+	}
+	if err := sender.ValidateConfig(body.Type, body.Config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkTeam(h.DB, body.TeamID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ch := models.Channel{Name: body.Name, Type: body.Type, Config: body.Config, Enabled: body.Enabled, RateLimit: body.RateLimit, TeamID: body.TeamID}
 	if err := h.DB.Create(&ch).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"id": ch.ID, "name": ch.Name, "type": ch.Type, "enabled": ch.Enabled})
+	c.JSON(http.StatusCreated, gin.H{"id": ch.ID, "name": ch.Name, "type": ch.Type, "enabled": ch.Enabled, "rate_limit": ch.RateLimit, "team_id": ch.TeamID})
 }
 
 // Update channel.
@@ -83,10 +108,12 @@ func (h *ChannelHandler) Update(c *gin.Context) {
 		return
 	}
 	var body struct {
-		Name    *string `json:"name"`
-		Type    *string `json:"type"`
-		Config  *string `json:"config"`
-		Enabled *bool   `json:"enabled"`
+		Name      *string `json:"name"`
+		Type      *string `json:"type"`
+		Config    *string `json:"config"`
+		Enabled   *bool   `json:"enabled"`
+		RateLimit *int    `json:"rate_limit"`
+		TeamID    *uint   `json:"team_id"` // 0 clears the team
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -104,11 +131,32 @@ func (h *ChannelHandler) Update(c *gin.Context) {
 	if body.Enabled != nil {
 		ch.Enabled = *body.Enabled
 	}
+	if body.RateLimit != nil {
+		if *body.RateLimit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rate_limit must be >= 0"})
+			return
+		}
+		ch.RateLimit = *body.RateLimit
+	}
+	if body.TeamID != nil {
+		ch.TeamID = body.TeamID
+		if *body.TeamID == 0 {
+			ch.TeamID = nil
+		}
+		if err := checkTeam(h.DB, ch.TeamID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := sender.ValidateConfig(ch.Type, ch.Config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err := h.DB.Save(&ch).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"id": ch.ID, "name": ch.Name, "type": ch.Type, "enabled": ch.Enabled})
+	c.JSON(http.StatusOK, gin.H{"id": ch.ID, "name": ch.Name, "type": ch.Type, "enabled": ch.Enabled, "rate_limit": ch.RateLimit, "team_id": ch.TeamID})
 }
 
 // Delete channel.
@@ -120,7 +168,127 @@ func (h *ChannelHandler) Delete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
-// TestSend sends a test message via the channel (Telegram/Lark).
+// A channel is reported as degraded when at least degradedMinSends sends in the rolling window include a
+// failure rate of degradedFailureRate or more.
+const (
+	degradedMinSends    = 5
+	degradedFailureRate = 0.2
+)
+
+// channelSendCounts counts a channel's successful and failed sends in [from, to] in one aggregate query.
+// Skipped duplicates are not counted.
+func channelSendCounts(db *gorm.DB, chID uint, from, to time.Time) (sent, failed int64, err error) {
+	var rows []struct {
+		Success bool
+		Count   int64
+	}
+	err = db.Model(&models.AlertSendRecord{}).
+		Select("success, count(*) as count").
+		Where("channel_id = ? AND created_at >= ? AND created_at <= ? AND skipped = ?", chID, from, to, false).
+		Group("success").
+		Scan(&rows).Error
+	for _, r := range rows {
+		if r.Success {
+			sent += r.Count
+		} else {
+			failed += r.Count
+		}
+	}
+	return sent, failed, err
+}
+
+// sendRate returns n/total, or nil when there were no sends.
+func sendRate(n, total int64) *float64 {
+	if total == 0 {
+		return nil
+	}
+	r := float64(n) / float64(total)
+	return &r
+}
+
+// Stats returns the channel's delivery counts and success rate over ?from= to ?to= (RFC3339, default the
+// last 24h), plus the failure rate over the rolling ?window= (Go duration, default 1h) ending now.
+func (h *ChannelHandler) Stats(c *gin.Context) {
+	var ch models.Channel
+	if err := h.DB.First(&ch, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	now := time.Now()
+	to, from := now, now.Add(-24*time.Hour)
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be RFC3339"})
+			return
+		}
+		to = t
+		if c.Query("from") == "" {
+			from = to.Add(-24 * time.Hour)
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be RFC3339"})
+			return
+		}
+		from = t
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return
+	}
+	window := time.Hour
+	if v := c.Query("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a positive duration, e.g. 1h"})
+			return
+		}
+		window = d
+	}
+
+	sent, failed, err := channelSendCounts(h.DB, ch.ID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recentSent, recentFailed, err := channelSendCounts(h.DB, ch.ID, now.Add(-window), now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recentTotal := recentSent + recentFailed
+	failureRate := sendRate(recentFailed, recentTotal)
+	c.JSON(http.StatusOK, gin.H{
+		"channel_id":   ch.ID,
+		"from":         from,
+		"to":           to,
+		"sent":         sent,
+		"failed":       failed,
+		"total":        sent + failed,
+		"success_rate": sendRate(sent, sent+failed),
+		"rolling": gin.H{
+			"window":       window.String(),
+			"sent":         recentSent,
+			"failed":       recentFailed,
+			"failure_rate": failureRate,
+		},
+		"degraded": recentTotal >= degradedMinSends && *failureRate >= degradedFailureRate,
+	})
+}
+
+// TestSendRequest is the optional body for POST /channels/:id/test. With template_id set, the template is
+// rendered over sample alert data (plus labels) and sent instead of the fixed test message.
+type TestSendRequest struct {
+	TemplateID uint              `json:"template_id"`
+	Labels     map[string]string `json:"labels"`
+	Severity   string            `json:"severity"`
+	IsRecovery bool              `json:"is_recovery"`
+}
+
+// TestSend sends a test message via the channel (Telegram/Lark), or a sample rendering of a template.
 func (h *ChannelHandler) TestSend(c *gin.Context) {
 	var ch models.Channel
 	if err := h.DB.First(&ch, c.Param("id")).Error; err != nil {
@@ -128,9 +296,37 @@ func (h *ChannelHandler) TestSend(c *gin.Context) {
 		return
 	}
 
-	log.Printf("[channel test] sending test message to channel %d (type=%s, config_set=%v)", ch.ID, ch.Type, ch.Config != "")
+	msg := sender.Message{Title: "KK Alert – 测试", Body: "这是一条来自 KK Alert 的测试消息。"}
+	var req TestSendRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TemplateID != 0 {
+		var t models.Template
+		if err := h.DB.First(&t, req.TemplateID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "模板不存在"})
+			return
+		}
+		data := sampleTemplateData(req.Labels)
+		if req.Severity != "" {
+			data.Severity = req.Severity
+		}
+		data.IsRecovery = req.IsRecovery
+		if req.IsRecovery {
+			data.ResolvedAt = data.StartAt
+		}
+		body, err := sender.RenderTemplate(t.Body, data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "template render failed: " + err.Error()})
+			return
+		}
+		msg = sender.Message{Title: data.Title, Body: body, IsRecovery: req.IsRecovery, Severity: data.Severity}
+	}
+
+	log.Printf("[channel test] sending test message to channel %d (type=%s, config_set=%v, template=%d)", ch.ID, ch.Type, ch.Config != "", req.TemplateID)
 
-	if err := sender.Send(ch.Type, ch.Config, "KK Alert – 测试", "这是一条来自 KK Alert 的测试消息。", false); err != nil {
+	if err := sender.Send(ch.Type, ch.Config, msg); err != nil {
 		log.Printf("[channel test] failed to send test message to channel %d: %v", ch.ID, err)
 		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "测试发送失败：" + err.Error()})
 		return
@@ -139,3 +335,123 @@ func (h *ChannelHandler) TestSend(c *gin.Context) {
 	log.Printf("[channel test] test message sent successfully to channel %d", ch.ID)
 	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "测试消息已发送成功"})
 }
+
+// channelExport is the export shape of a channel. Config is exported without its credential keys (see
+// channelSecretKeys); they must be supplied again when importing in add mode.
+type channelExport struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	TeamID    *uint  `json:"team_id,omitempty"`
+	Enabled   bool   `json:"enabled"`
+	RateLimit int    `json:"rate_limit"`
+	Config    string `json:"config,omitempty"`
+}
+
+// channelSecretKeys are the config keys holding credentials (bot tokens, webhook URLs with embedded keys).
+var channelSecretKeys = []string{"token", "bot_token", "webhook_url", "auth_token", "secret", "password"}
+
+// redactChannelConfig returns config without its credential keys, or "" when it is not a JSON object.
+func redactChannelConfig(config string) string {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(config), &m); err != nil || m == nil {
+		return ""
+	}
+	for _, k := range channelSecretKeys {
+		delete(m, k)
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// mergeChannelConfig overlays the keys of in onto existing, so an imported redacted config keeps the
+// credentials already stored for the channel.
+func mergeChannelConfig(existing, in string) (string, error) {
+	var base, over map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(in), &over); err != nil {
+		return "", errors.New("invalid config JSON: " + err.Error())
+	}
+	if json.Unmarshal([]byte(existing), &base) != nil || base == nil {
+		return in, nil
+	}
+	for k, v := range over {
+		base[k] = v
+	}
+	b, _ := json.Marshal(base)
+	return string(b), nil
+}
+
+// Export returns selected channels (all when ids is empty) with their config redacted.
+func (h *ChannelHandler) Export(c *gin.Context) {
+	var body ExportBody
+	_ = c.ShouldBindJSON(&body)
+	var list []models.Channel
+	q := h.DB.Model(&models.Channel{})
+	if len(body.IDs) > 0 {
+		q = q.Where("id IN ?", body.IDs)
+	}
+	if err := q.Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	out := make([]channelExport, 0, len(list))
+	for _, ch := range list {
+		out = append(out, channelExport{Name: ch.Name, Type: ch.Type, TeamID: ch.TeamID, Enabled: ch.Enabled,
+			RateLimit: ch.RateLimit, Config: redactChannelConfig(ch.Config)})
+	}
+	c.JSON(http.StatusOK, gin.H{"channels": out})
+}
+
+// ChannelImportRequest for channel import. Mode add creates every channel; overwrite updates the channel
+// with the same name (keeping the config keys, such as credentials, that are not given) and creates the rest.
+type ChannelImportRequest struct {
+	Channels []channelExport `json:"channels" binding:"required"`
+	Mode     string          `json:"mode"` // add, overwrite
+}
+
+// Import creates or updates channels from an export.
+func (h *ChannelHandler) Import(c *gin.Context) {
+	var req ChannelImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "add"
+	}
+	if req.Mode != "add" && req.Mode != "overwrite" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be add or overwrite"})
+		return
+	}
+	var imported, failed int
+	errs := []string{}
+	for _, in := range req.Channels {
+		var ch models.Channel
+		if req.Mode == "overwrite" {
+			h.DB.Where("name = ?", in.Name).Limit(1).Find(&ch)
+		}
+		ch.Name, ch.Type, ch.TeamID, ch.Enabled, ch.RateLimit = in.Name, in.Type, in.TeamID, in.Enabled, in.RateLimit
+		var err error
+		if in.Config != "" {
+			ch.Config, err = mergeChannelConfig(ch.Config, in.Config)
+		}
+		if err == nil {
+			err = sender.ValidateConfig(ch.Type, ch.Config)
+		}
+		if err == nil && (in.Name == "" || in.RateLimit < 0) {
+			err = errors.New("name is required and rate_limit must be >= 0")
+		}
+		if err == nil {
+			err = checkTeam(h.DB, ch.TeamID)
+		}
+		if err == nil {
+			err = h.DB.Save(&ch).Error
+		}
+		if err != nil {
+			failed++
+			errs = append(errs, in.Name+": "+err.Error())
+			continue
+		}
+		imported++
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": imported, "failed": failed, "errors": errs})
+}
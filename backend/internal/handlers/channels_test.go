@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestChannelStats(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.AlertSendRecord{}, &models.Channel{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Channel{ID: 1, Name: "ops-lark", Type: "lark"})
+	now := time.Now()
+	// Earlier today: 4 delivered. Last hour: 2 delivered, 3 rejected, 1 skipped duplicate.
+	for i := 0; i < 4; i++ {
+		db.Create(&models.AlertSendRecord{AlertID: "a", ChannelID: 1, Success: true, CreatedAt: now.Add(-5 * time.Hour)})
+	}
+	for i := 0; i < 2; i++ {
+		db.Create(&models.AlertSendRecord{AlertID: "a", ChannelID: 1, Success: true, CreatedAt: now.Add(-10 * time.Minute)})
+	}
+	for i := 0; i < 3; i++ {
+		db.Create(&models.AlertSendRecord{AlertID: "a", ChannelID: 1, Success: false, CreatedAt: now.Add(-5 * time.Minute)})
+	}
+	db.Create(&models.AlertSendRecord{AlertID: "a", ChannelID: 1, Success: true, Skipped: true, CreatedAt: now.Add(-time.Minute)})
+	db.Create(&models.AlertSendRecord{AlertID: "a", ChannelID: 2, Success: false, CreatedAt: now.Add(-time.Minute)})
+	h := &ChannelHandler{DB: db}
+
+	stats := func(id, query string) (int, map[string]interface{}) {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/channels/"+id+"/stats?"+query, nil)
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		h.Stats(c)
+		var resp map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := stats("1", "")
+	if code != http.StatusOK {
+		t.Fatalf("got %d: %v", code, resp)
+	}
+	if resp["sent"] != 6.0 || resp["failed"] != 3.0 || resp["success_rate"] != 6.0/9.0 {
+		t.Errorf("last 24h: got sent=%v failed=%v success_rate=%v", resp["sent"], resp["failed"], resp["success_rate"])
+	}
+	rolling := resp["rolling"].(map[string]interface{})
+	if rolling["failure_rate"] != 0.6 || resp["degraded"] != true {
+		t.Errorf("rolling: got %v degraded=%v, want failure_rate 0.6 and degraded", rolling, resp["degraded"])
+	}
+
+	from := now.Add(-6 * time.Hour).UTC().Format(time.RFC3339)
+	to := now.Add(-4 * time.Hour).UTC().Format(time.RFC3339)
+	if _, resp := stats("1", "from="+from+"&to="+to); resp["sent"] != 4.0 || resp["failed"] != 0.0 {
+		t.Errorf("range: got sent=%v failed=%v", resp["sent"], resp["failed"])
+	}
+	if code, _ := stats("1", "window=bogus"); code != http.StatusBadRequest {
+		t.Errorf("invalid window: got %d, want 400", code)
+	}
+	if code, _ := stats("9", ""); code != http.StatusNotFound {
+		t.Errorf("unknown channel: got %d, want 404", code)
+	}
+}
+
+func TestChannelExportImportRoundTrip(t *testing.T) {
+	db := newDatasourceTestDB(t)
+	if err := db.AutoMigrate(&models.Channel{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Team{ID: 1, Name: "dba"})
+	team := uint(1)
+	db.Create(&models.Channel{Name: "tg", Type: "telegram", TeamID: &team, Enabled: true, RateLimit: 10,
+		Config: `{"token":"123:s3cret","chat_id":"-100","parse_mode":"HTML"}`})
+	h := &ChannelHandler{DB: db}
+
+	w := postJSON(h.Export, `{}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "s3cret") {
+		t.Fatalf("export must carry no credentials: %d %s", w.Code, w.Body.String())
+	}
+	var exported struct {
+		Channels []channelExport `json:"channels"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &exported); err != nil || len(exported.Channels) != 1 {
+		t.Fatalf("export: %v %s", err, w.Body.String())
+	}
+	ex := exported.Channels[0]
+	if ex.TeamID == nil || *ex.TeamID != 1 || !strings.Contains(ex.Config, `"chat_id":"-100"`) {
+		t.Fatalf("export should keep team_id and non-secret config: %+v", ex)
+	}
+
+	// Overwrite applies the exported config over the stored one and keeps the token.
+	ex.Config = strings.Replace(ex.Config, "-100", "-200", 1)
+	req, _ := json.Marshal(ChannelImportRequest{Mode: "overwrite", Channels: []channelExport{ex}})
+	if w := postJSON(h.Import, string(req)); !strings.Contains(w.Body.String(), `"imported":1`) {
+		t.Fatalf("overwrite import: %s", w.Body.String())
+	}
+	var ch models.Channel
+	db.First(&ch)
+	if !strings.Contains(ch.Config, `"token":"123:s3cret"`) || !strings.Contains(ch.Config, `"chat_id":"-200"`) ||
+		ch.TeamID == nil || *ch.TeamID != 1 {
+		t.Fatalf("after overwrite: %+v", ch)
+	}
+
+	// Add needs the credentials back: the redacted config alone fails validation.
+	copied := ex
+	copied.Name = "tg-copy"
+	withToken := copied
+	withToken.Name = "tg-token"
+	withToken.Config = strings.Replace(ex.Config, "{", `{"token":"456:other",`, 1)
+	req, _ = json.Marshal(ChannelImportRequest{Channels: []channelExport{copied, withToken}})
+	w = postJSON(h.Import, string(req))
+	if !strings.Contains(w.Body.String(), `"imported":1`) || !strings.Contains(w.Body.String(), "tg-copy: ") {
+		t.Fatalf("add import: %s", w.Body.String())
+	}
+	var n int64
+	db.Model(&models.Channel{}).Count(&n)
+	if n != 2 {
+		t.Errorf("expected 2 channels after add, got %d", n)
+	}
+}
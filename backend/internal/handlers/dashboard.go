@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/engine"
 	"github.com/kk-alert/backend/internal/models"
 	"gorm.io/gorm"
 )
@@ -14,23 +16,45 @@ type DashboardHandler struct {
 }
 
 // Stats returns counts for dashboard cards: alertTotal, firing, rules, datasources, channels, templates.
+// maintenance_mode is true while notifications are globally paused.
+// by_severity breaks down currently firing alerts by severity; resolved_today counts alerts resolved since local midnight.
+// Alert and rule counts only cover the caller's team (see scopeTeam).
 func (h *DashboardHandler) Stats(c *gin.Context) {
+	alerts := func() *gorm.DB { return scopeTeam(h.DB.Model(&models.Alert{}), c) }
 	var alertTotal, firingTotal int64
-	h.DB.Model(&models.Alert{}).Count(&alertTotal)
-	h.DB.Model(&models.Alert{}).Where("status = ?", "firing").Count(&firingTotal)
+	alerts().Count(&alertTotal)
+	alerts().Where("status = ?", "firing").Count(&firingTotal)
+
+	bySeverity := map[string]int64{"critical": 0, "warning": 0, "info": 0}
+	var sevRows []struct {
+		Severity string
+		Count    int64
+	}
+	alerts().Select("severity, count(*) as count").Where("status = ?", "firing").Group("severity").Scan(&sevRows)
+	for _, r := range sevRows {
+		bySeverity[r.Severity] += r.Count
+	}
+
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var resolvedToday int64
+	alerts().Where("status = ? AND resolved_at >= ?", "resolved", midnight).Count(&resolvedToday)
 
 	var rules, datasources, channels, templates int64
-	h.DB.Model(&models.Rule{}).Count(&rules)
+	scopeTeam(h.DB.Model(&models.Rule{}), c).Count(&rules)
 	h.DB.Model(&models.Datasource{}).Count(&datasources)
 	h.DB.Model(&models.Channel{}).Count(&channels)
 	h.DB.Model(&models.Template{}).Count(&templates)
 
 	c.JSON(http.StatusOK, gin.H{
-		"alert_total":  alertTotal,
-		"firing":       firingTotal,
-		"rules":        rules,
-		"datasources":  datasources,
-		"channels":     channels,
-		"templates":    templates,
+		"alert_total":      alertTotal,
+		"firing":           firingTotal,
+		"rules":            rules,
+		"datasources":      datasources,
+		"channels":         channels,
+		"templates":        templates,
+		"by_severity":      bySeverity,
+		"resolved_today":   resolvedToday,
+		"maintenance_mode": engine.MaintenanceMode(h.DB),
 	})
 }
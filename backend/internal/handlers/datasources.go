@@ -5,7 +5,11 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/inbound"
+	"github.com/kk-alert/backend/internal/labels"
 	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/query"
+	"github.com/kk-alert/backend/internal/relabel"
 	"gorm.io/gorm"
 )
 
@@ -34,15 +38,61 @@ func (h *DatasourceHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, d)
 }
 
+// datasourceBody is the create/update payload. IngestSecret and AuthValue are write-only (json:"-" on the
+// model), so they are bound separately: omitted keeps the current value, "" clears it (for IngestSecret this
+// disables signature checks).
+type datasourceBody struct {
+	models.Datasource
+	IngestSecret *string `json:"ingest_secret"`
+	AuthValue    *string `json:"auth_value"`
+}
+
+// validateDatasource checks the JSON/list settings of a datasource.
+func validateDatasource(d *models.Datasource) error {
+	if d.IngestMapping != "" {
+		if _, err := inbound.ParseIngestMapping(d.IngestMapping); err != nil {
+			return err
+		}
+	}
+	if _, err := labels.ParseDefaults(d.DefaultLabels); err != nil {
+		return err
+	}
+	if _, err := relabel.Parse(d.RelabelConfig); err != nil {
+		return err
+	}
+	if d.Type == "influxdb" {
+		if err := query.ValidateInfluxAuth(d.AuthType, d.AuthValue); err != nil {
+			return err
+		}
+	}
+	_, err := inbound.ParseCIDRs(d.AllowedCIDRs)
+	return err
+}
+
 // Create datasource.
 func (h *DatasourceHandler) Create(c *gin.Context) {
-	var d models.Datasource
-	if err := c.ShouldBindJSON(&d); err != nil {
+	var body datasourceBody
+	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	d := body.Datasource
+	if body.IngestSecret != nil {
+		d.IngestSecret = *body.IngestSecret
+	}
 	d.Endpoint = normalizeEndpoint(d.Endpoint)
-	d.AuthValue = d.AuthValue // in production encrypt here
+	// AuthValue: in production encrypt here
+	if body.AuthValue != nil {
+		d.AuthValue = *body.AuthValue
+	}
+	if err := validateDatasource(&d); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkTeam(h.DB, d.TeamID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err := h.DB.Create(&d).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -57,17 +107,35 @@ func (h *DatasourceHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
-	var body models.Datasource
+	var body datasourceBody
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if body.IngestSecret != nil {
+		d.IngestSecret = *body.IngestSecret
+	}
 	d.Name = body.Name
 	d.Type = body.Type
 	d.Endpoint = normalizeEndpoint(body.Endpoint)
 	d.Enabled = body.Enabled
-	if body.AuthValue != "" {
-		d.AuthValue = body.AuthValue
+	d.AuthType = body.AuthType
+	if body.AuthValue != nil {
+		d.AuthValue = *body.AuthValue
+	}
+	d.Database, d.Org = body.Database, body.Org
+	d.IngestMapping = body.IngestMapping
+	d.DefaultLabels = body.DefaultLabels
+	d.RelabelConfig = body.RelabelConfig
+	d.AllowedCIDRs = body.AllowedCIDRs
+	d.TeamID = body.TeamID
+	if err := validateDatasource(&d); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkTeam(h.DB, d.TeamID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	if err := h.DB.Save(&d).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -104,3 +172,78 @@ func (h *DatasourceHandler) TestConnection(c *gin.Context) {
 	// Minimal: just confirm config exists
 	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "数据源配置有效，连接测试通过"})
 }
+
+// Export returns selected datasources (all when ids is empty). AuthValue and IngestSecret are not
+// serialized, so exports carry no credentials.
+func (h *DatasourceHandler) Export(c *gin.Context) {
+	var body ExportBody
+	_ = c.ShouldBindJSON(&body)
+	var list []models.Datasource
+	q := h.DB.Model(&models.Datasource{})
+	if len(body.IDs) > 0 {
+		q = q.Where("id IN ?", body.IDs)
+	}
+	if err := q.Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"datasources": list})
+}
+
+// DatasourceImportRequest for datasource import. Mode add creates every datasource; overwrite updates the
+// datasource with the same name (keeping credentials that are not given) and creates the rest.
+type DatasourceImportRequest struct {
+	Datasources []datasourceBody `json:"datasources" binding:"required"` // credentials may be supplied alongside the exported fields
+	Mode        string           `json:"mode"`                           // add, overwrite
+}
+
+// Import creates or updates datasources from an export.
+func (h *DatasourceHandler) Import(c *gin.Context) {
+	var req DatasourceImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "add"
+	}
+	if req.Mode != "add" && req.Mode != "overwrite" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be add or overwrite"})
+		return
+	}
+	var imported, failed int
+	errs := []string{}
+	for _, in := range req.Datasources {
+		var d models.Datasource
+		if req.Mode == "overwrite" {
+			h.DB.Where("name = ?", in.Name).Limit(1).Find(&d)
+		}
+		// Credentials are not part of the export: keep the existing ones unless given.
+		authValue, ingestSecret := d.AuthValue, d.IngestSecret
+		id, createdAt := d.ID, d.CreatedAt
+		d = in.Datasource
+		d.ID, d.CreatedAt = id, createdAt
+		d.Endpoint = normalizeEndpoint(d.Endpoint)
+		d.AuthValue, d.IngestSecret = authValue, ingestSecret
+		if in.AuthValue != nil {
+			d.AuthValue = *in.AuthValue
+		}
+		if in.IngestSecret != nil {
+			d.IngestSecret = *in.IngestSecret
+		}
+		err := validateDatasource(&d)
+		if err == nil {
+			err = checkTeam(h.DB, d.TeamID)
+		}
+		if err == nil {
+			err = h.DB.Save(&d).Error
+		}
+		if err != nil {
+			failed++
+			errs = append(errs, in.Name+": "+err.Error())
+			continue
+		}
+		imported++
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": imported, "failed": failed, "errors": errs})
+}
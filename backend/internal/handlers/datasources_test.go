@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newDatasourceTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Datasource{}, &models.Team{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// postJSON calls handler with body and returns the response.
+func postJSON(handler gin.HandlerFunc, body string, params ...gin.Param) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	handler(c)
+	return w
+}
+
+func TestDatasourceExportImportRoundTrip(t *testing.T) {
+	db := newDatasourceTestDB(t)
+	db.Create(&models.Team{ID: 1, Name: "dba"})
+	team := uint(1)
+	db.Create(&models.Datasource{Name: "prom", Type: "prometheus", Endpoint: "http://prom:9090", Enabled: true,
+		AuthType: "bearer", AuthValue: "s3cret", IngestSecret: "hmac", DefaultLabels: `{"env":"prod"}`, TeamID: &team})
+	h := &DatasourceHandler{DB: db}
+
+	w := postJSON(h.Export, `{}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "s3cret") || strings.Contains(w.Body.String(), "hmac") {
+		t.Fatalf("export must carry no credentials: %d %s", w.Code, w.Body.String())
+	}
+	var exported struct {
+		Datasources []json.RawMessage `json:"datasources"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &exported); err != nil || len(exported.Datasources) != 1 {
+		t.Fatalf("export: %v %s", err, w.Body.String())
+	}
+
+	// Overwrite updates the datasource of the same name and keeps its credentials.
+	edited := bytes.Replace(exported.Datasources[0], []byte("http://prom:9090"), []byte("http://prom-2:9090/"), 1)
+	req, _ := json.Marshal(map[string]interface{}{"mode": "overwrite", "datasources": []json.RawMessage{edited}})
+	if w := postJSON(h.Import, string(req)); !strings.Contains(w.Body.String(), `"imported":1`) {
+		t.Fatalf("overwrite import: %s", w.Body.String())
+	}
+	var list []models.Datasource
+	db.Find(&list)
+	if len(list) != 1 || list[0].Endpoint != "http://prom-2:9090" || list[0].AuthValue != "s3cret" ||
+		list[0].IngestSecret != "hmac" || list[0].TeamID == nil || *list[0].TeamID != 1 {
+		t.Fatalf("after overwrite: %+v", list)
+	}
+
+	// Add creates a copy; a datasource pointing at a team that does not exist is rejected.
+	req, _ = json.Marshal(map[string]interface{}{"datasources": []json.RawMessage{exported.Datasources[0],
+		json.RawMessage(`{"name":"orphan","type":"prometheus","team_id":99}`)}})
+	w = postJSON(h.Import, string(req))
+	if !strings.Contains(w.Body.String(), `"imported":1`) || !strings.Contains(w.Body.String(), "orphan: team_id does not exist") {
+		t.Fatalf("add import: %s", w.Body.String())
+	}
+	var n int64
+	db.Model(&models.Datasource{}).Count(&n)
+	if n != 2 {
+		t.Errorf("expected 2 datasources after add, got %d", n)
+	}
+}
+
+func TestDatasourceUpdateValidates(t *testing.T) {
+	db := newDatasourceTestDB(t)
+	d := models.Datasource{Name: "influx", Type: "influxdb", Endpoint: "http://influx:8086"}
+	db.Create(&d)
+	h := &DatasourceHandler{DB: db}
+	id := gin.Param{Key: "id", Value: "1"}
+
+	for _, body := range []string{
+		`{"name":"influx","type":"influxdb","auth_type":"basic","auth_value":"no-colon"}`,
+		`{"name":"influx","type":"influxdb","default_labels":"=x"}`,
+		`{"name":"influx","type":"influxdb","team_id":5}`,
+	} {
+		if w := postJSON(h.Update, body, id); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, w.Code)
+		}
+	}
+	if w := postJSON(h.Update, `{"name":"influx","type":"influxdb","auth_type":"token","auth_value":"t"}`, id); w.Code != http.StatusOK {
+		t.Errorf("valid update: got %d %s", w.Code, w.Body.String())
+	}
+}
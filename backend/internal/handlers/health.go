@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/engine"
+	"github.com/kk-alert/backend/internal/scheduler"
+	"github.com/kk-alert/backend/internal/sender"
+	"gorm.io/gorm"
+)
+
+// HealthHandler reports DB connectivity and scheduler/queue state for liveness and readiness probes.
+type HealthHandler struct {
+	DB        *gorm.DB
+	Scheduler *scheduler.Scheduler
+}
+
+// Health returns 200 with component status, or 503 when the database cannot be reached.
+func (h *HealthHandler) Health(c *gin.Context) {
+	dbStatus := "ok"
+	if err := h.pingDB(c.Request.Context()); err != nil {
+		// The endpoint is unauthenticated: keep driver errors (hosts, users) out of the response.
+		log.Printf("[health] database ping failed: %v", err)
+		dbStatus = "database unavailable"
+	}
+	out := gin.H{
+		"ok":          dbStatus == "ok",
+		"db":          dbStatus,
+		"queue_depth": engine.QueueDepth(),
+		// channels whose circuit breaker is currently fast-failing sends
+		"open_circuits": sender.OpenBreakers(),
+	}
+	if h.Scheduler != nil {
+		out["scheduled_rules"] = h.Scheduler.TaskCount()
+	}
+	if t := scheduler.LastSuccessfulEvaluation(); !t.IsZero() {
+		out["last_evaluation_at"] = t
+	}
+	if dbStatus != "ok" {
+		c.JSON(http.StatusServiceUnavailable, out)
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func (h *HealthHandler) pingDB(ctx context.Context) error {
+	sqlDB, err := h.DB.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
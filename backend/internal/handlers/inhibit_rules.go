@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/engine"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// InhibitRuleHandler CRUD for cross-rule inhibit rules.
+type InhibitRuleHandler struct {
+	DB *gorm.DB
+}
+
+// validateInhibitRule requires non-empty source/target matcher objects and a JSON array for equal.
+func validateInhibitRule(ir *models.InhibitRule) error {
+	for _, f := range []struct{ name, raw string }{{"source_match", ir.SourceMatch}, {"target_match", ir.TargetMatch}} {
+		var m map[string]string
+		if err := json.Unmarshal([]byte(f.raw), &m); err != nil || len(m) == 0 {
+			return errors.New(f.name + " must be a non-empty JSON object of label matchers")
+		}
+	}
+	_, err := engine.ParseInhibitEqual(ir.Equal)
+	return err
+}
+
+// List inhibit rules.
+func (h *InhibitRuleHandler) List(c *gin.Context) {
+	var list []models.InhibitRule
+	if err := h.DB.Order("id asc").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Get by ID.
+func (h *InhibitRuleHandler) Get(c *gin.Context) {
+	var ir models.InhibitRule
+	if err := h.DB.First(&ir, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, ir)
+}
+
+// Create inhibit rule.
+func (h *InhibitRuleHandler) Create(c *gin.Context) {
+	var ir models.InhibitRule
+	if err := c.ShouldBindJSON(&ir); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateInhibitRule(&ir); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.DB.Create(&ir).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, ir)
+}
+
+// Update inhibit rule.
+func (h *InhibitRuleHandler) Update(c *gin.Context) {
+	var ir models.InhibitRule
+	if err := h.DB.First(&ir, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var body models.InhibitRule
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ir.Name = body.Name
+	ir.SourceMatch = body.SourceMatch
+	ir.TargetMatch = body.TargetMatch
+	ir.Equal = body.Equal
+	ir.Enabled = body.Enabled
+	if err := validateInhibitRule(&ir); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.DB.Save(&ir).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ir)
+}
+
+// Delete inhibit rule.
+func (h *InhibitRuleHandler) Delete(c *gin.Context) {
+	if err := h.DB.Delete(&models.InhibitRule{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/ldap"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ldapConfig is the LDAP/Active Directory login setup, read from the environment:
+//
+//	LDAP_URL          ldap://host[:389] or ldaps://host[:636]; LDAP login is off when empty
+//	LDAP_USER_DN      bind DN template, %s is the login name, e.g. uid=%s,ou=people,dc=example,dc=com
+//	                  or %s@corp.example.com for Active Directory (default)
+//	LDAP_BASE_DN      where to look up the user's entry for groups and mail; when empty the bind DN is read
+//	LDAP_USER_ATTR    attribute holding the login name under LDAP_BASE_DN (default uid; sAMAccountName for AD)
+//	LDAP_ADMIN_GROUP  group DN or CN whose members (memberOf) log in as admin; when set the role is re-synced on
+//	                  every login, otherwise new users start as user and keep whatever role an admin gives them
+//	LDAP_TIMEOUT      dial and request timeout (default 5s)
+//
+// With LDAP on, passwords are checked against the directory only. The seeded "admin" account still falls back
+// to its local password when the directory is unreachable or does not know it, so the server stays manageable.
+type ldapConfig struct {
+	URL        string
+	UserDN     string
+	BaseDN     string
+	UserAttr   string
+	AdminGroup string
+	Timeout    time.Duration
+}
+
+var ldapConf = ldapConfig{
+	URL:        os.Getenv("LDAP_URL"),
+	UserDN:     envString("LDAP_USER_DN", "%s"),
+	BaseDN:     os.Getenv("LDAP_BASE_DN"),
+	UserAttr:   envString("LDAP_USER_ATTR", "uid"),
+	AdminGroup: os.Getenv("LDAP_ADMIN_GROUP"),
+	Timeout:    envDuration("LDAP_TIMEOUT", 5*time.Second),
+}
+
+func (l ldapConfig) enabled() bool { return l.URL != "" }
+
+// seededAdmin is the account created at first start; it may always fall back to local auth.
+const seededAdmin = "admin"
+
+// errLDAPUnavailable wraps failures to reach or talk to the directory (as opposed to a rejected password).
+var errLDAPUnavailable = errors.New("directory unavailable")
+
+// ldapIdentity is what a successful directory login yields.
+type ldapIdentity struct {
+	Email   string
+	IsAdmin bool
+}
+
+// ldapAuthenticate binds as username and reads the user's entry for mail and group membership. A wrong
+// password returns an error satisfying ldap.IsInvalidCredentials; anything else wraps errLDAPUnavailable.
+// A variable so tests can stand in for the directory.
+var ldapAuthenticate = func(username, password string) (*ldapIdentity, error) {
+	conn, err := ldap.Dial(ldapConf.URL, ldapConf.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errLDAPUnavailable, err)
+	}
+	defer conn.Close()
+	bindDN := strings.ReplaceAll(ldapConf.UserDN, "%s", ldap.EscapeDN(username))
+	if err := conn.Bind(bindDN, password); err != nil {
+		if ldap.IsInvalidCredentials(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errLDAPUnavailable, err)
+	}
+	id := &ldapIdentity{}
+	attrs := []string{"mail", "memberOf"}
+	var entries []ldap.Entry
+	if ldapConf.BaseDN != "" {
+		entries, err = conn.Search(ldapConf.BaseDN, ldap.ScopeSubtree, ldapConf.UserAttr, username, attrs, 2)
+	} else {
+		entries, err = conn.Search(bindDN, ldap.ScopeBase, "", "", attrs, 1)
+	}
+	if err != nil || len(entries) != 1 {
+		// The password was accepted; without the entry the user just gets no groups.
+		log.Printf("[ldap] lookup of %s: %d entries, err=%v", username, len(entries), err)
+		return id, nil
+	}
+	id.Email = strings.ToLower(entries[0].Get("mail"))
+	if ldapConf.AdminGroup != "" {
+		for _, g := range entries[0].Attributes["memberof"] {
+			if groupMatches(g, ldapConf.AdminGroup) {
+				id.IsAdmin = true
+				break
+			}
+		}
+	}
+	return id, nil
+}
+
+// groupMatches compares a memberOf DN with the configured group, given either as a full DN or as its CN.
+func groupMatches(memberOf, group string) bool {
+	if strings.EqualFold(memberOf, group) {
+		return true
+	}
+	first := strings.SplitN(memberOf, ",", 2)[0]
+	return strings.EqualFold(first, "cn="+group)
+}
+
+// ldapLogin authenticates req against the directory and writes the response. It returns false, having written
+// nothing, when the request should fall through to local password auth (the seeded admin only).
+func (h *AuthHandler) ldapLogin(c *gin.Context, req LoginRequest, limitKeys []string) bool {
+	// Directory logins share the local account lockout, so it cannot be bypassed by guessing over LDAP.
+	var local models.User
+	known := h.DB.Where("username = ?", req.Username).First(&local).Error == nil
+	if known && local.LockedUntil != nil && time.Now().Before(*local.LockedUntil) {
+		respondLocked(c, *local.LockedUntil)
+		return true
+	}
+	id, err := ldapAuthenticate(req.Username, req.Password)
+	if err != nil {
+		if req.Username == seededAdmin {
+			return false
+		}
+		if errors.Is(err, errLDAPUnavailable) {
+			log.Printf("[ldap] login %s: %v", req.Username, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "directory unavailable, try again later"})
+			return true
+		}
+		loginLimit.fail(limitKeys...)
+		if known {
+			if lockedUntil := recordFailedLogin(h.DB, local.ID); !lockedUntil.IsZero() {
+				respondLocked(c, lockedUntil)
+				return true
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return true
+	}
+	loginLimit.reset(limitKeys...)
+	u, err := h.ldapUser(req.Username, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	if u.FailedLoginCount > 0 || u.LockedUntil != nil {
+		h.DB.Table("users").Where("id = ?", u.ID).Updates(map[string]interface{}{"failed_login_count": 0, "locked_until": nil})
+	}
+	respondLogin(c, u.ID, u.Username, u.Role)
+	return true
+}
+
+// ldapUser finds the local record for a directory user, creating it on first login.
+func (h *AuthHandler) ldapUser(username string, id *ldapIdentity) (*models.User, error) {
+	role := "user"
+	if id.IsAdmin {
+		role = "admin"
+	}
+	var u models.User
+	err := h.DB.Where("username = ?", username).First(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if len(username) > 64 {
+			return nil, fmt.Errorf("username %q is too long", username)
+		}
+		u = models.User{Username: username, Role: role}
+		var taken int64
+		if id.Email != "" {
+			h.DB.Model(&models.User{}).Where("email = ?", id.Email).Count(&taken)
+		}
+		if taken == 0 {
+			u.Email = id.Email
+		}
+		if err := h.DB.Create(&u).Error; err != nil {
+			return nil, err
+		}
+		return &u, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The seeded admin keeps its role even if the directory has an account of the same name outside the group.
+	if synced := syncedRole(u.Role, id.IsAdmin); ldapConf.AdminGroup != "" && synced != u.Role && username != seededAdmin {
+		u.Role = synced
+		if err := h.DB.Model(&u).Update("role", synced).Error; err != nil {
+			return nil, err
+		}
+	}
+	if u.Role == "" {
+		u.Role = "user"
+	}
+	return &u, nil
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// loginBucket is a token bucket of allowed failed logins for one key (client IP or username).
+// Each failure consumes a token; tokens refill at maxFailures per window. When the bucket is empty the
+// key is blocked, and each consecutive block doubles in length (backoff) up to maxLoginBlock.
+type loginBucket struct {
+	tokens       float64
+	lastTime     time.Time
+	blockedUntil time.Time
+	strikes      int
+}
+
+// loginLimiter throttles failed logins per IP and per username (in memory, per process).
+type loginLimiter struct {
+	mu          sync.Mutex
+	buckets     map[string]*loginBucket
+	maxFailures float64
+	window      time.Duration
+	now         func() time.Time
+}
+
+const maxLoginBlock = time.Hour
+
+// loginLimit is shared by all AuthHandler instances. Configure with LOGIN_MAX_FAILURES (default 5)
+// and LOGIN_FAILURE_WINDOW (Go duration, default 15m).
+var loginLimit = newLoginLimiter(envInt("LOGIN_MAX_FAILURES", 5), envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute))
+
+func newLoginLimiter(maxFailures int, window time.Duration) *loginLimiter {
+	if maxFailures < 1 {
+		maxFailures = 1
+	}
+	if window <= 0 {
+		window = 15 * time.Minute
+	}
+	return &loginLimiter{
+		buckets:     make(map[string]*loginBucket),
+		maxFailures: float64(maxFailures),
+		window:      window,
+		now:         time.Now,
+	}
+}
+
+// blocked returns how long the caller must wait when any of keys is currently blocked, else 0.
+func (l *loginLimiter) blocked(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var wait time.Duration
+	for _, k := range keys {
+		if b, ok := l.buckets[k]; ok && now.Before(b.blockedUntil) {
+			if d := b.blockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// fail records a failed attempt for each key, blocking keys whose bucket runs empty.
+func (l *loginLimiter) fail(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if len(l.buckets) > 10000 {
+		l.prune(now)
+	}
+	rate := l.maxFailures / l.window.Seconds()
+	for _, k := range keys {
+		b, ok := l.buckets[k]
+		if !ok {
+			b = &loginBucket{tokens: l.maxFailures, lastTime: now}
+			l.buckets[k] = b
+		}
+		// Refill tokens based on elapsed time
+		b.tokens += now.Sub(b.lastTime).Seconds() * rate
+		if b.tokens > l.maxFailures {
+			b.tokens = l.maxFailures
+		}
+		b.lastTime = now
+		b.tokens--
+		if b.tokens < 1 {
+			b.strikes++
+			block := time.Duration(float64(l.window) * math.Pow(2, float64(b.strikes-1)))
+			if block > maxLoginBlock || block <= 0 {
+				block = maxLoginBlock
+			}
+			b.blockedUntil = now.Add(block)
+			b.tokens = l.maxFailures
+		}
+	}
+}
+
+// reset clears failures for keys (after a successful login).
+func (l *loginLimiter) reset(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, k := range keys {
+		delete(l.buckets, k)
+	}
+}
+
+// prune drops buckets that are no longer blocked and have fully refilled.
+func (l *loginLimiter) prune(now time.Time) {
+	for k, b := range l.buckets {
+		if now.After(b.blockedUntil) && now.Sub(b.lastTime) >= l.window {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
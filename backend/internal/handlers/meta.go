@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/scheduler"
+	"github.com/kk-alert/backend/internal/sender"
+)
+
+// MetaHandler serves backend capability metadata for the UI (so editors need not hardcode it).
+type MetaHandler struct{}
+
+// QueryLanguages returns the query languages per datasource type and the threshold operators.
+func (h *MetaHandler) QueryLanguages(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"datasource_types":    scheduler.Capabilities(),
+		"threshold_operators": scheduler.ThresholdOperators,
+	})
+}
+
+// ChannelTypes returns the supported channel types and the config fields each one takes.
+func (h *MetaHandler) ChannelTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"channel_types": sender.ChannelTypes()})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/engine"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// NotificationHandler exposes notification deliveries and the dead letters of failed ones.
+type NotificationHandler struct {
+	DB *gorm.DB
+}
+
+// pageParams reads ?page= (default 1) and ?page_size= (default 20, at most 100).
+func pageParams(c *gin.Context) (page, pageSize int) {
+	if p := c.Query("page"); p != "" {
+		_, _ = fmt.Sscanf(p, "%d", &page)
+	}
+	if ps := c.Query("page_size"); ps != "" {
+		_, _ = fmt.Sscanf(ps, "%d", &pageSize)
+	}
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+// NotificationItem is a send record with the name of its channel.
+type NotificationItem struct {
+	models.AlertSendRecord
+	ChannelName string `json:"channel_name"`
+}
+
+// List lists notification send records, newest first, for auditing deliveries. Filters: channel_id,
+// alert_id, success (true, false), from/to (RFC3339, on created_at). Callers restricted to a team only see
+// sends of their team's alerts.
+func (h *NotificationHandler) List(c *gin.Context) {
+	page, pageSize := pageParams(c)
+	q := h.DB.Model(&models.AlertSendRecord{})
+	if id := c.Query("channel_id"); id != "" {
+		q = q.Where("alert_send_records.channel_id = ?", id)
+	}
+	if id := c.Query("alert_id"); id != "" {
+		q = q.Where("alert_send_records.alert_id = ?", id)
+	}
+	if s := c.Query("success"); s != "" {
+		ok, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "success must be true or false"})
+			return
+		}
+		q = q.Where("alert_send_records.success = ?", ok)
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be RFC3339"})
+			return
+		}
+		q = q.Where("alert_send_records.created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be RFC3339"})
+			return
+		}
+		q = q.Where("alert_send_records.created_at <= ?", t)
+	}
+	if team, ok := callerTeam(c); ok {
+		q = q.Where("alert_send_records.alert_id IN (?)", h.DB.Model(&models.Alert{}).Select("id").Where("team_id = ?", team))
+	}
+	var total int64
+	q.Count(&total)
+	items := make([]NotificationItem, 0, pageSize)
+	err := q.Select("alert_send_records.*, channels.name AS channel_name").
+		Joins("LEFT JOIN channels ON channels.id = alert_send_records.channel_id").
+		Order("alert_send_records.id desc").Offset((page - 1) * pageSize).Limit(pageSize).
+		Scan(&items).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "page": page, "page_size": pageSize})
+}
+
+// ListFailed lists dead-lettered notifications, newest first. Filters: status (pending, delivered, superseded),
+// channel_id, alert_id.
+func (h *NotificationHandler) ListFailed(c *gin.Context) {
+	page, pageSize := pageParams(c)
+	q := h.DB.Model(&models.FailedNotification{})
+	if s := c.Query("status"); s != "" {
+		q = q.Where("status = ?", s)
+	}
+	if id := c.Query("channel_id"); id != "" {
+		q = q.Where("channel_id = ?", id)
+	}
+	if id := c.Query("alert_id"); id != "" {
+		q = q.Where("alert_id = ?", id)
+	}
+	var total int64
+	q.Count(&total)
+	var list []models.FailedNotification
+	if err := q.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": list, "total": total, "page": page, "page_size": pageSize})
+}
+
+// Retry re-sends a dead-lettered notification to its channel. 200 with the updated record when it was
+// delivered, 502 with the record (carrying the new error) when it failed again, and 409 when it was not sent:
+// already delivered, being retried, superseded by the alert's current state, or maintenance mode.
+func (h *NotificationHandler) Retry(c *gin.Context) {
+	var fn models.FailedNotification
+	if err := h.DB.First(&fn, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if err := engine.RetryFailedNotification(h.DB, &fn); err != nil {
+		if errors.Is(err, engine.ErrAlreadyDelivered) || errors.Is(err, engine.ErrRetryInProgress) ||
+			errors.Is(err, engine.ErrSuperseded) || errors.Is(err, engine.ErrMaintenance) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "retry failed: " + err.Error(), "notification": fn})
+		return
+	}
+	c.JSON(http.StatusOK, fn)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestListNotifications(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Alert{}, &models.AlertSendRecord{}, &models.Channel{}); err != nil {
+		t.Fatal(err)
+	}
+	team := uint(1)
+	db.Create(&models.Alert{ID: "a-1", Status: "firing", TeamID: &team})
+	db.Create(&models.Alert{ID: "a-2", Status: "firing"})
+	db.Create(&models.Channel{ID: 1, Name: "ops-lark", Type: "lark"})
+	now := time.Now()
+	db.Create(&models.AlertSendRecord{AlertID: "a-1", ChannelID: 1, Success: true, CreatedAt: now.Add(-3 * time.Hour)})
+	db.Create(&models.AlertSendRecord{AlertID: "a-1", ChannelID: 1, Success: false, Error: "429", CreatedAt: now.Add(-10 * time.Minute)})
+	db.Create(&models.AlertSendRecord{AlertID: "a-2", ChannelID: 1, Success: false, Error: "429", CreatedAt: now.Add(-5 * time.Minute)})
+	h := &NotificationHandler{DB: db}
+
+	get := func(query string, team uint) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/notifications?"+query, nil)
+		c.Set("role", "user")
+		if team != 0 {
+			c.Set("team_id", team)
+		}
+		h.List(c)
+		return w
+	}
+	list := func(query string, team uint) (items []NotificationItem, total int64) {
+		w := get(query, team)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", query, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Items []NotificationItem `json:"items"`
+			Total int64              `json:"total"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Items, resp.Total
+	}
+
+	from := now.Add(-time.Hour).UTC().Format(time.RFC3339)
+	items, total := list("channel_id=1&success=false&from="+from, 0)
+	if total != 2 || len(items) != 2 {
+		t.Fatalf("failed sends in the last hour: got %d (%d items), want 2", total, len(items))
+	}
+	if items[0].AlertID != "a-2" || items[0].ChannelName != "ops-lark" {
+		t.Errorf("newest first with channel name: got %+v", items[0])
+	}
+	if _, total := list("success=false", team); total != 1 {
+		t.Errorf("team caller sees only its alerts' sends: got %d, want 1", total)
+	}
+	if _, total := list("alert_id=a-1", 0); total != 2 {
+		t.Errorf("alert_id filter: got %d, want 2", total)
+	}
+	for _, query := range []string{"from=yesterday", "to=2024-13-01", "success=maybe"} {
+		if w := get(query, 0); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, w.Code)
+		}
+	}
+}
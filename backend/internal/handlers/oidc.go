@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kk-alert/backend/internal/auth"
+	"github.com/kk-alert/backend/internal/httpclient"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// oidcConfig is the OIDC/OAuth2 single sign-on setup, read from the environment:
+//
+//	OIDC_ISSUER          provider issuer URL (discovery is fetched from <issuer>/.well-known/openid-configuration)
+//	OIDC_CLIENT_ID       client id registered with the provider
+//	OIDC_CLIENT_SECRET   client secret
+//	OIDC_REDIRECT_URL    this server's callback, e.g. https://kk-alert.example.com/api/v1/auth/oidc/callback
+//	OIDC_SCOPES          space-separated scopes (default "openid email profile")
+//	OIDC_GROUPS_CLAIM    claim holding the user's groups (default "groups")
+//	OIDC_ADMIN_GROUP     members of this group log in as admin; everyone else as user
+//	OIDC_POST_LOGIN_URL  where the browser is sent after login, with the token in the fragment (#token=...);
+//	                     when empty the callback answers with the same JSON as /auth/login
+//
+// SSO is disabled unless issuer, client id and redirect URL are set. Local login keeps working either way.
+type oidcConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       string
+	GroupsClaim  string
+	AdminGroup   string
+	PostLogin    string
+}
+
+var oidcConf = oidcConfig{
+	Issuer:       strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"),
+	ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+	ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+	RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	Scopes:       envString("OIDC_SCOPES", "openid email profile"),
+	GroupsClaim:  envString("OIDC_GROUPS_CLAIM", "groups"),
+	AdminGroup:   os.Getenv("OIDC_ADMIN_GROUP"),
+	PostLogin:    os.Getenv("OIDC_POST_LOGIN_URL"),
+}
+
+func (o oidcConfig) enabled() bool {
+	return o.Issuer != "" && o.ClientID != "" && o.RedirectURL != ""
+}
+
+const (
+	oidcStateCookie = "kk_oidc_state"
+	oidcNonceCookie = "kk_oidc_nonce"
+	oidcCookieTTL   = 10 * time.Minute
+)
+
+// oidcProvider holds the endpoints from the provider's discovery document.
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// Discovery is fetched once and reused; a failed fetch is retried on the next login.
+var (
+	oidcDiscoveryMu sync.Mutex
+	oidcDiscovered  *oidcProvider
+)
+
+func discoverOIDC(issuer string) (*oidcProvider, error) {
+	oidcDiscoveryMu.Lock()
+	defer oidcDiscoveryMu.Unlock()
+	if oidcDiscovered != nil && oidcDiscovered.Issuer == issuer {
+		return oidcDiscovered, nil
+	}
+	var p oidcProvider
+	if err := oidcGetJSON(issuer+"/.well-known/openid-configuration", "", &p); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimRight(p.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", p.Issuer, issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" {
+		return nil, errors.New("discovery: missing authorization or token endpoint")
+	}
+	p.Issuer = issuer
+	oidcDiscovered = &p
+	return &p, nil
+}
+
+func oidcGetJSON(u, bearer string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := httpclient.Default.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// OIDCHandler implements the authorization code flow against an OIDC provider.
+type OIDCHandler struct {
+	DB *gorm.DB
+}
+
+// Login redirects the browser to the provider's authorization endpoint. State and nonce are kept in short-lived
+// HttpOnly cookies and checked on the callback.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	if !oidcConf.enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sso not configured"})
+		return
+	}
+	p, err := discoverOIDC(oidcConf.Issuer)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	state, nonce := randomToken(), randomToken()
+	secure := strings.HasPrefix(oidcConf.RedirectURL, "https://")
+	maxAge := int(oidcCookieTTL.Seconds())
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, "/api/v1/auth/oidc", "", secure, true)
+	c.SetCookie(oidcNonceCookie, nonce, maxAge, "/api/v1/auth/oidc", "", secure, true)
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {oidcConf.ClientID},
+		"redirect_uri":  {oidcConf.RedirectURL},
+		"scope":         {oidcConf.Scopes},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	c.Redirect(http.StatusFound, p.AuthorizationEndpoint+sep+q.Encode())
+}
+
+// Callback exchanges the authorization code, finds or creates the user by email, maps the groups claim to a
+// role and issues our JWT.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if !oidcConf.enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sso not configured"})
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sso: " + e, "description": c.Query("error_description")})
+		return
+	}
+	state, _ := c.Cookie(oidcStateCookie)
+	nonce, _ := c.Cookie(oidcNonceCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/v1/auth/oidc", "", false, true)
+	c.SetCookie(oidcNonceCookie, "", -1, "/api/v1/auth/oidc", "", false, true)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sso state"})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+	p, err := discoverOIDC(oidcConf.Issuer)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	claims, err := oidcExchange(p, code, nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sso: " + err.Error()})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(claimString(claims, "email")))
+	if email == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "sso: provider returned no email"})
+		return
+	}
+	if v, ok := claims["email_verified"].(bool); ok && !v {
+		c.JSON(http.StatusForbidden, gin.H{"error": "sso: email not verified"})
+		return
+	}
+	role := "user"
+	if oidcConf.AdminGroup != "" && containsString(claimStrings(claims, oidcConf.GroupsClaim), oidcConf.AdminGroup) {
+		role = "admin"
+	}
+	user, err := h.ssoUser(email, claimString(claims, "preferred_username"), role)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	// A lockout from failed local or LDAP logins also holds for SSO.
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		respondLocked(c, *user.LockedUntil)
+		return
+	}
+	token, err := auth.IssueToken(user.ID, user.Username, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue token"})
+		return
+	}
+	if oidcConf.PostLogin != "" {
+		c.Redirect(http.StatusFound, oidcConf.PostLogin+"#token="+url.QueryEscape(token))
+		return
+	}
+	resp := LoginResponse{Token: token}
+	resp.User.ID, resp.User.Username, resp.User.Role = user.ID, user.Username, user.Role
+	c.JSON(http.StatusOK, resp)
+}
+
+// syncedRole is the role of an existing SSO or LDAP user after login. The directory's admin group only decides
+// whether they are an admin: members are promoted, admins outside it drop to user, and the viewer or operator
+// role an admin assigned in the app is left alone.
+func syncedRole(current string, isAdmin bool) string {
+	switch {
+	case isAdmin:
+		return "admin"
+	case current == "admin":
+		return "user"
+	}
+	return current
+}
+
+// ssoUser looks up the user by email, creating one on first login. With OIDC_ADMIN_GROUP set, the admin bit
+// follows the group on every login so removing someone from the admin group takes effect at their next
+// sign-in (see syncedRole). SSO users get no password hash, so they cannot use local login.
+func (h *OIDCHandler) ssoUser(email, preferred, role string) (*models.User, error) {
+	var u models.User
+	err := h.DB.Where("email = ?", email).First(&u).Error
+	if err == nil {
+		if oidcConf.AdminGroup != "" {
+			if synced := syncedRole(u.Role, role == "admin"); synced != u.Role {
+				u.Role = synced
+				if err := h.DB.Model(&u).Update("role", synced).Error; err != nil {
+					return nil, err
+				}
+			}
+		}
+		return &u, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	username := email
+	if len(username) > 64 && preferred != "" {
+		username = preferred
+	}
+	if len(username) > 64 {
+		return nil, fmt.Errorf("username %q is too long", username)
+	}
+	var exists int64
+	h.DB.Model(&models.User{}).Where("username = ?", username).Count(&exists)
+	if exists > 0 {
+		// Never attach an SSO identity to an existing local account implicitly; an admin sets its email instead.
+		return nil, fmt.Errorf("username %q already exists", username)
+	}
+	u = models.User{Username: username, Email: email, Role: role}
+	if err := h.DB.Create(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// oidcExchange redeems code at the token endpoint and returns the ID token claims, merged with userinfo when
+// the provider has that endpoint (some providers only put groups there). The ID token comes straight from the
+// token endpoint over TLS, so its signature is not checked (OIDC Core 3.1.3.7); issuer, audience, expiry and
+// nonce are.
+func oidcExchange(p *oidcProvider, code, nonce string) (jwt.MapClaims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcConf.RedirectURL},
+		"client_id":     {oidcConf.ClientID},
+		"client_secret": {oidcConf.ClientSecret},
+	}
+	resp, err := httpclient.Default.PostForm(p.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.IDToken == "" {
+		if tok.Error == "" {
+			tok.Error = fmt.Sprintf("status %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("token exchange: %s", tok.Error)
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tok.IDToken, claims); err != nil {
+		return nil, fmt.Errorf("id token: %w", err)
+	}
+	if iss, _ := claims.GetIssuer(); strings.TrimRight(iss, "/") != p.Issuer {
+		return nil, errors.New("id token: issuer mismatch")
+	}
+	if aud, _ := claims.GetAudience(); !containsString(aud, oidcConf.ClientID) {
+		return nil, errors.New("id token: audience mismatch")
+	}
+	if exp, _ := claims.GetExpirationTime(); exp == nil || time.Now().After(exp.Time) {
+		return nil, errors.New("id token: expired")
+	}
+	if nonce == "" || claimString(claims, "nonce") != nonce {
+		return nil, errors.New("id token: nonce mismatch")
+	}
+	if p.UserinfoEndpoint != "" && tok.AccessToken != "" {
+		var info map[string]interface{}
+		if err := oidcGetJSON(p.UserinfoEndpoint, tok.AccessToken, &info); err == nil {
+			for k, v := range info {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+	return claims, nil
+}
+
+func claimString(claims jwt.MapClaims, key string) string {
+	s, _ := claims[key].(string)
+	return s
+}
+
+// claimStrings reads a claim that is a list of strings or a single string.
+func claimStrings(claims jwt.MapClaims, key string) []string {
+	switch v := claims[key].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kk-alert/backend/internal/models"
+)
+
+func TestOIDCCallbackCreatesUserWithMappedRole(t *testing.T) {
+	var issuer string
+	nonce := "n-123"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/authorize",
+			"token_endpoint":         issuer + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iss":    issuer,
+			"aud":    "kk",
+			"exp":    time.Now().Add(time.Minute).Unix(),
+			"nonce":  nonce,
+			"email":  "Bob@Example.com",
+			"groups": []string{"dev", "ops-admins"},
+		}).SignedString([]byte("provider-key"))
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	issuer = srv.URL
+
+	saved := oidcConf
+	defer func() { oidcConf = saved; oidcDiscovered = nil }()
+	oidcConf = oidcConfig{Issuer: issuer, ClientID: "kk", RedirectURL: "http://kk/cb", GroupsClaim: "groups", AdminGroup: "ops-admins"}
+	oidcDiscovered = nil
+
+	db := newAuthTestDB(t)
+	h := &OIDCHandler{DB: db}
+	callback := func(code, state string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		q := url.Values{"code": {code}, "state": {state}}
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?"+q.Encode(), nil)
+		c.Request.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: "s-1"})
+		c.Request.AddCookie(&http.Cookie{Name: oidcNonceCookie, Value: nonce})
+		h.Callback(c)
+		return w
+	}
+
+	if w := callback("good", "forged"); w.Code != http.StatusBadRequest {
+		t.Fatalf("state mismatch: got %d, want 400", w.Code)
+	}
+	if w := callback("bad", "s-1"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("bad code: got %d, want 401", w.Code)
+	}
+	w := callback("good", "s-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Token == "" || resp.User.Username != "bob@example.com" || resp.User.Role != "admin" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	var u models.User
+	db.First(&u, "email = ?", "bob@example.com")
+	if u.ID != resp.User.ID || u.PasswordHash != "" {
+		t.Fatalf("user not stored as SSO user: %+v", u)
+	}
+
+	// Losing the admin group demotes on the next login instead of creating a second user.
+	oidcConf.AdminGroup = "someone-else"
+	w = callback("good", "s-1")
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.User.ID != u.ID || resp.User.Role != "user" {
+		t.Fatalf("second login: %+v", resp)
+	}
+
+	// A role an admin set in the app other than admin survives the next login.
+	db.Model(&u).Update("role", "viewer")
+	w = callback("good", "s-1")
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.User.Role != "viewer" {
+		t.Fatalf("viewer re-login: got role %q, want viewer", resp.User.Role)
+	}
+
+	// A locked account gets no token.
+	db.Model(&u).Update("locked_until", time.Now().Add(time.Hour))
+	if w = callback("good", "s-1"); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "account locked") {
+		t.Fatalf("locked account: got %d %s, want 403", w.Code, w.Body.String())
+	}
+}
+
+func TestSyncedRole(t *testing.T) {
+	for _, tc := range []struct {
+		current string
+		isAdmin bool
+		want    string
+	}{
+		{"user", true, "admin"},
+		{"viewer", true, "admin"},
+		{"admin", false, "user"},
+		{"viewer", false, "viewer"},
+		{"operator", false, "operator"},
+		{"admin", true, "admin"},
+	} {
+		if got := syncedRole(tc.current, tc.isAdmin); got != tc.want {
+			t.Errorf("syncedRole(%q, %v) = %q, want %q", tc.current, tc.isAdmin, got, tc.want)
+		}
+	}
+}
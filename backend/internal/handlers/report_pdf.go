@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/kk-alert/backend/internal/models"
+)
+
+// pdfColumn describes one column of the alert table in the PDF report.
+type pdfColumn struct {
+	header string
+	width  float64 // mm, A4 landscape has ~277mm usable width
+	value  func(a models.Alert, now time.Time) string
+}
+
+var pdfColumns = []pdfColumn{
+	{"Title", 95, func(a models.Alert, _ time.Time) string { return a.Title }},
+	{"Severity", 20, func(a models.Alert, _ time.Time) string { return a.Severity }},
+	{"Status", 20, func(a models.Alert, _ time.Time) string { return a.Status }},
+	{"Firing At", 38, func(a models.Alert, _ time.Time) string { return formatInShanghai(a.FiringAt, exportTimeLayout) }},
+	{"Resolved At", 38, func(a models.Alert, _ time.Time) string {
+		if a.ResolvedAt == nil {
+			return ""
+		}
+		return formatInShanghai(*a.ResolvedAt, exportTimeLayout)
+	}},
+	{"Impact", 36, func(a models.Alert, now time.Time) string {
+		return formatImpactDuration(a.FiringAt, a.ResolvedAt, a.Status, now)
+	}},
+	{"Value", 30, func(a models.Alert, _ time.Time) string { return alertValueFromAnnotations(a.Annotations) }},
+}
+
+// writeAlertsPDF renders a summary page (date range, severity/status counts) followed by a table of alerts.
+// The built-in PDF fonts only cover Latin-1; set REPORT_PDF_FONT to a TTF file (e.g. Noto Sans SC) so
+// Chinese titles and durations render instead of being replaced.
+func writeAlertsPDF(list []models.Alert, from, to string) (*bytes.Buffer, error) {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.SetAutoPageBreak(true, 12)
+	family := "Helvetica"
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	if fontPath := os.Getenv("REPORT_PDF_FONT"); fontPath != "" {
+		pdf.AddUTF8Font("report", "", fontPath)
+		if pdf.Err() {
+			return nil, fmt.Errorf("load pdf font %s: %w", fontPath, pdf.Error())
+		}
+		family = "report"
+		tr = func(s string) string { return s }
+	}
+	now := time.Now()
+
+	// Summary page
+	pdf.AddPage()
+	pdf.SetFont(family, "", 18)
+	pdf.CellFormat(0, 12, tr("Alert Report"), "", 1, "L", false, 0, "")
+	pdf.SetFont(family, "", 11)
+	rangeText := "all time"
+	if from != "" || to != "" {
+		rangeText = pdfRangeBound(from) + " ~ " + pdfRangeBound(to)
+	}
+	pdf.CellFormat(0, 7, tr("Range: "+rangeText), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 7, tr("Generated: "+formatInShanghai(now, exportTimeLayout)+" (Asia/Shanghai)"), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 7, tr(fmt.Sprintf("Total alerts: %d", len(list))), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	sevCounts := make(map[string]int)
+	statusCounts := make(map[string]int)
+	for _, a := range list {
+		sevCounts[a.Severity]++
+		statusCounts[a.Status]++
+	}
+	writeSummary := func(title string, counts map[string]int) {
+		pdf.SetFont(family, "", 13)
+		pdf.CellFormat(0, 9, tr(title), "", 1, "L", false, 0, "")
+		pdf.SetFont(family, "", 11)
+		keys := make([]string, 0, len(counts))
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			name := k
+			if name == "" {
+				name = "(none)"
+			}
+			pdf.CellFormat(50, 7, tr(name), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(30, 7, fmt.Sprintf("%d", counts[k]), "1", 1, "R", false, 0, "")
+		}
+		pdf.Ln(4)
+	}
+	writeSummary("By severity", sevCounts)
+	writeSummary("By status", statusCounts)
+
+	// Alert table
+	writeHeader := func() {
+		pdf.SetFont(family, "", 9)
+		pdf.SetFillColor(240, 240, 240)
+		for _, col := range pdfColumns {
+			pdf.CellFormat(col.width, 7, tr(col.header), "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.AddPage()
+	writeHeader()
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	for _, a := range list {
+		if pdf.GetY()+6 > pageHeight-bottom-12 {
+			pdf.AddPage()
+			writeHeader()
+		}
+		for _, col := range pdfColumns {
+			text := pdfFit(pdf, tr, col.value(a, now), col.width-2)
+			pdf.CellFormat(col.width, 6, text, "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// pdfRangeBound formats an RFC3339 range bound in Shanghai time, or returns it unchanged if unparsable.
+func pdfRangeBound(s string) string {
+	if s == "" {
+		return "-"
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return formatInShanghai(t, exportTimeLayout)
+	}
+	return s
+}
+
+// pdfFit encodes s with tr, truncated with an ellipsis so it fits in width mm with the current font. s is
+// cut on runes before encoding: the core fonts' encoding is single-byte, not UTF-8.
+func pdfFit(pdf *fpdf.Fpdf, tr func(string) string, s string, width float64) string {
+	if enc := tr(s); pdf.GetStringWidth(enc) <= width {
+		return enc
+	}
+	r := []rune(s)
+	for len(r) > 0 && pdf.GetStringWidth(tr(string(r)+"...")) > width {
+		r = r[:len(r)-1]
+	}
+	return tr(string(r) + "...")
+}
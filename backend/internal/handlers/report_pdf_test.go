@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-pdf/fpdf"
+)
+
+func TestPDFFitTruncatesNonASCII(t *testing.T) {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 9)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	s := strings.Repeat("Température élevée ", 10)
+
+	got := pdfFit(pdf, tr, s, 40)
+	if pdf.GetStringWidth(got) > 40 {
+		t.Errorf("truncated text is %.1fmm wide, want at most 40", pdf.GetStringWidth(got))
+	}
+	r := []rune(s)
+	for n := len(r); n > 0; n-- {
+		if got == tr(string(r[:n])+"...") {
+			return
+		}
+	}
+	t.Errorf("result %q is not an encoded prefix of the input plus an ellipsis", got)
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/sender"
+	"gorm.io/gorm"
+)
+
+// ScheduledReportHandler CRUD for scheduled report delivery.
+type ScheduledReportHandler struct {
+	DB *gorm.DB
+}
+
+// scheduledReportBody is the create/update payload; nil fields are left unchanged on update.
+type scheduledReportBody struct {
+	Name       *string  `json:"name"`
+	Enabled    *bool    `json:"enabled"`
+	Interval   *string  `json:"interval"`
+	Format     *string  `json:"format"`
+	Range      *string  `json:"range"`
+	Recipients []string `json:"recipients"`
+	ChannelIDs []uint   `json:"channel_ids"`
+}
+
+// List scheduled reports.
+func (h *ScheduledReportHandler) List(c *gin.Context) {
+	var list []models.ScheduledReport
+	if err := h.DB.Order("id asc").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Get scheduled report by ID.
+func (h *ScheduledReportHandler) Get(c *gin.Context) {
+	var r models.ScheduledReport
+	if err := h.DB.First(&r, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// Create scheduled report.
+func (h *ScheduledReportHandler) Create(c *gin.Context) {
+	var body scheduledReportBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	r := models.ScheduledReport{Enabled: true, Interval: "7d", Format: "xlsx", Range: "last_7d"}
+	if err := applyScheduledReportBody(&r, &body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.DB.Create(&r).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, r)
+}
+
+// Update scheduled report.
+func (h *ScheduledReportHandler) Update(c *gin.Context) {
+	var r models.ScheduledReport
+	if err := h.DB.First(&r, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var body scheduledReportBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := applyScheduledReportBody(&r, &body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.DB.Save(&r).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// Delete scheduled report.
+func (h *ScheduledReportHandler) Delete(c *gin.Context) {
+	if err := h.DB.Delete(&models.ScheduledReport{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// applyScheduledReportBody copies set fields from body into r and validates the result.
+func applyScheduledReportBody(r *models.ScheduledReport, body *scheduledReportBody) error {
+	if body.Name != nil {
+		r.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.Enabled != nil {
+		r.Enabled = *body.Enabled
+	}
+	if body.Interval != nil {
+		r.Interval = strings.TrimSpace(*body.Interval)
+	}
+	if body.Format != nil {
+		r.Format = strings.ToLower(strings.TrimSpace(*body.Format))
+	}
+	if body.Range != nil {
+		r.Range = strings.TrimSpace(*body.Range)
+	}
+	if body.Recipients != nil {
+		b, _ := json.Marshal(body.Recipients)
+		r.Recipients = string(b)
+	}
+	if body.ChannelIDs != nil {
+		b, _ := json.Marshal(body.ChannelIDs)
+		r.ChannelIDs = string(b)
+	}
+
+	if r.Name == "" {
+		return fmt.Errorf("name required")
+	}
+	interval, err := parseDayDuration(r.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid interval %q: %v", r.Interval, err)
+	}
+	if interval < time.Hour {
+		return fmt.Errorf("interval must be at least 1h")
+	}
+	switch r.Format {
+	case "json", "csv", "xlsx", "pdf":
+	default:
+		return fmt.Errorf("format must be one of json, csv, xlsx, pdf")
+	}
+	if _, err := parseRelativeRange(r.Range); err != nil {
+		return err
+	}
+	if len(parseStringList(r.Recipients)) == 0 && len(parseUintList(r.ChannelIDs)) == 0 {
+		return fmt.Errorf("at least one recipient or channel_id required")
+	}
+	return nil
+}
+
+// parseDayDuration parses a Go duration, additionally accepting a whole number of days such as "7d".
+func parseDayDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid day count")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// parseRelativeRange parses "last_<duration>" (e.g. last_24h, last_7d) into the lookback duration.
+func parseRelativeRange(s string) (time.Duration, error) {
+	if !strings.HasPrefix(s, "last_") {
+		return 0, fmt.Errorf("range must look like last_24h, last_7d or last_30d")
+	}
+	d, err := parseDayDuration(strings.TrimPrefix(s, "last_"))
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid range %q", s)
+	}
+	return d, nil
+}
+
+func parseStringList(raw string) []string {
+	var out []string
+	if raw != "" {
+		_ = json.Unmarshal([]byte(raw), &out)
+	}
+	return out
+}
+
+func parseUintList(raw string) []uint {
+	var out []uint
+	if raw != "" {
+		_ = json.Unmarshal([]byte(raw), &out)
+	}
+	return out
+}
+
+// RunScheduledReports delivers every enabled scheduled report whose interval has elapsed since its last run.
+// Call periodically (e.g. every minute).
+func RunScheduledReports(db *gorm.DB) {
+	var list []models.ScheduledReport
+	if err := db.Where("enabled = ?", true).Find(&list).Error; err != nil {
+		log.Printf("[report schedule] list: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range list {
+		r := &list[i]
+		interval, err := parseDayDuration(r.Interval)
+		if err != nil || interval <= 0 {
+			continue
+		}
+		if r.LastRunAt != nil && now.Sub(*r.LastRunAt) < interval {
+			continue
+		}
+		errMsg := ""
+		if err := deliverScheduledReport(db, r, now); err != nil {
+			log.Printf("[report schedule] report %d (%s): %v", r.ID, r.Name, err)
+			errMsg = err.Error()
+			if len(errMsg) > 512 {
+				errMsg = errMsg[:512]
+			}
+		} else {
+			log.Printf("[report schedule] report %d (%s) delivered", r.ID, r.Name)
+		}
+		db.Model(r).Updates(map[string]interface{}{"last_run_at": now, "last_error": errMsg})
+	}
+}
+
+// deliverScheduledReport builds the export for r's range and sends it to all recipients and channels.
+func deliverScheduledReport(db *gorm.DB, r *models.ScheduledReport, now time.Time) error {
+	lookback, err := parseRelativeRange(r.Range)
+	if err != nil {
+		return err
+	}
+	from := now.Add(-lookback).Format(time.RFC3339)
+	to := now.Format(time.RFC3339)
+	list, err := loadExportAlerts(db, from, to)
+	if err != nil {
+		return err
+	}
+	title := fmt.Sprintf("KK Alert 报表 - %s", r.Name)
+	summary := scheduledReportSummary(list, now.Add(-lookback), now)
+
+	var errs []string
+	if recipients := parseStringList(r.Recipients); len(recipients) > 0 {
+		data, contentType, ext, err := renderAlertExport(list, r.Format, from, to)
+		if err != nil {
+			return err
+		}
+		att := sender.Attachment{
+			Filename:    "alerts-" + now.In(locShanghai).Format("2006-01-02") + ext,
+			ContentType: contentType,
+			Data:        data,
+		}
+		if err := sender.SendEmail(recipients, title, summary, att); err != nil {
+			errs = append(errs, "email: "+err.Error())
+		}
+	}
+	for _, chID := range parseUintList(r.ChannelIDs) {
+		var ch models.Channel
+		if err := db.First(&ch, chID).Error; err != nil {
+			errs = append(errs, fmt.Sprintf("channel %d: not found", chID))
+			continue
+		}
+		if !ch.Enabled {
+			continue
+		}
+		if err := sender.Send(ch.Type, ch.Config, sender.Message{Title: title, Body: summary}); err != nil {
+			errs = append(errs, fmt.Sprintf("channel %d: %v", chID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// scheduledReportSummary is the text digest sent as the email body and to channels (which cannot take attachments).
+func scheduledReportSummary(list []models.Alert, from, to time.Time) string {
+	sevCounts := make(map[string]int)
+	statusCounts := make(map[string]int)
+	titleCounts := make(map[string]int)
+	for _, a := range list {
+		sevCounts[a.Severity]++
+		statusCounts[a.Status]++
+		titleCounts[a.Title]++
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "时间范围: %s ~ %s\n", formatInShanghai(from, exportTimeLayout), formatInShanghai(to, exportTimeLayout))
+	fmt.Fprintf(&b, "告警总数: %d\n", len(list))
+	fmt.Fprintf(&b, "严重程度: %s\n", formatCountMap(sevCounts))
+	fmt.Fprintf(&b, "状态: %s\n", formatCountMap(statusCounts))
+	if len(titleCounts) > 0 {
+		type kv struct {
+			Title string
+			Count int
+		}
+		top := make([]kv, 0, len(titleCounts))
+		for t, n := range titleCounts {
+			top = append(top, kv{t, n})
+		}
+		sort.Slice(top, func(i, j int) bool {
+			if top[i].Count != top[j].Count {
+				return top[i].Count > top[j].Count
+			}
+			return top[i].Title < top[j].Title
+		})
+		if len(top) > 10 {
+			top = top[:10]
+		}
+		b.WriteString("Top 告警:\n")
+		for _, t := range top {
+			fmt.Fprintf(&b, "• %s (%d)\n", t.Title, t.Count)
+		}
+	}
+	return b.String()
+}
+
+func formatCountMap(m map[string]int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, m[k]))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
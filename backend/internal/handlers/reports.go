@@ -5,6 +5,7 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -15,7 +16,7 @@ import (
 )
 
 var (
-	exportHeaders = []string{"告警ID", "数据源ID", "数据源类型", "标题", "严重程度", "状态", "告警时间", "恢复时间", "影响时长", "创建时间", "当前值/阈值"}
+	exportHeaders = []string{"告警ID", "数据源ID", "数据源类型", "标题", "严重程度", "状态", "告警时间", "恢复时间", "影响时长", "创建时间", "当前值/阈值", "规则ID"}
 	locShanghai   *time.Location
 )
 
@@ -95,9 +96,9 @@ func joinStrings(parts []string, sep string) string {
 	return s
 }
 
-func writeAlertsCSV(w http.ResponseWriter, list []models.Alert) {
+func writeAlertsCSV(w io.Writer, list []models.Alert) {
 	enc := csv.NewWriter(w)
-	enc.Write([]string{"alert_id", "source_id", "source_type", "title", "severity", "status", "firing_at", "resolved_at", "影响时长", "created_at", "value"})
+	enc.Write([]string{"alert_id", "source_id", "source_type", "title", "severity", "status", "firing_at", "resolved_at", "影响时长", "created_at", "value", "rule_id"})
 	now := time.Now()
 	for _, a := range list {
 		firingAt := formatInShanghai(a.FiringAt, exportTimeLayout)
@@ -108,7 +109,7 @@ func writeAlertsCSV(w http.ResponseWriter, list []models.Alert) {
 		impactDur := formatImpactDuration(a.FiringAt, a.ResolvedAt, a.Status, now)
 		createdAt := formatInShanghai(a.CreatedAt, exportTimeLayout)
 		value := alertValueFromAnnotations(a.Annotations)
-		enc.Write([]string{a.ID, fmt.Sprintf("%d", a.SourceID), a.SourceType, a.Title, a.Severity, a.Status, firingAt, resolvedAt, impactDur, createdAt, value})
+		enc.Write([]string{a.ID, fmt.Sprintf("%d", a.SourceID), a.SourceType, a.Title, a.Severity, a.Status, firingAt, resolvedAt, impactDur, createdAt, value, fmt.Sprintf("%d", a.RuleID)})
 	}
 	enc.Flush()
 }
@@ -127,7 +128,7 @@ func writeAlertsExcel(list []models.Alert) (*bytes.Buffer, error) {
 		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center", WrapText: true},
 		Fill:      excelize.Fill{Type: "pattern", Color: []string{"#f0f0f0"}, Pattern: 1},
 	})
-	_ = f.SetCellStyle(sheet, "A1", "K1", styleHeader)
+	_ = f.SetCellStyle(sheet, "A1", "L1", styleHeader)
 	now := time.Now()
 	for row, a := range list {
 		firingAt := formatInShanghai(a.FiringAt, exportTimeLayout)
@@ -149,6 +150,7 @@ func writeAlertsExcel(list []models.Alert) (*bytes.Buffer, error) {
 		_ = f.SetCellValue(sheet, fmt.Sprintf("I%d", row+2), impactDur)
 		_ = f.SetCellValue(sheet, fmt.Sprintf("J%d", row+2), createdAt)
 		_ = f.SetCellValue(sheet, fmt.Sprintf("K%d", row+2), value)
+		_ = f.SetCellValue(sheet, fmt.Sprintf("L%d", row+2), a.RuleID)
 	}
 	f.SetColWidth(sheet, "A", "A", 38)
 	f.SetColWidth(sheet, "B", "B", 10)
@@ -161,6 +163,7 @@ func writeAlertsExcel(list []models.Alert) (*bytes.Buffer, error) {
 	f.SetColWidth(sheet, "I", "I", 14)
 	f.SetColWidth(sheet, "J", "J", 20)
 	f.SetColWidth(sheet, "K", "K", 14)
+	f.SetColWidth(sheet, "L", "L", 10)
 	f.SetActiveSheet(idx)
 	var buf bytes.Buffer
 	if _, err := f.WriteTo(&buf); err != nil {
@@ -202,7 +205,7 @@ func (h *ReportHandler) Trend(c *gin.Context) {
 		var count int64
 		// Use firing_at (when alert started firing) instead of created_at which can be
 		// corrupted to zero by GORM Save. This also matches reports/export filter behaviour.
-		h.DB.Model(&models.Alert{}).Where("firing_at >= ? AND firing_at < ?", bucketStart, bucketEnd).Count(&count)
+		scopeTeam(h.DB.Model(&models.Alert{}), c).Where("firing_at >= ? AND firing_at < ?", bucketStart, bucketEnd).Count(&count)
 		data = append(data, gin.H{"hour": bucketStart.Format(time.RFC3339), "count": count})
 	}
 	c.JSON(http.StatusOK, gin.H{"data": data})
@@ -218,8 +221,9 @@ func parseIntDefault(s string, defaultVal int) (int, error) {
 }
 
 // Aggregate returns counts by time, datasource, or severity.
+// group_by=hour_of_week returns a 7x24 matrix instead (see hourOfWeekMatrix).
 func (h *ReportHandler) Aggregate(c *gin.Context) {
-	groupBy := c.Query("group_by") // time, datasource, severity
+	groupBy := c.Query("group_by") // time, datasource, rule, severity, hour_of_week
 	from := c.Query("from")
 	to := c.Query("to")
 	var fromT, toT time.Time
@@ -235,7 +239,16 @@ func (h *ReportHandler) Aggregate(c *gin.Context) {
 	}
 
 	// Use firing_at so aggregate matches "alerts that fired in this range" (same as export and alert history)
-	q := h.DB.Model(&models.Alert{}).Where("firing_at >= ? AND firing_at <= ?", fromT, toT)
+	q := scopeTeam(h.DB.Model(&models.Alert{}), c).Where("firing_at >= ? AND firing_at <= ?", fromT, toT)
+	if groupBy == "hour_of_week" {
+		var firingTimes []time.Time
+		if err := q.Pluck("firing_at", &firingTimes).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": hourOfWeekMatrix(firingTimes, locShanghai), "timezone": locShanghai.String()})
+		return
+	}
 	var results []AggregationResult
 	switch groupBy {
 	case "severity":
@@ -256,6 +269,15 @@ func (h *ReportHandler) Aggregate(c *gin.Context) {
 		for _, r := range rows {
 			results = append(results, AggregationResult{Dimension: fmt.Sprintf("%d", r.SourceID), Count: r.Count})
 		}
+	case "rule", "rule_id":
+		var rows []struct {
+			RuleID uint
+			Count  int64
+		}
+		q.Where("rule_id > 0").Select("rule_id as rule_id, count(*) as count").Group("rule_id").Scan(&rows)
+		for _, r := range rows {
+			results = append(results, AggregationResult{Dimension: fmt.Sprintf("%d", r.RuleID), Count: r.Count})
+		}
 	case "time", "day":
 		var rows []struct {
 			Day   string
@@ -273,6 +295,21 @@ func (h *ReportHandler) Aggregate(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": results})
 }
 
+// hourOfWeekMatrix counts alerts per (weekday, hour) in loc for the heatmap report.
+// Row index is time.Weekday (0 = Sunday), column index is the hour of day (0-23).
+// Bucketing is done in Go because SQLite and PostgreSQL have no common timezone-aware date functions.
+func hourOfWeekMatrix(times []time.Time, loc *time.Location) [7][24]int64 {
+	var m [7][24]int64
+	for _, t := range times {
+		if t.IsZero() {
+			continue
+		}
+		lt := t.In(loc)
+		m[lt.Weekday()][lt.Hour()]++
+	}
+	return m
+}
+
 // Preview returns paginated alert list + summary stats for the selected date range.
 // Used by the reports UI to show a data table before exporting.
 func (h *ReportHandler) Preview(c *gin.Context) {
@@ -295,7 +332,7 @@ func (h *ReportHandler) Preview(c *gin.Context) {
 		pageSize = 20
 	}
 
-	q := h.DB.Model(&models.Alert{})
+	q := scopeTeam(h.DB.Model(&models.Alert{}), c)
 	if from != "" {
 		if t, err := time.Parse(time.RFC3339, from); err == nil {
 			q = q.Where("firing_at >= ?", t)
@@ -360,6 +397,7 @@ func (h *ReportHandler) Preview(c *gin.Context) {
 			"value":           value,
 			"labels":          a.Labels,
 			"source_type":     a.SourceType,
+			"rule_id":         a.RuleID,
 		})
 	}
 
@@ -375,16 +413,30 @@ func (h *ReportHandler) Preview(c *gin.Context) {
 	})
 }
 
-// Export alerts as JSON or CSV based on format= query (default json).
+// Export alerts as JSON, CSV, Excel or PDF based on format= query (default json).
 func (h *ReportHandler) Export(c *gin.Context) {
 	from := c.Query("from")
 	to := c.Query("to")
-	format := c.Query("format")
-	if format == "" {
-		format = "json"
+	list, err := loadExportAlerts(scopeTeam(h.DB, c), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	data, contentType, ext, err := renderAlertExport(list, c.Query("format"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	// Filter by firing_at so export matches "alerts that fired in this range" (same as alert history semantics)
-	q := h.DB.Model(&models.Alert{})
+	dateStr := time.Now().UTC().Format("2006-01-02")
+	c.Header("Content-Disposition", "attachment; filename=alerts-"+dateStr+ext)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// loadExportAlerts returns up to 10000 alerts whose firing_at is within [from, to] (RFC3339, either may be empty).
+// Filter by firing_at so export matches "alerts that fired in this range" (same as alert history semantics).
+// Pass a team-scoped db (scopeTeam) to restrict the export to the caller's team.
+func loadExportAlerts(db *gorm.DB, from, to string) ([]models.Alert, error) {
+	q := db.Model(&models.Alert{})
 	if from != "" {
 		if t, err := time.Parse(time.RFC3339, from); err == nil {
 			q = q.Where("firing_at >= ?", t)
@@ -397,28 +449,32 @@ func (h *ReportHandler) Export(c *gin.Context) {
 	}
 	var list []models.Alert
 	if err := q.Order("firing_at desc, created_at desc").Limit(10000).Find(&list).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	dateStr := time.Now().UTC().Format("2006-01-02")
-	if format == "csv" {
-		c.Header("Content-Type", "text/csv; charset=utf-8")
-		c.Header("Content-Disposition", "attachment; filename=alerts-"+dateStr+".csv")
-		writeAlertsCSV(c.Writer, list)
-		return
+		return nil, err
 	}
-	if format == "xlsx" || format == "excel" {
+	return list, nil
+}
+
+// renderAlertExport encodes alerts in the given format (json, csv, xlsx/excel, pdf; default json)
+// and returns the bytes, content type and file extension.
+func renderAlertExport(list []models.Alert, format, from, to string) ([]byte, string, string, error) {
+	switch format {
+	case "csv":
+		var buf bytes.Buffer
+		writeAlertsCSV(&buf, list)
+		return buf.Bytes(), "text/csv; charset=utf-8", ".csv", nil
+	case "xlsx", "excel":
 		buf, err := writeAlertsExcel(list)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return nil, "", "", err
 		}
-		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-		c.Header("Content-Disposition", "attachment; filename=alerts-"+dateStr+".xlsx")
-		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
-		return
+		return buf.Bytes(), "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx", nil
+	case "pdf":
+		buf, err := writeAlertsPDF(list, from, to)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return buf.Bytes(), "application/pdf", ".pdf", nil
 	}
-	c.Header("Content-Disposition", "attachment; filename=alerts-"+dateStr+".json")
 	now := time.Now()
 	out := make([]map[string]interface{}, 0, len(list))
 	for _, a := range list {
@@ -435,5 +491,9 @@ func (h *ReportHandler) Export(c *gin.Context) {
 		m["created_at"] = formatInShanghai(a.CreatedAt, exportTimeLayout)
 		out = append(out, m)
 	}
-	c.JSON(http.StatusOK, out)
+	b, err := json.Marshal(out)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return b, "application/json; charset=utf-8", ".json", nil
 }
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// actingUsername returns the authenticated username from the JWT context, or "" when unauthenticated.
+func actingUsername(c *gin.Context) string {
+	if v, ok := c.Get("username"); ok {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// recordRuleRevision stores a snapshot of r and prunes revisions beyond the configured retention.
+// Failures are logged only; history must never block saving the rule itself.
+func recordRuleRevision(db *gorm.DB, r *models.Rule, username, action string) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("[rules] revision snapshot for rule %d: %v", r.ID, err)
+		return
+	}
+	rev := models.RuleRevision{RuleID: r.ID, Action: action, Username: username, Snapshot: string(b)}
+	if err := db.Create(&rev).Error; err != nil {
+		log.Printf("[rules] save revision for rule %d: %v", r.ID, err)
+		return
+	}
+	keep := systemConfigInt(db, ConfigKeyRuleRevisionRetention, DefaultRuleRevisionRetention)
+	var stale []uint
+	db.Model(&models.RuleRevision{}).Where("rule_id = ?", r.ID).Order("id desc").Offset(keep).Pluck("id", &stale)
+	if len(stale) > 0 {
+		db.Where("id IN ?", stale).Delete(&models.RuleRevision{})
+	}
+}
+
+// Revisions lists a rule's revisions, newest first. Snapshots have jira_config removed.
+func (h *RuleHandler) Revisions(c *gin.Context) {
+	var list []models.RuleRevision
+	if err := h.DB.Where("rule_id = ?", c.Param("id")).Order("id desc").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	out := make([]gin.H, 0, len(list))
+	for _, rev := range list {
+		var snap map[string]interface{}
+		_ = json.Unmarshal([]byte(rev.Snapshot), &snap)
+		delete(snap, "jira_config")
+		out = append(out, gin.H{
+			"id":         rev.ID,
+			"rule_id":    rev.RuleID,
+			"action":     rev.Action,
+			"username":   rev.Username,
+			"created_at": rev.CreatedAt,
+			"snapshot":   snap,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": out})
+}
+
+// Revert restores a rule to the state captured in a revision (recorded as a new "revert" revision).
+func (h *RuleHandler) Revert(c *gin.Context) {
+	var current models.Rule
+	if err := h.DB.First(&current, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var rev models.RuleRevision
+	if err := h.DB.Where("id = ? AND rule_id = ?", c.Param("revision_id"), current.ID).First(&rev).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+	var r models.Rule
+	if err := json.Unmarshal([]byte(rev.Snapshot), &r); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid revision snapshot: " + err.Error()})
+		return
+	}
+	// Keep server-managed fields from the live row
+	r.ID = current.ID
+	r.CreatedAt = current.CreatedAt
+	r.LastRunAt = current.LastRunAt
+	r.SilencedUntil = current.SilencedUntil
+	r.Paused = current.Paused
+	r.LastError, r.LastErrorAt = current.LastError, current.LastErrorAt
+	r.LastEvalDurationMs, r.LastSeriesCount = current.LastEvalDurationMs, current.LastSeriesCount
+	r.DeletedAt = current.DeletedAt
+	if err := h.DB.Save(&r).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordRuleRevision(h.DB, &r, actingUsername(c), "revert")
+	if h.Scheduler != nil {
+		h.Scheduler.RunRuleNow(r.ID)
+	}
+	stripJiraConfig(&r)
+	c.JSON(http.StatusOK, r)
+}
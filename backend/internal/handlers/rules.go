@@ -3,13 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/engine"
 	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/relabel"
 	"github.com/kk-alert/backend/internal/query"
 	"github.com/kk-alert/backend/internal/scheduler"
 	"gorm.io/gorm"
@@ -61,7 +66,7 @@ func stripJiraConfig(r *models.Rule) { r.JiraConfig = "" }
 // Query: name — fuzzy match on rule name (LIKE %name%).
 func (h *RuleHandler) List(c *gin.Context) {
 	name := strings.TrimSpace(c.Query("name"))
-	q := h.DB.Model(&models.Rule{})
+	q := scopeTeam(h.DB.Model(&models.Rule{}), c)
 	if name != "" {
 		q = q.Where("name LIKE ?", "%"+name+"%")
 	}
@@ -90,7 +95,7 @@ func (h *RuleHandler) List(c *gin.Context) {
 // Get by ID.
 func (h *RuleHandler) Get(c *gin.Context) {
 	var r models.Rule
-	if err := h.DB.First(&r, c.Param("id")).Error; err != nil {
+	if err := scopeTeam(h.DB, c).First(&r, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
@@ -112,10 +117,25 @@ func (h *RuleHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateRuleFields(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkTeam(h.DB, r.TeamID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("validate") == "true" {
+		if status, err := h.validatePromQL(c.Request.Context(), &r); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	if err := h.DB.Create(&r).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordRuleRevision(h.DB, &r, actingUsername(c), "create")
 	if h.Scheduler != nil {
 		h.Scheduler.RunRuleNow(r.ID)
 	}
@@ -145,11 +165,30 @@ func (h *RuleHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateRuleFields(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkTeam(h.DB, body.TeamID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("validate") == "true" {
+		if status, err := h.validatePromQL(c.Request.Context(), &body); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	body.ID = r.ID
+	body.SilencedUntil = r.SilencedUntil // managed by Silence/Unsilence only
+	body.Paused = r.Paused               // managed by Pause/Resume only
+	body.LastError, body.LastErrorAt = r.LastError, r.LastErrorAt
+	body.LastEvalDurationMs, body.LastSeriesCount = r.LastEvalDurationMs, r.LastSeriesCount
 	if err := h.DB.Save(&body).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordRuleRevision(h.DB, &body, actingUsername(c), "update")
 	if h.Scheduler != nil {
 		h.Scheduler.RunRuleNow(body.ID)
 	}
@@ -157,6 +196,121 @@ func (h *RuleHandler) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, body)
 }
 
+// isHTTPURL reports whether s is an absolute http(s) URL.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validateRuleFields checks rule fields that would otherwise fail silently at evaluation time.
+func validateRuleFields(r *models.Rule) error {
+	if _, err := engine.ParseRoutes(r.Routes); err != nil {
+		return err
+	}
+	if _, err := engine.ParseSeverityChannels(r.SeverityChannels); err != nil {
+		return err
+	}
+	if _, err := engine.ParseFallbackChannelIDs(r.FallbackChannelIDs); err != nil {
+		return err
+	}
+	if _, err := relabel.Parse(r.RelabelConfig); err != nil {
+		return err
+	}
+	if r.RunbookURL != "" && !isHTTPURL(r.RunbookURL) {
+		return fmt.Errorf("runbook_url must be an http(s) URL")
+	}
+	if r.EnrichURL != "" && !isHTTPURL(r.EnrichURL) {
+		return fmt.Errorf("enrich_url must be an http(s) URL")
+	}
+	if r.DigestInterval != "" {
+		if d, err := time.ParseDuration(r.DigestInterval); err != nil || d < time.Minute {
+			return fmt.Errorf("digest_interval must be a duration of at least 1m")
+		}
+	}
+	if r.FlapThreshold < 0 || r.FlapThreshold == 1 {
+		return fmt.Errorf("flap_threshold must be 0 (off) or at least 2")
+	}
+	if r.QueryTimeout != "" {
+		d, err := time.ParseDuration(r.QueryTimeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid query_timeout %q (use a duration such as 5s or 1m)", r.QueryTimeout)
+		}
+		if d > scheduler.MaxQueryTimeout {
+			return fmt.Errorf("query_timeout must not exceed %s", scheduler.MaxQueryTimeout)
+		}
+	}
+	for _, l := range scheduler.ParseThresholds(r.Thresholds) {
+		if l.EvalFor < 0 {
+			return fmt.Errorf("thresholds: eval_for must not be negative")
+		}
+		if l.ResolveValue == nil {
+			continue
+		}
+		switch l.Operator {
+		case "==", "!=":
+			return fmt.Errorf("thresholds: resolve_value is not supported with operator %s", l.Operator)
+		case "<", "<=":
+			if *l.ResolveValue < l.Value {
+				return fmt.Errorf("thresholds: resolve_value for %s %v must not be below the threshold", l.Operator, l.Value)
+			}
+		default:
+			if *l.ResolveValue > l.Value {
+				return fmt.Errorf("thresholds: resolve_value for %s %v must not be above the threshold", l.Operator, l.Value)
+			}
+		}
+	}
+	if r.QueryOffset != "" {
+		if d, err := time.ParseDuration(r.QueryOffset); err != nil || d < 0 {
+			return fmt.Errorf("invalid query_offset %q (use a duration such as 30s or 2m)", r.QueryOffset)
+		}
+	}
+	if r.MaxSeries < 0 {
+		return fmt.Errorf("max_series must be 0 (use MAX_SERIES) or positive")
+	}
+	if r.ReprocessInterval != "" {
+		d, err := time.ParseDuration(r.ReprocessInterval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid reprocess_interval %q (use a duration such as 5m)", r.ReprocessInterval)
+		}
+		if ci := scheduler.CheckInterval(r.CheckInterval); d < ci {
+			return fmt.Errorf("reprocess_interval must not be shorter than the check interval (%s)", ci)
+		}
+	}
+	return nil
+}
+
+// validatePromQL asks the rule's first Prometheus/VictoriaMetrics datasource (or the first enabled one when
+// datasource_ids is empty) to parse the expression. Returns 400 for an invalid expression and 502 when no
+// datasource could be asked. Non-PromQL rules and empty expressions are not validated.
+func (h *RuleHandler) validatePromQL(ctx context.Context, r *models.Rule) (int, error) {
+	expr := strings.TrimSpace(r.QueryExpression)
+	if expr == "" || (r.QueryLanguage != "" && r.QueryLanguage != "promql") {
+		return http.StatusOK, nil
+	}
+	var dsIDs []uint
+	_ = json.Unmarshal([]byte(r.DatasourceIDs), &dsIDs)
+	var ds models.Datasource
+	q := h.DB.Where("type IN ?", []string{"prometheus", "victoriametrics"})
+	if len(dsIDs) > 0 {
+		q = q.Where("id IN ?", dsIDs)
+	} else {
+		q = q.Where("enabled = ?", true)
+	}
+	if err := q.Order("id asc").First(&ds).Error; err != nil {
+		return http.StatusBadGateway, fmt.Errorf("promql validation: no prometheus/victoriametrics datasource available")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := query.NewPrometheusClient(ds.Endpoint).Validate(ctx, expr); err != nil {
+		var invalid *query.InvalidQueryError
+		if errors.As(err, &invalid) {
+			return http.StatusBadRequest, fmt.Errorf("invalid promql: %s", invalid.Message)
+		}
+		return http.StatusBadGateway, fmt.Errorf("promql validation against datasource %d failed: %v", ds.ID, err)
+	}
+	return http.StatusOK, nil
+}
+
 // Trigger runs a rule immediately (manual trigger from UI).
 func (h *RuleHandler) Trigger(c *gin.Context) {
 	var r models.Rule
@@ -180,15 +334,114 @@ func (h *RuleHandler) Trigger(c *gin.Context) {
 	}
 }
 
-// Delete rule.
+// Silence mutes notifications for every alert of a rule for duration_minutes (same body as alert silences).
+// The rule keeps evaluating and recording alerts; the silence expires on its own.
+func (h *RuleHandler) Silence(c *gin.Context) {
+	var r models.Rule
+	if err := scopeTeam(h.DB, c).First(&r, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var req CreateSilenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.DurationMinutes <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration_minutes required and must be positive"})
+		return
+	}
+	if req.DurationMinutes > 60*24*30 {
+		req.DurationMinutes = 60 * 24 * 30 // cap 30 days
+	}
+	until := time.Now().Add(time.Duration(req.DurationMinutes) * time.Minute)
+	if err := h.DB.Model(&r).UpdateColumn("silenced_until", until).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rule_id": r.ID, "silenced_until": until.Format(time.RFC3339)})
+}
+
+// Unsilence lifts a rule silence early.
+func (h *RuleHandler) Unsilence(c *gin.Context) {
+	res := scopeTeam(h.DB.Model(&models.Rule{}), c).Where("id = ?", c.Param("id")).UpdateColumn("silenced_until", nil)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// Pause keeps a rule evaluating (firing/resolve tracking and history continue) but stops its notifications
+// until Resume. Unlike disabling, the scheduler keeps the rule's in-memory state.
+func (h *RuleHandler) Pause(c *gin.Context) {
+	h.setPaused(c, true)
+}
+
+// Resume re-enables notifications for a paused rule.
+func (h *RuleHandler) Resume(c *gin.Context) {
+	h.setPaused(c, false)
+}
+
+func (h *RuleHandler) setPaused(c *gin.Context, paused bool) {
+	res := scopeTeam(h.DB.Model(&models.Rule{}), c).Where("id = ?", c.Param("id")).UpdateColumn("paused", paused)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "paused": paused})
+}
+
+// Delete rule (soft delete: sets deleted_at; the scheduler stops the rule on its next tick and it can be restored).
 func (h *RuleHandler) Delete(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err := h.DB.Delete(&models.Rule{}, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// A restored rule starts with fresh per-series state.
+	scheduler.DeleteRuleState(h.DB, uint(id))
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
+// ListDeleted returns soft-deleted rules, most recently deleted first.
+func (h *RuleHandler) ListDeleted(c *gin.Context) {
+	var list []models.Rule
+	if err := h.DB.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	out := make([]gin.H, 0, len(list))
+	for i := range list {
+		stripJiraConfig(&list[i])
+		out = append(out, gin.H{"rule": list[i], "deleted_at": list[i].DeletedAt.Time})
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": out})
+}
+
+// Restore undoes a soft delete and reschedules the rule.
+func (h *RuleHandler) Restore(c *gin.Context) {
+	var r models.Rule
+	if err := h.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&r, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deleted rule not found"})
+		return
+	}
+	if err := h.DB.Unscoped().Model(&r).Update("deleted_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	r.DeletedAt = gorm.DeletedAt{}
+	if h.Scheduler != nil {
+		h.Scheduler.RunRuleNow(r.ID)
+	}
+	stripJiraConfig(&r)
+	c.JSON(http.StatusOK, r)
+}
+
 // BatchRequest for enable/disable/delete.
 type BatchRequest struct {
 	IDs    []uint `json:"ids" binding:"required"`
@@ -216,6 +469,9 @@ func (h *RuleHandler) Batch(c *gin.Context) {
 		res := h.DB.Delete(&models.Rule{}, req.IDs)
 		ok = int(res.RowsAffected)
 		fail = len(req.IDs) - ok
+		for _, id := range req.IDs {
+			scheduler.DeleteRuleState(h.DB, id)
+		}
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid action"})
 		return
@@ -225,13 +481,22 @@ func (h *RuleHandler) Batch(c *gin.Context) {
 
 // ExportBody optional body with ids.
 type ExportBody struct {
-	IDs []uint `json:"ids"`
+	IDs    []uint `json:"ids"`
+	Format string `json:"format,omitempty"` // rules only: json (default) or prometheus_yaml; also accepted as ?format=
 }
 
-// Export returns selected rules as JSON.
+// Export returns selected rules as JSON, or with format=prometheus_yaml as a Prometheus alerting-rules YAML
+// group (promql rules only; the others are listed under skipped).
 func (h *RuleHandler) Export(c *gin.Context) {
 	var body ExportBody
 	_ = c.ShouldBindJSON(&body)
+	if f := c.Query("format"); f != "" {
+		body.Format = f
+	}
+	if body.Format != "" && body.Format != "json" && body.Format != "prometheus_yaml" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or prometheus_yaml"})
+		return
+	}
 	var list []models.Rule
 	q := h.DB.Model(&models.Rule{})
 	if len(body.IDs) > 0 {
@@ -241,6 +506,15 @@ func (h *RuleHandler) Export(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if body.Format == "prometheus_yaml" {
+		out, skipped, err := exportPrometheusYAML(list)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"yaml": out, "skipped": skipped})
+		return
+	}
 	// Strip JiraConfig for export
 	out := make([]map[string]interface{}, 0, len(list))
 	for _, r := range list {
@@ -285,19 +559,77 @@ func (h *RuleHandler) Import(c *gin.Context) {
 			failed++
 			continue
 		}
+		recordRuleRevision(h.DB, &r, actingUsername(c), "import")
 		imported++
 	}
 	c.JSON(http.StatusOK, gin.H{"imported": imported, "failed": failed})
 }
 
+// ImportPrometheus creates rules from a Prometheus alerting-rules YAML file (see rulesFromPrometheusYAML),
+// attached to the given datasources and channels.
+func (h *RuleHandler) ImportPrometheus(c *gin.Context) {
+	var req PrometheusImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkTeam(h.DB, req.TeamID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rules, skipped, err := rulesFromPrometheusYAML(req.YAML)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	dsJSON, _ := json.Marshal(req.DatasourceIDs)
+	chJSON, _ := json.Marshal(req.ChannelIDs)
+	enabled := req.Enabled == nil || *req.Enabled
+	var imported, failed int
+	ids := []uint{}
+	for i := range rules {
+		r := &rules[i]
+		r.DatasourceIDs, r.ChannelIDs, r.Enabled = string(dsJSON), string(chJSON), enabled
+		if len(req.DatasourceIDs) == 0 {
+			r.DatasourceIDs = ""
+		}
+		if len(req.ChannelIDs) == 0 {
+			r.ChannelIDs = ""
+		}
+		r.TeamID = req.TeamID
+		if err := validateRuleFields(r); err != nil {
+			skipped = append(skipped, skippedRule{Name: r.Name, Reason: err.Error()})
+			continue
+		}
+		if err := h.DB.Create(r).Error; err != nil {
+			failed++
+			continue
+		}
+		if !enabled {
+			// Create skips zero values, so the column default (true) applies; write false explicitly.
+			h.DB.Model(r).UpdateColumn("enabled", false)
+		}
+		recordRuleRevision(h.DB, r, actingUsername(c), "import")
+		if h.Scheduler != nil && enabled {
+			h.Scheduler.RunRuleNow(r.ID)
+		}
+		ids = append(ids, r.ID)
+		imported++
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": imported, "failed": failed, "rule_ids": ids, "skipped": skipped})
+}
+
 // TestMatchRequest for testing rule match.
 type TestMatchRequest struct {
 	DatasourceIDs   string `json:"datasource_ids"`
 	QueryLanguage   string `json:"query_language"`
 	QueryExpression string `json:"query_expression"`
 	MatchLabels     string `json:"match_labels"`
+	MatchLabelsAny  string `json:"match_labels_any"` // at least one pair must match
 	MatchSeverity   string `json:"match_severity"`
 	Thresholds      string `json:"thresholds"` // JSON array of multi-level thresholds
+	QueryOffset     string `json:"query_offset"`
+	RuleID          uint   `json:"rule_id"`    // optional saved rule being edited: its current breach counts are included
 }
 
 // TestMatchResponse for test match result.
@@ -319,6 +651,7 @@ type MatchedAlert struct {
 	Labels   map[string]string `json:"labels"`
 	Status   string            `json:"status"`
 	Value    float64           `json:"value"` // metric value for threshold display
+	Breaches int               `json:"breaches"` // consecutive evaluations the scheduler has seen this series breaching (saved rules only)
 }
 
 // TestMatch runs PromQL (or other query) on selected datasources in real time and returns
@@ -335,8 +668,16 @@ func (h *RuleHandler) TestMatch(c *gin.Context) {
 		QueryLanguage:   req.QueryLanguage,
 		QueryExpression: req.QueryExpression,
 		MatchLabels:     req.MatchLabels,
+		MatchLabelsAny:  req.MatchLabelsAny,
 		MatchSeverity:   req.MatchSeverity,
 		Thresholds:      req.Thresholds,
+		QueryOffset:     req.QueryOffset,
+	}
+	if req.RuleID != 0 {
+		var saved models.Rule
+		if scopeTeam(h.DB, c).Where("id = ?", req.RuleID).Limit(1).Find(&saved); saved.ID != 0 {
+			rule.ID, rule.Name = saved.ID, saved.Name
+		}
 	}
 
 	var dsIDs []uint
@@ -352,12 +693,12 @@ func (h *RuleHandler) TestMatch(c *gin.Context) {
 		})
 		return
 	}
-	if rule.QueryLanguage != "" && rule.QueryLanguage != "promql" {
+	if !vectorQueryLanguage(rule.QueryLanguage) {
 		c.JSON(http.StatusOK, TestMatchResponse{
 			Matched:       false,
 			TotalAlerts:   0,
 			MatchedAlerts: nil,
-			Message:       "当前仅支持 PromQL 的测试匹配，请选择查询语言为 PromQL。",
+			Message:       "当前仅支持 PromQL、LogQL、InfluxQL 与 Flux 的测试匹配，请选择对应的查询语言。",
 		})
 		return
 	}
@@ -386,8 +727,59 @@ func (h *RuleHandler) TestMatch(c *gin.Context) {
 	})
 }
 
-// runTestMatchPromQL runs PromQL on each selected Prometheus/VictoriaMetrics datasource and returns
-// synthetic matched alerts. When thresholds are configured, applies threshold filtering and assigns
+// Series runs the saved rule's query now and returns the currently matching series with values and
+// computed severities (same evaluation as TestMatch, without re-posting the rule).
+func (h *RuleHandler) Series(c *gin.Context) {
+	var rule models.Rule
+	if err := h.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if strings.TrimSpace(rule.QueryExpression) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rule has no query expression"})
+		return
+	}
+	if !vectorQueryLanguage(rule.QueryLanguage) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "series preview only supports promql, logql, influxql and flux rules"})
+		return
+	}
+	var dsIDs []uint
+	_ = json.Unmarshal([]byte(rule.DatasourceIDs), &dsIDs)
+	if len(dsIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rule has no datasource"})
+		return
+	}
+	// The scheduler evaluates against the first datasource only; preview the same.
+	matched, total, rawSeries, message, _, _, err := h.runTestMatchPromQL(c.Request.Context(), &rule, dsIDs[:1])
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "执行 PromQL 失败: " + err.Error()})
+		return
+	}
+	if matched == nil {
+		matched = []MatchedAlert{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"rule_id":          rule.ID,
+		"series":           matched,
+		"total":            total,
+		"raw_series_count": rawSeries,
+		"message":          message,
+		"evaluated_at":     time.Now(),
+	})
+}
+
+// vectorQueryLanguage reports whether rules in lang return a vector that TestMatch and Series can evaluate.
+// An empty language means PromQL.
+func vectorQueryLanguage(lang string) bool {
+	switch lang {
+	case "", "promql", "logql", "influxql", "flux":
+		return true
+	}
+	return false
+}
+
+// runTestMatchPromQL runs the rule's PromQL, LogQL, InfluxQL or Flux query on each selected datasource of a
+// matching type and returns synthetic matched alerts. When thresholds are configured, applies threshold filtering and assigns
 // severity per level — mirroring the real scheduler evaluation.
 func (h *RuleHandler) runTestMatchPromQL(ctx context.Context, rule *models.Rule, dsIDs []uint) (
 	matched []MatchedAlert, total int, rawSeriesCount int, message string, fromDS int, withSev int, err error,
@@ -401,17 +793,37 @@ func (h *RuleHandler) runTestMatchPromQL(ctx context.Context, rule *models.Rule,
 			lastErr = fmt.Errorf("数据源 %d 不存在", id)
 			continue
 		}
-		if ds.Type != "prometheus" && ds.Type != "victoriametrics" {
-			lastErr = fmt.Errorf("数据源 %d 类型 %s 不支持 PromQL 测试", id, ds.Type)
+		lang := rule.QueryLanguage
+		if lang == "" {
+			lang = "promql"
+		}
+		if !scheduler.SupportsLanguage(ds.Type, lang) {
+			lastErr = fmt.Errorf("数据源 %d 类型 %s 不支持 %s 测试", id, ds.Type, lang)
 			continue
 		}
-		client := query.NewPrometheusClient(ds.Endpoint)
-		result, qerr := client.Query(ctx, rule.QueryExpression)
+		var result *query.QueryResult
+		var qerr error
+		switch lang {
+		case "logql":
+			client := query.NewLokiClient(ds.Endpoint)
+			client.Offset = scheduler.QueryOffset(rule)
+			result, qerr = client.Query(ctx, rule.QueryExpression)
+		case "influxql", "flux":
+			client := query.NewInfluxClient(ds.Endpoint)
+			client.Language = lang
+			client.Database, client.Org = ds.Database, ds.Org
+			client.AuthType, client.AuthValue = ds.AuthType, ds.AuthValue
+			result, qerr = client.Query(ctx, rule.QueryExpression)
+		default:
+			client := query.NewPrometheusClient(ds.Endpoint)
+			client.Offset = scheduler.QueryOffset(rule)
+			result, qerr = client.Query(ctx, rule.QueryExpression)
+		}
 		if qerr != nil {
 			lastErr = qerr
 			continue
 		}
-		for _, r := range result.Data.Result {
+		for i, r := range result.Data.Result {
 			rawSeriesCount++
 			labels := r.Metric
 			if labels == nil {
@@ -437,6 +849,10 @@ func (h *RuleHandler) runTestMatchPromQL(ctx context.Context, rule *models.Rule,
 				}
 			}
 
+			breaches := 0
+			if rule.ID != 0 {
+				breaches = scheduler.BreachCount(rule.ID, id, rule.Name, r.Metric, i)
+			}
 			total++
 			title := formatMetricForTest(r.Metric)
 			alertID := generateFingerprintForTest(r.Metric, id)
@@ -447,6 +863,7 @@ func (h *RuleHandler) runTestMatchPromQL(ctx context.Context, rule *models.Rule,
 				Labels:   labels,
 				Status:   "firing",
 				Value:    value,
+				Breaches: breaches,
 			})
 		}
 	}
@@ -459,7 +876,7 @@ func (h *RuleHandler) runTestMatchPromQL(ctx context.Context, rule *models.Rule,
 		if rule.MatchSeverity == "" || rule.MatchSeverity == a.Severity {
 			withSev++
 		}
-		if !matchLabelsForTest(rule.MatchLabels, a.Labels) {
+		if !matchLabelsForTest(rule, a.Labels) {
 			continue
 		}
 		if rule.MatchSeverity != "" && rule.MatchSeverity != a.Severity {
@@ -500,19 +917,6 @@ func generateFingerprintForTest(metric map[string]string, dsID uint) string {
 	return fmt.Sprintf("test-%d-%s", dsID, formatMetricForTest(metric))
 }
 
-func matchLabelsForTest(matchLabelsJSON string, labels map[string]string) bool {
-	if matchLabelsJSON == "" || matchLabelsJSON == "{}" {
-		return true
-	}
-	var want map[string]string
-	if err := json.Unmarshal([]byte(matchLabelsJSON), &want); err != nil || len(want) == 0 {
-		return true
-	}
-	for k, v := range want {
-		if labels[k] != v {
-			return false
-		}
-	}
-	return true
+func matchLabelsForTest(rule *models.Rule, labels map[string]string) bool {
+	return engine.RuleLabelsMatch(rule, labels)
 }
-
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/scheduler"
+	"gopkg.in/yaml.v3"
+)
+
+// promRuleFile is a Prometheus rule file (https://prometheus.io/docs/prometheus/latest/configuration/alerting_rules/).
+type promRuleFile struct {
+	Groups []promRuleGroup `yaml:"groups"`
+}
+
+type promRuleGroup struct {
+	Name        string          `yaml:"name"`
+	Interval    string          `yaml:"interval,omitempty"`
+	QueryOffset string          `yaml:"query_offset,omitempty"` // imported as each rule's query_offset
+	Rules       []promAlertRule `yaml:"rules"`
+}
+
+type promAlertRule struct {
+	Record      string            `yaml:"record,omitempty"` // recording rules are not imported
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// skippedRule is a rule left out of a conversion, with the reason.
+type skippedRule struct {
+	ID     uint   `json:"id,omitempty"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// prometheusAlertRules converts a promql rule into Prometheus alerting rules: one per threshold level with the
+// threshold inlined into expr (severity from the level), or a single rule using the expression as is.
+func prometheusAlertRules(r *models.Rule) []promAlertRule {
+	base := promAlertRule{
+		Alert: r.Name,
+		Expr:  strings.TrimSpace(r.QueryExpression),
+	}
+	if r.Duration != "" && r.Duration != "0" {
+		base.For = r.Duration
+	}
+	annotations := map[string]string{}
+	if r.Description != "" {
+		annotations["description"] = r.Description
+	}
+	if r.RunbookURL != "" {
+		annotations["runbook_url"] = r.RunbookURL
+	}
+	if len(annotations) > 0 {
+		base.Annotations = annotations
+	}
+	severity := r.MatchSeverity
+	if severity == "" {
+		severity = "warning"
+	}
+	levels := scheduler.ParseThresholds(r.Thresholds)
+	if len(levels) == 0 {
+		base.Labels = map[string]string{"severity": severity}
+		return []promAlertRule{base}
+	}
+	out := make([]promAlertRule, 0, len(levels))
+	for _, l := range levels {
+		pr := base
+		pr.Expr = "(" + base.Expr + ") " + l.Operator + " " + strconv.FormatFloat(l.Value, 'f', -1, 64)
+		if l.Severity != "" {
+			pr.Labels = map[string]string{"severity": l.Severity}
+		} else {
+			pr.Labels = map[string]string{"severity": severity}
+		}
+		out = append(out, pr)
+	}
+	return out
+}
+
+// exportPrometheusYAML renders the promql rules in list (an empty query_language is promql) as one Prometheus
+// alerting-rules group; other rules are returned as skipped.
+func exportPrometheusYAML(list []models.Rule) (string, []skippedRule, error) {
+	group := promRuleGroup{Name: "kk-alert", Rules: []promAlertRule{}}
+	skipped := []skippedRule{}
+	for i := range list {
+		r := &list[i]
+		if (r.QueryLanguage != "" && r.QueryLanguage != "promql") || strings.TrimSpace(r.QueryExpression) == "" {
+			skipped = append(skipped, skippedRule{ID: r.ID, Name: r.Name, Reason: "not a promql rule"})
+			continue
+		}
+		group.Rules = append(group.Rules, prometheusAlertRules(r)...)
+	}
+	b, err := yaml.Marshal(promRuleFile{Groups: []promRuleGroup{group}})
+	return string(b), skipped, err
+}
+
+// PrometheusImportRequest for POST /rules/import-prometheus: a Prometheus rule file plus the datasource,
+// channels and team every imported rule is attached to.
+type PrometheusImportRequest struct {
+	YAML          string `json:"yaml" binding:"required"`
+	DatasourceIDs []uint `json:"datasource_ids"`
+	ChannelIDs    []uint `json:"channel_ids"`
+	TeamID        *uint  `json:"team_id"`
+	Enabled       *bool  `json:"enabled"` // default true
+}
+
+// rulesFromPrometheusYAML converts each alerting rule of a Prometheus rule file into a promql rule: expr is
+// the query, for the duration, labels.severity the severity and annotations.description (or summary) the
+// description. Recording rules and rules with values KK Alert cannot use are returned as skipped.
+func rulesFromPrometheusYAML(raw string) ([]models.Rule, []skippedRule, error) {
+	var file promRuleFile
+	if err := yaml.Unmarshal([]byte(raw), &file); err != nil {
+		return nil, nil, fmt.Errorf("invalid prometheus rules yaml: %w", err)
+	}
+	var out []models.Rule
+	skipped := []skippedRule{}
+	for _, g := range file.Groups {
+		interval := ""
+		if g.Interval != "" {
+			if _, err := time.ParseDuration(g.Interval); err == nil {
+				interval = g.Interval
+			}
+		}
+		offset := ""
+		if d, err := time.ParseDuration(g.QueryOffset); err == nil && d > 0 {
+			offset = g.QueryOffset
+		}
+		for _, pr := range g.Rules {
+			if pr.Alert == "" {
+				skipped = append(skipped, skippedRule{Name: pr.Record, Reason: "recording rule"})
+				continue
+			}
+			if strings.TrimSpace(pr.Expr) == "" {
+				skipped = append(skipped, skippedRule{Name: pr.Alert, Reason: "empty expr"})
+				continue
+			}
+			if pr.For != "" {
+				if _, err := time.ParseDuration(pr.For); err != nil {
+					skipped = append(skipped, skippedRule{Name: pr.Alert, Reason: "unsupported for: " + pr.For})
+					continue
+				}
+			}
+			r := models.Rule{
+				Name:            pr.Alert,
+				QueryLanguage:   "promql",
+				QueryExpression: strings.TrimSpace(pr.Expr),
+				Duration:        pr.For,
+				CheckInterval:   interval,
+				QueryOffset:     offset,
+				MatchSeverity:   pr.Labels["severity"],
+				Description:     pr.Annotations["description"],
+			}
+			if r.Description == "" {
+				r.Description = pr.Annotations["summary"]
+			}
+			if u := pr.Annotations["runbook_url"]; isHTTPURL(u) {
+				r.RunbookURL = u
+			}
+			out = append(out, r)
+		}
+	}
+	return out, skipped, nil
+}
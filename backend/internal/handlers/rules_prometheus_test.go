@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestExportPrometheusYAML(t *testing.T) {
+	list := []models.Rule{
+		{ID: 1, Name: "HighCPU", QueryLanguage: "promql", QueryExpression: "avg(cpu_usage)", Duration: "5m",
+			Description: "CPU above threshold", Thresholds: `[{"operator":">","value":80,"severity":"warning"},{"operator":">","value":95,"severity":"critical"}]`},
+		{ID: 2, Name: "Up", QueryExpression: "up == 0", MatchSeverity: "critical"}, // empty query_language means promql
+		{ID: 3, Name: "ES errors", QueryLanguage: "elasticsearch_sql", QueryExpression: "SELECT 1"},
+	}
+	out, skipped, err := exportPrometheusYAML(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"expr: (avg(cpu_usage)) > 80",
+		"expr: (avg(cpu_usage)) > 95",
+		"for: 5m",
+		"severity: critical",
+		"expr: up == 0",
+		"description: CPU above threshold",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if len(skipped) != 1 || skipped[0].ID != 3 {
+		t.Errorf("skipped: %+v", skipped)
+	}
+}
+
+func TestRulesFromPrometheusYAML(t *testing.T) {
+	raw := `groups:
+- name: node
+  interval: 30s
+  query_offset: 1m
+  rules:
+  - record: job:up:sum
+    expr: sum(up) by (job)
+  - alert: InstanceDown
+    expr: up == 0
+    for: 5m
+    labels:
+      severity: critical
+    annotations:
+      summary: Instance {{ $labels.instance }} down
+      runbook_url: https://wiki.example.com/instance-down
+  - alert: SlowDisk
+    expr: disk_latency > 1
+    for: 1d
+`
+	rules, skipped, err := rulesFromPrometheusYAML(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("expected 1 rule, got %d", len(rules))
+	}
+	r := rules[0]
+	if r.Name != "InstanceDown" || r.QueryExpression != "up == 0" || r.Duration != "5m" || r.MatchSeverity != "critical" ||
+		r.CheckInterval != "30s" || r.QueryOffset != "1m" || r.QueryLanguage != "promql" || r.RunbookURL == "" || !strings.Contains(r.Description, "down") {
+		t.Errorf("converted rule: %+v", r)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("expected recording rule and unsupported for to be skipped, got %+v", skipped)
+	}
+	if _, _, err := rulesFromPrometheusYAML("groups: ["); err == nil {
+		t.Error("expected error for invalid yaml")
+	}
+}
+
+func TestImportPrometheusChecksTeam(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Rule{}, &models.RuleRevision{}, &models.Team{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Team{ID: 1, Name: "dba"})
+	h := &RuleHandler{DB: db}
+	yaml := `"groups:\n- name: node\n  rules:\n  - alert: InstanceDown\n    expr: up == 0\n"`
+
+	if w := postJSON(h.ImportPrometheus, `{"yaml":`+yaml+`,"team_id":99}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown team: got %d %s, want 400", w.Code, w.Body.String())
+	}
+	if w := postJSON(h.ImportPrometheus, `{"yaml":`+yaml+`,"team_id":1}`); !strings.Contains(w.Body.String(), `"imported":1`) {
+		t.Fatalf("import: %d %s", w.Code, w.Body.String())
+	}
+	var r models.Rule
+	if err := db.First(&r).Error; err != nil || r.TeamID == nil || *r.TeamID != 1 {
+		t.Errorf("imported rule should belong to team 1: %+v %v", r, err)
+	}
+}
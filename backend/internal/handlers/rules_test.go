@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRuleDeleteDropsSeriesState(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Rule{}, &models.RuleSeriesState{}); err != nil {
+		t.Fatal(err)
+	}
+	for id := uint(1); id <= 3; id++ {
+		db.Create(&models.Rule{ID: id, Name: "r"})
+		db.Create(&models.RuleSeriesState{RuleID: id, ExternalID: "s", AlertID: "a", LastSeenAt: time.Now()})
+	}
+	h := &RuleHandler{DB: db}
+
+	if w := postJSON(h.Batch, `{"ids":[1,2],"action":"delete"}`); w.Code != http.StatusOK {
+		t.Fatalf("batch delete: %d %s", w.Code, w.Body.String())
+	}
+	var rows []models.RuleSeriesState
+	db.Find(&rows)
+	if len(rows) != 1 || rows[0].RuleID != 3 {
+		t.Errorf("batch delete should drop the deleted rules' series state: %+v", rows)
+	}
+}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/engine"
 	"github.com/kk-alert/backend/internal/models"
 	"gorm.io/gorm"
 )
@@ -14,8 +16,22 @@ import (
 const (
 	ConfigKeyRetentionDays = "retention_days"
 	DefaultRetentionDays   = 90
+
+	ConfigKeyRuleRevisionRetention = "rule_revision_retention"
+	DefaultRuleRevisionRetention   = 50
 )
 
+// systemConfigInt reads a positive integer setting, falling back to def when unset or invalid.
+func systemConfigInt(db *gorm.DB, key string, def int) int {
+	var cfg models.SystemConfig
+	if err := db.Where("key = ?", key).First(&cfg).Error; err == nil && cfg.Value != "" {
+		if v, e := strconv.Atoi(cfg.Value); e == nil && v > 0 {
+			return v
+		}
+	}
+	return def
+}
+
 // SettingsHandler provides GET/PUT for system settings (admin only).
 type SettingsHandler struct {
 	DB *gorm.DB
@@ -23,20 +39,39 @@ type SettingsHandler struct {
 
 // Get returns current system settings (e.g. retention_days). All authenticated users can read.
 func (h *SettingsHandler) Get(c *gin.Context) {
-	var cfg models.SystemConfig
-	err := h.DB.Where("key = ?", ConfigKeyRetentionDays).First(&cfg).Error
-	retentionDays := DefaultRetentionDays
-	if err == nil && cfg.Value != "" {
-		if v, e := strconv.Atoi(cfg.Value); e == nil && v > 0 {
-			retentionDays = v
-		}
+	c.JSON(http.StatusOK, gin.H{
+		"retention_days":          systemConfigInt(h.DB, ConfigKeyRetentionDays, DefaultRetentionDays),
+		"rule_revision_retention": systemConfigInt(h.DB, ConfigKeyRuleRevisionRetention, DefaultRuleRevisionRetention),
+		"maintenance_mode":        engine.MaintenanceMode(h.DB),
+		"quiet_hours":             engine.LoadQuietHours(h.DB),
+	})
+}
+
+// MaintenanceRequest toggles maintenance mode.
+type MaintenanceRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// SetMaintenance turns maintenance mode on or off: while on, alerts are recorded but no notifications are sent. Admin only.
+func (h *SettingsHandler) SetMaintenance(c *gin.Context) {
+	var req MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "enabled is required"})
+		return
+	}
+	if err := engine.SetMaintenanceMode(h.DB, *req.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	c.JSON(http.StatusOK, gin.H{"retention_days": retentionDays})
+	log.Printf("[settings] maintenance mode set to %v by %s", *req.Enabled, actingUsername(c))
+	c.JSON(http.StatusOK, gin.H{"maintenance_mode": *req.Enabled})
 }
 
 // SettingsUpdateRequest for updating settings.
 type SettingsUpdateRequest struct {
-	RetentionDays *int `json:"retention_days"`
+	RetentionDays         *int               `json:"retention_days"`
+	RuleRevisionRetention *int               `json:"rule_revision_retention"` // revisions kept per rule
+	QuietHours            *engine.QuietHours `json:"quiet_hours"`
 }
 
 // Update saves system settings. Admin only.
@@ -58,22 +93,43 @@ func (h *SettingsHandler) Update(c *gin.Context) {
 			return
 		}
 	}
+	if req.RuleRevisionRetention != nil {
+		v := *req.RuleRevisionRetention
+		if v < 1 || v > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rule_revision_retention must be between 1 and 1000"})
+			return
+		}
+		err := h.DB.Save(&models.SystemConfig{Key: ConfigKeyRuleRevisionRetention, Value: strconv.Itoa(v)}).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.QuietHours != nil {
+		if err := req.QuietHours.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		b, _ := json.Marshal(req.QuietHours)
+		if err := h.DB.Save(&models.SystemConfig{Key: engine.ConfigKeyQuietHours, Value: string(b)}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	// Return current state
 	h.Get(c)
 }
 
-// RunRetentionCleanup deletes alerts and their send records older than retention days. Call periodically (e.g. daily).
+// RunRetentionCleanup deletes alerts, their send records and failed notifications older than retention days.
+// Call periodically (e.g. daily).
 func RunRetentionCleanup(db *gorm.DB) {
-	var cfg models.SystemConfig
-	err := db.Where("key = ?", ConfigKeyRetentionDays).First(&cfg).Error
-	retentionDays := DefaultRetentionDays
-	if err == nil && cfg.Value != "" {
-		if v, e := strconv.Atoi(cfg.Value); e == nil && v > 0 {
-			retentionDays = v
-		}
-	}
+	retentionDays := systemConfigInt(db, ConfigKeyRetentionDays, DefaultRetentionDays)
 	cutoff := time.Now().UTC().Add(-time.Duration(retentionDays) * 24 * time.Hour)
 
+	if res := db.Where("created_at < ?", cutoff).Delete(&models.FailedNotification{}); res.Error != nil {
+		log.Printf("[retention] delete failed notifications: %v", res.Error)
+	}
+
 	var ids []string
 	if err := db.Model(&models.Alert{}).Where("created_at < ?", cutoff).Pluck("id", &ids).Error; err != nil {
 		log.Printf("[retention] list old alerts: %v", err)
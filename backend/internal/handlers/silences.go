@@ -26,6 +26,10 @@ func (h *SilenceHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "alert_id required"})
 		return
 	}
+	if !alertVisible(h.DB, c, id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert not found"})
+		return
+	}
 	var req CreateSilenceRequest
 	if err := c.ShouldBindJSON(&req); err != nil || req.DurationMinutes <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "duration_minutes required and must be positive"})
@@ -40,6 +44,7 @@ func (h *SilenceHandler) Create(c *gin.Context) {
 	h.DB.Where("alert_id = ?", id).Limit(1).Find(&s)
 	if s.ID != 0 {
 		s.SilenceUntil = silenceUntil
+		s.UntilResolved = false // a fixed-duration silence replaces a snooze
 		if err := h.DB.Save(&s).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -58,11 +63,35 @@ func (h *SilenceHandler) Create(c *gin.Context) {
 	})
 }
 
+// Snooze silences an alert until it resolves (POST /api/v1/alerts/:id/snooze). The silence is removed when
+// the alert resolves, so the recovery and any later occurrence are notified again.
+func (h *SilenceHandler) Snooze(c *gin.Context) {
+	id := c.Param("id")
+	var a models.Alert
+	if scopeTeam(h.DB, c).Where("id = ?", id).Limit(1).Find(&a); a.ID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert not found"})
+		return
+	}
+	if a.Status != "firing" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only firing alerts can be snoozed"})
+		return
+	}
+	var s models.AlertSilence
+	h.DB.Where("alert_id = ?", id).Limit(1).Find(&s)
+	s.AlertID = id
+	s.UntilResolved = true
+	if err := h.DB.Save(&s).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": s.ID, "alert_id": s.AlertID, "until_resolved": true})
+}
+
 // List returns active silences (silence_until > now), with alert title when available.
 func (h *SilenceHandler) List(c *gin.Context) {
 	now := time.Now()
 	var list []models.AlertSilence
-	if err := h.DB.Where("silence_until > ?", now).Order("silence_until asc").Find(&list).Error; err != nil {
+	if err := h.DB.Where("silence_until > ? OR until_resolved = ?", now, true).Order("silence_until asc").Find(&list).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -70,12 +99,15 @@ func (h *SilenceHandler) List(c *gin.Context) {
 		models.AlertSilence
 		Title string `json:"title,omitempty"`
 	}
+	_, scoped := callerTeam(c)
 	items := make([]item, 0, len(list))
 	for _, s := range list {
 		i := item{AlertSilence: s}
 		var a models.Alert
-		if h.DB.Where("id = ?", s.AlertID).First(&a).Error == nil {
+		if scopeTeam(h.DB, c).Where("id = ?", s.AlertID).First(&a).Error == nil {
 			i.Title = a.Title
+		} else if scoped {
+			continue // another team's alert
 		}
 		items = append(items, i)
 	}
@@ -89,6 +121,10 @@ func (h *SilenceHandler) Delete(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "alert_id required"})
 		return
 	}
+	if !alertVisible(h.DB, c, alertID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert not found"})
+		return
+	}
 	res := h.DB.Where("alert_id = ?", alertID).Delete(&models.AlertSilence{})
 	if res.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
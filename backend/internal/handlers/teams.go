@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// TeamHandler CRUD for teams (admin only).
+type TeamHandler struct {
+	DB *gorm.DB
+}
+
+// List returns all teams.
+func (h *TeamHandler) List(c *gin.Context) {
+	var list []models.Team
+	if err := h.DB.Order("name asc").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Create a team.
+func (h *TeamHandler) Create(c *gin.Context) {
+	var t models.Team
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	t.ID = 0
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	var exists int64
+	h.DB.Model(&models.Team{}).Where("name = ?", t.Name).Count(&exists)
+	if exists > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "team already exists"})
+		return
+	}
+	if err := h.DB.Create(&t).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
+
+// Update renames or re-describes a team.
+func (h *TeamHandler) Update(c *gin.Context) {
+	var t models.Team
+	if err := h.DB.First(&t, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var body models.Team
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	var exists int64
+	h.DB.Model(&models.Team{}).Where("name = ? AND id <> ?", body.Name, t.ID).Count(&exists)
+	if exists > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "team already exists"})
+		return
+	}
+	t.Name, t.Description = body.Name, body.Description
+	if err := h.DB.Save(&t).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// Delete removes a team that nothing belongs to any more.
+func (h *TeamHandler) Delete(c *gin.Context) {
+	var t models.Team
+	if err := h.DB.First(&t, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	for _, m := range []interface{}{&models.User{}, &models.Rule{}, &models.Channel{}, &models.Datasource{}} {
+		var n int64
+		h.DB.Model(m).Where("team_id = ?", t.ID).Count(&n)
+		if n > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "team is still assigned to users, rules, channels or datasources"})
+			return
+		}
+	}
+	if err := h.DB.Delete(&t).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// callerTeam returns the team a non-admin caller is restricted to. Admins and users without a team are not
+// restricted.
+func callerTeam(c *gin.Context) (uint, bool) {
+	if role, _ := c.Get("role"); role == "admin" {
+		return 0, false
+	}
+	v, ok := c.Get("team_id")
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(uint)
+	return id, ok && id != 0
+}
+
+// scopeTeam restricts q to the caller's team (see callerTeam).
+func scopeTeam(q *gorm.DB, c *gin.Context) *gorm.DB {
+	if id, ok := callerTeam(c); ok {
+		return q.Where("team_id = ?", id)
+	}
+	return q
+}
+
+// alertVisible reports whether the caller may see the alert with the given ID.
+func alertVisible(db *gorm.DB, c *gin.Context, alertID string) bool {
+	if _, ok := callerTeam(c); !ok {
+		return true
+	}
+	var n int64
+	scopeTeam(db.Model(&models.Alert{}), c).Where("id = ?", alertID).Count(&n)
+	return n > 0
+}
+
+var errUnknownTeam = errors.New("team_id does not exist")
+
+// checkTeam validates an optional team reference.
+func checkTeam(db *gorm.DB, id *uint) error {
+	if id == nil {
+		return nil
+	}
+	var n int64
+	db.Model(&models.Team{}).Where("id = ?", *id).Count(&n)
+	if n == 0 {
+		return errUnknownTeam
+	}
+	return nil
+}
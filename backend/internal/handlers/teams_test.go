@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAlertsScopedToTeam(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Alert{}, &models.AlertSendRecord{}, &models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	dbTeam, webTeam := uint(1), uint(2)
+	db.Create(&models.Alert{ID: "db-1", Status: "firing", TeamID: &dbTeam})
+	db.Create(&models.Alert{ID: "web-1", Status: "firing", TeamID: &webTeam})
+	h := &AlertHandler{DB: db}
+
+	get := func(role string, team uint, id string) int {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/alerts/"+id, nil)
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		c.Set("role", role)
+		if team != 0 {
+			c.Set("team_id", team)
+		}
+		h.Get(c)
+		return w.Code
+	}
+	if code := get("user", dbTeam, "db-1"); code != http.StatusOK {
+		t.Errorf("own team alert: got %d", code)
+	}
+	if code := get("user", dbTeam, "web-1"); code != http.StatusNotFound {
+		t.Errorf("other team alert: got %d, want 404", code)
+	}
+	if code := get("admin", dbTeam, "web-1"); code != http.StatusOK {
+		t.Errorf("admin sees every team: got %d", code)
+	}
+	if code := get("user", 0, "web-1"); code != http.StatusOK {
+		t.Errorf("user without team is unrestricted: got %d", code)
+	}
+}
+
+// twoTeamAlerts returns a db holding one firing alert (and one rule) per team, for team 1 and team 2.
+func twoTeamAlerts(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Alert{}, &models.AlertSendRecord{}, &models.Rule{}, &models.Datasource{},
+		&models.Channel{}, &models.Template{}, &models.SystemConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	firing := time.Now().Add(-time.Hour)
+	for _, team := range []uint{1, 2} {
+		team := team
+		db.Create(&models.Alert{ID: fmt.Sprintf("team%d-alert", team), Title: "alert", Status: "firing", Severity: "critical",
+			FiringAt: firing, TeamID: &team})
+		db.Create(&models.Rule{Name: fmt.Sprintf("team%d-rule", team), TeamID: &team})
+	}
+	return db
+}
+
+// teamGet calls handler as a member of team 1 and returns the response.
+func teamGet(handler gin.HandlerFunc, target string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	c.Set("role", "user")
+	c.Set("team_id", uint(1))
+	handler(c)
+	return w
+}
+
+func TestReportPreviewScopedToTeam(t *testing.T) {
+	h := &ReportHandler{DB: twoTeamAlerts(t)}
+	w := teamGet(h.Preview, "/api/v1/reports/preview")
+	var resp struct {
+		Total  int64 `json:"total"`
+		Alerts []struct {
+			AlertID string `json:"alert_id"`
+		} `json:"alerts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 1 || len(resp.Alerts) != 1 || resp.Alerts[0].AlertID != "team1-alert" {
+		t.Errorf("got %+v, want only team1-alert", resp)
+	}
+}
+
+func TestReportExportScopedToTeam(t *testing.T) {
+	h := &ReportHandler{DB: twoTeamAlerts(t)}
+	w := teamGet(h.Export, "/api/v1/reports/export?format=csv")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "team1-alert") || strings.Contains(body, "team2-alert") {
+		t.Errorf("export should hold only team1-alert:\n%s", body)
+	}
+}
+
+func TestDashboardStatsScopedToTeam(t *testing.T) {
+	h := &DashboardHandler{DB: twoTeamAlerts(t)}
+	w := teamGet(h.Stats, "/api/v1/dashboard/stats")
+	var resp struct {
+		AlertTotal int64            `json:"alert_total"`
+		Firing     int64            `json:"firing"`
+		Rules      int64            `json:"rules"`
+		BySeverity map[string]int64 `json:"by_severity"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.AlertTotal != 1 || resp.Firing != 1 || resp.Rules != 1 || resp.BySeverity["critical"] != 1 {
+		t.Errorf("got %+v, want team 1's counts only", resp)
+	}
+}
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"regexp"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/engine"
 	"github.com/kk-alert/backend/internal/models"
 	"github.com/kk-alert/backend/internal/sender"
 	"gorm.io/gorm"
@@ -137,6 +139,7 @@ func replaceAll(s, old, new string) string {
 }
 
 // PreviewRequest for template preview. All fields optional; defaults used for Go template rendering (including {{.RuleDescription}}, {{.SourceType}}, etc.).
+// When AlertID names a stored alert, that alert is rendered exactly as a notification would be and the other fields are ignored.
 type PreviewRequest struct {
 	Labels           map[string]string `json:"labels"`
 	AlertID          string            `json:"alert_id"`
@@ -149,15 +152,31 @@ type PreviewRequest struct {
 	Value            string            `json:"value"` // trigger value (当前值/阈值) for {{.Value}}
 	IsRecovery       bool              `json:"is_recovery"`
 	ResolvedAt       string            `json:"resolved_at"`
+	RunbookURL       string            `json:"runbook_url"`
+	ResolutionReason string            `json:"resolution_reason"`
+	Enrich           map[string]string `json:"enrich"` // sample enrichment fields for {{.Enrich.xxx}}
 }
 
-// Preview renders template with sample data using the same AlertTemplateData as real notifications.
+// Preview renders template with sample data (or a stored alert, see PreviewRequest) using the same AlertTemplateData as real notifications.
 func (h *TemplateHandler) Preview(c *gin.Context) {
 	var req PreviewRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	id := c.Param("id")
+	var t models.Template
+	if err := h.DB.First(&t, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if req.AlertID != "" {
+		var alert models.Alert
+		if h.DB.Where("id = ?", req.AlertID).Limit(1).Find(&alert); alert.ID != "" {
+			h.previewAlert(c, &t, &alert)
+			return
+		}
+	}
 	if req.Labels == nil {
 		req.Labels = make(map[string]string)
 	}
@@ -185,32 +204,95 @@ func (h *TemplateHandler) Preview(c *gin.Context) {
 	if req.Value == "" {
 		req.Value = "80.5"
 	}
-	id := c.Param("id")
-	var t models.Template
-	if err := h.DB.First(&t, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
-		return
+	if req.RunbookURL == "" {
+		req.RunbookURL = "https://wiki.example.com/runbooks/sample"
 	}
 	data := sender.AlertTemplateData{
-		AlertID:         req.AlertID,
-		Title:           req.Title,
-		Severity:        req.Severity,
-		Labels:          req.Labels,
-		StartAt:         req.StartAt,
-		SourceType:      req.SourceType,
-		Description:     req.Description,
-		Value:           req.Value,
-		RuleDescription: req.RuleDescription,
-		IsRecovery:      req.IsRecovery,
-		ResolvedAt:      req.ResolvedAt,
-		SentAt:          req.StartAt, // preview uses StartAt as sample send time when not provided
+		AlertID:          req.AlertID,
+		Title:            req.Title,
+		Severity:         req.Severity,
+		Labels:           req.Labels,
+		StartAt:          req.StartAt,
+		SourceType:       req.SourceType,
+		Description:      req.Description,
+		Value:            req.Value,
+		RuleDescription:  req.RuleDescription,
+		IsRecovery:       req.IsRecovery,
+		ResolvedAt:       req.ResolvedAt,
+		SentAt:           req.StartAt, // preview uses StartAt as sample send time when not provided
+		RunbookURL:       req.RunbookURL,
+		AlertURL:         engine.AlertURL(req.AlertID),
+		ResolutionReason: req.ResolutionReason,
+		Enrich:           req.Enrich,
 	}
 	rendered, err := sender.RenderTemplate(t.Body, data)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "template render failed: " + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"rendered": rendered})
+	c.JSON(http.StatusOK, gin.H{"rendered": rendered, "source": "sample"})
+}
+
+// previewAlert renders t for a stored alert with the data the engine would use for its notification.
+func (h *TemplateHandler) previewAlert(c *gin.Context, t *models.Template, alert *models.Alert) {
+	var rule models.Rule
+	if alert.RuleID != 0 {
+		h.DB.Where("id = ?", alert.RuleID).Limit(1).Find(&rule)
+	}
+	labels := make(map[string]string)
+	_ = json.Unmarshal([]byte(alert.Labels), &labels)
+	isRecovery := alert.Status == "resolved"
+	sendAt := alert.FiringAt
+	if isRecovery && alert.ResolvedAt != nil {
+		sendAt = *alert.ResolvedAt
+	}
+	rendered, err := sender.RenderTemplate(t.Body, engine.TemplateData(&rule, alert, labels, isRecovery, sendAt))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "template render failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rendered": rendered, "source": "alert"})
+}
+
+// LintRequest is the body for template lint. Labels seed the dry run so {{.Labels.xxx}} lookups can be checked.
+type LintRequest struct {
+	Body   string            `json:"body" binding:"required"`
+	Labels map[string]string `json:"labels"`
+	Enrich map[string]string `json:"enrich"` // seeds {{.Enrich.xxx}} like Labels
+}
+
+// Lint parses a template body and reports parse errors, unknown fields and dry-run errors with line/column.
+func (h *TemplateHandler) Lint(c *gin.Context) {
+	var req LintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	data := sampleTemplateData(req.Labels)
+	data.Enrich = req.Enrich
+	issues := sender.LintTemplate(req.Body, data)
+	if issues == nil {
+		issues = []sender.TemplateIssue{}
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": len(issues) == 0, "issues": issues})
+}
+
+// sampleTemplateData is placeholder alert data for linting and test sends.
+func sampleTemplateData(labels map[string]string) sender.AlertTemplateData {
+	return sender.AlertTemplateData{
+		AlertID:         "sample-id",
+		Title:           "Sample Alert",
+		Severity:        "warning",
+		Labels:          labels,
+		StartAt:         "2006-01-02 15:04:05",
+		SourceType:      "prometheus",
+		Description:     "Sample alert description",
+		Value:           "80.5",
+		RuleDescription: "Sample rule description",
+		SentAt:          "2006-01-02 15:04:05",
+		RunbookURL:      "https://wiki.example.com/runbooks/sample",
+		AlertURL:        engine.AlertURL("sample-id"),
+	}
 }
 
 // ExpandTemplateForAlert renders template for an alert (used by rule engine). Uses regex for {{.Labels.xxx}}.
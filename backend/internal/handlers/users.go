@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/auth"
 	"github.com/kk-alert/backend/internal/models"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -14,10 +16,10 @@ type UserHandler struct {
 	DB *gorm.DB
 }
 
-// List returns all users (id, username, role, created_at). Password hashes omitted.
+// List returns all users (id, username, role, lockout state, created_at). Password hashes omitted.
 func (h *UserHandler) List(c *gin.Context) {
 	var list []models.User
-	if err := h.DB.Select("id", "username", "role", "created_at").Order("id asc").Find(&list).Error; err != nil {
+	if err := h.DB.Select("id", "username", "email", "role", "team_id", "failed_login_count", "locked_until", "created_at").Order("id asc").Find(&list).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -29,6 +31,7 @@ type CreateRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 	Role     string `json:"role"`
+	TeamID   *uint  `json:"team_id"`
 }
 
 // Create a new user.
@@ -41,8 +44,12 @@ func (h *UserHandler) Create(c *gin.Context) {
 	if req.Role == "" {
 		req.Role = "user"
 	}
-	if req.Role != "admin" && req.Role != "user" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be admin or user"})
+	if !auth.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of " + strings.Join(auth.Roles, ", ")})
+		return
+	}
+	if err := checkTeam(h.DB, req.TeamID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	var exists int64
@@ -56,18 +63,21 @@ func (h *UserHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
 		return
 	}
-	u := models.User{Username: req.Username, PasswordHash: string(hash), Role: req.Role}
+	u := models.User{Username: req.Username, PasswordHash: string(hash), Role: req.Role, TeamID: req.TeamID}
 	if err := h.DB.Create(&u).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"id": u.ID, "username": u.Username, "role": u.Role})
+	c.JSON(http.StatusOK, gin.H{"id": u.ID, "username": u.Username, "role": u.Role, "team_id": u.TeamID})
 }
 
-// UpdateRequest for updating a user (password and/or role).
+// UpdateRequest for updating a user (password, role and/or clearing a login lockout).
 type UpdateRequest struct {
 	Password *string `json:"password"`
 	Role     *string `json:"role"`
+	Email    *string `json:"email"`   // links an existing account to an SSO identity; "" unlinks
+	TeamID   *uint   `json:"team_id"` // 0 removes the user from their team
+	Unlock   bool    `json:"unlock"`  // reset failed_login_count and locked_until
 }
 
 // Update user by id (path :id).
@@ -85,8 +95,8 @@ func (h *UserHandler) Update(c *gin.Context) {
 	}
 	if req.Role != nil {
 		r := *req.Role
-		if r != "admin" && r != "user" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be admin or user"})
+		if !auth.ValidRole(r) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of " + strings.Join(auth.Roles, ", ")})
 			return
 		}
 		u.Role = r
@@ -99,11 +109,37 @@ func (h *UserHandler) Update(c *gin.Context) {
 		}
 		u.PasswordHash = string(hash)
 	}
+	if req.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*req.Email))
+		if email != "" {
+			var taken int64
+			h.DB.Model(&models.User{}).Where("email = ? AND id <> ?", email, u.ID).Count(&taken)
+			if taken > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "email already used by another user"})
+				return
+			}
+		}
+		u.Email = email
+	}
+	if req.TeamID != nil {
+		u.TeamID = req.TeamID
+		if *req.TeamID == 0 {
+			u.TeamID = nil
+		}
+		if err := checkTeam(h.DB, u.TeamID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Unlock {
+		u.FailedLoginCount = 0
+		u.LockedUntil = nil
+	}
 	if err := h.DB.Save(&u).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"id": u.ID, "username": u.Username, "role": u.Role})
+	c.JSON(http.StatusOK, gin.H{"id": u.ID, "username": u.Username, "email": u.Email, "role": u.Role, "team_id": u.TeamID, "locked_until": u.LockedUntil})
 }
 
 // Delete user by id.
@@ -0,0 +1,40 @@
+// Package httpclient provides HTTP clients that share one tuned transport, so notification senders,
+// Jira and datasource queries reuse keep-alive connections instead of dialing per request.
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Transport is shared by every client from this package.
+var Transport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   10,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: time.Second,
+}
+
+// Default is used for outbound notifications and Jira. Its timeout is HTTP_CLIENT_TIMEOUT (Go duration, default 10s).
+var Default = New(envTimeout("HTTP_CLIENT_TIMEOUT", 10*time.Second))
+
+// New returns a client with its own timeout on the shared transport.
+func New(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: Transport}
+}
+
+func envTimeout(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
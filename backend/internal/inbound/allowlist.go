@@ -0,0 +1,93 @@
+package inbound
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// globalAllowedCIDRs is INBOUND_ALLOWED_CIDRS: a comma-separated list of CIDRs/IPs allowed to reach any
+// inbound endpoint. Empty means no global restriction.
+var globalAllowedCIDRs = func() []*net.IPNet {
+	nets, err := ParseCIDRs(os.Getenv("INBOUND_ALLOWED_CIDRS"))
+	if err != nil {
+		log.Printf("[inbound] invalid INBOUND_ALLOWED_CIDRS, ignoring: %v", err)
+		return nil
+	}
+	return nets
+}()
+
+// trustForwarded reports whether X-Forwarded-For may be used for the client IP; only when TRUSTED_PROXIES
+// is configured (see main), otherwise the header is client-controlled and the socket address is used.
+var trustForwarded = os.Getenv("TRUSTED_PROXIES") != ""
+
+// ParseCIDRs parses a comma-separated list of CIDRs or bare IPs (treated as /32 or /128). Empty input yields nil.
+func ParseCIDRs(raw string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(raw, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowIPs is middleware for the inbound group rejecting with 403 clients outside INBOUND_ALLOWED_CIDRS
+// (when set) or outside the target datasource's AllowedCIDRs (when set). Both lists apply when both are set.
+func AllowIPs(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ds := requestSource(c, db)
+		if len(globalAllowedCIDRs) == 0 && ds.AllowedCIDRs == "" {
+			c.Next()
+			return
+		}
+		addr := c.RemoteIP()
+		if trustForwarded {
+			addr = c.ClientIP()
+		}
+		ip := net.ParseIP(addr)
+		allowed := ip != nil && (len(globalAllowedCIDRs) == 0 || containsIP(globalAllowedCIDRs, ip))
+		if allowed && ds.AllowedCIDRs != "" {
+			nets, err := ParseCIDRs(ds.AllowedCIDRs)
+			allowed = err == nil && containsIP(nets, ip)
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "client address not allowed"})
+			return
+		}
+		c.Next()
+	}
+}
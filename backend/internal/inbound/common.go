@@ -0,0 +1,219 @@
+package inbound
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kk-alert/backend/internal/engine"
+	"github.com/kk-alert/backend/internal/labels"
+	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/relabel"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// incomingAlert is a webhook alert normalized by an inbound handler before it is stored.
+type incomingAlert struct {
+	ExternalID  string
+	Title       string
+	Severity    string
+	Status      string // firing or resolved
+	Labels      map[string]string
+	Annotations map[string]string
+	FiringAt    time.Time
+	ResolvedAt  *time.Time
+}
+
+// sourceIDFromQuery returns ?source_id= when set to a non-zero number, else def.
+func sourceIDFromQuery(c *gin.Context, def uint) uint {
+	if id := c.Query("source_id"); id != "" {
+		var u uint
+		if _, _ = fmt.Sscanf(id, "%d", &u); u != 0 {
+			return u
+		}
+	}
+	return def
+}
+
+// parseWebhookTimes parses RFC3339 start/end times; firingAt defaults to now, resolvedAt is nil when absent.
+func parseWebhookTimes(startsAt, endsAt string) (time.Time, *time.Time) {
+	var resolvedAt *time.Time
+	if endsAt != "" {
+		if t, err := time.Parse(time.RFC3339, endsAt); err == nil {
+			resolvedAt = &t
+		}
+	}
+	var firingAt time.Time
+	if startsAt != "" {
+		firingAt, _ = time.Parse(time.RFC3339, startsAt)
+	}
+	if firingAt.IsZero() {
+		firingAt = time.Now()
+	}
+	return firingAt, resolvedAt
+}
+
+// storeAlert upserts an inbound alert. It reuses the same alert ID while a previous alert with the same
+// (source_id, external_id) is still firing and only creates a new ID after it was resolved.
+// created is true when a new firing alert row was inserted. A non-nil error means the alert was not
+// stored and must not be processed.
+func storeAlert(db *gorm.DB, sourceID uint, sourceType string, in incomingAlert) (alert models.Alert, created bool, err error) {
+	defaults, relabelCfgs := sourceLabelConfig(db, sourceID)
+	in.Labels = mergeMissing(in.Labels, defaults)
+	if len(relabelCfgs) > 0 {
+		var keep bool
+		if in.Labels, keep = relabel.Apply(relabelCfgs, in.Labels); !keep {
+			return alert, false, errAlertDropped
+		}
+	}
+	labelsJSON, _ := json.Marshal(in.Labels)
+	annotationsJSON, _ := json.Marshal(in.Annotations)
+	if in.Labels == nil {
+		labelsJSON = []byte("{}")
+	}
+	if in.Annotations == nil {
+		annotationsJSON = []byte("{}")
+	}
+
+	hasFiring := db.Where("source_id = ? AND external_id = ? AND status = ?", sourceID, in.ExternalID, "firing").First(&alert).Error == nil
+
+	if in.Status == "resolved" {
+		if hasFiring {
+			alert.Status = "resolved"
+			alert.ResolvedAt = in.ResolvedAt
+			alert.Title = in.Title
+			alert.Labels = string(labelsJSON)
+			alert.Annotations = string(annotationsJSON)
+			db.Save(&alert)
+			engine.ClearSnooze(db, alert.ID)
+		} else {
+			// No prior firing row: create resolved-only record for history
+			alert = models.Alert{
+				ID:          uuid.New().String(),
+				SourceID:    sourceID,
+				SourceType:  sourceType,
+				ExternalID:  in.ExternalID,
+				Title:       in.Title,
+				Severity:    in.Severity,
+				Status:      "resolved",
+				FiringAt:    in.FiringAt,
+				ResolvedAt:  in.ResolvedAt,
+				Labels:      string(labelsJSON),
+				Annotations: string(annotationsJSON),
+			}
+			db.Create(&alert)
+		}
+		return alert, false, nil
+	}
+
+	if !hasFiring {
+		// No firing for this fingerprint: create new. The partial unique index on firing
+		// (source_id, external_id) turns a concurrent duplicate into a no-op insert.
+		alert = models.Alert{
+			ID:          uuid.New().String(),
+			SourceID:    sourceID,
+			SourceType:  sourceType,
+			ExternalID:  in.ExternalID,
+			Title:       in.Title,
+			Severity:    in.Severity,
+			Status:      "firing",
+			FiringAt:    in.FiringAt,
+			ResolvedAt:  nil,
+			Labels:      string(labelsJSON),
+			Annotations: string(annotationsJSON),
+		}
+		res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&alert)
+		if res.Error != nil {
+			return alert, false, res.Error
+		}
+		if res.RowsAffected > 0 {
+			return alert, true, nil
+		}
+		// Lost the race against a concurrent delivery: update the row it created instead.
+		alert = models.Alert{}
+		if err := db.Where("source_id = ? AND external_id = ? AND status = ?", sourceID, in.ExternalID, "firing").First(&alert).Error; err != nil {
+			return alert, false, err
+		}
+	}
+	// Existing firing: update in place (keep same ID)
+	alert.Title = in.Title
+	alert.Severity = in.Severity
+	alert.FiringAt = in.FiringAt
+	alert.Labels = string(labelsJSON)
+	alert.Annotations = string(annotationsJSON)
+	db.Save(&alert)
+	return alert, false, nil
+}
+
+// mergeMissing copies entries of common into dst that dst does not already have. dst may be nil.
+func mergeMissing(dst, common map[string]string) map[string]string {
+	if len(common) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(common))
+	}
+	for k, v := range common {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+	return dst
+}
+
+// StoredAlert is one entry of an inbound response's "alerts" list, letting callers correlate what they
+// sent with alert IDs (e.g. to create silences).
+type StoredAlert struct {
+	ID     string `json:"id"`
+	Action string `json:"action"` // created, updated or resolved
+}
+
+// batchResult collects per-alert outcomes for an inbound response. Alerts that failed to store or were
+// dropped by relabeling are not listed.
+type batchResult struct {
+	created  int
+	alerts   []StoredAlert
+	timedOut bool // processing stopped at the request deadline
+}
+
+func (b *batchResult) add(alert models.Alert, isNew bool) {
+	action := "updated"
+	switch {
+	case isNew:
+		action = "created"
+		b.created++
+	case alert.Status == "resolved":
+		action = "resolved"
+	}
+	b.alerts = append(b.alerts, StoredAlert{ID: alert.ID, Action: action})
+}
+
+func (b *batchResult) response(received int) gin.H {
+	alerts := b.alerts
+	if alerts == nil {
+		alerts = []StoredAlert{}
+	}
+	return gin.H{"received": received, "created": b.created, "alerts": alerts}
+}
+
+// errAlertDropped is returned by storeAlert when the datasource's relabel config drops the alert.
+var errAlertDropped = errors.New("alert dropped by relabel config")
+
+// sourceLabelConfig returns the DefaultLabels and RelabelConfig of datasource sourceID (nil when unset or
+// unknown; an invalid config is ignored).
+func sourceLabelConfig(db *gorm.DB, sourceID uint) (map[string]string, []relabel.Config) {
+	if sourceID == 0 {
+		return nil, nil
+	}
+	var ds models.Datasource
+	if db.Select("id, default_labels, relabel_config").Where("id = ?", sourceID).Limit(1).Find(&ds); ds.ID == 0 {
+		return nil, nil
+	}
+	defaults, _ := labels.ParseDefaults(ds.DefaultLabels)
+	cfgs, _ := relabel.Parse(ds.RelabelConfig)
+	return defaults, cfgs
+}
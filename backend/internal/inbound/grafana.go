@@ -0,0 +1,99 @@
+package inbound
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/dedup"
+	"gorm.io/gorm"
+)
+
+// GrafanaWebhook is the payload posted by Grafana unified alerting webhook contact points.
+// https://grafana.com/docs/grafana/latest/alerting/configure-notifications/manage-contact-points/integrations/webhook-notifier/
+type GrafanaWebhook struct {
+	Status string `json:"status"`
+	Alerts []struct {
+		Status       string             `json:"status"`
+		Labels       map[string]string  `json:"labels"`
+		Annotations  map[string]string  `json:"annotations"`
+		StartsAt     string             `json:"startsAt"`
+		EndsAt       string             `json:"endsAt"`
+		GeneratorURL string             `json:"generatorURL"`
+		Fingerprint  string             `json:"fingerprint"`
+		DashboardURL string             `json:"dashboardURL"`
+		PanelURL     string             `json:"panelURL"`
+		Values       map[string]float64 `json:"values"`
+		ValueString  string             `json:"valueString"`
+	} `json:"alerts"`
+}
+
+// GrafanaHandler receives Grafana unified alerting webhooks and normalizes to unified alert model.
+type GrafanaHandler struct {
+	DB       *gorm.DB
+	SourceID uint
+}
+
+// Serve handles POST /inbound/grafana.
+func (h *GrafanaHandler) Serve(c *gin.Context) {
+	var payload GrafanaWebhook
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		abortBadBody(c, err, "invalid json")
+		return
+	}
+	sourceID := sourceIDFromQuery(c, h.SourceID)
+	if sourceID == 0 {
+		sourceID = 1
+	}
+	alerts := make([]incomingAlert, 0, len(payload.Alerts))
+	for _, a := range payload.Alerts {
+		status := "firing"
+		if a.Status == "resolved" {
+			status = "resolved"
+		}
+		// Grafana sends endsAt=0001-01-01T00:00:00Z for firing alerts; only meaningful once resolved.
+		firingAt, resolvedAt := parseWebhookTimes(a.StartsAt, a.EndsAt)
+		labels := a.Labels
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		annotations := make(map[string]string, len(a.Annotations)+4)
+		for k, v := range a.Annotations {
+			annotations[k] = v
+		}
+		if a.ValueString != "" {
+			annotations["value"] = a.ValueString
+		}
+		for k, v := range map[string]string{"generator_url": a.GeneratorURL, "dashboard_url": a.DashboardURL, "panel_url": a.PanelURL} {
+			if v != "" {
+				annotations[k] = v
+			}
+		}
+		title := annotations["summary"]
+		if title == "" {
+			title = labels["alertname"]
+		}
+		if title == "" {
+			title = "Alert"
+		}
+		severity := labels["severity"]
+		if severity == "" {
+			severity = "warning"
+		}
+		// Uniqueness: upstream fingerprint when sent (stable even if our title extraction changes),
+		// else datasource + title + all labels (same => same alert, reuse ID until resolved)
+		externalID := a.Fingerprint
+		if externalID == "" {
+			externalID = dedup.Key(sourceID, title, labels)
+		}
+
+		alerts = append(alerts, incomingAlert{
+			ExternalID:  externalID,
+			Title:       title,
+			Severity:    severity,
+			Status:      status,
+			Labels:      labels,
+			Annotations: annotations,
+			FiringAt:    firingAt,
+			ResolvedAt:  resolvedAt,
+		})
+	}
+	ingest(c, h.DB, sourceID, "grafana", alerts, len(payload.Alerts))
+}
@@ -0,0 +1,575 @@
+package inbound
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/engine"
+	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/store"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// TestMain sets gin's mode once: gin.SetMode is not safe to call from handlers running concurrently.
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Rule{}, &models.Alert{}, &models.Channel{}, &models.Template{}, &models.AlertSendRecord{}, &models.AlertSilence{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func serve(handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler(c)
+	return w
+}
+
+func post(t *testing.T, handler gin.HandlerFunc, body string) {
+	t.Helper()
+	if w := serve(handler, body); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPrometheusFingerprintUpdatesSameRow(t *testing.T) {
+	db := newTestDB(t)
+	h := &PrometheusHandler{DB: db, SourceType: "prometheus"}
+
+	// Same fingerprint, different summary: must map to one alert row.
+	post(t, h.Serve, `{"alerts":[{"status":"firing","fingerprint":"abc123","labels":{"alertname":"HighCPU"},"annotations":{"summary":"cpu high"}}]}`)
+	post(t, h.Serve, `{"alerts":[{"status":"firing","fingerprint":"abc123","labels":{"alertname":"HighCPU"},"annotations":{"summary":"cpu very high"}}]}`)
+
+	var list []models.Alert
+	db.Find(&list)
+	if len(list) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(list))
+	}
+	if list[0].ExternalID != "abc123" {
+		t.Errorf("external_id: got %q, want fingerprint", list[0].ExternalID)
+	}
+	if list[0].Title != "cpu very high" {
+		t.Errorf("title not updated: %q", list[0].Title)
+	}
+}
+
+func TestPrometheusWithoutFingerprintFallsBackToDedupKey(t *testing.T) {
+	db := newTestDB(t)
+	h := &PrometheusHandler{DB: db, SourceType: "prometheus"}
+
+	post(t, h.Serve, `{"alerts":[{"status":"firing","labels":{"alertname":"HighCPU"},"annotations":{"summary":"cpu high"}}]}`)
+	post(t, h.Serve, `{"alerts":[{"status":"firing","labels":{"alertname":"HighCPU"},"annotations":{"summary":"cpu high"}}]}`)
+
+	var list []models.Alert
+	db.Find(&list)
+	if len(list) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(list))
+	}
+	if list[0].ExternalID == "" {
+		t.Error("expected dedup key as external_id")
+	}
+}
+
+func TestConcurrentDeliveriesCreateOneFiringAlert(t *testing.T) {
+	// Make sure deliveries really run in parallel even on single-CPU runners.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	// busy_timeout lets concurrent writers wait for the SQLite lock instead of failing with SQLITE_BUSY.
+	sdb, err := store.NewSQLite(filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &PrometheusHandler{DB: sdb.DB, SourceType: "prometheus"}
+	body := `{"alerts":[{"status":"firing","fingerprint":"retry-1","labels":{"alertname":"HighCPU"},"annotations":{"summary":"cpu high"}}]}`
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	codes := make([]int, 32)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			codes[i] = serve(h.Serve, body).Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("delivery %d: status %d", i, code)
+		}
+	}
+
+	var n int64
+	sdb.DB.Model(&models.Alert{}).Where("external_id = ? AND status = ?", "retry-1", "firing").Count(&n)
+	if n != 1 {
+		t.Fatalf("expected 1 firing alert, got %d", n)
+	}
+}
+
+func TestStoreAlertLosesRaceToConcurrentInsert(t *testing.T) {
+	sdb, err := store.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sdb.DB
+	// Simulate another delivery inserting the same firing alert right after our lookup missed.
+	injected := false
+	if err := db.Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if injected {
+			return
+		}
+		injected = true
+		other := models.Alert{ID: "other", SourceID: 1, SourceType: "prometheus", ExternalID: "fp-race", Title: "first", Status: "firing", Labels: "{}", Annotations: "{}"}
+		if err := tx.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Exec(
+			"INSERT INTO alerts (id, source_id, source_type, external_id, title, status, labels, annotations) VALUES (?,?,?,?,?,?,?,?)",
+			other.ID, other.SourceID, other.SourceType, other.ExternalID, other.Title, other.Status, other.Labels, other.Annotations).Error; err != nil {
+			t.Errorf("inject: %v", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	alert, created, err := storeAlert(db, 1, "prometheus", incomingAlert{ExternalID: "fp-race", Title: "second", Severity: "warning", Status: "firing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || alert.ID != "other" {
+		t.Errorf("expected to update the concurrently created row, got id=%s created=%v", alert.ID, created)
+	}
+	var n int64
+	db.Model(&models.Alert{}).Where("external_id = ? AND status = ?", "fp-race", "firing").Count(&n)
+	if n != 1 {
+		t.Fatalf("expected 1 firing alert, got %d", n)
+	}
+}
+
+func TestResolveClearsSnooze(t *testing.T) {
+	db := newTestDB(t)
+	h := &PrometheusHandler{DB: db, SourceType: "prometheus"}
+
+	post(t, h.Serve, `{"alerts":[{"status":"firing","fingerprint":"snz","labels":{"alertname":"HighCPU"}}]}`)
+	var a models.Alert
+	db.First(&a)
+	db.Create(&models.AlertSilence{AlertID: a.ID, UntilResolved: true})
+	if !engine.IsSilenced(db, a.ID) {
+		t.Fatal("snoozed alert should be silenced")
+	}
+
+	post(t, h.Serve, `{"alerts":[{"status":"resolved","fingerprint":"snz","labels":{"alertname":"HighCPU"}}]}`)
+	if engine.IsSilenced(db, a.ID) {
+		t.Error("snooze should be cleared when the alert resolves")
+	}
+}
+
+func TestDatasourceDefaultLabelsMerged(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&models.Datasource{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Datasource{ID: 1, Name: "prom", Type: "prometheus", DefaultLabels: `{"cluster":"prod","env":"default"}`})
+	h := &PrometheusHandler{DB: db, SourceType: "prometheus", SourceID: 1}
+
+	post(t, h.Serve, `{"alerts":[{"status":"firing","fingerprint":"dl","labels":{"alertname":"HighCPU","env":"staging"}}]}`)
+	var a models.Alert
+	db.First(&a)
+	if !strings.Contains(a.Labels, `"cluster":"prod"`) {
+		t.Errorf("default label not merged: %s", a.Labels)
+	}
+	if !strings.Contains(a.Labels, `"env":"staging"`) {
+		t.Errorf("incoming label should win on conflict: %s", a.Labels)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&models.Datasource{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Datasource{ID: 1, Name: "prom", Type: "prometheus"})
+	h := &PrometheusHandler{DB: db, SourceType: "prometheus"}
+	r := gin.New()
+	r.POST("/prometheus", VerifySignature(db), h.Serve)
+	body := `{"alerts":[{"status":"firing","fingerprint":"sig","labels":{"alertname":"HighCPU"}}]}`
+	send := func(sig string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/prometheus", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if sig != "" {
+			req.Header.Set(SignatureHeader, sig)
+		}
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(""); code != http.StatusOK {
+		t.Fatalf("no secret set: unsigned request should pass, got %d", code)
+	}
+	db.Model(&models.Datasource{}).Where("id = ?", 1).Update("ingest_secret", "s3cret")
+	if code := send(""); code != http.StatusUnauthorized {
+		t.Errorf("missing signature: got %d, want 401", code)
+	}
+	if code := send(Sign("wrong", []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("bad signature: got %d, want 401", code)
+	}
+	if code := send(Sign("s3cret", []byte(body))); code != http.StatusOK {
+		t.Errorf("valid signature: got %d, want 200", code)
+	}
+	if code := send(strings.TrimPrefix(Sign("s3cret", []byte(body)), "sha256=")); code != http.StatusOK {
+		t.Errorf("bare hex signature: got %d, want 200", code)
+	}
+}
+
+func TestLimitRequest(t *testing.T) {
+	db := newTestDB(t)
+	h := &PrometheusHandler{DB: db, SourceType: "prometheus"}
+	origMax, origTimeout := maxBodyBytes, processTimeout
+	defer func() { maxBodyBytes, processTimeout = origMax, origTimeout }()
+	maxBodyBytes = 200
+	r := gin.New()
+	r.POST("/prometheus", LimitRequest(), h.Serve)
+	send := func(body string, chunked bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/prometheus", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if chunked {
+			req.ContentLength = -1 // no declared length: the limit applies while reading
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	small := `{"alerts":[{"status":"firing","fingerprint":"lim","labels":{"alertname":"HighCPU"}}]}`
+	if w := send(small, false); w.Code != http.StatusOK {
+		t.Fatalf("small body: got %d", w.Code)
+	}
+	large := `{"alerts":[{"status":"firing","labels":{"alertname":"` + strings.Repeat("x", 300) + `"}}]}`
+	if w := send(large, false); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("declared oversized body: got %d, want 413", w.Code)
+	}
+	if w := send(large, true); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("undeclared oversized body: got %d, want 413", w.Code)
+	}
+
+	processTimeout = time.Nanosecond
+	if w := send(small, false); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expired deadline: got %d, want 503", w.Code)
+	}
+}
+
+func TestLargeBatchIsQueued(t *testing.T) {
+	// The batch is stored on a worker goroutine, so use a file database every connection shares.
+	sdb, err := store.NewSQLite(filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &PrometheusHandler{DB: sdb.DB, SourceType: "prometheus"}
+	defer func(n int) { maxSyncAlerts = n }(maxSyncAlerts)
+	maxSyncAlerts = 1
+	StartQueue()
+
+	w := serve(h.Serve, `{"alerts":[{"fingerprint":"q1","labels":{"alertname":"A"}},{"fingerprint":"q2","labels":{"alertname":"B"}}]}`)
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"queued":2`) {
+		t.Fatalf("over the limit: status %d %s, want 202", w.Code, w.Body.String())
+	}
+	var n int64
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if sdb.DB.Model(&models.Alert{}).Count(&n); n == 2 {
+			break
+		}
+	}
+	if n != 2 {
+		t.Errorf("queued batch stored %d alerts, want 2", n)
+	}
+	if w := serve(h.Serve, `{"alerts":[{"fingerprint":"q3","labels":{"alertname":"C"}}]}`); w.Code != http.StatusOK {
+		t.Errorf("within the limit: status %d, want 200", w.Code)
+	}
+}
+
+func TestInboundAlertGetsTeamDuringMaintenance(t *testing.T) {
+	// The engine assigns the team on a worker goroutine, so use a file database every connection shares.
+	sdb, err := store.NewSQLite(filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sdb.DB
+	team := uint(3)
+	db.Create(&models.Rule{Name: "db alerts", Enabled: true, TeamID: &team})
+	if err := engine.SetMaintenanceMode(db, true); err != nil {
+		t.Fatal(err)
+	}
+	h := &PrometheusHandler{DB: db, SourceType: "prometheus"}
+
+	post(t, h.Serve, `{"alerts":[{"status":"firing","fingerprint":"m1","labels":{"alertname":"A"}},`+
+		`{"status":"resolved","fingerprint":"m2","labels":{"alertname":"B"}}]}`)
+	var n int64
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if db.Model(&models.Alert{}).Where("team_id = ?", team).Count(&n); n == 2 {
+			break
+		}
+	}
+	if n != 2 {
+		var alerts []models.Alert
+		db.Find(&alerts)
+		t.Errorf("alerts received in maintenance mode should still get the rule's team: %+v", alerts)
+	}
+}
+
+func TestAllowIPs(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&models.Datasource{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Datasource{ID: 1, Name: "prom", Type: "prometheus", AllowedCIDRs: "10.0.0.0/8, 192.0.2.7"})
+	h := &PrometheusHandler{DB: db, SourceType: "prometheus"}
+	r := gin.New()
+	r.POST("/prometheus", AllowIPs(db), h.Serve)
+	send := func(remote string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/prometheus", strings.NewReader(`{"alerts":[]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "10.1.2.3") // ignored: no trusted proxies configured
+		req.RemoteAddr = remote
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for remote, want := range map[string]int{
+		"10.20.30.40:5000": http.StatusOK,
+		"192.0.2.7:5000":   http.StatusOK,
+		"192.0.2.8:5000":   http.StatusForbidden,
+	} {
+		if code := send(remote); code != want {
+			t.Errorf("%s: got %d, want %d", remote, code, want)
+		}
+	}
+	if _, err := ParseCIDRs("10.0.0.0/33"); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
+
+func TestResponseListsAlertIDs(t *testing.T) {
+	db := newTestDB(t)
+	h := &PrometheusHandler{DB: db, SourceType: "prometheus"}
+	decode := func(body string) (resp struct {
+		Created int           `json:"created"`
+		Alerts  []StoredAlert `json:"alerts"`
+	}) {
+		w := serve(h.Serve, body)
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	first := decode(`{"alerts":[{"status":"firing","fingerprint":"ids","labels":{"alertname":"HighCPU"}}]}`)
+	if first.Created != 1 || len(first.Alerts) != 1 || first.Alerts[0].Action != "created" || first.Alerts[0].ID == "" {
+		t.Fatalf("first delivery: %+v", first)
+	}
+	again := decode(`{"alerts":[{"status":"firing","fingerprint":"ids","labels":{"alertname":"HighCPU"}}]}`)
+	if len(again.Alerts) != 1 || again.Alerts[0] != (StoredAlert{ID: first.Alerts[0].ID, Action: "updated"}) {
+		t.Errorf("repeat delivery: %+v", again)
+	}
+	resolved := decode(`{"alerts":[{"status":"resolved","fingerprint":"ids","labels":{"alertname":"HighCPU"}}]}`)
+	if len(resolved.Alerts) != 1 || resolved.Alerts[0] != (StoredAlert{ID: first.Alerts[0].ID, Action: "resolved"}) {
+		t.Errorf("resolve: %+v", resolved)
+	}
+}
+
+func TestPrometheusReceiverLabelAndBatchStatus(t *testing.T) {
+	db := newTestDB(t)
+	h := &PrometheusHandler{DB: db, SourceType: "prometheus"}
+
+	post(t, h.Serve, `{"version":"4","receiver":"team-db","status":"firing","alerts":[{"fingerprint":"rcv","labels":{"alertname":"HighCPU"}}]}`)
+	var a models.Alert
+	db.First(&a)
+	if a.Status != "firing" {
+		t.Errorf("status should fall back to the batch status, got %q", a.Status)
+	}
+	if !strings.Contains(a.Labels, `"receiver":"team-db"`) {
+		t.Errorf("receiver label missing: %s", a.Labels)
+	}
+}
+
+const testSNSCertURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-test.pem"
+
+// snsSigner stands in for SNS: it serves a throwaway signing certificate at testSNSCertURL and returns a
+// function that signs a message with it (SignatureVersion 2 unless set) and encodes it as SNS would post it.
+func snsSigner(t *testing.T) func(SNSMessage) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	orig := fetchSigningCert
+	fetchSigningCert = func(u string) (*x509.Certificate, error) {
+		if u != testSNSCertURL {
+			t.Errorf("fetched unexpected certificate URL %s", u)
+		}
+		return cert, nil
+	}
+	t.Cleanup(func() { fetchSigningCert = orig })
+	return func(msg SNSMessage) string {
+		if msg.SignatureVersion == "" {
+			msg.SignatureVersion = "2"
+		}
+		if msg.SigningCertURL == "" {
+			msg.SigningCertURL = testSNSCertURL
+		}
+		text, err := snsStringToSign(&msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sig []byte
+		if msg.SignatureVersion == "1" {
+			sum := sha1.Sum([]byte(text))
+			sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, sum[:])
+		} else {
+			sum := sha256.Sum256([]byte(text))
+			sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Signature = base64.StdEncoding.EncodeToString(sig)
+		b, _ := json.Marshal(msg)
+		return string(b)
+	}
+}
+
+func TestSNSCloudWatchAlarm(t *testing.T) {
+	db := newTestDB(t)
+	h := &SNSHandler{DB: db}
+	sign := snsSigner(t)
+
+	var confirmed string
+	orig := confirmSubscription
+	confirmSubscription = func(u string) error { confirmed = u; return nil }
+	defer func() { confirmSubscription = orig }()
+	if w := serve(h.Serve, sign(SNSMessage{Type: "SubscriptionConfirmation", MessageID: "m-0", SubscribeURL: "https://evil.example.com/confirm"})); w.Code != http.StatusBadRequest || confirmed != "" {
+		t.Errorf("non-SNS SubscribeURL: status %d, fetched %q", w.Code, confirmed)
+	}
+	post(t, h.Serve, sign(SNSMessage{Type: "SubscriptionConfirmation", MessageID: "m-1", Token: "tok", SubscribeURL: "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription"}))
+	if confirmed == "" {
+		t.Error("subscription not confirmed")
+	}
+
+	notification := func(state string) string {
+		alarm := `{"AlarmName":"HighCPU","NewStateValue":"` + state + `","NewStateReason":"Threshold Crossed","StateChangeTime":"2024-05-01T10:00:00.000+0000",` +
+			`"AlarmArn":"arn:aws:cloudwatch:us-east-1:123456789012:alarm:HighCPU",` +
+			`"Trigger":{"MetricName":"CPUUtilization","Namespace":"AWS/EC2","ComparisonOperator":"GreaterThanThreshold","Threshold":80,"Dimensions":[{"name":"InstanceId","value":"i-0abc"}]}}`
+		return sign(SNSMessage{Type: "Notification", MessageID: "n-" + state, Subject: "ALARM: HighCPU", Message: alarm,
+			TopicArn: "arn:aws:sns:us-east-1:123456789012:alarms", Timestamp: "2024-05-01T10:00:01.000Z"})
+	}
+	post(t, h.Serve, notification("ALARM"))
+	var a models.Alert
+	db.First(&a)
+	if a.Status != "firing" || a.SourceType != "cloudwatch" || a.Title != "HighCPU" {
+		t.Fatalf("firing alert: %+v", a)
+	}
+	for _, want := range []string{`"InstanceId":"i-0abc"`, `"region":"us-east-1"`, `"metric_name":"CPUUtilization"`} {
+		if !strings.Contains(a.Labels, want) {
+			t.Errorf("labels %s missing %s", a.Labels, want)
+		}
+	}
+	post(t, h.Serve, notification("INSUFFICIENT_DATA"))
+	post(t, h.Serve, notification("OK"))
+	var alerts []models.Alert
+	db.Find(&alerts)
+	if len(alerts) != 1 || alerts[0].Status != "resolved" {
+		t.Errorf("OK should resolve the same alert, got %+v", alerts)
+	}
+}
+
+func TestSNSSkipsIngestSignature(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&models.Datasource{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Datasource{ID: 1, Name: "aws", Type: "cloudwatch", IngestSecret: "s3cret"})
+	h := &SNSHandler{DB: db}
+	sign := snsSigner(t)
+	r := gin.New()
+	r.POST("/api/v1/inbound/cloudwatch", VerifySignature(db), h.Serve)
+	alarm := `{"AlarmName":"HighCPU","NewStateValue":"ALARM","AlarmArn":"arn:aws:cloudwatch:us-east-1:123456789012:alarm:HighCPU"}`
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/inbound/cloudwatch", strings.NewReader(sign(SNSMessage{Type: "Notification",
+		MessageID: "n-1", Message: alarm, TopicArn: "arn:aws:sns:us-east-1:123456789012:alarms", Timestamp: "2024-05-01T10:00:01.000Z"})))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("SNS-signed message with an ingest secret set: got %d %s, want 200", w.Code, w.Body.String())
+	}
+}
+
+func TestSNSRejectsUnsignedAndForgedMessages(t *testing.T) {
+	db := newTestDB(t)
+	h := &SNSHandler{DB: db}
+	sign := snsSigner(t)
+	alarm := `{"AlarmName":"HighCPU","NewStateValue":"ALARM","AlarmArn":"arn:aws:cloudwatch:us-east-1:123456789012:alarm:HighCPU"}`
+	msg := SNSMessage{Type: "Notification", MessageID: "n-1", Message: alarm, TopicArn: "arn:aws:sns:us-east-1:123456789012:alarms", Timestamp: "2024-05-01T10:00:01.000Z"}
+
+	unsigned, _ := json.Marshal(msg)
+	var tampered SNSMessage
+	_ = json.Unmarshal([]byte(sign(msg)), &tampered)
+	tampered.Message = strings.Replace(tampered.Message, "HighCPU", "Forged", 1)
+	forged, _ := json.Marshal(tampered)
+	otherHost := msg
+	otherHost.SigningCertURL = "https://evil.example.com/cert.pem"
+	for name, body := range map[string]string{"unsigned": string(unsigned), "tampered": string(forged), "foreign cert": sign(otherHost)} {
+		if w := serve(h.Serve, body); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d, want 401", name, w.Code)
+		}
+	}
+	var n int64
+	db.Model(&models.Alert{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("rejected messages created %d alerts", n)
+	}
+
+	v1 := msg
+	v1.SignatureVersion = "1"
+	post(t, h.Serve, sign(v1))
+	if db.Model(&models.Alert{}).Count(&n); n != 1 {
+		t.Errorf("SignatureVersion 1 message: got %d alerts, want 1", n)
+	}
+}
@@ -0,0 +1,112 @@
+package inbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathSegment is one step of a parsed JSONPath: an object key or an array index.
+type jsonPathSegment struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+// parseJSONPath parses the JSONPath subset used by ingest mappings: $, .key, ['key'], ["key"] and [n].
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	p := strings.TrimSpace(path)
+	if !strings.HasPrefix(p, "$") {
+		return nil, fmt.Errorf("jsonpath %q must start with $", path)
+	}
+	p = p[1:]
+	var segs []jsonPathSegment
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("jsonpath %q: empty key", path)
+			}
+			segs = append(segs, jsonPathSegment{key: p[:end]})
+			p = p[end:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q: missing ]", path)
+			}
+			inner := strings.TrimSpace(p[1:end])
+			p = p[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segs = append(segs, jsonPathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			n, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("jsonpath %q: invalid index %q", path, inner)
+			}
+			segs = append(segs, jsonPathSegment{index: n, isIdx: true})
+		default:
+			return nil, fmt.Errorf("jsonpath %q: unexpected %q", path, p[0])
+		}
+	}
+	return segs, nil
+}
+
+// evalJSONPath returns the value at path in doc (decoded with encoding/json), or nil when it does not exist.
+// Negative indexes count from the end of the array.
+func evalJSONPath(doc interface{}, path string) (interface{}, error) {
+	segs, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	cur := doc
+	for _, s := range segs {
+		if s.isIdx {
+			arr, ok := cur.([]interface{})
+			if !ok {
+				return nil, nil
+			}
+			i := s.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, nil
+			}
+			cur = arr[i]
+			continue
+		}
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		cur, ok = obj[s.key]
+		if !ok {
+			return nil, nil
+		}
+	}
+	return cur, nil
+}
+
+// jsonScalarString formats a JSON scalar as string; objects and arrays are re-encoded as JSON.
+func jsonScalarString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
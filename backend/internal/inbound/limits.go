@@ -0,0 +1,92 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/requestid"
+)
+
+// maxBodyBytes bounds an inbound request body. Configure with INBOUND_MAX_BODY_BYTES (default 10 MiB).
+var maxBodyBytes = func() int64 {
+	v := os.Getenv("INBOUND_MAX_BODY_BYTES")
+	if v == "" {
+		return 10 << 20
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		log.Printf("[inbound] invalid INBOUND_MAX_BODY_BYTES %q, using 10 MiB", v)
+		return 10 << 20
+	}
+	return n
+}()
+
+// processTimeout bounds how long one inbound request may spend storing its alerts.
+// Configure with INBOUND_TIMEOUT (Go duration, default 30s).
+var processTimeout = func() time.Duration {
+	v := os.Getenv("INBOUND_TIMEOUT")
+	if v == "" {
+		return 30 * time.Second
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("[inbound] invalid INBOUND_TIMEOUT %q, using 30s", v)
+		return 30 * time.Second
+	}
+	return d
+}()
+
+// LimitRequest is middleware for the inbound group: bodies over INBOUND_MAX_BODY_BYTES get 413, and the
+// request context gets a deadline of INBOUND_TIMEOUT that the handlers check between alerts. It runs before
+// VerifySignature so the signature check never buffers an oversized body.
+func LimitRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBodyBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), processTimeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// abortBadBody answers a failed body read or decode: 413 when the body hit the size limit, else 400 with msg.
+func abortBadBody(c *gin.Context, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+}
+
+// deadlinePassed reports whether the request's processing deadline has passed. Handlers check it before
+// each alert of a batch and stop once it has, so no alert is left half-processed.
+func (b *batchResult) deadlinePassed(c *gin.Context) bool {
+	if c.Request.Context().Err() != nil {
+		b.timedOut = true
+	}
+	return b.timedOut
+}
+
+// respond writes the batch result: 200, or 503 when processing stopped at the deadline so the sender retries
+// (alerts already stored are deduplicated on redelivery).
+func (b *batchResult) respond(c *gin.Context, received int) {
+	resp := b.response(received)
+	if b.timedOut {
+		log.Printf("[inbound] [trace=%s] processing timed out, %d of %d alerts stored", requestid.Get(c), len(b.alerts), received)
+		resp["error"] = "processing timed out"
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,191 @@
+package inbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/dedup"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// IngestMapping maps fields of an arbitrary JSON payload to alert fields using JSONPath (stored on
+// Datasource.IngestMapping). When Alerts is set, each element of that array is one alert and the other
+// paths are evaluated against the element; otherwise the whole payload is a single alert.
+//
+//	{"alerts":"$.events","title":"$.alert.name","severity":"$.level","status":"$.state","labels":"$.tags"}
+type IngestMapping struct {
+	Alerts      string `json:"alerts,omitempty"`
+	Title       string `json:"title"`
+	Severity    string `json:"severity,omitempty"`
+	Status      string `json:"status,omitempty"`      // value matching ResolvedValues (or "resolved") marks the alert resolved
+	Labels      string `json:"labels,omitempty"`      // object path; values are stringified
+	Annotations string `json:"annotations,omitempty"` // object path; values are stringified
+	Value       string `json:"value,omitempty"`       // stored as annotations.value
+	Fingerprint string `json:"fingerprint,omitempty"` // used as external_id when present
+	StartsAt    string `json:"starts_at,omitempty"`   // RFC3339 string or unix seconds
+	EndsAt      string `json:"ends_at,omitempty"`
+	// ResolvedValues lists status values (case-insensitive) meaning resolved; default resolved, ok, recovered, closed.
+	ResolvedValues []string `json:"resolved_values,omitempty"`
+}
+
+// ParseIngestMapping decodes and validates a mapping (all set paths must parse; title is required).
+func ParseIngestMapping(raw string) (*IngestMapping, error) {
+	var m IngestMapping
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return nil, fmt.Errorf("invalid ingest mapping json: %w", err)
+	}
+	if m.Title == "" {
+		return nil, fmt.Errorf("ingest mapping: title path required")
+	}
+	for _, p := range []string{m.Alerts, m.Title, m.Severity, m.Status, m.Labels, m.Annotations, m.Value, m.Fingerprint, m.StartsAt, m.EndsAt} {
+		if p == "" {
+			continue
+		}
+		if _, err := parseJSONPath(p); err != nil {
+			return nil, fmt.Errorf("ingest mapping: %w", err)
+		}
+	}
+	return &m, nil
+}
+
+// MappedHandler receives arbitrary JSON payloads and converts them to alerts with the datasource's IngestMapping.
+type MappedHandler struct {
+	DB *gorm.DB
+}
+
+// Serve handles POST /inbound/custom/:source_id.
+func (h *MappedHandler) Serve(c *gin.Context) {
+	sourceID, err := strconv.ParseUint(c.Param("source_id"), 10, 64)
+	if err != nil || sourceID == 0 {
+		c.JSON(400, gin.H{"error": "invalid source_id"})
+		return
+	}
+	var ds models.Datasource
+	if err := h.DB.First(&ds, sourceID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "datasource not found"})
+		return
+	}
+	if !ds.Enabled {
+		c.JSON(403, gin.H{"error": "datasource disabled"})
+		return
+	}
+	if ds.IngestMapping == "" {
+		c.JSON(400, gin.H{"error": "datasource has no ingest_mapping"})
+		return
+	}
+	mapping, err := ParseIngestMapping(ds.IngestMapping)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		abortBadBody(c, err, "read body failed")
+		return
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		c.JSON(400, gin.H{"error": "invalid json"})
+		return
+	}
+	items := []interface{}{doc}
+	if mapping.Alerts != "" {
+		v, _ := evalJSONPath(doc, mapping.Alerts)
+		arr, ok := v.([]interface{})
+		if !ok {
+			c.JSON(400, gin.H{"error": "alerts path " + mapping.Alerts + " is not an array"})
+			return
+		}
+		items = arr
+	}
+	sourceType := ds.Type
+	if sourceType == "" {
+		sourceType = "custom"
+	}
+	alerts := make([]incomingAlert, 0, len(items))
+	for _, item := range items {
+		in := mapping.apply(item)
+		if in.ExternalID == "" {
+			// Uniqueness: datasource + title + all labels (same => same alert, reuse ID until resolved)
+			in.ExternalID = dedup.Key(uint(sourceID), in.Title, in.Labels)
+		}
+		alerts = append(alerts, in)
+	}
+	ingest(c, h.DB, uint(sourceID), sourceType, alerts, len(items))
+}
+
+// apply evaluates the mapping against one alert item.
+func (m *IngestMapping) apply(item interface{}) incomingAlert {
+	str := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		v, _ := evalJSONPath(item, path)
+		return jsonScalarString(v)
+	}
+	strMap := func(path string) map[string]string {
+		out := make(map[string]string)
+		if path == "" {
+			return out
+		}
+		v, _ := evalJSONPath(item, path)
+		if obj, ok := v.(map[string]interface{}); ok {
+			for k, val := range obj {
+				out[k] = jsonScalarString(val)
+			}
+		}
+		return out
+	}
+
+	in := incomingAlert{
+		Title:       str(m.Title),
+		Severity:    strings.ToLower(str(m.Severity)),
+		Labels:      strMap(m.Labels),
+		Annotations: strMap(m.Annotations),
+		ExternalID:  str(m.Fingerprint),
+		Status:      "firing",
+	}
+	if in.Title == "" {
+		in.Title = "Alert"
+	}
+	if in.Severity == "" {
+		in.Severity = "warning"
+	}
+	if v := str(m.Value); v != "" {
+		in.Annotations["value"] = v
+	}
+	resolvedValues := m.ResolvedValues
+	if len(resolvedValues) == 0 {
+		resolvedValues = []string{"resolved", "ok", "recovered", "closed"}
+	}
+	status := str(m.Status)
+	for _, rv := range resolvedValues {
+		if status != "" && strings.EqualFold(status, rv) {
+			in.Status = "resolved"
+			break
+		}
+	}
+	in.FiringAt, in.ResolvedAt = parseWebhookTimes(normalizeTime(str(m.StartsAt)), normalizeTime(str(m.EndsAt)))
+	if in.Status == "resolved" && in.ResolvedAt == nil {
+		now := time.Now()
+		in.ResolvedAt = &now
+	}
+	return in
+}
+
+// normalizeTime converts unix seconds to RFC3339 so parseWebhookTimes accepts either form.
+func normalizeTime(s string) string {
+	if s == "" {
+		return ""
+	}
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(int64(sec), 0).UTC().Format(time.RFC3339)
+	}
+	return s
+}
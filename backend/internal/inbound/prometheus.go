@@ -1,22 +1,24 @@
 package inbound
 
 import (
-	"encoding/json"
-	"fmt"
-	"time"
+	"log"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/kk-alert/backend/internal/dedup"
-	"github.com/kk-alert/backend/internal/engine"
-	"github.com/kk-alert/backend/internal/models"
+	"github.com/kk-alert/backend/internal/requestid"
 	"gorm.io/gorm"
 )
 
 // Prometheus webhook payload (Alertmanager format).
 // https://prometheus.io/docs/alerting/latest/configuration/#webhook_config
 type PrometheusWebhook struct {
-	Alerts []struct {
+	Version           string            `json:"version"`  // "4" for current Alertmanager releases
+	Receiver          string            `json:"receiver"` // Alertmanager receiver that delivered the batch
+	Status            string            `json:"status"`   // batch status; used when an alert omits its own
+	GroupKey          string            `json:"groupKey"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	Alerts            []struct {
 		Status      string            `json:"status"`
 		Labels      map[string]string  `json:"labels"`
 		Annotations map[string]string  `json:"annotations"`
@@ -26,6 +28,9 @@ type PrometheusWebhook struct {
 	} `json:"alerts"`
 }
 
+// alertmanagerWebhookVersion is the webhook payload version this handler understands.
+const alertmanagerWebhookVersion = "4"
+
 // PrometheusHandler receives Alertmanager webhooks and normalizes to unified alert model.
 type PrometheusHandler struct {
 	DB         *gorm.DB
@@ -37,39 +42,39 @@ type PrometheusHandler struct {
 func (h *PrometheusHandler) Serve(c *gin.Context) {
 	var payload PrometheusWebhook
 	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(400, gin.H{"error": "invalid json"})
+		abortBadBody(c, err, "invalid json")
 		return
 	}
-	sourceID := h.SourceID
-	if id := c.Query("source_id"); id != "" {
-		var u uint
-		if _, _ = fmt.Sscanf(id, "%d", &u); u != 0 {
-			sourceID = u
-		}
-	}
+	sourceID := sourceIDFromQuery(c, h.SourceID)
 	if sourceID == 0 {
 		sourceID = 1
 	}
-	created := 0
+	if payload.Version != "" && payload.Version != alertmanagerWebhookVersion {
+		log.Printf("[inbound] [trace=%s] unexpected Alertmanager webhook version %q (want %q), payload may not parse as expected",
+			requestid.Get(c), payload.Version, alertmanagerWebhookVersion)
+	}
+	alerts := make([]incomingAlert, 0, len(payload.Alerts))
 	for _, a := range payload.Alerts {
-		labelsJSON, _ := json.Marshal(a.Labels)
-		annotationsJSON, _ := json.Marshal(a.Annotations)
+		if a.Status == "" {
+			a.Status = payload.Status
+		}
+		if payload.Receiver != "" {
+			// Lets rules route by which receiver fed the batch; an alert's own receiver label wins.
+			a.Labels = mergeMissing(a.Labels, map[string]string{"receiver": payload.Receiver})
+		}
 		status := "firing"
 		if a.Status == "resolved" {
 			status = "resolved"
 		}
-		var resolvedAt *time.Time
-		if a.EndsAt != "" {
-			if t, err := time.Parse(time.RFC3339, a.EndsAt); err == nil {
-				resolvedAt = &t
+		firingAt, resolvedAt := parseWebhookTimes(a.StartsAt, a.EndsAt)
+		// Keep Alertmanager's grouping context: per-alert values win over common ones.
+		a.Labels = mergeMissing(a.Labels, payload.CommonLabels)
+		a.Annotations = mergeMissing(a.Annotations, payload.CommonAnnotations)
+		if payload.GroupKey != "" {
+			if a.Annotations == nil {
+				a.Annotations = make(map[string]string)
 			}
-		}
-		var firingAt time.Time
-		if a.StartsAt != "" {
-			firingAt, _ = time.Parse(time.RFC3339, a.StartsAt)
-		}
-		if firingAt.IsZero() {
-			firingAt = time.Now()
+			a.Annotations["group_key"] = payload.GroupKey
 		}
 		title := a.Annotations["summary"]
 		if title == "" {
@@ -82,69 +87,23 @@ func (h *PrometheusHandler) Serve(c *gin.Context) {
 		if severity == "" {
 			severity = "warning"
 		}
-		// Uniqueness: datasource + title + all labels (same => same alert, reuse ID until resolved)
-		externalID := dedup.Key(sourceID, title, a.Labels)
-
-		// Reuse same alert ID while previous alert with same (source_id, external_id) is still firing; only new ID after resolved.
-		var alert models.Alert
-		hasFiring := h.DB.Where("source_id = ? AND external_id = ? AND status = ?", sourceID, externalID, "firing").First(&alert).Error == nil
-
-		if status == "resolved" {
-			if hasFiring {
-				alert.Status = "resolved"
-				alert.ResolvedAt = resolvedAt
-				alert.Title = title
-				alert.Labels = string(labelsJSON)
-				alert.Annotations = string(annotationsJSON)
-				h.DB.Save(&alert)
-			} else {
-				// No prior firing row: create resolved-only record for history
-				alert = models.Alert{
-					ID:          uuid.New().String(),
-					SourceID:    sourceID,
-					SourceType:  h.SourceType,
-					ExternalID:  externalID,
-					Title:       title,
-					Severity:    severity,
-					Status:      "resolved",
-					FiringAt:    firingAt,
-					ResolvedAt:  resolvedAt,
-					Labels:      string(labelsJSON),
-					Annotations: string(annotationsJSON),
-				}
-				h.DB.Create(&alert)
-			}
-		} else {
-			if hasFiring {
-				// Existing firing: update in place (keep same ID)
-				alert.Title = title
-				alert.Severity = severity
-				alert.FiringAt = firingAt
-				alert.Labels = string(labelsJSON)
-				alert.Annotations = string(annotationsJSON)
-				h.DB.Save(&alert)
-			} else {
-				// No firing for this fingerprint: create new
-				alert = models.Alert{
-					ID:          uuid.New().String(),
-					SourceID:    sourceID,
-					SourceType:  h.SourceType,
-					ExternalID:  externalID,
-					Title:       title,
-					Severity:    severity,
-					Status:      "firing",
-					FiringAt:    firingAt,
-					ResolvedAt:  nil,
-					Labels:      string(labelsJSON),
-					Annotations: string(annotationsJSON),
-				}
-				if err := h.DB.Create(&alert).Error; err != nil {
-					continue
-				}
-				created++
-			}
+		// Uniqueness: upstream fingerprint when sent (stable even if our title extraction changes),
+		// else datasource + title + all labels (same => same alert, reuse ID until resolved)
+		externalID := a.Fingerprint
+		if externalID == "" {
+			externalID = dedup.Key(sourceID, title, a.Labels)
 		}
-		engine.ProcessAlert(h.DB, &alert)
+
+		alerts = append(alerts, incomingAlert{
+			ExternalID:  externalID,
+			Title:       title,
+			Severity:    severity,
+			Status:      status,
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			FiringAt:    firingAt,
+			ResolvedAt:  resolvedAt,
+		})
 	}
-	c.JSON(200, gin.H{"received": len(payload.Alerts), "created": created})
+	ingest(c, h.DB, sourceID, h.SourceType, alerts, len(payload.Alerts))
 }
@@ -0,0 +1,153 @@
+package inbound
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/engine"
+	"github.com/kk-alert/backend/internal/requestid"
+	"gorm.io/gorm"
+)
+
+// maxSyncAlerts is the largest batch an inbound request stores within the request. Larger batches (e.g. an
+// Alertmanager storm) are queued and answered with 202 at once. Configure with INBOUND_MAX_BATCH (default
+// 200; 0 processes every batch within the request).
+var maxSyncAlerts = func() int {
+	v := os.Getenv("INBOUND_MAX_BATCH")
+	if v == "" {
+		return 200
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("[inbound] invalid INBOUND_MAX_BATCH %q, using 200", v)
+		return 200
+	}
+	return n
+}()
+
+// batchJob is a queued inbound batch.
+type batchJob struct {
+	db         *gorm.DB
+	sourceID   uint
+	sourceType string
+	alerts     []incomingAlert
+	traceID    string
+}
+
+// Queued batches are stored by 2 workers (see StartQueue); a full queue (32 batches) makes the request fail
+// with 503 so the sender retries later instead of the server buffering without bound.
+var batchQueue = make(chan batchJob, 32)
+
+// queueMu guards queueStarted and queueClosed; workers tracks the batch workers so Drain can wait for them.
+var (
+	queueMu      sync.RWMutex
+	queueStarted bool
+	queueClosed  bool
+	workers      sync.WaitGroup
+)
+
+// StartQueue starts the workers that store queued batches. Call it once at startup; Drain stops them.
+// Until it is called, batches over INBOUND_MAX_BATCH are refused with 503.
+func StartQueue() {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	if queueStarted || queueClosed {
+		return
+	}
+	queueStarted = true
+	const numWorkers = 2
+	for i := 0; i < numWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range batchQueue {
+				var result batchResult
+				for _, in := range job.alerts {
+					result.store(job.db, job.sourceID, job.sourceType, in, job.traceID)
+				}
+				log.Printf("[inbound] [trace=%s] queued batch done: %d of %d alerts stored, %d created",
+					job.traceID, len(result.alerts), len(job.alerts), result.created)
+			}
+		}()
+	}
+}
+
+// enqueueBatch queues job, reporting false when the queue is not started, full or draining.
+func enqueueBatch(job batchJob) bool {
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	if !queueStarted || queueClosed {
+		return false
+	}
+	select {
+	case batchQueue <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain stops accepting queued batches, then waits until the queued ones have been stored or ctx is done.
+// Run it after the HTTP server has stopped and before engine.Drain.
+func Drain(ctx context.Context) error {
+	queueMu.Lock()
+	if !queueClosed {
+		queueClosed = true
+		close(batchQueue)
+	}
+	queueMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		log.Printf("[inbound] drain timed out with %d batches still queued", len(batchQueue))
+		return ctx.Err()
+	}
+}
+
+// store stores one alert and queues it for the engine, like the scheduler does, so a slow channel does not
+// hold up the webhook response. The result counts what was stored, not what was delivered. Alerts that fail
+// to store or are dropped by relabeling are skipped.
+func (b *batchResult) store(db *gorm.DB, sourceID uint, sourceType string, in incomingAlert, traceID string) {
+	alert, isNew, err := storeAlert(db, sourceID, sourceType, in)
+	if err != nil {
+		return
+	}
+	b.add(alert, isNew)
+	engine.ProcessAlertAsync(db, &alert, traceID)
+}
+
+// ingest stores the alerts a handler normalized from one request and writes the response. received is the
+// number of alerts in the payload. A batch over maxSyncAlerts is queued and answered with 202.
+func ingest(c *gin.Context, db *gorm.DB, sourceID uint, sourceType string, alerts []incomingAlert, received int) {
+	traceID := requestid.Get(c)
+	if maxSyncAlerts > 0 && len(alerts) > maxSyncAlerts {
+		if !enqueueBatch(batchJob{db: db, sourceID: sourceID, sourceType: sourceType, alerts: alerts, traceID: traceID}) {
+			c.Header("Retry-After", "30")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "inbound queue full, retry later"})
+			return
+		}
+		log.Printf("[inbound] [trace=%s] batch of %d alerts queued (over INBOUND_MAX_BATCH=%d)", traceID, len(alerts), maxSyncAlerts)
+		c.JSON(http.StatusAccepted, gin.H{"received": received, "queued": len(alerts)})
+		return
+	}
+	var result batchResult
+	for _, in := range alerts {
+		if result.deadlinePassed(c) {
+			break
+		}
+		result.store(db, sourceID, sourceType, in, traceID)
+	}
+	result.respond(c, received)
+}
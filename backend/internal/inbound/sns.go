@@ -0,0 +1,317 @@
+package inbound
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kk-alert/backend/internal/httpclient"
+	"github.com/kk-alert/backend/internal/requestid"
+	"gorm.io/gorm"
+)
+
+// SNSMessage is the envelope AWS SNS posts to an HTTP(S) subscription.
+// https://docs.aws.amazon.com/sns/latest/dg/sns-message-and-json-formats.html
+type SNSMessage struct {
+	Type             string `json:"Type"` // SubscriptionConfirmation, Notification or UnsubscribeConfirmation
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SubscribeURL     string `json:"SubscribeURL"`
+	SignatureVersion string `json:"SignatureVersion"` // 1 = SHA1withRSA, 2 = SHA256withRSA
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+}
+
+// CloudWatchAlarm is the Message of an SNS notification sent by a CloudWatch alarm action.
+type CloudWatchAlarm struct {
+	AlarmName        string `json:"AlarmName"`
+	AlarmDescription string `json:"AlarmDescription"`
+	AWSAccountID     string `json:"AWSAccountId"`
+	NewStateValue    string `json:"NewStateValue"` // ALARM, OK or INSUFFICIENT_DATA
+	NewStateReason   string `json:"NewStateReason"`
+	StateChangeTime  string `json:"StateChangeTime"`
+	Region           string `json:"Region"` // display name, e.g. "US East (N. Virginia)"
+	AlarmArn         string `json:"AlarmArn"`
+	OldStateValue    string `json:"OldStateValue"`
+	Trigger          struct {
+		MetricName         string  `json:"MetricName"`
+		Namespace          string  `json:"Namespace"`
+		Statistic          string  `json:"Statistic"`
+		ComparisonOperator string  `json:"ComparisonOperator"`
+		Threshold          float64 `json:"Threshold"`
+		Dimensions         []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"Dimensions"`
+	} `json:"Trigger"`
+}
+
+// snsSubscribeHost matches the SNS endpoints a SubscribeURL may point at, so a forged confirmation cannot
+// make the server fetch an arbitrary URL.
+var snsSubscribeHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// confirmSubscription fetches an SNS SubscribeURL (overridden in tests).
+var confirmSubscription = func(subscribeURL string) error {
+	resp, err := httpclient.Default.Get(subscribeURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// validSubscribeURL reports whether u is an https URL on an SNS endpoint.
+func validSubscribeURL(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && parsed.Scheme == "https" && snsSubscribeHost.MatchString(parsed.Hostname())
+}
+
+// snsCerts caches parsed SNS signing certificates by URL; SNS rotates them rarely.
+var snsCerts sync.Map
+
+// fetchSigningCert downloads and parses the PEM certificate at an SNS SigningCertURL (overridden in tests).
+var fetchSigningCert = func(certURL string) (*x509.Certificate, error) {
+	if c, ok := snsCerts.Load(certURL); ok {
+		return c.(*x509.Certificate), nil
+	}
+	resp, err := httpclient.Default.Get(certURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	snsCerts.Store(certURL, cert)
+	return cert, nil
+}
+
+// snsStringToSign builds the canonical text SNS signs for msg: the message-type specific keys in byte order,
+// each as "Key\nvalue\n", with Subject left out when empty.
+func snsStringToSign(msg *SNSMessage) (string, error) {
+	var fields [][2]string
+	switch msg.Type {
+	case "Notification":
+		fields = [][2]string{{"Message", msg.Message}, {"MessageId", msg.MessageID}}
+		if msg.Subject != "" {
+			fields = append(fields, [2]string{"Subject", msg.Subject})
+		}
+		fields = append(fields, [2]string{"Timestamp", msg.Timestamp}, [2]string{"TopicArn", msg.TopicArn}, [2]string{"Type", msg.Type})
+	case "SubscriptionConfirmation", "UnsubscribeConfirmation":
+		fields = [][2]string{{"Message", msg.Message}, {"MessageId", msg.MessageID}, {"SubscribeURL", msg.SubscribeURL},
+			{"Timestamp", msg.Timestamp}, {"Token", msg.Token}, {"TopicArn", msg.TopicArn}, {"Type", msg.Type}}
+	default:
+		return "", fmt.Errorf("unsupported SNS message type %s", strconv.Quote(msg.Type))
+	}
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(f[0] + "\n" + f[1] + "\n")
+	}
+	return b.String(), nil
+}
+
+// verifySNSMessage checks msg's signature against the certificate at its SigningCertURL, which must be an
+// https URL on an SNS endpoint, so only messages actually sent by SNS are accepted.
+func verifySNSMessage(msg *SNSMessage) error {
+	var hash crypto.Hash
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("unsupported SignatureVersion %s", strconv.Quote(msg.SignatureVersion))
+	}
+	if !validSubscribeURL(msg.SigningCertURL) || !strings.HasSuffix(msg.SigningCertURL, ".pem") {
+		return errors.New("SigningCertURL is not an SNS certificate")
+	}
+	sig, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return errors.New("invalid Signature encoding")
+	}
+	text, err := snsStringToSign(msg)
+	if err != nil {
+		return err
+	}
+	cert, err := fetchSigningCert(msg.SigningCertURL)
+	if err != nil {
+		return fmt.Errorf("fetch signing certificate: %w", err)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("signing certificate has no RSA key")
+	}
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(text))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(text))
+		digest = sum[:]
+	}
+	if err := rsa.VerifyPKCS1v15(key, hash, digest, sig); err != nil {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// SNSHandler receives CloudWatch alarm notifications through an SNS topic's HTTP(S) subscription and
+// confirms the subscription when SNS asks. SNS cannot sign requests with an ingest secret; instead every
+// message's SNS signature is verified against the amazonaws.com signing certificate it names.
+type SNSHandler struct {
+	DB       *gorm.DB
+	SourceID uint
+}
+
+// Serve handles POST /inbound/cloudwatch.
+func (h *SNSHandler) Serve(c *gin.Context) {
+	// SNS posts with Content-Type text/plain, so the body is decoded directly rather than bound.
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		abortBadBody(c, err, "read body failed")
+		return
+	}
+	var msg SNSMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.JSON(400, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := verifySNSMessage(&msg); err != nil {
+		log.Printf("[inbound] [trace=%s] rejected SNS message %s: %v", requestid.Get(c), msg.MessageID, err)
+		c.JSON(401, gin.H{"error": "invalid SNS signature: " + err.Error()})
+		return
+	}
+	switch msg.Type {
+	case "SubscriptionConfirmation":
+		if !validSubscribeURL(msg.SubscribeURL) {
+			c.JSON(400, gin.H{"error": "SubscribeURL is not an SNS endpoint"})
+			return
+		}
+		if err := confirmSubscription(msg.SubscribeURL); err != nil {
+			log.Printf("[inbound] [trace=%s] confirm SNS subscription to %s failed: %v", requestid.Get(c), msg.TopicArn, err)
+			c.JSON(502, gin.H{"error": "confirm subscription failed: " + err.Error()})
+			return
+		}
+		log.Printf("[inbound] confirmed SNS subscription to %s", msg.TopicArn)
+		c.JSON(200, gin.H{"status": "subscribed"})
+		return
+	case "UnsubscribeConfirmation":
+		c.JSON(200, gin.H{"status": "ignored"})
+		return
+	case "Notification":
+	default:
+		c.JSON(400, gin.H{"error": "unsupported SNS message type " + strconv.Quote(msg.Type)})
+		return
+	}
+
+	var alarm CloudWatchAlarm
+	if err := json.Unmarshal([]byte(msg.Message), &alarm); err != nil || alarm.AlarmName == "" {
+		c.JSON(400, gin.H{"error": "message is not a CloudWatch alarm"})
+		return
+	}
+	var status string
+	switch alarm.NewStateValue {
+	case "ALARM":
+		status = "firing"
+	case "OK":
+		status = "resolved"
+	default:
+		// INSUFFICIENT_DATA says nothing about the metric; keep the alert as it is.
+		var result batchResult
+		c.JSON(200, result.response(1))
+		return
+	}
+	sourceID := sourceIDFromQuery(c, h.SourceID)
+	if sourceID == 0 {
+		sourceID = 1
+	}
+
+	changedAt, err := time.Parse("2006-01-02T15:04:05.000-0700", alarm.StateChangeTime)
+	if err != nil {
+		changedAt = time.Now()
+	}
+	firingAt := changedAt
+	var resolvedAt *time.Time
+	if status == "resolved" {
+		resolvedAt = &changedAt
+	}
+
+	labels := map[string]string{"alertname": alarm.AlarmName}
+	// arn:aws:cloudwatch:<region>:<account>:alarm:<name>
+	if parts := strings.SplitN(alarm.AlarmArn, ":", 6); len(parts) == 6 {
+		labels["region"] = parts[3]
+	}
+	for k, v := range map[string]string{"account_id": alarm.AWSAccountID, "namespace": alarm.Trigger.Namespace, "metric_name": alarm.Trigger.MetricName} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	for _, d := range alarm.Trigger.Dimensions {
+		if d.Name != "" {
+			labels[d.Name] = d.Value
+		}
+	}
+	annotations := map[string]string{"description": alarm.NewStateReason}
+	if alarm.AlarmDescription != "" {
+		annotations["summary"] = alarm.AlarmDescription
+	}
+	if alarm.Trigger.ComparisonOperator != "" {
+		annotations["threshold"] = alarm.Trigger.ComparisonOperator + " " + strconv.FormatFloat(alarm.Trigger.Threshold, 'g', -1, 64)
+	}
+	severity := c.Query("severity")
+	if severity == "" {
+		severity = "warning"
+	}
+	// The alarm ARN is unique per alarm and stable across its state changes.
+	externalID := alarm.AlarmArn
+	if externalID == "" {
+		externalID = "cloudwatch:" + alarm.AlarmName
+	}
+
+	ingest(c, h.DB, sourceID, "cloudwatch", []incomingAlert{{
+		ExternalID:  externalID,
+		Title:       alarm.AlarmName,
+		Severity:    severity,
+		Status:      status,
+		Labels:      labels,
+		Annotations: annotations,
+		FiringAt:    firingAt,
+		ResolvedAt:  resolvedAt,
+	}}, 1)
+}
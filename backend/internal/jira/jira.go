@@ -6,7 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
+
+	"github.com/kk-alert/backend/internal/httpclient"
 )
 
 // Config from rule JiraConfig JSON. For Jira Cloud use Email + Token (API token) as basic auth.
@@ -59,8 +60,7 @@ func CreateIssue(cfg *Config, summary, description string) (string, error) {
 			req.Header.Set("Authorization", "Bearer "+cfg.Token)
 		}
 	}
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := httpclient.Default.Do(req)
 	if err != nil {
 		return "", err
 	}
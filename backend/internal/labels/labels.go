@@ -0,0 +1,19 @@
+// Package labels holds label helpers shared by the inbound handlers, the scheduler and the API.
+package labels
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ParseDefaults decodes a datasource's DefaultLabels JSON object. Empty input yields nil.
+func ParseDefaults(raw string) (map[string]string, error) {
+	if raw == "" || raw == "{}" || raw == "null" {
+		return nil, nil
+	}
+	var m map[string]string
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return nil, fmt.Errorf("invalid default_labels: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,390 @@
+// Package ldap is a minimal LDAPv3 client: simple bind and search over ldap:// or ldaps://, enough to check
+// a user's password against a directory and read their group memberships.
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Result codes used by callers.
+const (
+	ResultSuccess            = 0
+	ResultInvalidCredentials = 49
+)
+
+// Error is a non-success LDAPResult.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("ldap: result %d: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("ldap: result %d", e.Code)
+}
+
+// IsInvalidCredentials reports whether err is the directory rejecting a bind.
+func IsInvalidCredentials(err error) bool {
+	var le *Error
+	return errors.As(err, &le) && le.Code == ResultInvalidCredentials
+}
+
+// Conn is one connection to a directory server. It is not safe for concurrent use.
+type Conn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	msgID   int64
+	timeout time.Duration
+}
+
+// Dial connects to rawURL (ldap://host[:389] or ldaps://host[:636]). timeout bounds the dial and every
+// later request.
+func Dial(rawURL string, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	d := &net.Dialer{Timeout: timeout}
+	var nc net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		nc, err = d.Dial("tcp", host)
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		nc, err = tls.DialWithDialer(d, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: nc, r: bufio.NewReader(nc), timeout: timeout}, nil
+}
+
+// Close sends an unbind and closes the connection.
+func (c *Conn) Close() error {
+	c.msgID++
+	_ = c.write(sequence(integer(c.msgID), tlv(0x42, nil)))
+	return c.conn.Close()
+}
+
+// Bind performs a simple bind. An empty password is refused here: servers treat it as an anonymous bind
+// and report success.
+func (c *Conn) Bind(dn, password string) error {
+	if password == "" {
+		return &Error{Code: ResultInvalidCredentials, Message: "empty password"}
+	}
+	c.msgID++
+	req := tlv(0x60, concat(integer(3), octetString(dn), tlv(0x80, []byte(password))))
+	if err := c.write(sequence(integer(c.msgID), req)); err != nil {
+		return err
+	}
+	op, err := c.read()
+	if err != nil {
+		return err
+	}
+	if op.tag != 0x61 {
+		return fmt.Errorf("ldap: unexpected response tag 0x%x to bind", op.tag)
+	}
+	return result(op)
+}
+
+// Scope of a search.
+const (
+	ScopeBase    = 0
+	ScopeSubtree = 2
+)
+
+// Entry is one search result.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string // keyed by the attribute name as the server returned it, lower-cased
+}
+
+// Get returns the first value of attr, or "".
+func (e *Entry) Get(attr string) string {
+	if v := e.Attributes[strings.ToLower(attr)]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Search runs a search whose filter is (attr=value), or (objectClass=*) when attr is empty, returning at
+// most sizeLimit entries.
+func (c *Conn) Search(base string, scope int, attr, value string, attrs []string, sizeLimit int) ([]Entry, error) {
+	var filter []byte
+	if attr == "" {
+		filter = tlv(0x87, []byte("objectClass"))
+	} else {
+		filter = tlv(0xa3, concat(octetString(attr), octetString(value)))
+	}
+	var attrList []byte
+	for _, a := range attrs {
+		attrList = append(attrList, octetString(a)...)
+	}
+	req := tlv(0x63, concat(
+		octetString(base),
+		tlv(0x0a, []byte{byte(scope)}),
+		tlv(0x0a, []byte{0}), // neverDerefAliases
+		integer(int64(sizeLimit)),
+		integer(int64(c.timeout/time.Second)),
+		tlv(0x01, []byte{0}), // typesOnly false
+		filter,
+		sequence(attrList),
+	))
+	c.msgID++
+	if err := c.write(sequence(integer(c.msgID), req)); err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for {
+		op, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case 0x64: // SearchResultEntry
+			e, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		case 0x73: // SearchResultReference: referrals are not followed
+		case 0x65: // SearchResultDone
+			return entries, result(op)
+		default:
+			return nil, fmt.Errorf("ldap: unexpected response tag 0x%x to search", op.tag)
+		}
+	}
+}
+
+func parseEntry(op element) (Entry, error) {
+	kids, err := op.children()
+	if err != nil || len(kids) < 2 {
+		return Entry{}, errors.New("ldap: malformed search entry")
+	}
+	e := Entry{DN: string(kids[0].value), Attributes: make(map[string][]string)}
+	attrs, err := kids[1].children()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, a := range attrs {
+		pair, err := a.children()
+		if err != nil || len(pair) < 2 {
+			return Entry{}, errors.New("ldap: malformed attribute")
+		}
+		vals, err := pair[1].children()
+		if err != nil {
+			return Entry{}, err
+		}
+		name := strings.ToLower(string(pair[0].value))
+		for _, v := range vals {
+			e.Attributes[name] = append(e.Attributes[name], string(v.value))
+		}
+	}
+	return e, nil
+}
+
+// result turns an LDAPResult body (resultCode, matchedDN, diagnosticMessage, ...) into an error.
+func result(op element) error {
+	kids, err := op.children()
+	if err != nil || len(kids) < 3 {
+		return errors.New("ldap: malformed result")
+	}
+	code := int(kids[0].int())
+	if code == ResultSuccess {
+		return nil
+	}
+	return &Error{Code: code, Message: string(kids[2].value)}
+}
+
+func (c *Conn) write(b []byte) error {
+	if c.timeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// read returns the protocol op of the next message for the current request; messages for other IDs
+// (e.g. unsolicited notifications) are skipped.
+func (c *Conn) read() (element, error) {
+	for {
+		if c.timeout > 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+		}
+		msg, err := readElement(c.r)
+		if err != nil {
+			return element{}, err
+		}
+		kids, err := msg.children()
+		if err != nil || len(kids) < 2 {
+			return element{}, errors.New("ldap: malformed message")
+		}
+		if kids[0].int() != c.msgID {
+			continue
+		}
+		return kids[1], nil
+	}
+}
+
+// EscapeDN escapes a value for use inside a distinguished name attribute value (RFC 4514).
+func EscapeDN(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, ch) >= 0,
+			ch == '#' && i == 0,
+			ch == ' ' && (i == 0 || i == len(s)-1):
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// BER encoding, limited to the definite-length forms LDAP uses.
+
+// element is a decoded TLV.
+type element struct {
+	tag   byte
+	value []byte
+}
+
+func (e element) children() ([]element, error) {
+	var out []element
+	r := &sliceReader{b: e.value}
+	for r.len() > 0 {
+		k, err := readElement(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+func (e element) int() int64 {
+	var n int64
+	for i, b := range e.value {
+		if i == 0 && b&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int64(b)
+	}
+	return n
+}
+
+// maxElementSize bounds a single message so a misbehaving server cannot make us allocate without limit.
+const maxElementSize = 16 << 20
+
+func readElement(r io.ByteReader) (element, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return element{}, err
+	}
+	lb, err := r.ReadByte()
+	if err != nil {
+		return element{}, err
+	}
+	n := int(lb)
+	if lb&0x80 != 0 {
+		k := int(lb & 0x7f)
+		if k == 0 || k > 4 {
+			return element{}, errors.New("ldap: unsupported length encoding")
+		}
+		n = 0
+		for i := 0; i < k; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return element{}, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	if n > maxElementSize {
+		return element{}, errors.New("ldap: message too large")
+	}
+	v := make([]byte, n)
+	for i := range v {
+		if v[i], err = r.ReadByte(); err != nil {
+			return element{}, err
+		}
+	}
+	return element{tag: tag, value: v}, nil
+}
+
+type sliceReader struct {
+	b []byte
+	i int
+}
+
+func (s *sliceReader) ReadByte() (byte, error) {
+	if s.i >= len(s.b) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	s.i++
+	return s.b[s.i-1], nil
+}
+
+func (s *sliceReader) len() int { return len(s.b) - s.i }
+
+func tlv(tag byte, v []byte) []byte {
+	out := []byte{tag}
+	switch n := len(v); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xffff:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, v...)
+}
+
+func integer(n int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+		if (n == 0 && b[0]&0x80 == 0) || (n == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return tlv(0x02, b)
+}
+
+func octetString(s string) []byte { return tlv(0x04, []byte(s)) }
+
+func sequence(parts ...[]byte) []byte { return tlv(0x30, concat(parts...)) }
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
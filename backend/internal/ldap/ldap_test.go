@@ -0,0 +1,116 @@
+package ldap
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeServer answers binds (password "good" succeeds) and returns one entry for any search.
+func fakeServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFake(nc)
+		}
+	}()
+	return "ldap://" + ln.Addr().String()
+}
+
+func serveFake(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	ldapResult := func(tag byte, code byte, msg string) []byte {
+		return tlv(tag, concat(tlv(0x0a, []byte{code}), octetString(""), octetString(msg)))
+	}
+	for {
+		msg, err := readElement(r)
+		if err != nil {
+			return
+		}
+		kids, _ := msg.children()
+		id := integer(kids[0].int())
+		switch kids[1].tag {
+		case 0x60:
+			req, _ := kids[1].children()
+			code := byte(ResultSuccess)
+			if string(req[2].value) != "good" {
+				code = ResultInvalidCredentials
+			}
+			nc.Write(sequence(id, ldapResult(0x61, code, "")))
+		case 0x63:
+			attrs := sequence(
+				sequence(octetString("mail"), tlv(0x31, octetString("bob@example.com"))),
+				sequence(octetString("memberOf"), tlv(0x31, concat(
+					octetString("cn=dev,ou=groups,dc=example,dc=com"),
+					octetString("cn=ops-admins,ou=groups,dc=example,dc=com"),
+				))),
+			)
+			nc.Write(sequence(id, tlv(0x64, concat(octetString("uid=bob,dc=example,dc=com"), attrs))))
+			nc.Write(sequence(id, ldapResult(0x65, ResultSuccess, "")))
+		case 0x42:
+			return
+		}
+	}
+}
+
+func TestBindAndSearch(t *testing.T) {
+	url := fakeServer(t)
+	conn, err := Dial(url, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind("uid=bob,dc=example,dc=com", "bad"); !IsInvalidCredentials(err) {
+		t.Fatalf("bad password: got %v", err)
+	}
+	if err := conn.Bind("uid=bob,dc=example,dc=com", ""); !IsInvalidCredentials(err) {
+		t.Fatalf("empty password must not bind anonymously: got %v", err)
+	}
+	if err := conn.Bind("uid=bob,dc=example,dc=com", "good"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	entries, err := conn.Search("dc=example,dc=com", ScopeSubtree, "uid", "bob", []string{"mail", "memberOf"}, 2)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("search: %v %v", entries, err)
+	}
+	e := entries[0]
+	if e.DN != "uid=bob,dc=example,dc=com" || e.Get("mail") != "bob@example.com" || len(e.Attributes["memberof"]) != 2 {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	for in, want := range map[string]string{
+		"bob":          "bob",
+		"a,b=c":        `a\,b\=c`,
+		" lead":        `\ lead`,
+		"#x":           `\#x`,
+		"x)(uid=*":     `x)(uid\=*`,
+		`back\slash"q`: `back\\slash\"q`,
+	} {
+		if got := EscapeDN(in); got != want {
+			t.Errorf("EscapeDN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIntegerRoundTrip(t *testing.T) {
+	for _, n := range []int64{0, 1, 127, 128, 255, 256, 65535, -1, -129} {
+		e, err := readElement(&sliceReader{b: integer(n)})
+		if err != nil || e.int() != n {
+			t.Errorf("integer(%d) decoded as %d (%v)", n, e.int(), err)
+		}
+	}
+}
@@ -8,36 +8,50 @@ import (
 
 // User for auth (minimal user store). Role: admin (all permissions), user (dashboard, alerts, reports only).
 type User struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	Username     string         `gorm:"uniqueIndex;size:64" json:"username"`
-	PasswordHash string         `gorm:"size:255" json:"-"`
-	Role         string         `gorm:"size:32;default:user" json:"role"` // admin | user
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	Username         string         `gorm:"uniqueIndex;size:64" json:"username"`
+	PasswordHash     string         `gorm:"size:255" json:"-"`
+	Email            string         `gorm:"size:255;index" json:"email,omitempty"` // SSO identity; users created by OIDC login have no password
+	TeamID           *uint          `gorm:"index" json:"team_id,omitempty"`        // non-admins only see their team's rules and alerts; nil = no restriction
+	Role             string         `gorm:"size:32;default:user" json:"role"`      // admin | operator | user | viewer
+	FailedLoginCount int            `gorm:"default:0" json:"failed_login_count"`   // consecutive bad passwords, reset on success
+	LockedUntil      *time.Time     `json:"locked_until,omitempty"`                // login refused until then (lock grows on repeated lockouts)
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // Datasource for alert ingestion (Prometheus, VictoriaMetrics, ES, Doris).
 type Datasource struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Name      string         `gorm:"size:128" json:"name"`
-	Type      string         `gorm:"size:32" json:"type"` // prometheus, victoriametrics, elasticsearch, doris
-	Endpoint  string         `gorm:"size:512" json:"endpoint"`
-	AuthType  string         `gorm:"size:32" json:"auth_type,omitempty"`
-	AuthValue string         `gorm:"size:512" json:"-"` // encrypted/masked in API
-	Enabled   bool           `gorm:"default:true" json:"enabled"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	Name          string         `gorm:"size:128" json:"name"`
+	Type          string         `gorm:"size:32" json:"type"` // prometheus, victoriametrics, loki, influxdb, elasticsearch, doris
+	TeamID        *uint          `gorm:"index" json:"team_id,omitempty"`
+	Endpoint      string         `gorm:"size:512" json:"endpoint"`
+	AuthType      string         `gorm:"size:32" json:"auth_type,omitempty"` // influxdb: basic (1.x, auth_value user:password) or token (2.x)
+	AuthValue     string         `gorm:"size:512" json:"-"` // encrypted/masked in API
+	Database      string         `gorm:"size:128" json:"database,omitempty"` // influxdb: database for InfluxQL queries
+	Org           string         `gorm:"size:128" json:"org,omitempty"`      // influxdb: organization for Flux queries (2.x)
+	Enabled       bool           `gorm:"default:true" json:"enabled"`
+	IngestMapping string         `gorm:"type:text" json:"ingest_mapping,omitempty"` // JSONPath field mapping for /inbound/custom/:source_id, e.g. {"title":"$.alert.name"}
+	DefaultLabels string         `gorm:"type:text" json:"default_labels,omitempty"` // JSON object merged into every alert from this source, e.g. {"cluster":"prod"}; alert labels win
+	RelabelConfig string         `gorm:"type:text" json:"relabel_config,omitempty"` // JSON array of {source_label, target_label, regex, replacement, action}; applied after default labels
+	IngestSecret  string         `gorm:"size:128" json:"-"`                         // when set, inbound webhooks for this source must carry a valid X-KK-Signature
+	AllowedCIDRs  string         `gorm:"column:allowed_cidrs;size:1024" json:"allowed_cidrs,omitempty"` // comma-separated CIDRs/IPs allowed to post inbound webhooks for this source; empty = any
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // Channel for notifications (Telegram, Lark).
 type Channel struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
 	Name      string         `gorm:"size:128" json:"name"`
-	Type      string         `gorm:"size:32" json:"type"` // telegram, lark
+	Type      string         `gorm:"size:32" json:"type"` // telegram, lark, wechat, msteams, sms, voice
+	TeamID    *uint          `gorm:"index" json:"team_id,omitempty"`
 	Config    string         `gorm:"type:text" json:"-"`  // JSON, secrets stored encrypted
 	Enabled   bool           `gorm:"default:true" json:"enabled"`
+	RateLimit int            `gorm:"default:0" json:"rate_limit"` // max messages per minute; 0 = unlimited
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
@@ -60,22 +74,40 @@ type Rule struct {
 	ID              uint           `gorm:"primaryKey" json:"id"`
 	Name            string         `gorm:"size:128" json:"name"`
 	Description     string         `gorm:"type:text" json:"description"`        // Human-readable purpose/usage for this rule, available in templates as {{.RuleDescription}}
+	TeamID          *uint          `gorm:"index" json:"team_id,omitempty"`      // owning team; alerts the rule produces or matches inherit it
 	Enabled         bool           `gorm:"default:true" json:"enabled"`
 	Priority        int            `gorm:"default:0" json:"priority"`
 	DatasourceIDs    string         `gorm:"type:text" json:"datasource_ids"`    // JSON array of IDs, empty = all
-	QueryLanguage    string         `gorm:"size:32" json:"query_language"`      // promql, elasticsearch_sql, sql, or empty
-	QueryExpression  string         `gorm:"type:text" json:"query_expression"` // PromQL, ES SQL, or Doris SQL text
-	MatchLabels      string         `gorm:"type:text" json:"match_labels"`     // JSON object
+	QueryLanguage    string         `gorm:"size:32" json:"query_language"`      // promql, logql, influxql, flux, elasticsearch_sql, sql, or empty
+	QueryExpression  string         `gorm:"type:text" json:"query_expression"` // PromQL, LogQL, InfluxQL, Flux, ES SQL, or Doris SQL text
+	MatchLabels      string         `gorm:"type:text" json:"match_labels"`     // JSON object; values may be prefixed with =, !=, ~ (regex), !~
+	MatchLabelsAny   string         `gorm:"type:text" json:"match_labels_any"` // JSON object; at least one pair must match (combined with match_labels)
 	MatchSeverity    string         `gorm:"size:32" json:"match_severity"`
+	RelabelConfig    string         `gorm:"type:text" json:"relabel_config"`   // JSON array of relabel rules applied to alert labels before this rule matches
 	ChannelIDs      string         `gorm:"type:text" json:"channel_ids"`     // JSON array
+	Routes          string         `gorm:"type:text" json:"routes"`          // JSON array of {match_labels, channel_ids, severity_override}; first match wins, channel_ids is the default route
+	SeverityChannels string        `gorm:"type:text" json:"severity_channels"` // JSON object severity -> channel IDs, e.g. {"critical":[1]}; used when no route/threshold channels apply
+	FallbackChannelIDs string      `gorm:"type:text" json:"fallback_channel_ids"` // JSON array; tried once when every primary delivery of a notification failed
 	TemplateID      *uint          `json:"template_id"`
+	TitlePrefix     string         `gorm:"size:128" json:"title_prefix"`     // prepended to the notification title (to the body for template-only recovery), e.g. [PROD]
+	BodyFooter      string         `gorm:"type:text" json:"body_footer"`     // appended to the rendered body, e.g. a runbook link
+	RunbookURL      string         `gorm:"size:512" json:"runbook_url"`      // optional remediation link, available in templates as {{.RunbookURL}}
+	EnrichURL       string         `gorm:"size:512" json:"enrich_url"`       // optional lookup: alert labels are POSTed here before notifying and the JSON answer is available as {{.Enrich.xxx}}
+	ResolveInstance bool           `gorm:"default:false" json:"resolve_instance"` // add a hostname label for an IP instance (or ip for a hostname) via DNS before notifying
 	CheckInterval   string         `gorm:"size:16" json:"check_interval"`    // e.g. 1m
+	ReprocessInterval string       `gorm:"size:16" json:"reprocess_interval"` // how often an unchanged firing series is re-sent to the engine (for send_interval repeats); empty = STABLE_REPROCESS_INTERVAL, not shorter than check_interval
+	QueryTimeout    string         `gorm:"size:16" json:"query_timeout"`     // e.g. 5s, 60s; empty = 30s, max 2m
+	QueryOffset     string         `gorm:"size:16" json:"query_offset"`     // evaluate the query this far in the past (e.g. 1m) for metrics that lag ingestion; empty = now
+	MaxSeries       int            `gorm:"default:0" json:"max_series"`       // evaluation is skipped when the query returns more series; 0 = MAX_SERIES (default 1000)
 	Duration        string         `gorm:"size:16" json:"duration"`          // e.g. 5m, 0 = immediate
 	ExcludeWindows  string         `gorm:"type:text" json:"exclude_windows"`   // JSON array
 	RecoveryNotify  bool           `gorm:"default:false" json:"recovery_notify"`
+	EditOnRecovery  bool           `gorm:"default:false" json:"edit_on_recovery"` // Telegram/Slack (bot token): rewrite the firing message as recovered instead of sending a new one
+	FlapThreshold   int            `gorm:"default:0" json:"flap_threshold"`     // fire/resolve transitions per series within 10m that mark it flapping; 0 = off
 	SendInterval       string         `gorm:"size:16" json:"send_interval"`        // min interval per alert
+	DigestInterval     string         `gorm:"size:16" json:"digest_interval"`      // e.g. 15m: info/warning notifications are batched into one summary per interval; empty = off
 	AggregationEnabled bool           `gorm:"default:false" json:"aggregation_enabled"` // when true, merge same-type alerts per window; default off to avoid merging different alerts
-	AggregateBy        string         `gorm:"size:32" json:"aggregate_by"`         // hostname, instance, etc.
+	AggregateBy        string         `gorm:"size:128" json:"aggregate_by"`        // hostname, ip, port or a label that varies; or a comma-separated label list (e.g. service,env) to group by
 	AggregateWindow    string         `gorm:"size:16" json:"aggregate_window"`
 	Suppression     string         `gorm:"type:text" json:"suppression"`      // JSON
 	Thresholds      string         `gorm:"type:text" json:"thresholds"`       // JSON array of multi-level thresholds: [{operator,value,severity,channel_ids}]
@@ -83,6 +115,12 @@ type Rule struct {
 	JiraAfterN      int            `gorm:"default:3" json:"jira_after_n"`
 	JiraConfig      string         `gorm:"type:text" json:"jira_config,omitempty"` // Accepted on create/update; strip in List/Get for security
 	LastRunAt       *time.Time     `json:"last_run_at,omitempty"`                 // last scheduler execution time for this rule
+	SilencedUntil   *time.Time     `json:"silenced_until,omitempty"`              // notifications for every alert of this rule are muted until then; set via POST /rules/:id/silence
+	Paused          bool           `gorm:"default:false" json:"paused"`             // still evaluated (state and history kept) but never notified; set via POST /rules/:id/pause|resume
+	LastError       string         `gorm:"type:text" json:"last_error,omitempty"`  // error of the last failed evaluation; cleared by a successful one
+	LastErrorAt     *time.Time     `json:"last_error_at,omitempty"`
+	LastEvalDurationMs int64      `gorm:"default:0" json:"last_eval_duration_ms"` // query + processing time of the last successful evaluation
+	LastSeriesCount    int        `gorm:"default:0" json:"last_series_count"`     // series returned by the last successful evaluation
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
@@ -94,12 +132,16 @@ type Alert struct {
 	SourceID    uint      `gorm:"index" json:"source_id"`
 	SourceType  string    `gorm:"size:32;index" json:"source_type"`
 	ExternalID  string    `gorm:"size:128;index" json:"external_id,omitempty"`
+	RuleID      uint      `gorm:"index" json:"rule_id"` // rule that produced the alert (scheduler); 0 for inbound webhooks
+	TeamID      *uint     `gorm:"index" json:"team_id,omitempty"` // inherited from the producing (or first matching) rule
 	Title       string    `gorm:"size:256" json:"title"`
 	Severity    string    `gorm:"size:32;index" json:"severity"`
-	Status      string    `gorm:"size:32;index" json:"status"` // firing, resolved, suppressed
+	Status      string    `gorm:"size:32;index;index:idx_alerts_status_labels,priority:1" json:"status"` // firing, resolved, suppressed
+	Flapping    bool      `gorm:"default:false" json:"flapping"` // series is flapping; notifications are held until it stabilizes
+	AssignedTo  *uint     `gorm:"index" json:"assigned_to,omitempty"` // user handling the alert; nil = unassigned
 	FiringAt    time.Time  `gorm:"index" json:"firing_at"`
 	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
-	Labels      string     `gorm:"type:text" json:"labels"`      // JSON
+	Labels      string     `gorm:"type:text;index:idx_alerts_status_labels,priority:2" json:"labels"` // JSON; indexed with status for inhibition lookups
 	Annotations string     `gorm:"type:text" json:"annotations"` // JSON
 	Raw         string     `gorm:"type:text" json:"-"`           // optional full payload
 	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
@@ -122,18 +164,117 @@ type AlertSendRecord struct {
 	AlertID   string    `gorm:"index;size:64" json:"alert_id"`
 	ChannelID uint      `gorm:"index:idx_send_rate,priority:1" json:"channel_id"`
 	Success   bool      `gorm:"index:idx_send_rate,priority:2" json:"success"`
+	Skipped   bool      `gorm:"default:false" json:"skipped,omitempty"` // not sent: identical message went to the channel moments before
 	Error     string    `gorm:"size:512" json:"error,omitempty"`
-	CreatedAt time.Time `gorm:"index:idx_send_rate,priority:3" json:"created_at"`
+	Detail    string    `gorm:"size:512" json:"detail,omitempty"` // what the channel reported back, e.g. voice call SIDs
+	MessageID string    `gorm:"size:128" json:"message_id,omitempty"` // platform message ID (Telegram message_id, Slack channel/ts) when the channel reports one
+	CreatedAt time.Time `gorm:"index;index:idx_send_rate,priority:3" json:"created_at"` // created_at alone serves time-range searches across channels
+}
+
+// FailedNotification is a dead letter: a notification whose delivery still failed after the sender's
+// retries, kept with its full message so it can be retried once the channel works again. Status is pending
+// until a retry delivers it.
+type FailedNotification struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	AlertID    string     `gorm:"index;size:64" json:"alert_id,omitempty"` // empty for digests, which cover several alerts
+	ChannelID  uint       `gorm:"index" json:"channel_id"`
+	Kind       string     `gorm:"size:32" json:"kind"` // alert, recovery, aggregated, fallback, digest, or a notice kind
+	Title      string     `gorm:"type:text" json:"title"`
+	Body       string     `gorm:"type:text" json:"body"`
+	IsRecovery bool       `json:"is_recovery"`
+	Severity   string     `gorm:"size:32" json:"severity"`
+	Labels     string     `gorm:"type:text" json:"labels"` // JSON object
+	Error      string     `gorm:"size:512" json:"error"`   // last delivery error
+	Status     string     `gorm:"size:16;index;default:pending" json:"status"` // pending, delivered, superseded
+	Attempts   int        `gorm:"default:0" json:"attempts"`                   // retries through the API
+	RetriedAt  *time.Time `json:"retried_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
 }
 
 // AlertSilence records manual silence-until time for an alert; no notifications are sent until then.
+// UntilResolved silences (snooze) instead last until the alert resolves, whatever SilenceUntil says.
 type AlertSilence struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	AlertID      string    `gorm:"uniqueIndex:idx_silence_alert;size:64" json:"alert_id"`
-	SilenceUntil time.Time `gorm:"index" json:"silence_until"`
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	AlertID       string    `gorm:"uniqueIndex:idx_silence_alert;size:64" json:"alert_id"`
+	SilenceUntil  time.Time `gorm:"index" json:"silence_until"`
+	UntilResolved bool      `gorm:"default:false" json:"until_resolved"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// AggregationState persists when an aggregated notification (rule + alert type) was last sent, so a restart
+// inside the aggregate window does not send it again. Rows past ExpiresAt are deleted periodically.
+type AggregationState struct {
+	StateKey   string    `gorm:"primaryKey;size:160" json:"state_key"` // hex sha256 of ruleID_typeFingerprint
+	RuleID     uint      `gorm:"index" json:"rule_id"`
+	LastSentAt time.Time `json:"last_sent_at"`
+	ExpiresAt  time.Time `gorm:"index" json:"expires_at"`
+}
+
+// Team groups users with the rules, channels and datasources they own. Non-admin members only see their
+// team's rules and alerts.
+type Team struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;size:64" json:"name"`
+	Description string    `gorm:"size:512" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// InhibitRule suppresses notifications for target alerts while a matching source alert is firing, across
+// rules (e.g. a datacenter-down alert inhibits the host alerts in that datacenter). Matchers use the
+// Rule.MatchLabels syntax.
+type InhibitRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:128" json:"name"`
+	SourceMatch string    `gorm:"type:text" json:"source_match"` // JSON object; a firing alert matching it is a source
+	TargetMatch string    `gorm:"type:text" json:"target_match"` // JSON object; alerts matching it are inhibited
+	Equal       string    `gorm:"type:text" json:"equal"`        // JSON array of label names source and target must share, e.g. ["datacenter"]
+	Enabled     bool      `gorm:"default:true" json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RuleSeriesState persists the scheduler's per-series state (rule + series key) so miss counts,
+// alert IDs and last values survive restarts instead of being rebuilt from firing alerts only.
+type RuleSeriesState struct {
+	RuleID     uint      `gorm:"primaryKey;autoIncrement:false" json:"rule_id"`
+	ExternalID string    `gorm:"primaryKey;size:128" json:"external_id"`
+	AlertID    string    `gorm:"size:64" json:"alert_id"`
+	Metric     string    `gorm:"type:text" json:"metric"` // JSON labels of the series
+	Value      float64   `json:"value"`
+	Severity   string    `gorm:"size:32" json:"severity"`
+	MissCount  int       `json:"miss_count"`
+	LastSeenAt time.Time `json:"last_seen_at"` // last time the series was (re-)processed
+}
+
+// RuleRevision is a JSON snapshot of a rule taken on every create/update/revert, for change history and rollback.
+type RuleRevision struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	RuleID    uint      `gorm:"index" json:"rule_id"`
+	Action    string    `gorm:"size:16" json:"action"` // create, update, import, revert
+	Username  string    `gorm:"size:64" json:"username"`
+	Snapshot  string    `gorm:"type:text" json:"snapshot"` // JSON of models.Rule
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// ScheduledReport periodically exports alerts for a relative date range and delivers the file by email
+// and/or a summary to notification channels.
+type ScheduledReport struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	Name       string         `gorm:"size:128" json:"name"`
+	Enabled    bool           `gorm:"default:true" json:"enabled"`
+	Interval   string         `gorm:"size:16" json:"interval"`      // e.g. 24h, 7d
+	Format     string         `gorm:"size:16" json:"format"`        // json, csv, xlsx, pdf
+	Range      string         `gorm:"size:16" json:"range"`         // relative range, e.g. last_24h, last_7d, last_30d
+	Recipients string         `gorm:"type:text" json:"recipients"`  // JSON array of email addresses
+	ChannelIDs string         `gorm:"type:text" json:"channel_ids"` // JSON array; channels receive a text summary
+	LastRunAt  *time.Time     `json:"last_run_at,omitempty"`
+	LastError  string         `gorm:"size:512" json:"last_error,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
 // SystemConfig stores key-value system settings (e.g. retention_days).
 type SystemConfig struct {
 	Key   string `gorm:"primaryKey;size:64" json:"key"`
@@ -0,0 +1,266 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kk-alert/backend/internal/httpclient"
+)
+
+// InfluxClient runs InfluxQL (1.x /query, also served by 2.x for mapped buckets) or Flux (/api/v2/query)
+// queries and returns them as an instant vector: one sample per InfluxQL series or Flux table, holding the
+// value of its last row. The query itself chooses the time range, e.g. WHERE time > now() - 5m.
+type InfluxClient struct {
+	BaseURL    string
+	Timeout    time.Duration
+	HTTPClient *http.Client
+	Language   string // influxql (default) or flux
+	Database   string // InfluxQL database
+	Org        string // Flux organization; InfluxDB 1.8 ignores it
+	AuthType   string // basic (1.x, AuthValue "user:password") or token (2.x API token); empty = no auth
+	AuthValue  string
+}
+
+func NewInfluxClient(baseURL string) *InfluxClient {
+	return &InfluxClient{
+		BaseURL:    baseURL,
+		Timeout:    30 * time.Second,
+		HTTPClient: httpclient.New(30 * time.Second),
+	}
+}
+
+// ValidateInfluxAuth checks an InfluxDB datasource's auth_type and auth_value.
+func ValidateInfluxAuth(authType, authValue string) error {
+	switch authType {
+	case "", "token":
+		return nil
+	case "basic":
+		if !strings.Contains(authValue, ":") {
+			return errors.New("influxdb basic auth: auth_value must be user:password")
+		}
+		return nil
+	}
+	return fmt.Errorf("influxdb: unsupported auth_type %q (use basic or token)", authType)
+}
+
+// Query runs expr and converts the result. For InfluxQL the value is the first numeric column other than
+// time and the labels are the series tags plus "measurement"; for Flux it is _value (else the first
+// numeric column) and the labels are the table's string columns.
+func (c *InfluxClient) Query(ctx context.Context, expr string) (*QueryResult, error) {
+	if err := ValidateInfluxAuth(c.AuthType, c.AuthValue); err != nil {
+		return nil, err
+	}
+	flux := c.Language == "flux"
+	var req *http.Request
+	var err error
+	if flux {
+		u, _ := url.Parse(c.BaseURL + "/api/v2/query")
+		if c.Org != "" {
+			q := u.Query()
+			q.Set("org", c.Org)
+			u.RawQuery = q.Encode()
+		}
+		body, _ := json.Marshal(map[string]interface{}{
+			"query":   expr,
+			"type":    "flux",
+			"dialect": map[string]interface{}{"header": true, "annotations": []string{"datatype"}},
+		})
+		req, err = http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/csv")
+	} else {
+		u, _ := url.Parse(c.BaseURL + "/query")
+		q := u.Query()
+		q.Set("q", expr)
+		q.Set("db", c.Database)
+		q.Set("epoch", "s")
+		u.RawQuery = q.Encode()
+		req, err = http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch c.AuthType {
+	case "basic":
+		user, pass, _ := strings.Cut(c.AuthValue, ":")
+		req.SetBasicAuth(user, pass)
+	case "token":
+		req.Header.Set("Authorization", "Token "+c.AuthValue)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("influxdb query failed: %s", string(body))
+	}
+
+	var samples []Sample
+	if flux {
+		samples, err = parseFluxCSV(body)
+	} else {
+		samples, err = parseInfluxQL(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{Status: "success"}
+	result.Data.ResultType = "vector"
+	result.Data.Result = samples
+	return result, nil
+}
+
+func influxSample(labels map[string]string, ts time.Time, value float64) Sample {
+	return Sample{Metric: labels, Value: []interface{}{float64(ts.Unix()), strconv.FormatFloat(value, 'f', -1, 64)}}
+}
+
+func parseInfluxQL(body []byte) ([]Sample, error) {
+	var out struct {
+		Results []struct {
+			Series []struct {
+				Name    string            `json:"name"`
+				Tags    map[string]string `json:"tags"`
+				Columns []string          `json:"columns"`
+				Values  [][]interface{}   `json:"values"`
+			} `json:"series"`
+			Error string `json:"error"`
+		} `json:"results"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, err
+	}
+	if out.Error != "" {
+		return nil, fmt.Errorf("influxdb error: %s", out.Error)
+	}
+	var samples []Sample
+	for _, r := range out.Results {
+		if r.Error != "" {
+			return nil, fmt.Errorf("influxdb error: %s", r.Error)
+		}
+		for _, s := range r.Series {
+			if len(s.Values) == 0 {
+				continue
+			}
+			row := s.Values[len(s.Values)-1]
+			ts := time.Now()
+			valueCol := -1
+			for i, col := range s.Columns {
+				if i >= len(row) {
+					break
+				}
+				n, isNum := row[i].(float64)
+				switch {
+				case col == "time" && isNum:
+					ts = time.Unix(int64(n), 0)
+				case col != "time" && isNum && valueCol < 0:
+					valueCol = i
+				}
+			}
+			if valueCol < 0 {
+				continue
+			}
+			labels := make(map[string]string, len(s.Tags)+1)
+			for k, v := range s.Tags {
+				labels[k] = v
+			}
+			if s.Name != "" {
+				labels["measurement"] = s.Name
+			}
+			samples = append(samples, influxSample(labels, ts, row[valueCol].(float64)))
+		}
+	}
+	return samples, nil
+}
+
+// parseFluxCSV reads annotated CSV (with the datatype annotation) as returned by /api/v2/query.
+func parseFluxCSV(body []byte) ([]Sample, error) {
+	r := csv.NewReader(bytes.NewReader(body))
+	r.FieldsPerRecord = -1
+	var types, header []string
+	expectHeader := false
+	byTable := make(map[string]Sample)
+	var order []string
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("influxdb: invalid flux response: %v", err)
+		}
+		if rec[0] == "#datatype" {
+			types, expectHeader = rec, true
+			continue
+		}
+		if strings.HasPrefix(rec[0], "#") {
+			continue
+		}
+		if expectHeader {
+			header, expectHeader = rec, false
+			continue
+		}
+		if header == nil {
+			continue
+		}
+		labels := make(map[string]string)
+		ts := time.Now()
+		var result, table string
+		var value *float64
+		for i, col := range header {
+			if i >= len(rec) || i >= len(types) {
+				break
+			}
+			v, typ := rec[i], types[i]
+			switch {
+			case col == "error" && v != "":
+				return nil, fmt.Errorf("influxdb error: %s", v)
+			case col == "result":
+				result = v
+			case col == "table":
+				table = v
+			case col == "":
+			case col == "_time":
+				if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+					ts = t
+				}
+			case typ == "double" || typ == "long" || typ == "unsignedLong":
+				if n, err := strconv.ParseFloat(v, 64); err == nil && (value == nil || col == "_value") {
+					value = &n
+				}
+			case typ == "string":
+				labels[col] = v
+			}
+		}
+		if value == nil {
+			continue
+		}
+		key := result + "/" + table
+		if _, seen := byTable[key]; !seen {
+			order = append(order, key)
+		}
+		byTable[key] = influxSample(labels, ts, *value)
+	}
+	samples := make([]Sample, 0, len(order))
+	for _, k := range order {
+		samples = append(samples, byTable[k])
+	}
+	return samples, nil
+}
@@ -0,0 +1,60 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInfluxQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/query":
+			if user, pass, _ := r.BasicAuth(); user != "reader" || pass != "secret" || r.URL.Query().Get("db") != "telegraf" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"results":[{"statement_id":0,"series":[` +
+				`{"name":"cpu","tags":{"host":"a"},"columns":["time","mean"],"values":[[1700000000,10],[1700000060,91.5]]},` +
+				`{"name":"cpu","tags":{"host":"b"},"columns":["time","mean"],"values":[[1700000060,null]]}]}]}`))
+		case "/api/v2/query":
+			if r.Header.Get("Authorization") != "Token tkn" || r.URL.Query().Get("org") != "ops" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("#datatype,string,long,dateTime:RFC3339,double,string,string\r\n" +
+				",result,table,_time,_value,_field,host\r\n" +
+				",_result,0,2024-05-01T10:00:00Z,1,usage,a\r\n" +
+				",_result,0,2024-05-01T10:01:00Z,2.5,usage,a\r\n" +
+				",_result,1,2024-05-01T10:01:00Z,7,usage,b\r\n\r\n"))
+		}
+	}))
+	defer srv.Close()
+
+	c := NewInfluxClient(srv.URL)
+	c.Database, c.AuthType, c.AuthValue = "telegraf", "basic", "reader:secret"
+	res, err := c.Query(context.Background(), `SELECT mean(usage_user) FROM cpu WHERE time > now() - 5m GROUP BY time(1m), host`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data.Result) != 1 || res.Data.Result[0].Metric["host"] != "a" || res.Data.Result[0].Metric["measurement"] != "cpu" ||
+		GetValue(res.Data.Result[0].Value) != 91.5 {
+		t.Errorf("influxql: %+v", res.Data.Result)
+	}
+
+	c = NewInfluxClient(srv.URL)
+	c.Language, c.Org, c.AuthType, c.AuthValue = "flux", "ops", "token", "tkn"
+	res, err = c.Query(context.Background(), `from(bucket:"metrics") |> range(start: -5m)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data.Result) != 2 || res.Data.Result[0].Metric["host"] != "a" || GetValue(res.Data.Result[0].Value) != 2.5 ||
+		res.Data.Result[1].Metric["_field"] != "usage" || GetValue(res.Data.Result[1].Value) != 7 {
+		t.Errorf("flux: %+v", res.Data.Result)
+	}
+
+	if err := ValidateInfluxAuth("basic", "no-colon"); err == nil {
+		t.Error("basic auth without password should be rejected")
+	}
+}
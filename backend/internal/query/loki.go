@@ -0,0 +1,72 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kk-alert/backend/internal/httpclient"
+)
+
+// LokiClient runs LogQL instant queries. Only metric queries (e.g. sum by (app) (rate({job="api"} |= "error" [5m])))
+// are accepted: they return a vector shaped like Prometheus's, so their series go through the same
+// threshold evaluation.
+type LokiClient struct {
+	BaseURL    string
+	Timeout    time.Duration
+	HTTPClient *http.Client
+	// Offset moves Query's evaluation time into the past, for logs that are ingested late.
+	Offset time.Duration
+}
+
+func NewLokiClient(baseURL string) *LokiClient {
+	return &LokiClient{
+		BaseURL:    baseURL,
+		Timeout:    30 * time.Second,
+		HTTPClient: httpclient.New(30 * time.Second),
+	}
+}
+
+// Query runs expr through /loki/api/v1/query. A log query (resultType streams) is an error.
+func (c *LokiClient) Query(ctx context.Context, expr string) (*QueryResult, error) {
+	u, _ := url.Parse(c.BaseURL + "/loki/api/v1/query")
+	q := u.Query()
+	q.Set("query", expr)
+	q.Set("time", strconv.FormatInt(time.Now().Add(-c.Offset).UnixNano(), 10))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("loki query failed: %s", string(body))
+	}
+
+	var result QueryResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	if result.Status != "success" {
+		return nil, fmt.Errorf("loki error: %s", result.Error)
+	}
+	if result.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("loki query returned %s, not a vector: use a LogQL metric query such as count_over_time or rate", result.Data.ResultType)
+	}
+
+	return &result, nil
+}
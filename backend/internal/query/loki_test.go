@@ -0,0 +1,38 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLokiQuery(t *testing.T) {
+	resultType := "vector"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/query" || r.URL.Query().Get("query") == "" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if resultType == "streams" {
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"api"},"values":[["1700000000000000000","boom"]]}]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"app":"api"},"value":[1700000000,"12.5"]}]}}`))
+	}))
+	defer srv.Close()
+
+	c := NewLokiClient(srv.URL)
+	res, err := c.Query(context.Background(), `sum by (app) (rate({job="api"} |= "error" [5m]))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data.Result) != 1 || res.Data.Result[0].Metric["app"] != "api" || GetValue(res.Data.Result[0].Value) != 12.5 {
+		t.Errorf("vector result: %+v", res.Data.Result)
+	}
+
+	resultType = "streams"
+	if _, err := c.Query(context.Background(), `{job="api"} |= "error"`); err == nil || !strings.Contains(err.Error(), "metric query") {
+		t.Errorf("log query should be rejected, got %v", err)
+	}
+}
@@ -8,40 +8,47 @@ import (
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/kk-alert/backend/internal/httpclient"
 )
 
 type PrometheusClient struct {
 	BaseURL    string
 	Timeout    time.Duration
 	HTTPClient *http.Client
+	// Offset moves Query's evaluation time into the past, for metrics whose latest samples arrive late.
+	Offset time.Duration
 }
 
 func NewPrometheusClient(baseURL string) *PrometheusClient {
 	return &PrometheusClient{
 		BaseURL:    baseURL,
 		Timeout:    30 * time.Second,
-		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		HTTPClient: httpclient.New(30 * time.Second),
 	}
 }
 
 type QueryResult struct {
 	Status string `json:"status"`
 	Data   struct {
-		ResultType string `json:"resultType"`
-		Result     []struct {
-			Metric map[string]string `json:"metric"`
-			Value  []interface{}     `json:"value"`
-		} `json:"result"`
+		ResultType string   `json:"resultType"`
+		Result     []Sample `json:"result"`
 	} `json:"data"`
 	ErrorType string `json:"errorType,omitempty"`
 	Error     string `json:"error,omitempty"`
 }
 
+// Sample is one series of an instant vector; Value is [unix seconds, "value"].
+type Sample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
 func (c *PrometheusClient) Query(ctx context.Context, expr string) (*QueryResult, error) {
 	u, _ := url.Parse(c.BaseURL + "/api/v1/query")
 	q := u.Query()
 	q.Set("query", expr)
-	q.Set("time", fmt.Sprintf("%d", time.Now().Unix()))
+	q.Set("time", fmt.Sprintf("%d", time.Now().Add(-c.Offset).Unix()))
 	u.RawQuery = q.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
@@ -105,6 +112,50 @@ func (c *PrometheusClient) QueryRange(ctx context.Context, expr string, start, e
 	return &result, nil
 }
 
+// InvalidQueryError is returned by Validate when Prometheus rejects the expression (errorType bad_data).
+type InvalidQueryError struct {
+	Message string
+}
+
+func (e *InvalidQueryError) Error() string { return e.Message }
+
+// Validate runs expr as an instant query with a 1s lookback so the datasource parses it cheaply.
+// A parse/semantic error is returned as *InvalidQueryError; any other error means the datasource could not be asked.
+func (c *PrometheusClient) Validate(ctx context.Context, expr string) error {
+	u, _ := url.Parse(c.BaseURL + "/api/v1/query")
+	q := u.Query()
+	q.Set("query", expr)
+	q.Set("time", fmt.Sprintf("%d", time.Now().Unix()))
+	q.Set("lookback_delta", "1s")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var result QueryResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("prometheus query failed: %s", string(body))
+		}
+		return err
+	}
+	if result.Status == "success" {
+		return nil
+	}
+	if result.ErrorType == "bad_data" {
+		return &InvalidQueryError{Message: result.Error}
+	}
+	return fmt.Errorf("prometheus error: %s", result.Error)
+}
+
 func GetValue(val []interface{}) float64 {
 	if len(val) < 2 {
 		return 0
@@ -0,0 +1,122 @@
+// Package relabel rewrites alert labels with Prometheus-style relabeling rules before alerts are matched
+// and stored.
+package relabel
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// Actions supported by Config.Action.
+const (
+	ActionReplace  = "replace"  // set target_label to replacement when source_label's value matches regex
+	ActionDrop     = "drop"     // drop the alert when source_label's value matches regex
+	ActionLabelMap = "labelmap" // copy every label whose name matches regex to the name given by replacement
+)
+
+// Config is one relabeling rule. Regex is anchored on both ends, as in Prometheus; it defaults to (.*)
+// and Replacement to $1. Action defaults to replace.
+type Config struct {
+	SourceLabel string `json:"source_label,omitempty"`
+	TargetLabel string `json:"target_label,omitempty"`
+	Regex       string `json:"regex,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	Action      string `json:"action,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Parse decodes and validates a JSON array of relabel configs. Empty input yields nil.
+func Parse(raw string) ([]Config, error) {
+	if raw == "" || raw == "[]" || raw == "null" {
+		return nil, nil
+	}
+	var cfgs []Config
+	if err := json.Unmarshal([]byte(raw), &cfgs); err != nil {
+		return nil, fmt.Errorf("invalid relabel config: %w", err)
+	}
+	for i := range cfgs {
+		c := &cfgs[i]
+		if c.Action == "" {
+			c.Action = ActionReplace
+		}
+		if c.Regex == "" {
+			c.Regex = "(.*)"
+		}
+		if c.Replacement == "" && c.Action != ActionDrop {
+			c.Replacement = "$1"
+		}
+		re, err := regexp.Compile("^(?:" + c.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid relabel config %d: regex: %w", i, err)
+		}
+		c.re = re
+		switch c.Action {
+		case ActionReplace:
+			if c.SourceLabel == "" || c.TargetLabel == "" {
+				return nil, fmt.Errorf("invalid relabel config %d: replace needs source_label and target_label", i)
+			}
+		case ActionDrop:
+			if c.SourceLabel == "" {
+				return nil, fmt.Errorf("invalid relabel config %d: drop needs source_label", i)
+			}
+		case ActionLabelMap:
+		default:
+			return nil, fmt.Errorf("invalid relabel config %d: unknown action %q (use replace, drop or labelmap)", i, c.Action)
+		}
+	}
+	return cfgs, nil
+}
+
+// Apply runs cfgs in order over a copy of labels. keep is false when a drop rule matched; the alert should
+// then be discarded. A missing source label has the empty value. A replace whose result is empty removes
+// the target label.
+func Apply(cfgs []Config, labels map[string]string) (out map[string]string, keep bool) {
+	out = make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	for _, c := range cfgs {
+		switch c.Action {
+		case ActionReplace:
+			val := out[c.SourceLabel]
+			m := c.re.FindStringSubmatchIndex(val)
+			if m == nil {
+				continue
+			}
+			res := string(c.re.ExpandString(nil, c.Replacement, val, m))
+			if res == "" {
+				delete(out, c.TargetLabel)
+			} else {
+				out[c.TargetLabel] = res
+			}
+		case ActionDrop:
+			if c.re.MatchString(out[c.SourceLabel]) {
+				return out, false
+			}
+		case ActionLabelMap:
+			mapped := make(map[string]string)
+			for k, v := range out {
+				if m := c.re.FindStringSubmatchIndex(k); m != nil {
+					if name := string(c.re.ExpandString(nil, c.Replacement, k, m)); name != "" {
+						mapped[name] = v
+					}
+				}
+			}
+			for k, v := range mapped {
+				out[k] = v
+			}
+		}
+	}
+	return out, true
+}
+
+// ParseAndApply is Parse followed by Apply; an invalid config leaves labels unchanged.
+func ParseAndApply(raw string, labels map[string]string) (map[string]string, bool) {
+	cfgs, err := Parse(raw)
+	if err != nil || len(cfgs) == 0 {
+		return labels, true
+	}
+	return Apply(cfgs, labels)
+}
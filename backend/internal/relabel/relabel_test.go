@@ -0,0 +1,60 @@
+package relabel
+
+import "testing"
+
+func TestApplyReplace(t *testing.T) {
+	cfgs, err := Parse(`[{"source_label":"instance","target_label":"hostname","regex":"([^:]+):\\d+"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, keep := Apply(cfgs, map[string]string{"instance": "web-1:9100"})
+	if !keep || out["hostname"] != "web-1" || out["instance"] != "web-1:9100" {
+		t.Errorf("got %v, keep=%v", out, keep)
+	}
+	// No match leaves labels alone.
+	out, _ = Apply(cfgs, map[string]string{"instance": "web-1"})
+	if _, ok := out["hostname"]; ok {
+		t.Errorf("unexpected hostname: %v", out)
+	}
+}
+
+func TestApplyDrop(t *testing.T) {
+	cfgs, err := Parse(`[{"source_label":"env","regex":"dev|test","action":"drop"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, keep := Apply(cfgs, map[string]string{"env": "dev"}); keep {
+		t.Error("env=dev should be dropped")
+	}
+	if _, keep := Apply(cfgs, map[string]string{"env": "devops"}); !keep {
+		t.Error("regex is anchored: env=devops should be kept")
+	}
+}
+
+func TestApplyLabelMap(t *testing.T) {
+	cfgs, err := Parse(`[{"regex":"__meta_(.+)","action":"labelmap"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := Apply(cfgs, map[string]string{"__meta_zone": "a", "job": "node"})
+	if out["zone"] != "a" || out["job"] != "node" || out["__meta_zone"] != "a" {
+		t.Errorf("got %v", out)
+	}
+}
+
+func TestParseValidation(t *testing.T) {
+	for _, raw := range []string{
+		`{}`,
+		`[{"source_label":"a","target_label":"b","regex":"("}]`,
+		`[{"source_label":"a"}]`,
+		`[{"action":"drop"}]`,
+		`[{"source_label":"a","target_label":"b","action":"keep"}]`,
+	} {
+		if _, err := Parse(raw); err == nil {
+			t.Errorf("Parse(%s): expected error", raw)
+		}
+	}
+	if cfgs, err := Parse(""); err != nil || cfgs != nil {
+		t.Errorf("empty: got %v, %v", cfgs, err)
+	}
+}
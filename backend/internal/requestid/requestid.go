@@ -0,0 +1,40 @@
+// Package requestid assigns each HTTP request a correlation ID so an alert can be traced from ingestion
+// through asynchronous notification delivery in the logs.
+package requestid
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Header is read from incoming requests and echoed on responses.
+const Header = "X-Request-ID"
+
+const contextKey = "request_id"
+
+// Middleware uses the caller's X-Request-ID when present (truncated to 64 chars) or generates one, stores it
+// in the gin context and sets it on the response.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if len(id) > 64 {
+			id = id[:64]
+		}
+		if id == "" {
+			id = New()
+		}
+		c.Set(contextKey, id)
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// Get returns the request ID set by Middleware, or "" when the middleware did not run.
+func Get(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
+
+// New generates a short random ID (also used for scheduler evaluation IDs).
+func New() string {
+	return uuid.New().String()[:8]
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/kk-alert/backend/internal/engine"
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// defaultMaxSeries is the most series a rule's query may return before the evaluation is skipped, so a
+// typo such as a missing label filter does not create thousands of alerts. Configure with MAX_SERIES
+// (default 1000; 0 disables); a rule's max_series overrides it.
+var defaultMaxSeries = func() int {
+	v := os.Getenv("MAX_SERIES")
+	if v == "" {
+		return 1000
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("[scheduler] invalid MAX_SERIES %q, using 1000", v)
+		return 1000
+	}
+	return n
+}()
+
+// maxSeries returns the series limit for rule (0 = unlimited).
+func maxSeries(rule *models.Rule) int {
+	if rule.MaxSeries > 0 {
+		return rule.MaxSeries
+	}
+	return defaultMaxSeries
+}
+
+// overLimit holds the rules whose last query exceeded their series limit, so the notice goes out once per
+// episode rather than on every evaluation.
+var (
+	overLimitMu sync.Mutex
+	overLimit   = make(map[uint]bool)
+)
+
+// cardinalityExceeded reports whether a query that returned n series must be skipped. When it is, the rule's
+// evaluation error is recorded and, on the first evaluation over the limit, a notice goes to the rule's
+// channels. Alerts already firing are left as they are.
+func cardinalityExceeded(db *gorm.DB, rule *models.Rule, n int, evalID string) bool {
+	limit := maxSeries(rule)
+	overLimitMu.Lock()
+	defer overLimitMu.Unlock()
+	if limit == 0 || n <= limit {
+		delete(overLimit, rule.ID)
+		return false
+	}
+	msg := fmt.Sprintf("query cardinality too high: %d series (limit %d), evaluation skipped", n, limit)
+	log.Printf("[scheduler] [eval=%s] rule %d (%s) %s", evalID, rule.ID, rule.Name, msg)
+	recordEvalError(db, rule.ID, msg)
+	if !overLimit[rule.ID] {
+		overLimit[rule.ID] = true
+		title := "Query cardinality too high: " + rule.Name
+		body := fmt.Sprintf("规则 %s 的查询返回 %d 条序列，超过上限 %d，本次及后续评估将跳过，直到序列数回到上限以内。请检查查询表达式或调整 max_series。", rule.Name, n, limit)
+		engine.SendRuleNotice(db, rule, fmt.Sprintf("rule-%d-cardinality", rule.ID), "cardinality", title, body, "warning", evalID)
+	}
+	return true
+}
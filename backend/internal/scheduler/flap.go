@@ -0,0 +1,83 @@
+package scheduler
+
+import "time"
+
+// flapWindow is how far back fire/resolve transitions are counted for flap detection.
+const flapWindow = 10 * time.Minute
+
+// flapTracker counts fire/resolve transitions per series key. It outlives a series' queryResult, which is
+// dropped on resolve, so a series that keeps coming back is still recognised.
+type flapTracker struct {
+	transitions map[string][]time.Time
+	flapping    map[string]bool
+	held        map[string]string // series key -> resolved alert whose recovery was held while flapping
+}
+
+// hold records that the recovery of alertID was held back because its series is flapping.
+func (f *flapTracker) hold(key, alertID string) {
+	if f.held == nil {
+		f.held = make(map[string]string)
+	}
+	f.held[key] = alertID
+}
+
+// release forgets the held recovery of a series, e.g. because it fires again, and returns its alert ID.
+func (f *flapTracker) release(key string) string {
+	id := f.held[key]
+	delete(f.held, key)
+	return id
+}
+
+// update prunes transitions older than flapWindow, records one at now when transition is set, and reports
+// whether the series is flapping (at least threshold transitions in the window) and whether that changed.
+// threshold <= 0 disables detection.
+func (f *flapTracker) update(key string, threshold int, transition bool, now time.Time) (flapping, changed bool) {
+	if f.transitions == nil {
+		f.transitions = make(map[string][]time.Time)
+		f.flapping = make(map[string]bool)
+	}
+	was := f.flapping[key]
+	if threshold <= 0 {
+		delete(f.transitions, key)
+		delete(f.flapping, key)
+		return false, was
+	}
+	ts := f.transitions[key]
+	i := 0
+	for i < len(ts) && now.Sub(ts[i]) > flapWindow {
+		i++
+	}
+	ts = ts[i:]
+	if transition {
+		ts = append(ts, now)
+	}
+	if len(ts) == 0 {
+		delete(f.transitions, key)
+	} else {
+		f.transitions[key] = ts
+	}
+	flapping = len(ts) >= threshold
+	if flapping {
+		f.flapping[key] = true
+	} else {
+		delete(f.flapping, key)
+	}
+	return flapping, flapping != was
+}
+
+// prune drops tracking for keys not in keep whose transitions have all aged out. It returns the alerts whose
+// recovery was held and is now due because their resolved series stopped flapping.
+func (f *flapTracker) prune(keep map[string]bool, threshold int, now time.Time) (recovered []string) {
+	for key := range f.transitions {
+		if !keep[key] {
+			f.update(key, threshold, false, now)
+		}
+	}
+	for key, id := range f.held {
+		if !keep[key] && !f.flapping[key] {
+			recovered = append(recovered, id)
+			delete(f.held, key)
+		}
+	}
+	return recovered
+}
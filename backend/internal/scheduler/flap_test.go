@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFlapTrackerEntersFlapping(t *testing.T) {
+	var f flapTracker
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		flapping, changed := f.update("s", 4, true, now.Add(time.Duration(i)*time.Minute))
+		if flapping || changed {
+			t.Fatalf("transition %d: flapping=%v changed=%v before the threshold", i+1, flapping, changed)
+		}
+	}
+	flapping, changed := f.update("s", 4, true, now.Add(3*time.Minute))
+	if !flapping || !changed {
+		t.Fatalf("4th transition: flapping=%v changed=%v, want both", flapping, changed)
+	}
+	// Further transitions keep it flapping without another change, so only one notice goes out.
+	if flapping, changed := f.update("s", 4, true, now.Add(4*time.Minute)); !flapping || changed {
+		t.Errorf("5th transition: flapping=%v changed=%v, want flapping without change", flapping, changed)
+	}
+	if flapping, _ := f.update("other", 4, true, now); flapping {
+		t.Error("series are tracked independently")
+	}
+}
+
+func TestFlapTrackerHoldsRecoveryUntilStable(t *testing.T) {
+	var f flapTracker
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		f.update("s", 4, true, now)
+	}
+	f.hold("s", "alert-1")
+
+	// Still flapping: the recovery stays held.
+	if got := f.prune(map[string]bool{}, 4, now.Add(time.Minute)); len(got) != 0 {
+		t.Fatalf("recovery released while flapping: %v", got)
+	}
+	// Transitions age out: flapping clears and the held recovery is due exactly once.
+	later := now.Add(flapWindow + time.Minute)
+	if got := f.prune(map[string]bool{}, 4, later); len(got) != 1 || got[0] != "alert-1" {
+		t.Fatalf("after flapping cleared: got %v, want [alert-1]", got)
+	}
+	if got := f.prune(map[string]bool{}, 4, later); len(got) != 0 {
+		t.Errorf("held recovery sent twice: %v", got)
+	}
+}
+
+func TestFlapTrackerRefireSupersedesHeldRecovery(t *testing.T) {
+	var f flapTracker
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		f.update("s", 4, true, now)
+	}
+	f.hold("s", "alert-1")
+	if id := f.release("s"); id != "alert-1" {
+		t.Fatalf("release: got %q", id)
+	}
+	if got := f.prune(map[string]bool{"s": true}, 4, now.Add(flapWindow+time.Minute)); len(got) != 0 {
+		t.Errorf("released recovery should not be sent: %v", got)
+	}
+}
+
+func TestNewQueryStateRestoresHeldRecoveries(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Alert{}, &models.RuleSeriesState{}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+	db.Create(&models.Alert{ID: "old", RuleID: 7, ExternalID: "s", Status: "resolved", Flapping: true, ResolvedAt: &earlier})
+	db.Create(&models.Alert{ID: "new", RuleID: 7, ExternalID: "s", Status: "resolved", Flapping: true, ResolvedAt: &now})
+	db.Create(&models.Alert{ID: "quiet", RuleID: 7, ExternalID: "q", Status: "resolved", ResolvedAt: &now})
+
+	state := newQueryState(db, 7)
+	// Transition history is not persisted, so the held recovery is due at the first evaluation.
+	if got := state.flaps.prune(map[string]bool{}, 4, now); len(got) != 1 || got[0] != "new" {
+		t.Errorf("restored held recoveries: got %v, want [new]", got)
+	}
+}
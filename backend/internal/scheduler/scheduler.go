@@ -5,16 +5,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"math"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/kk-alert/backend/internal/dedup"
 	"github.com/kk-alert/backend/internal/engine"
+	"github.com/kk-alert/backend/internal/labels"
 	"github.com/kk-alert/backend/internal/models"
 	"github.com/kk-alert/backend/internal/query"
+	"github.com/kk-alert/backend/internal/relabel"
+	"github.com/kk-alert/backend/internal/requestid"
+	"golang.org/x/sync/semaphore"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Scheduler struct {
@@ -34,6 +45,10 @@ type queryState struct {
 	mu            sync.RWMutex
 	lastResults   map[string]queryResult
 	lastCheckTime time.Time
+	flaps         flapTracker
+	breaches      map[string]int         // consecutive evaluations each series has been returned and matched a threshold level
+	saved         map[string]queryResult // lastResults as last persisted to rule_series_states
+	deleted       bool                   // the rule was deleted; its state is no longer persisted
 }
 
 type queryResult struct {
@@ -49,6 +64,35 @@ type queryResult struct {
 // Prevents flapping when Prometheus temporarily drops a series (scrape gap, network hiccup).
 const resolveGracePeriod = 3
 
+// stableReprocessInterval is how often an unchanged firing series is passed to the engine again so its
+// send_interval can produce a repeat notification. Configure with STABLE_REPROCESS_INTERVAL (Go duration,
+// default 1m); a rule's reprocess_interval overrides it.
+var stableReprocessInterval = func() time.Duration {
+	v := os.Getenv("STABLE_REPROCESS_INTERVAL")
+	if v == "" {
+		return time.Minute
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("[scheduler] invalid STABLE_REPROCESS_INTERVAL %q, using 1m", v)
+		return time.Minute
+	}
+	return d
+}()
+
+// reprocessSlack lets a series due for reprocessing within this much of the next evaluation be reprocessed
+// now, so a reprocess interval equal to the check interval applies on every evaluation rather than every
+// other one.
+const reprocessSlack = 5 * time.Second
+
+// reprocessInterval returns the rule's reprocess_interval, or STABLE_REPROCESS_INTERVAL when it has none.
+func reprocessInterval(rule *models.Rule) time.Duration {
+	if d, err := time.ParseDuration(rule.ReprocessInterval); err == nil && d > 0 {
+		return d
+	}
+	return stableReprocessInterval
+}
+
 // roundValue rounds a float64 to 2 decimal places to avoid re-processing on tiny fluctuations.
 func roundValue(v float64) float64 {
 	return math.Round(v*100) / 100
@@ -59,6 +103,18 @@ var (
 	stateMu    sync.RWMutex
 )
 
+// lastEvalOK is the unix-nano time of the last rule evaluation whose query succeeded (0 = none yet).
+var lastEvalOK atomic.Int64
+
+// LastSuccessfulEvaluation returns when a rule query last succeeded (zero time if none since start).
+func LastSuccessfulEvaluation() time.Time {
+	n := lastEvalOK.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
 func NewScheduler(db *gorm.DB) *Scheduler {
 	return &Scheduler{
 		db:       db,
@@ -69,6 +125,7 @@ func NewScheduler(db *gorm.DB) *Scheduler {
 
 func (s *Scheduler) Start() {
 	log.Println("[scheduler] starting rule scheduler")
+	s.restoreStates()
 	s.loadRules()
 
 	// Reload rules every 5 minutes to pick up changes
@@ -99,6 +156,13 @@ func (s *Scheduler) Stop() {
 	s.tasks = make(map[uint]*RuleTask)
 }
 
+// TaskCount returns the number of rules currently scheduled.
+func (s *Scheduler) TaskCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tasks)
+}
+
 // SeverityCounts holds alert counts broken down by severity level.
 type SeverityCounts struct {
 	Total    int `json:"total"`
@@ -133,6 +197,7 @@ func FiringCountByRule() map[uint]*SeverityCounts {
 }
 
 // RunRuleNow runs the given rule once immediately (non-blocking). Used after create/update so new rules run without waiting for next interval.
+// Soft-deleted rules are not found (GORM excludes deleted_at rows) and are never run.
 func (s *Scheduler) RunRuleNow(ruleID uint) {
 	var rule models.Rule
 	if err := s.db.First(&rule, ruleID).Error; err != nil {
@@ -195,8 +260,34 @@ func (s *Scheduler) loadRules() {
 	}
 }
 
+// jitterEnabled staggers each rule's first evaluation by a random fraction of its interval so a restart
+// does not query every rule at once. Disable with SCHEDULER_JITTER=false.
+var jitterEnabled = os.Getenv("SCHEDULER_JITTER") != "false"
+
+// startJitter returns the delay before a rule's first evaluation (0 when jitter is disabled).
+func startJitter(interval time.Duration) time.Duration {
+	if !jitterEnabled || interval <= 0 {
+		return 0
+	}
+	return rand.N(interval)
+}
+
 // runTask runs one rule in its own goroutine; each rule has independent schedule and fixed interval (no drift).
+// The first run is delayed by startJitter, which also offsets all later ticks so rules stay spread out.
 func (s *Scheduler) runTask(task *RuleTask, rule models.Rule, interval time.Duration) {
+	if d := startJitter(interval); d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-task.stopChan:
+			t.Stop()
+			return
+		}
+		// Pick up edits made while waiting
+		if err := s.db.First(&rule, task.ruleID).Error; err != nil || !rule.Enabled || rule.QueryExpression == "" {
+			return
+		}
+	}
 	s.evaluateRule(&rule)
 	s.updateLastRunAt(task.ruleID)
 	nextRun := time.Now().Add(interval)
@@ -237,8 +328,69 @@ func (s *Scheduler) updateLastRunAt(ruleID uint) {
 	_ = s.db.Model(&models.Rule{}).Where("id = ?", ruleID).Update("last_run_at", now).Error
 }
 
+// recordEvalStats stores how long the last evaluation took and how many series it returned (one UPDATE).
+func recordEvalStats(db *gorm.DB, ruleID uint, took time.Duration, series int) {
+	_ = db.Model(&models.Rule{}).Where("id = ?", ruleID).
+		UpdateColumns(map[string]interface{}{"last_eval_duration_ms": took.Milliseconds(), "last_series_count": series}).Error
+}
+
+// recordEvalError stores why an evaluation of the rule failed, so the API can flag broken rules.
+func recordEvalError(db *gorm.DB, ruleID uint, msg string) {
+	_ = db.Model(&models.Rule{}).Where("id = ?", ruleID).
+		UpdateColumns(map[string]interface{}{"last_error": msg, "last_error_at": time.Now()}).Error
+}
+
+// clearEvalError drops a previously recorded evaluation error after a successful evaluation. Rules without
+// an error are not written.
+func clearEvalError(db *gorm.DB, ruleID uint) {
+	_ = db.Model(&models.Rule{}).Where("id = ? AND last_error <> ?", ruleID, "").
+		UpdateColumns(map[string]interface{}{"last_error": "", "last_error_at": nil}).Error
+}
+
+const (
+	// DefaultQueryTimeout applies when a rule has no query_timeout.
+	DefaultQueryTimeout = 30 * time.Second
+	// MaxQueryTimeout caps query_timeout so one slow query cannot hold a worker indefinitely.
+	MaxQueryTimeout = 2 * time.Minute
+	minQueryTimeout = time.Second
+)
+
+// QueryOffset returns how far in the past the rule's query is evaluated (0 when query_offset is unset).
+func QueryOffset(rule *models.Rule) time.Duration {
+	if d, err := time.ParseDuration(rule.QueryOffset); err == nil && d > 0 {
+		return d
+	}
+	return 0
+}
+
+// queryTimeout returns the rule's query timeout clamped to [1s, MaxQueryTimeout].
+func queryTimeout(rule *models.Rule) time.Duration {
+	d, err := time.ParseDuration(rule.QueryTimeout)
+	if err != nil || d <= 0 {
+		return DefaultQueryTimeout
+	}
+	if d < minQueryTimeout {
+		return minQueryTimeout
+	}
+	if d > MaxQueryTimeout {
+		return MaxQueryTimeout
+	}
+	return d
+}
+
+// querySem bounds concurrent datasource queries across all rules so rules sharing a check interval do not
+// hit the same Prometheus at once. Configure with MAX_CONCURRENT_QUERIES (default 16).
+var querySem = semaphore.NewWeighted(int64(maxConcurrentQueries()))
+
+func maxConcurrentQueries() int {
+	if n, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_QUERIES")); err == nil && n > 0 {
+		return n
+	}
+	return 16
+}
+
 func (s *Scheduler) evaluateRule(rule *models.Rule) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout(rule))
 	defer cancel()
 
 	// Create a fresh DB session for this goroutine to avoid shared-session
@@ -256,69 +408,184 @@ func (s *Scheduler) evaluateRule(rule *models.Rule) {
 
 	if datasourceID == 0 {
 		log.Printf("[scheduler] rule %d has no datasource", rule.ID)
+		recordEvalError(db, rule.ID, "rule has no datasource")
 		return
 	}
 
 	var ds models.Datasource
 	if err := db.First(&ds, datasourceID).Error; err != nil {
 		log.Printf("[scheduler] rule %d datasource %d not found", rule.ID, datasourceID)
+		recordEvalError(db, rule.ID, fmt.Sprintf("datasource %d not found", datasourceID))
 		return
 	}
 
 	if !ds.Enabled {
 		log.Printf("[scheduler] rule %d datasource %d disabled", rule.ID, datasourceID)
+		recordEvalError(db, rule.ID, fmt.Sprintf("datasource %d is disabled", datasourceID))
 		return
 	}
 
 	// Query based on datasource type
-	switch ds.Type {
-	case "prometheus", "victoriametrics":
-		s.queryPrometheus(ctx, rule, &ds, db)
-	default:
+	ev, ok := evaluators[ds.Type]
+	if !ok || ev.query == nil {
 		log.Printf("[scheduler] rule %d unsupported datasource type: %s", rule.ID, ds.Type)
+		recordEvalError(db, rule.ID, "unsupported datasource type: "+ds.Type)
+		return
+	}
+
+	// Waiting for a slot counts against the rule's query timeout; give up this round if none frees up.
+	if err := querySem.Acquire(ctx, 1); err != nil {
+		log.Printf("[scheduler] rule %d skipped: no query slot within timeout", rule.ID)
+		return
 	}
+	defer querySem.Release(1)
+
+	ev.query(s, ctx, rule, &ds, db, requestid.New())
+}
+
+// datasourceEvaluator describes how rules on one datasource type are evaluated. A nil query means the type
+// only delivers alerts through inbound webhooks, so its rules are not evaluated by the scheduler.
+type datasourceEvaluator struct {
+	queryLanguages []string
+	query          func(s *Scheduler, ctx context.Context, rule *models.Rule, ds *models.Datasource, db *gorm.DB, evalID string)
+}
+
+var evaluators = map[string]datasourceEvaluator{
+	"prometheus":      {queryLanguages: []string{"promql"}, query: (*Scheduler).queryPrometheus},
+	"victoriametrics": {queryLanguages: []string{"promql"}, query: (*Scheduler).queryPrometheus},
+	"elasticsearch":   {queryLanguages: []string{"elasticsearch_sql"}},
+	"doris":           {queryLanguages: []string{"sql"}},
+	"loki":            {queryLanguages: []string{"logql"}, query: (*Scheduler).queryLoki},
+	"influxdb":        {queryLanguages: []string{"influxql", "flux"}, query: (*Scheduler).queryInflux},
+}
+
+// ThresholdOperators are the operators MatchThreshold understands.
+var ThresholdOperators = []string{">", ">=", "<", "<=", "==", "!="}
+
+// DatasourceCapability reports the query languages a datasource type accepts and whether the scheduler
+// evaluates rules against it.
+type DatasourceCapability struct {
+	DatasourceType string   `json:"datasource_type"`
+	QueryLanguages []string `json:"query_languages"`
+	Scheduled      bool     `json:"scheduled"`
+}
+
+// SupportsLanguage reports whether rules on datasourceType may use queryLanguage.
+func SupportsLanguage(datasourceType, queryLanguage string) bool {
+	for _, l := range evaluators[datasourceType].queryLanguages {
+		if l == queryLanguage {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities lists every known datasource type, sorted by name.
+func Capabilities() []DatasourceCapability {
+	out := make([]DatasourceCapability, 0, len(evaluators))
+	for typ, ev := range evaluators {
+		out = append(out, DatasourceCapability{DatasourceType: typ, QueryLanguages: ev.queryLanguages, Scheduled: ev.query != nil})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DatasourceType < out[j].DatasourceType })
+	return out
 }
 
-func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *models.Datasource, db *gorm.DB) {
+// queryPrometheus evaluates a rule against a Prometheus-compatible datasource. evalID identifies this
+// evaluation run and is passed to the engine so notifications can be traced back to it.
+func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *models.Datasource, db *gorm.DB, evalID string) {
 	client := query.NewPrometheusClient(ds.Endpoint)
+	// The evaluation context carries the rule's query_timeout; don't let the client's default cut it short.
+	client.Timeout = queryTimeout(rule)
+	client.HTTPClient.Timeout = client.Timeout
+	client.Offset = QueryOffset(rule)
+	s.evaluateVector(ctx, rule, ds, db, evalID, client.Query)
+}
+
+// queryLoki evaluates a rule whose LogQL metric query runs on a Loki datasource.
+func (s *Scheduler) queryLoki(ctx context.Context, rule *models.Rule, ds *models.Datasource, db *gorm.DB, evalID string) {
+	client := query.NewLokiClient(ds.Endpoint)
+	client.Timeout = queryTimeout(rule)
+	client.HTTPClient.Timeout = client.Timeout
+	client.Offset = QueryOffset(rule)
+	s.evaluateVector(ctx, rule, ds, db, evalID, client.Query)
+}
 
-	result, err := client.Query(ctx, rule.QueryExpression)
+// queryInflux evaluates a rule whose InfluxQL or Flux query runs on an InfluxDB datasource.
+func (s *Scheduler) queryInflux(ctx context.Context, rule *models.Rule, ds *models.Datasource, db *gorm.DB, evalID string) {
+	client := query.NewInfluxClient(ds.Endpoint)
+	client.Timeout = queryTimeout(rule)
+	client.HTTPClient.Timeout = client.Timeout
+	client.Language = rule.QueryLanguage
+	client.Database, client.Org = ds.Database, ds.Org
+	client.AuthType, client.AuthValue = ds.AuthType, ds.AuthValue
+	s.evaluateVector(ctx, rule, ds, db, evalID, client.Query)
+}
+
+// evaluateVector runs the rule's instant query with run and turns the returned series into alerts: new
+// and changed series fire, absent ones resolve after the grace period.
+func (s *Scheduler) evaluateVector(ctx context.Context, rule *models.Rule, ds *models.Datasource, db *gorm.DB, evalID string,
+	run func(ctx context.Context, expr string) (*query.QueryResult, error)) {
+	start := time.Now()
+	result, err := run(ctx, rule.QueryExpression)
 	if err != nil {
-		log.Printf("[scheduler] rule %d (%s) query failed: %v", rule.ID, rule.Name, err)
+		log.Printf("[scheduler] [eval=%s] rule %d (%s) query failed: %v", evalID, rule.ID, rule.Name, err)
+		recordEvalError(db, rule.ID, "query failed: "+err.Error())
 		return
 	}
+	lastEvalOK.Store(time.Now().UnixNano())
+	defer func() { recordEvalStats(db, rule.ID, time.Since(start), len(result.Data.Result)) }()
+	if cardinalityExceeded(db, rule, len(result.Data.Result), evalID) {
+		return
+	}
+	clearEvalError(db, rule.ID)
 
-	// Get or create state for this rule
+	// Get or create state for this rule (restored from rule_series_states after a restart)
 	stateMu.Lock()
 	state, exists := stateCache[rule.ID]
 	if !exists {
-		state = &queryState{
-			lastResults: make(map[string]queryResult),
-		}
+		state = newQueryState(db, rule.ID)
 		stateCache[rule.ID] = state
 	}
 	stateMu.Unlock()
 
 	state.mu.Lock()
 	defer state.mu.Unlock()
+	defer saveSeriesState(db, rule.ID, state)
 
 	// Uniqueness key: datasource + title + all labels (same => same alert, reuse ID until resolved).
 	// When labels lack instance/job, KeyForSeries uses result index so each series gets its own alert.
 	currentKeys := make(map[string]bool)
 	numResults := len(result.Data.Result)
 	if numResults > 0 {
-		log.Printf("[scheduler] rule %d (%s) query returned %d series", rule.ID, rule.Name, numResults)
+		log.Printf("[scheduler] [eval=%s] rule %d (%s) query returned %d series", evalID, rule.ID, rule.Name, numResults)
 	}
 	// 0 series is normal when no condition is met (e.g. no disk > threshold); no log to avoid noise
 
 	thresholds := ParseThresholds(rule.Thresholds)
+	if state.breaches == nil {
+		state.breaches = make(map[string]int)
+	}
+	breaching := make(map[string]bool)
+	defaultLabels, _ := labels.ParseDefaults(ds.DefaultLabels)
+	dsRelabel, _ := relabel.Parse(ds.RelabelConfig)
+	ruleRelabel, _ := relabel.Parse(rule.RelabelConfig)
 
 	for i, r := range result.Data.Result {
 		metric := r.Metric
 		if metric == nil {
 			metric = make(map[string]string)
 		}
-		labels, _ := json.Marshal(metric)
+		// Datasource default labels and relabeling apply to the labels stored with the alert; metric, which
+		// keys the series, stays as queried. A drop rule skips the series (its alert resolves as absent).
+		// The rule's own relabeling happens only here; the engine does not repeat it for this rule's alerts.
+		stored, keep := relabel.Apply(dsRelabel, withDefaults(metric, defaultLabels))
+		if keep {
+			stored, keep = relabel.Apply(ruleRelabel, stored)
+		}
+		if !keep {
+			continue
+		}
+		labels, _ := json.Marshal(stored)
 		value := query.GetValue(r.Value)
 
 		severity := rule.MatchSeverity
@@ -329,10 +596,20 @@ func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *
 		// Build annotations map
 		annotations := map[string]string{"value": fmt.Sprintf("%v", value)}
 
+		title := fmt.Sprintf("%s: %s", rule.Name, formatMetric(metric))
+		// Include rule ID so different rules get different alerts for the same instance (avoid 3 rules x 7 instances => 7 alerts)
+		extKey := dedup.KeyForSeriesWithRule(uint(ds.ID), uint(rule.ID), title, metric, i)
+
 		// Multi-level threshold evaluation: first matching level wins.
 		// If thresholds are configured but none match, this series is "normal" (skip / resolve).
+		evalFor := 0
 		if thresholds != nil {
-			matched := MatchThreshold(thresholds, value)
+			// A firing series keeps its level until the value crosses the level's resolve_value (hysteresis).
+			firingSeverity := ""
+			if prev, ok := state.lastResults[extKey]; ok && prev.AlertID != "" {
+				firingSeverity = prev.Severity
+			}
+			matched := MatchThresholdFiring(thresholds, value, firingSeverity)
 			if matched == nil {
 				// Value below all thresholds — don't add to currentKeys so existing alert gets resolved
 				continue
@@ -346,14 +623,27 @@ func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *
 				chJSON, _ := json.Marshal(matched.ChannelIDs)
 				annotations["threshold_channel_ids"] = string(chJSON)
 			}
+			evalFor = matched.EvalFor
 		}
 
-		title := fmt.Sprintf("%s: %s", rule.Name, formatMetric(metric))
-		// Include rule ID so different rules get different alerts for the same instance (avoid 3 rules x 7 instances => 7 alerts)
-		extKey := dedup.KeyForSeriesWithRule(uint(ds.ID), uint(rule.ID), title, metric, i)
+		// A new series must breach eval_for consecutive evaluations before it fires, so a single-sample
+		// spike does not alert. Until then it is pending: no alert, and not a current key.
+		breaching[extKey] = true
+		state.breaches[extKey]++
+		if _, known := state.lastResults[extKey]; !known && state.breaches[extKey] < evalFor {
+			continue
+		}
 		currentKeys[extKey] = true
 
 		lastResult, hadResult := state.lastResults[extKey]
+		if !hadResult {
+			// Firing again supersedes a recovery held while the series flapped.
+			if id := state.flaps.release(extKey); id != "" {
+				db.Model(&models.Alert{}).Where("id = ?", id).UpdateColumn("flapping", false)
+			}
+		}
+		// A series appearing again is a fire transition for flap detection.
+		flapping, flapChanged := state.flaps.update(extKey, rule.FlapThreshold, !hadResult, time.Now())
 
 		// Determine if this alert needs (re-)processing:
 		// 1. First time seeing this series (!hadResult)
@@ -362,11 +652,11 @@ func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *
 		valueChanged := !hadResult || roundValue(lastResult.Value) != roundValue(value)
 		needsReprocess := false
 		if hadResult && !valueChanged && lastResult.AlertID != "" {
-			// Re-process stable alerts every 60s so the engine's sendRateLimited
+			// Re-process stable alerts every reprocessInterval so the engine's sendRateLimited
 			// can decide whether to send a repeat notification.
-			needsReprocess = time.Since(lastResult.Timestamp) >= 60*time.Second
+			needsReprocess = time.Since(lastResult.Timestamp) >= reprocessInterval(rule)-reprocessSlack
 		}
-		if valueChanged || needsReprocess {
+		if valueChanged || needsReprocess || flapChanged {
 			alertID := lastResult.AlertID
 			if alertID == "" {
 				// After restart, in-memory state is lost. Reuse existing firing alert with same (source_id, external_id).
@@ -385,9 +675,12 @@ func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *
 				SourceID:     uint(ds.ID),
 				SourceType:   ds.Type,
 				ExternalID:   extKey,
+				RuleID:       rule.ID,
+				TeamID:       rule.TeamID,
 				Title:        title,
 				Severity:     severity,
 				Status:       "firing",
+				Flapping:     flapping,
 				FiringAt:     time.Now(),
 				Labels:       string(labels),
 				Annotations:  string(annotationsJSON),
@@ -404,6 +697,7 @@ func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *
 						alert.FiringAt = exists.FiringAt
 					}
 					alert.CreatedAt = exists.CreatedAt
+					alert.AssignedTo = exists.AssignedTo
 					if res := db.Save(&alert); res.Error != nil {
 						log.Printf("[scheduler] rule %d failed to update alert %s: %v", rule.ID, alertID, res.Error)
 						continue
@@ -426,6 +720,7 @@ func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *
 				if existing.ID != "" {
 					alert.FiringAt = existing.FiringAt // preserve so duration (e.g. 5m) is satisfied when re-processing
 					alert.CreatedAt = existing.CreatedAt
+					alert.AssignedTo = existing.AssignedTo
 				}
 				if res := db.Save(&alert); res.Error != nil {
 					log.Printf("[scheduler] rule %d failed to update alert %s: %v", rule.ID, alertID, res.Error)
@@ -435,7 +730,14 @@ func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *
 
 			// Process alert through engine asynchronously so notification
 			// delivery (rate limiters, HTTP) does not block the scheduler.
-			engine.ProcessAlertAsync(db, &alert)
+			// Flapping series are held back after a single notice until they stabilize.
+			if flapping {
+				if flapChanged {
+					notifyFlapping(db, rule, &alert, evalID)
+				}
+			} else {
+				engine.ProcessAlertAsync(db, &alert, evalID)
+			}
 
 			// Update state (reset MissCount since series is present)
 			state.lastResults[extKey] = queryResult{
@@ -458,6 +760,11 @@ func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *
 			state.lastResults[extKey] = lastResult
 		}
 	}
+	for k := range state.breaches {
+		if !breaching[k] {
+			delete(state.breaches, k)
+		}
+	}
 	if numResults > 0 {
 		uniqueKeys := len(currentKeys)
 		if uniqueKeys < numResults {
@@ -485,12 +792,23 @@ func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *
 				if err := db.First(&alert, "id = ?", lastResult.AlertID).Error; err == nil {
 					if alert.Status == "firing" {
 						now := time.Now()
+						flapping, flapChanged := state.flaps.update(extKey, rule.FlapThreshold, true, now)
 						alert.Status = "resolved"
 						alert.ResolvedAt = &now
+						alert.Flapping = flapping
 						db.Save(&alert)
-
-						// Process resolved alert (recovery notification) asynchronously
-						engine.ProcessAlertAsync(db, &alert)
+						engine.ClearSnooze(db, alert.ID)
+
+						// Process resolved alert (recovery notification) asynchronously. A flapping series' recovery
+						// is held and sent once it stops flapping (see flapTracker.prune).
+						if flapping {
+							if flapChanged {
+								notifyFlapping(db, rule, &alert, evalID)
+							}
+							state.flaps.hold(extKey, alert.ID)
+						} else {
+							engine.ProcessAlertAsync(db, &alert, evalID)
+						}
 
 						log.Printf("[scheduler] rule %d resolved alert %s (absent %d checks)",
 							rule.ID, alert.ID, lastResult.MissCount)
@@ -501,15 +819,192 @@ func (s *Scheduler) queryPrometheus(ctx context.Context, rule *models.Rule, ds *
 		}
 	}
 
+	for _, id := range state.flaps.prune(currentKeys, rule.FlapThreshold, time.Now()) {
+		sendHeldRecovery(db, rule, id, evalID)
+	}
 	state.lastCheckTime = time.Now()
 }
 
+// sendHeldRecovery notifies the recovery held while a series flapped, now that it has stabilized resolved.
+func sendHeldRecovery(db *gorm.DB, rule *models.Rule, alertID, evalID string) {
+	var alert models.Alert
+	if err := db.Where("id = ?", alertID).Limit(1).Find(&alert).Error; err != nil || alert.Status != "resolved" {
+		return
+	}
+	alert.Flapping = false
+	db.Model(&alert).UpdateColumn("flapping", false)
+	log.Printf("[scheduler] [eval=%s] rule %d alert %s stopped flapping, sending held recovery", evalID, rule.ID, alertID)
+	engine.ProcessAlertAsync(db, &alert, evalID)
+}
+
+// notifyFlapping sends the single "flapping detected" notice for a series; its alerts are not notified again
+// until the series stabilizes.
+func notifyFlapping(db *gorm.DB, rule *models.Rule, alert *models.Alert, evalID string) {
+	log.Printf("[scheduler] [eval=%s] rule %d alert %s is flapping (>= %d transitions in %s), holding notifications",
+		evalID, rule.ID, alert.ID, rule.FlapThreshold, flapWindow)
+	title := "Flapping: " + alert.Title
+	body := fmt.Sprintf("%s\n\n告警在 %s 内状态切换 %d 次以上，已暂停通知，直到状态稳定。", alert.Title, flapWindow, rule.FlapThreshold)
+	engine.SendRuleNotice(db, rule, alert.ID, "flapping", title, body, alert.Severity, evalID)
+}
+
+// withDefaults returns labels plus any defaults it lacks, without modifying labels.
+func withDefaults(labels, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return labels
+	}
+	out := make(map[string]string, len(labels)+len(defaults))
+	for k, v := range defaults {
+		out[k] = v
+	}
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
+
+// restoreStates loads persisted per-series state for all rules so firing counts and miss counters
+// are available immediately after a restart, before each rule's first evaluation.
+func (s *Scheduler) restoreStates() {
+	var ruleIDs []uint
+	if err := s.db.Model(&models.RuleSeriesState{}).Distinct("rule_id").Pluck("rule_id", &ruleIDs).Error; err != nil {
+		log.Printf("[scheduler] failed to list persisted series state: %v", err)
+		return
+	}
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for _, id := range ruleIDs {
+		if _, ok := stateCache[id]; ok {
+			continue
+		}
+		stateCache[id] = newQueryState(s.db, id)
+	}
+	if len(ruleIDs) > 0 {
+		log.Printf("[scheduler] restored series state for %d rule(s)", len(ruleIDs))
+	}
+}
+
+// newQueryState restores a rule's state: its persisted series and the recoveries held for flapping series.
+// Held recoveries are kept as resolved alerts still marked flapping; transition history is not persisted,
+// so after a restart they are sent at the rule's first evaluation unless their series fires again.
+func newQueryState(db *gorm.DB, ruleID uint) *queryState {
+	state := &queryState{lastResults: loadSeriesState(db, ruleID)}
+	state.saved = maps.Clone(state.lastResults)
+	var held []models.Alert
+	db.Select("id, external_id").
+		Where("rule_id = ? AND status = ? AND flapping = ?", ruleID, "resolved", true).
+		Order("resolved_at asc").Find(&held)
+	for _, a := range held {
+		state.flaps.hold(a.ExternalID, a.ID) // the latest resolved alert of a series wins
+	}
+	return state
+}
+
+// loadSeriesState reads the persisted series state of one rule. Returns an empty map when nothing is stored.
+func loadSeriesState(db *gorm.DB, ruleID uint) map[string]queryResult {
+	out := make(map[string]queryResult)
+	var rows []models.RuleSeriesState
+	if err := db.Where("rule_id = ?", ruleID).Find(&rows).Error; err != nil {
+		log.Printf("[scheduler] rule %d failed to load series state: %v", ruleID, err)
+		return out
+	}
+	for _, row := range rows {
+		var metric map[string]string
+		_ = json.Unmarshal([]byte(row.Metric), &metric)
+		out[row.ExternalID] = queryResult{
+			Metric:    metric,
+			Value:     row.Value,
+			Timestamp: row.LastSeenAt,
+			AlertID:   row.AlertID,
+			Severity:  row.Severity,
+			MissCount: row.MissCount,
+		}
+	}
+	return out
+}
+
+// saveSeriesState brings the persisted series state of one rule in line with state.lastResults: series that
+// changed since the last save are upserted and series that are gone are deleted. Call with state.mu held.
+func saveSeriesState(db *gorm.DB, ruleID uint, state *queryState) {
+	if state.deleted {
+		return
+	}
+	var rows []models.RuleSeriesState
+	for extKey, r := range state.lastResults {
+		if prev, ok := state.saved[extKey]; ok && sameSeries(prev, r) {
+			continue
+		}
+		metric, _ := json.Marshal(r.Metric)
+		rows = append(rows, models.RuleSeriesState{
+			RuleID:     ruleID,
+			ExternalID: extKey,
+			AlertID:    r.AlertID,
+			Metric:     string(metric),
+			Value:      r.Value,
+			Severity:   r.Severity,
+			MissCount:  r.MissCount,
+			LastSeenAt: r.Timestamp,
+		})
+	}
+	var gone []string
+	for extKey := range state.saved {
+		if _, ok := state.lastResults[extKey]; !ok {
+			gone = append(gone, extKey)
+		}
+	}
+	if len(rows) == 0 && len(gone) == 0 {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(gone) > 0 {
+			if err := tx.Where("rule_id = ? AND external_id IN ?", ruleID, gone).Delete(&models.RuleSeriesState{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rows, 100).Error
+	})
+	if err != nil {
+		log.Printf("[scheduler] rule %d failed to persist series state: %v", ruleID, err)
+		return
+	}
+	state.saved = maps.Clone(state.lastResults)
+}
+
+// sameSeries reports whether two states of a series would be persisted identically.
+func sameSeries(a, b queryResult) bool {
+	return a.Value == b.Value && a.Timestamp.Equal(b.Timestamp) && a.AlertID == b.AlertID &&
+		a.Severity == b.Severity && a.MissCount == b.MissCount && maps.Equal(a.Metric, b.Metric)
+}
+
+// DeleteRuleState drops the scheduler state of a deleted rule, in memory and in rule_series_states.
+func DeleteRuleState(db *gorm.DB, ruleID uint) {
+	stateMu.Lock()
+	state := stateCache[ruleID]
+	delete(stateCache, ruleID)
+	stateMu.Unlock()
+	if state != nil {
+		// Wait for a running evaluation, then keep it from saving the state again.
+		state.mu.Lock()
+		state.deleted = true
+		state.mu.Unlock()
+	}
+	if err := db.Where("rule_id = ?", ruleID).Delete(&models.RuleSeriesState{}).Error; err != nil {
+		log.Printf("[scheduler] rule %d failed to delete series state: %v", ruleID, err)
+	}
+}
+
 // ThresholdLevel represents one level in a multi-threshold rule.
 type ThresholdLevel struct {
 	Operator   string  `json:"operator"`    // >, <, >=, <=, ==, !=
 	Value      float64 `json:"value"`
 	Severity   string  `json:"severity"`    // critical, warning, info
 	ChannelIDs []uint  `json:"channel_ids"`
+	EvalFor    int     `json:"eval_for,omitempty"` // consecutive evaluations a new series must match before it fires; 0 or 1 = immediately
+	// ResolveValue, when set, is where a series firing at this level resolves instead of Value, e.g. fire at
+	// > 90 and resolve only below 80, so a value hovering at the threshold does not flap. Only for >, >=, <, <=.
+	ResolveValue *float64 `json:"resolve_value,omitempty"`
 }
 
 // ParseThresholds parses the rule's Thresholds JSON into a slice. Returns nil if empty or invalid.
@@ -527,8 +1022,71 @@ func ParseThresholds(raw string) []ThresholdLevel {
 	return levels
 }
 
+// BreachCount returns how many consecutive evaluations of the rule have returned the series (and matched a
+// threshold level, when the rule has thresholds); 0 when the last evaluation did not or the rule has not
+// been evaluated since start. metric and index identify the series as in the query result.
+func BreachCount(ruleID, dsID uint, ruleName string, metric map[string]string, index int) int {
+	stateMu.RLock()
+	state := stateCache[ruleID]
+	stateMu.RUnlock()
+	if state == nil {
+		return 0
+	}
+	if metric == nil {
+		metric = make(map[string]string)
+	}
+	key := dedup.KeyForSeriesWithRule(dsID, ruleID, fmt.Sprintf("%s: %s", ruleName, formatMetric(metric)), metric, index)
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	return state.breaches[key]
+}
+
 // MatchThreshold evaluates value against threshold levels in order (first match wins).
 func MatchThreshold(levels []ThresholdLevel, value float64) *ThresholdLevel {
+	if i := matchThresholdIndex(levels, value); i >= 0 {
+		return &levels[i]
+	}
+	return nil
+}
+
+// MatchThresholdFiring is MatchThreshold for a series already firing with firingSeverity ("" when it is not
+// firing). The first level with that severity and a resolve_value holds while the value has not crossed its
+// resolve_value; a level listed before it that matches outright still wins.
+func MatchThresholdFiring(levels []ThresholdLevel, value float64, firingSeverity string) *ThresholdLevel {
+	matched := matchThresholdIndex(levels, value)
+	if firingSeverity != "" {
+		for i, l := range levels {
+			sev := l.Severity
+			if sev == "" {
+				sev = "warning"
+			}
+			if sev != firingSeverity || l.ResolveValue == nil {
+				continue
+			}
+			if thresholdHeld(l, value) && (matched < 0 || matched > i) {
+				return &levels[i]
+			}
+			break
+		}
+	}
+	if matched >= 0 {
+		return &levels[matched]
+	}
+	return nil
+}
+
+// thresholdHeld reports whether value is still on the firing side of l's resolve_value.
+func thresholdHeld(l ThresholdLevel, value float64) bool {
+	switch l.Operator {
+	case "<", "<=":
+		return value <= *l.ResolveValue
+	case "==", "!=":
+		return false
+	}
+	return value >= *l.ResolveValue // > and >= (and the > default)
+}
+
+func matchThresholdIndex(levels []ThresholdLevel, value float64) int {
 	for i, l := range levels {
 		matched := false
 		switch l.Operator {
@@ -548,10 +1106,15 @@ func MatchThreshold(levels []ThresholdLevel, value float64) *ThresholdLevel {
 			matched = value > l.Value // default to >
 		}
 		if matched {
-			return &levels[i]
+			return i
 		}
 	}
-	return nil
+	return -1
+}
+
+// CheckInterval returns the evaluation interval a rule's check_interval resolves to (at least 1m).
+func CheckInterval(s string) time.Duration {
+	return parseInterval(s)
 }
 
 func parseInterval(s string) time.Duration {
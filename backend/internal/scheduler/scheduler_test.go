@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kk-alert/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSaveSeriesStateWritesChangesOnly(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Alert{}, &models.RuleSeriesState{}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	state := newQueryState(db, 9)
+	state.lastResults["a"] = queryResult{Metric: map[string]string{"host": "a"}, Value: 1, Timestamp: now, AlertID: "alert-a"}
+	state.lastResults["b"] = queryResult{Metric: map[string]string{"host": "b"}, Value: 2, Timestamp: now, AlertID: "alert-b"}
+	saveSeriesState(db, 9, state)
+	if got := loadSeriesState(db, 9); len(got) != 2 || got["b"].AlertID != "alert-b" {
+		t.Fatalf("first save: %+v", got)
+	}
+
+	// Mark the stored row of the unchanged series: a save that rewrote it would reset the value.
+	db.Model(&models.RuleSeriesState{}).Where("rule_id = ? AND external_id = ?", 9, "a").Update("value", 42)
+	b := state.lastResults["b"]
+	b.MissCount = 1
+	state.lastResults["b"] = b
+	state.lastResults["c"] = queryResult{Metric: map[string]string{"host": "c"}, Value: 3, Timestamp: now}
+	saveSeriesState(db, 9, state)
+	got := loadSeriesState(db, 9)
+	if len(got) != 3 || got["a"].Value != 42 || got["b"].MissCount != 1 || got["c"].Value != 3 {
+		t.Fatalf("second save should upsert only b and c: %+v", got)
+	}
+
+	delete(state.lastResults, "c")
+	saveSeriesState(db, 9, state)
+	if got := loadSeriesState(db, 9); len(got) != 2 {
+		t.Errorf("series gone from the results should be deleted: %+v", got)
+	}
+}
+
+func TestDeleteRuleState(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Alert{}, &models.RuleSeriesState{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.RuleSeriesState{RuleID: 10, ExternalID: "a", LastSeenAt: time.Now()})
+	db.Create(&models.RuleSeriesState{RuleID: 11, ExternalID: "a", LastSeenAt: time.Now()})
+	state := newQueryState(db, 10)
+	stateMu.Lock()
+	stateCache[10] = state
+	stateMu.Unlock()
+
+	DeleteRuleState(db, 10)
+	stateMu.RLock()
+	_, cached := stateCache[10]
+	stateMu.RUnlock()
+	if cached {
+		t.Error("state of a deleted rule should leave the cache")
+	}
+	// An evaluation that was running when the rule was deleted must not write the state back.
+	state.lastResults["b"] = queryResult{Timestamp: time.Now()}
+	saveSeriesState(db, 10, state)
+	var rows []models.RuleSeriesState
+	db.Find(&rows)
+	if len(rows) != 1 || rows[0].RuleID != 11 {
+		t.Errorf("only the other rule's state should remain: %+v", rows)
+	}
+}
@@ -0,0 +1,57 @@
+package scheduler
+
+import "testing"
+
+func TestMatchThresholdFiringHysteresis(t *testing.T) {
+	resolve := 80.0
+	levels := []ThresholdLevel{{Operator: ">", Value: 90, Severity: "critical", ResolveValue: &resolve}}
+
+	if m := MatchThresholdFiring(levels, 85, ""); m != nil {
+		t.Fatal("85 must not fire a series that is not firing")
+	}
+	if m := MatchThresholdFiring(levels, 95, ""); m == nil || m.Severity != "critical" {
+		t.Fatal("95 should fire")
+	}
+	for _, v := range []float64{82, 88, 83, 87, 82, 88} {
+		if m := MatchThresholdFiring(levels, v, "critical"); m == nil || m.Severity != "critical" {
+			t.Fatalf("value %v oscillating above resolve_value should stay firing", v)
+		}
+	}
+	if m := MatchThresholdFiring(levels, 79, "critical"); m != nil {
+		t.Error("79 is below resolve_value and should resolve")
+	}
+
+	// Without resolve_value the level resolves at its threshold as before.
+	plain := []ThresholdLevel{{Operator: ">", Value: 90, Severity: "critical"}}
+	if m := MatchThresholdFiring(plain, 88, "critical"); m != nil {
+		t.Error("level without resolve_value should resolve at its threshold")
+	}
+}
+
+func TestMatchThresholdFiringLevels(t *testing.T) {
+	resolve := 80.0
+	levels := []ThresholdLevel{
+		{Operator: ">", Value: 90, Severity: "critical", ResolveValue: &resolve},
+		{Operator: ">", Value: 70, Severity: "warning"},
+	}
+	// A critical series at 85 holds critical rather than dropping to warning.
+	if m := MatchThresholdFiring(levels, 85, "critical"); m == nil || m.Severity != "critical" {
+		t.Errorf("got %+v, want critical held", m)
+	}
+	if m := MatchThresholdFiring(levels, 75, "critical"); m == nil || m.Severity != "warning" {
+		t.Errorf("got %+v, want warning below resolve_value", m)
+	}
+	// A warning series escalates as soon as critical matches.
+	if m := MatchThresholdFiring(levels, 95, "warning"); m == nil || m.Severity != "critical" {
+		t.Errorf("got %+v, want critical", m)
+	}
+
+	below := 20.0
+	low := []ThresholdLevel{{Operator: "<", Value: 10, Severity: "warning", ResolveValue: &below}}
+	if m := MatchThresholdFiring(low, 15, "warning"); m == nil {
+		t.Error("< level should hold until the value rises above resolve_value")
+	}
+	if m := MatchThresholdFiring(low, 21, "warning"); m != nil {
+		t.Error("< level should resolve above resolve_value")
+	}
+}
@@ -0,0 +1,122 @@
+package sender
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the endpoint while a channel's circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit open: channel endpoint failing, skipping send during cooldown")
+
+// Breaker states reported by BreakerState.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// Circuit breaker policy: a channel opens after CIRCUIT_FAILURE_THRESHOLD consecutive failed sends (default 5)
+// and fast-fails for CIRCUIT_COOLDOWN (Go duration, default 1m). Then one trial send is let through
+// (half-open): success closes the circuit, failure re-opens it for another cooldown.
+var (
+	breakerThreshold = envInt("CIRCUIT_FAILURE_THRESHOLD", 5)
+	breakerCooldown  = envDuration("CIRCUIT_COOLDOWN", time.Minute)
+)
+
+type breaker struct {
+	failures  int
+	openUntil time.Time
+	trial     bool // a half-open trial send is in flight
+}
+
+var (
+	breakerMu sync.Mutex
+	breakers  = make(map[string]*breaker)
+)
+
+// breakerKey identifies a channel endpoint by type and config, so every rule sending to it shares one breaker.
+func breakerKey(channelType, configJSON string) string {
+	sum := sha256.Sum256([]byte(channelType + "\x00" + configJSON))
+	return hex.EncodeToString(sum[:8])
+}
+
+// breakerAllow reports whether a send may proceed.
+func breakerAllow(key string) bool {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	b := breakers[key]
+	if b == nil || b.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// breakerResult records the outcome of a send that breakerAllow let through. Permanent errors (invalid
+// config) do not count as endpoint failures.
+func breakerResult(key string, err error) {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	b := breakers[key]
+	var pe *permanentError
+	if errors.As(err, &pe) {
+		// Bad config is not an endpoint outage; don't count it
+		if b != nil {
+			b.trial = false
+		}
+		return
+	}
+	if err == nil {
+		if b != nil {
+			delete(breakers, key)
+		}
+		return
+	}
+	if b == nil {
+		b = &breaker{}
+		breakers[key] = b
+	}
+	b.failures++
+	b.trial = false
+	if b.failures >= breakerThreshold {
+		b.openUntil = time.Now().Add(breakerCooldown)
+	}
+}
+
+// BreakerState returns the circuit state for a channel (closed, open or half_open) and its consecutive failures.
+func BreakerState(channelType, configJSON string) (state string, failures int) {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	b := breakers[breakerKey(channelType, configJSON)]
+	if b == nil {
+		return BreakerClosed, 0
+	}
+	switch {
+	case b.openUntil.IsZero():
+		return BreakerClosed, b.failures
+	case time.Now().Before(b.openUntil):
+		return BreakerOpen, b.failures
+	default:
+		return BreakerHalfOpen, b.failures
+	}
+}
+
+// OpenBreakers returns the number of channel circuits currently open.
+func OpenBreakers() int {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	now := time.Now()
+	n := 0
+	for _, b := range breakers {
+		if now.Before(b.openUntil) {
+			n++
+		}
+	}
+	return n
+}
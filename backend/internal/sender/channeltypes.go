@@ -0,0 +1,108 @@
+package sender
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// channelType binds a channel type name to its config struct, validator and send function.
+type channelType struct {
+	config   interface{} // zero value of the config struct; its json tags define the config schema
+	validate func(configJSON string) error
+	send     func(configJSON string, msg Message) (Receipt, error)
+	// edit replaces a message the channel sent before (by Receipt.MessageID); nil when the platform or
+	// channel cannot edit messages.
+	edit func(configJSON, messageID string, msg Message) (Receipt, error)
+}
+
+var channelTypes = map[string]channelType{
+	"telegram": {config: TelegramConfig{}, validate: validateWith(parseTelegramConfig), send: sendTelegram, edit: editTelegram},
+	"lark":     {config: LarkConfig{}, validate: validateWith(parseLarkConfig), send: noReceipt(sendLark)},
+	"wechat":   {config: WeChatConfig{}, validate: validateWith(parseWeChatConfig), send: noReceipt(sendWeChat)},
+	"slack":    {config: SlackConfig{}, validate: validateWith(parseSlackConfig), send: sendSlack, edit: editSlack},
+	"msteams":  {config: MSTeamsConfig{}, validate: validateWith(parseMSTeamsConfig), send: noReceipt(sendMSTeams)},
+	"sms":      {config: TwilioConfig{}, validate: validateWith(parseTwilioConfig), send: sendSMS},
+	"voice":    {config: VoiceConfig{}, validate: validateWith(parseVoiceConfig), send: sendVoice},
+}
+
+// noReceipt adapts a send function for channels that report nothing beyond success.
+func noReceipt(send func(configJSON string, msg Message) error) func(string, Message) (Receipt, error) {
+	return func(configJSON string, msg Message) (Receipt, error) {
+		return Receipt{}, send(configJSON, msg)
+	}
+}
+
+func validateWith[T any](parse func(string) (T, error)) func(string) error {
+	return func(configJSON string) error {
+		_, err := parse(configJSON)
+		return err
+	}
+}
+
+// ValidateConfig checks that configJSON parses into channelType's config struct and has its required fields.
+func ValidateConfig(channelType, configJSON string) error {
+	ct, ok := channelTypes[channelType]
+	if !ok {
+		return fmt.Errorf("unsupported channel type: %s", channelType)
+	}
+	return ct.validate(configJSON)
+}
+
+// ConfigField describes one key of a channel's config JSON. Fields without omitempty are required.
+type ConfigField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // string, integer, number, boolean, array
+	Required bool   `json:"required"`
+}
+
+// ChannelTypeInfo describes a supported channel type and its config fields.
+type ChannelTypeInfo struct {
+	Type   string        `json:"type"`
+	Fields []ConfigField `json:"fields"`
+}
+
+// ChannelTypes lists the supported channel types with config schemas derived from their config structs.
+func ChannelTypes() []ChannelTypeInfo {
+	out := make([]ChannelTypeInfo, 0, len(channelTypes))
+	for name, ct := range channelTypes {
+		out = append(out, ChannelTypeInfo{Type: name, Fields: configFields(reflect.TypeOf(ct.config))})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+// configFields walks a config struct's json tags, flattening embedded structs.
+func configFields(t reflect.Type) []ConfigField {
+	var fields []ConfigField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, configFields(f.Type)...)
+			continue
+		}
+		tag := f.Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, ConfigField{Name: name, Type: jsonKind(f.Type.Kind()), Required: !strings.Contains(opts, "omitempty")})
+	}
+	return fields
+}
+
+func jsonKind(k reflect.Kind) string {
+	switch k {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "string"
+}
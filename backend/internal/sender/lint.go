@@ -0,0 +1,142 @@
+package sender
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"text/template"
+	"text/template/parse"
+)
+
+// TemplateIssue is one problem found by LintTemplate. Line and Column are 1-based; 0 when unknown.
+type TemplateIssue struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Field   string `json:"field,omitempty"` // set for references to fields AlertTemplateData does not have
+	Message string `json:"message"`
+}
+
+// templateFields is the set of field names available to templates at the top level.
+var templateFields = func() map[string]bool {
+	m := make(map[string]bool)
+	t := reflect.TypeOf(AlertTemplateData{})
+	for i := 0; i < t.NumField(); i++ {
+		m[t.Field(i).Name] = true
+	}
+	return m
+}()
+
+// templateErrRe matches the location prefix text/template puts on parse and exec errors, e.g.
+// "template: alert:3:12: executing ..." or "template: alert:3: unexpected ...".
+var templateErrRe = regexp.MustCompile(`^template: [^:]+:(\d+)(?::(\d+))?: (.*)$`)
+
+// nodeLocRe matches the "name:line:col" location parse.Tree.ErrorContext returns for a node.
+var nodeLocRe = regexp.MustCompile(`:(\d+):(\d+)$`)
+
+// LintTemplate parses body and reports parse errors, references to fields AlertTemplateData does not have
+// (e.g. {{.Sevrity}}) and errors from a dry run over data with missingkey=error. No issues means the
+// template is valid.
+func LintTemplate(body string, data AlertTemplateData) []TemplateIssue {
+	tpl, err := template.New("alert").Parse(body)
+	if err != nil {
+		return []TemplateIssue{issueFromError(err)}
+	}
+	var issues []TemplateIssue
+	if tpl.Tree != nil && tpl.Tree.Root != nil {
+		l := &linter{tree: tpl.Tree, seen: make(map[string]bool)}
+		l.walk(tpl.Tree.Root, true)
+		issues = l.issues
+	}
+	if len(issues) > 0 {
+		return issues // the dry run would only stop at the first unknown field again
+	}
+	if _, err := RenderTemplateStrict(body, data); err != nil {
+		issues = append(issues, issueFromError(err))
+	}
+	return issues
+}
+
+func issueFromError(err error) TemplateIssue {
+	m := templateErrRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return TemplateIssue{Message: err.Error()}
+	}
+	line, _ := strconv.Atoi(m[1])
+	col, _ := strconv.Atoi(m[2])
+	return TemplateIssue{Line: line, Column: col, Message: m[3]}
+}
+
+// linter walks a parse tree collecting unknown field references. rooted tracks whether dot is still the
+// top-level AlertTemplateData (it is not inside range/with bodies).
+type linter struct {
+	tree   *parse.Tree
+	seen   map[string]bool
+	issues []TemplateIssue
+}
+
+func (l *linter) walk(node parse.Node, rooted bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			l.walk(c, rooted)
+		}
+	case *parse.ActionNode:
+		l.walk(n.Pipe, rooted)
+	case *parse.IfNode:
+		l.branch(&n.BranchNode, rooted, rooted)
+	case *parse.RangeNode:
+		l.branch(&n.BranchNode, rooted, false)
+	case *parse.WithNode:
+		l.branch(&n.BranchNode, rooted, false)
+	case *parse.TemplateNode:
+		if n.Pipe != nil {
+			l.walk(n.Pipe, rooted)
+		}
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			l.walk(c, rooted)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			l.walk(a, rooted)
+		}
+	case *parse.ChainNode:
+		l.walk(n.Node, rooted)
+	case *parse.FieldNode:
+		if rooted {
+			l.check(n, n.Ident[0])
+		}
+	case *parse.VariableNode:
+		// $ is always the top-level data, so $.Field is checked even inside range/with.
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			l.check(n, n.Ident[1])
+		}
+	}
+}
+
+func (l *linter) branch(b *parse.BranchNode, rooted, bodyRooted bool) {
+	l.walk(b.Pipe, rooted)
+	l.walk(b.List, bodyRooted)
+	l.walk(b.ElseList, rooted)
+}
+
+func (l *linter) check(node parse.Node, field string) {
+	if templateFields[field] || l.seen[field] {
+		return
+	}
+	l.seen[field] = true
+	iss := TemplateIssue{Field: field, Message: "unknown field ." + field}
+	if loc, _ := l.tree.ErrorContext(node); loc != "" {
+		if m := nodeLocRe.FindStringSubmatch(loc); m != nil {
+			iss.Line, _ = strconv.Atoi(m[1])
+			iss.Column, _ = strconv.Atoi(m[2])
+		}
+	}
+	l.issues = append(l.issues, iss)
+}
@@ -0,0 +1,40 @@
+package sender
+
+import "strings"
+
+// MentionConfig is part of the Lark and WeChat channel configs: who to @-mention on severe alerts.
+type MentionConfig struct {
+	AtUserIDs []string `json:"at_user_ids,omitempty"` // Lark open_id / user_id, WeChat userid
+	AtMobiles []string `json:"at_mobiles,omitempty"`  // WeChat only (mentioned_mobile_list)
+	AtAll     bool     `json:"at_all,omitempty"`
+	// MentionSeverity is the lowest severity that mentions (info < warning < critical); default critical.
+	MentionSeverity string `json:"mention_severity,omitempty"`
+}
+
+var severityRank = map[string]int{"info": 1, "warning": 2, "critical": 3}
+
+// shouldMention reports whether msg should ping the configured people: firing alerts only, at or above
+// MentionSeverity.
+func (m MentionConfig) shouldMention(msg Message) bool {
+	if msg.IsRecovery || (!m.AtAll && len(m.AtUserIDs) == 0 && len(m.AtMobiles) == 0) {
+		return false
+	}
+	min := m.MentionSeverity
+	if min == "" {
+		min = "critical"
+	}
+	rank := severityRank[strings.ToLower(msg.Severity)]
+	return rank > 0 && rank >= severityRank[strings.ToLower(min)]
+}
+
+// larkAtContent renders Lark card <at> tags for the configured users (Lark cards cannot mention by mobile).
+func (m MentionConfig) larkAtContent() string {
+	var parts []string
+	if m.AtAll {
+		parts = append(parts, "<at id=all></at>")
+	}
+	for _, id := range m.AtUserIDs {
+		parts = append(parts, "<at id="+id+"></at>")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,130 @@
+package sender
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kk-alert/backend/internal/httpclient"
+)
+
+// MSTeamsConfig from channel config JSON (Microsoft Teams incoming webhook or Workflows webhook URL).
+type MSTeamsConfig struct {
+	WebhookURL string `json:"webhook_url"`
+	Format     string `json:"format,omitempty"` // "adaptive" (default) or "messagecard" for legacy O365 connectors
+}
+
+// msteamsMaxContent keeps the card under the 28 KB Teams message limit with room for the envelope.
+const msteamsMaxContent = 24000
+
+func parseMSTeamsConfig(configJSON string) (MSTeamsConfig, error) {
+	var cfg MSTeamsConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil || cfg.WebhookURL == "" {
+		return cfg, fmt.Errorf("invalid msteams config: webhook_url required (%v)", err)
+	}
+	switch cfg.Format {
+	case "", "adaptive", "messagecard":
+	default:
+		return cfg, fmt.Errorf("invalid msteams config: format must be adaptive or messagecard, got %q", cfg.Format)
+	}
+	return cfg, nil
+}
+
+// msteamsStyle returns the Adaptive Card container style and MessageCard theme color for a message:
+// green for recovery, red for critical, amber for warning, blue otherwise.
+func msteamsStyle(msg Message) (style, themeColor string) {
+	switch {
+	case msg.IsRecovery:
+		return "good", "2EB886"
+	case msg.Severity == "critical":
+		return "attention", "D13438"
+	case msg.Severity == "warning":
+		return "warning", "FFB900"
+	}
+	return "accent", "0078D4"
+}
+
+func msteamsPayload(cfg MSTeamsConfig, msg Message) map[string]interface{} {
+	header := "告警通知"
+	if msg.IsRecovery {
+		header = "恢复通知"
+	}
+	if msg.Title != "" {
+		header += " · " + msg.Title
+	}
+	content := strings.TrimLeft(msg.Body, "\n\r\t ")
+	if content == "" {
+		content = msg.Title
+	}
+	content = truncateUTF8(content, msteamsMaxContent)
+	style, color := msteamsStyle(msg)
+	if cfg.Format == "messagecard" {
+		return map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"themeColor": color,
+			"summary":    header,
+			"title":      header,
+			// MessageCard text is markdown: keep the body's line breaks
+			"text": strings.ReplaceAll(content, "\n", "  \n"),
+		}
+	}
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"msteams": map[string]interface{}{"width": "Full"},
+		"body": []map[string]interface{}{
+			{
+				"type":  "Container",
+				"style": style,
+				"bleed": true,
+				"items": []map[string]interface{}{
+					{"type": "TextBlock", "text": header, "weight": "Bolder", "size": "Medium", "wrap": true},
+				},
+			},
+			{"type": "TextBlock", "text": content, "wrap": true},
+		},
+	}
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}
+}
+
+func sendMSTeams(configJSON string, msg Message) error {
+	cfg, err := parseMSTeamsConfig(configJSON)
+	if err != nil {
+		return &permanentError{err}
+	}
+	b, _ := json.Marshal(msteamsPayload(cfg, msg))
+	req, err := http.NewRequest(http.MethodPost, cfg.WebhookURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpclient.Default.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	bb, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &apiError{Service: "msteams", StatusCode: resp.StatusCode, Body: string(bb)}
+	}
+	// Connector webhooks answer 200 with body "1" on success and an error string otherwise (some failures,
+	// including throttling, still come back as 200); Workflows webhooks answer 202 with an empty body.
+	body := strings.TrimSpace(string(bb))
+	if body == "" || body == "1" {
+		return nil
+	}
+	if strings.Contains(body, "429") {
+		return &apiError{Service: "msteams", StatusCode: http.StatusTooManyRequests, Body: body}
+	}
+	return &permanentError{fmt.Errorf("msteams api error: %s", truncate(body, 200))}
+}
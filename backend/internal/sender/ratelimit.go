@@ -0,0 +1,60 @@
+package sender
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// limiters holds token buckets created on demand (per channel ID, per Lark webhook).
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*rateLimiter)
+)
+
+// keyedLimiter returns the bucket for key, rebuilding it when rate or burst changed.
+func keyedLimiter(key, name string, rate, burst float64) *rateLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	if rl, ok := limiters[key]; ok && rl.rate == rate && rl.burst == burst {
+		return rl
+	}
+	rl := &rateLimiter{
+		name:     name,
+		rate:     rate,
+		burst:    burst,
+		tokens:   burst,
+		lastTime: time.Now(),
+	}
+	limiters[key] = rl
+	return rl
+}
+
+// channelLimiter returns the bucket for a channel allowing perMinute messages per minute (bursts of up to
+// 10 seconds' worth), or nil when perMinute <= 0 (unlimited).
+func channelLimiter(channelID uint, perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	burst := float64(perMinute) / 6
+	if burst < 1 {
+		burst = 1
+	}
+	return keyedLimiter(fmt.Sprintf("channel:%d", channelID), fmt.Sprintf("channel %d", channelID), float64(perMinute)/60, burst)
+}
+
+// larkWebhookLimiter returns the limiter for a Lark webhook: the shared default bucket unless the channel
+// config sets its own rate (requests per second) and/or burst.
+func larkWebhookLimiter(cfg LarkConfig) *rateLimiter {
+	if cfg.RateLimit <= 0 && cfg.Burst <= 0 {
+		return larkLimiter
+	}
+	rate, burst := larkLimiter.rate, larkLimiter.burst
+	if cfg.RateLimit > 0 {
+		rate = cfg.RateLimit
+	}
+	if cfg.Burst > 0 {
+		burst = float64(cfg.Burst)
+	}
+	return keyedLimiter("lark:"+cfg.WebhookURL, "lark", rate, burst)
+}
@@ -3,31 +3,59 @@ package sender
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
 	"net/http"
+	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
 	"time"
+
+	"github.com/kk-alert/backend/internal/httpclient"
 )
 
 // TelegramConfig from channel config JSON.
 type TelegramConfig struct {
 	Token  string `json:"token"`
 	ChatID string `json:"chat_id"`
+	// ParseMode is "MarkdownV2" or "HTML" (empty = plain text). The header is shown bold and the body is
+	// escaped so label values cannot break Telegram's parser.
+	ParseMode string `json:"parse_mode,omitempty"`
+	// ThreadID targets a forum topic in a supergroup (sent as message_thread_id); 0 = general topic.
+	ThreadID int64 `json:"thread_id,omitempty"`
 }
 
+// telegramAPIBase is the Bot API endpoint (overridden in tests).
+var telegramAPIBase = "https://api.telegram.org"
+
 // LarkConfig from channel config JSON (webhook).
 type LarkConfig struct {
 	WebhookURL string `json:"webhook_url"`
+	// RateLimit (requests per second) and Burst give this webhook its own limiter instead of the shared
+	// default (5/s, burst 3).
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	Burst     int     `json:"burst,omitempty"`
+	MentionConfig
+	// HeaderColor overrides the red card header of alert notifications (a Lark card template color such as
+	// blue, orange or purple). Recovery cards stay green.
+	HeaderColor string `json:"header_color,omitempty"`
+}
+
+// larkHeaderColors are the card header templates Lark accepts.
+var larkHeaderColors = map[string]bool{
+	"blue": true, "wathet": true, "turquoise": true, "green": true, "yellow": true, "orange": true, "red": true,
+	"carmine": true, "violet": true, "purple": true, "indigo": true, "grey": true, "default": true,
 }
 
-// larkRateLimiter implements a token bucket rate limiter for Lark webhook API
-// Limits: 5 requests per second with burst of 3
-type larkRateLimiter struct {
+// rateLimiter implements a token bucket rate limiter (used for the Lark webhook API and per-channel limits).
+type rateLimiter struct {
+	name     string // for logs
 	mu       sync.Mutex
 	tokens   float64
 	lastTime time.Time
@@ -35,13 +63,15 @@ type larkRateLimiter struct {
 	burst    float64 // max burst size
 }
 
-var larkLimiter = &larkRateLimiter{
+// larkLimiter limits the Lark webhook API: 5 requests per second with burst of 3.
+var larkLimiter = &rateLimiter{
+	name:   "lark",
 	rate:   5, // 5 requests per second
 	burst:  3, // burst of 3
 	tokens: 3, // start with full bucket
 }
 
-func (rl *larkRateLimiter) acquire() {
+func (rl *rateLimiter) acquire() {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
@@ -58,7 +88,7 @@ func (rl *larkRateLimiter) acquire() {
 	// If no tokens available, wait
 	if rl.tokens < 1 {
 		sleepTime := time.Duration((1 - rl.tokens) / rl.rate * float64(time.Second))
-		log.Printf("[lark rate limiter] waiting %v for token (tokens=%.2f)", sleepTime, rl.tokens)
+		log.Printf("[%s rate limiter] waiting %v for token (tokens=%.2f)", rl.name, sleepTime, rl.tokens)
 		rl.mu.Unlock()
 		time.Sleep(sleepTime)
 		rl.mu.Lock()
@@ -90,14 +120,36 @@ type AlertTemplateData struct {
 	RuleDescription string
 	// SentAt is when this notification is sent (e.g. "2006-01-02 15:04:05" in Asia/Shanghai), for {{.SentAt}} in template.
 	SentAt string
+	// RunbookURL is the rule's runbook link, empty when the rule has none; use {{if .RunbookURL}} in template.
+	RunbookURL string
+	// AlertURL links to the alert in the UI (UI_BASE_URL + /alerts/<id>), empty when UI_BASE_URL is unset.
+	AlertURL string
+	// ResolutionReason is the reason given when the alert was resolved by hand, empty otherwise.
+	ResolutionReason string
+	// Enrich holds the fields returned by the rule's enrichment lookup (EnrichURL), e.g. {{.Enrich.owner}}; empty when the rule has none.
+	Enrich map[string]string
 }
 
 // RenderTemplate renders the body with text/template so {{.StartAt}}, {{range .Labels}}, {{.Description}} etc. work.
+// A label missing from the alert renders as "" rather than "<no value>"; unknown top-level fields are still errors.
 func RenderTemplate(body string, data AlertTemplateData) (string, error) {
+	return renderTemplate(body, data, "missingkey=zero")
+}
+
+// RenderTemplateStrict is RenderTemplate with missingkey=error: referencing a label the alert lacks is an error.
+// Used by template lint.
+func RenderTemplateStrict(body string, data AlertTemplateData) (string, error) {
+	return renderTemplate(body, data, "missingkey=error")
+}
+
+func renderTemplate(body string, data AlertTemplateData, missingKey string) (string, error) {
 	if data.Labels == nil {
 		data.Labels = make(map[string]string)
 	}
-	tpl, err := template.New("alert").Parse(body)
+	if data.Enrich == nil {
+		data.Enrich = make(map[string]string)
+	}
+	tpl, err := template.New("alert").Option(missingKey).Parse(body)
 	if err != nil {
 		return "", err
 	}
@@ -128,93 +180,378 @@ func RenderBody(body string, labels map[string]string, alertID, title, severity
 	return string(out)
 }
 
-const maxSendRetries = 3
-const retryDelay = time.Second
+// Retry policy: exponential backoff with jitter. Configure with SEND_MAX_RETRIES (attempts, default 3)
+// and SEND_RETRY_BASE_DELAY (Go duration, default 1s). The delay before retry n is base*2^(n-1), randomized
+// to 50–100% of that and capped at maxRetryDelay.
+var (
+	maxSendRetries = envInt("SEND_MAX_RETRIES", 3)
+	retryBaseDelay = envDuration("SEND_RETRY_BASE_DELAY", time.Second)
+)
+
+const maxRetryDelay = 30 * time.Second
+
+// apiError is a non-2xx (or in-body error) response from a channel API.
+type apiError struct {
+	Service    string
+	StatusCode int
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s api %d: %s", e.Service, e.StatusCode, e.Body)
+}
+
+// permanentError marks failures that retrying cannot fix (e.g. invalid channel config).
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// isRetryable reports whether a failed send may succeed on retry: network errors (statusCode 0), 429 and
+// 5xx responses are retried; other 4xx responses and permanent errors are not.
+func isRetryable(err error, statusCode int) bool {
+	if err == nil {
+		return false
+	}
+	var pe *permanentError
+	if errors.As(err, &pe) {
+		return false
+	}
+	if statusCode == 0 {
+		return true
+	}
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// statusCodeOf returns the HTTP status carried by an apiError in err's chain, or 0.
+func statusCodeOf(err error) int {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae.StatusCode
+	}
+	return 0
+}
+
+// backoffDelay returns the jittered delay before retrying after the given (1-based) failed attempt.
+func backoffDelay(attempt int) time.Duration {
+	d := retryBaseDelay << (attempt - 1)
+	if d > maxRetryDelay || d <= 0 {
+		d = maxRetryDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// Message is one notification to deliver to a channel.
+type Message struct {
+	Title      string
+	Body       string
+	IsRecovery bool   // when true, Lark uses the green card header and no one is mentioned
+	Severity   string // alert severity; gates @-mentions (see MentionConfig)
+	// Labels are the alert's labels as routed; channels that build their own short text (SMS) pick from them.
+	Labels map[string]string
+	// OriginalMessageID is the Receipt.MessageID of the firing notification a recovery belongs to on this
+	// channel, when known. With EditOriginal, channels that can edit messages (Telegram, Slack with a bot
+	// token) rewrite that message instead of sending a new one, and send a new one if the edit fails.
+	OriginalMessageID string
+	EditOriginal      bool
+}
+
+// Receipt is what a channel reports about a delivered message.
+type Receipt struct {
+	Detail string // stored on the send record, e.g. the call SIDs of a voice call
+	// MessageID identifies the delivered message on the platform (Telegram message_id, Slack channel/ts), so
+	// it can be edited or replied to later; empty when the channel does not report one.
+	MessageID string
+	// Skipped is set when the channel deliberately sent nothing (e.g. below its min_severity), so the
+	// attempt is recorded as a skip rather than a delivery.
+	Skipped bool
+}
+
+// SendToChannel is Send for a configured channel: it first waits for the channel's rate limit
+// (messages per minute; 0 = unlimited).
+func SendToChannel(channelID uint, ratePerMinute int, channelType, configJSON string, msg Message) error {
+	_, err := SendToChannelReceipt(channelID, ratePerMinute, channelType, configJSON, msg)
+	return err
+}
+
+// SendToChannelReceipt is SendToChannel returning the channel's Receipt.
+func SendToChannelReceipt(channelID uint, ratePerMinute int, channelType, configJSON string, msg Message) (Receipt, error) {
+	if rl := channelLimiter(channelID, ratePerMinute); rl != nil {
+		rl.acquire()
+	}
+	return SendReceipt(channelType, configJSON, msg)
+}
+
+// Send delivers a message to the channel, retrying transient failures with exponential backoff to avoid losing alerts. msg.IsRecovery: when true, Lark uses green card header; when false, red (alert).
+// Sends to a channel whose circuit breaker is open fail immediately with ErrCircuitOpen.
+func Send(channelType, configJSON string, msg Message) error {
+	_, err := SendReceipt(channelType, configJSON, msg)
+	return err
+}
+
+// SendReceipt is Send returning the channel's Receipt.
+func SendReceipt(channelType, configJSON string, msg Message) (Receipt, error) {
+	key := breakerKey(channelType, configJSON)
+	if !breakerAllow(key) {
+		return Receipt{}, ErrCircuitOpen
+	}
+	if rc, ok := editOriginal(channelType, configJSON, msg); ok {
+		breakerResult(key, nil)
+		return rc, nil
+	}
+	rc, err := sendWithRetry(channelType, configJSON, msg)
+	breakerResult(key, err)
+	return rc, err
+}
+
+// editOriginal rewrites msg.OriginalMessageID with msg when msg asks for it and the channel type can edit
+// messages. It reports false (after logging why) when a new message has to be sent instead.
+func editOriginal(channelType, configJSON string, msg Message) (Receipt, bool) {
+	if !msg.EditOriginal || msg.OriginalMessageID == "" {
+		return Receipt{}, false
+	}
+	ct, ok := channelTypes[channelType]
+	if !ok || ct.edit == nil {
+		return Receipt{}, false
+	}
+	rc, err := ct.edit(configJSON, msg.OriginalMessageID, msg)
+	if err != nil {
+		log.Printf("[sender] editing %s message %s failed, sending a new message: %v", channelType, msg.OriginalMessageID, err)
+		return Receipt{}, false
+	}
+	if rc.MessageID == "" {
+		rc.MessageID = msg.OriginalMessageID
+	}
+	if rc.Detail == "" {
+		rc.Detail = "edited message " + msg.OriginalMessageID
+	}
+	return rc, true
+}
+
+func sendWithRetry(channelType, configJSON string, msg Message) (Receipt, error) {
+	ct, ok := channelTypes[channelType]
+	if !ok {
+		return Receipt{}, fmt.Errorf("unsupported channel type: %s", channelType)
+	}
+	var rc Receipt
+	err := withRetry(func() error {
+		var err error
+		rc, err = ct.send(configJSON, msg)
+		return err
+	})
+	return rc, err
+}
 
-// Send delivers a message to the channel with automatic retry (max 3 times) to avoid losing alerts. isRecovery: when true, Lark uses green card header; when false, red (alert).
-func Send(channelType, configJSON, title, body string, isRecovery bool) error {
+// withRetry calls fn until it succeeds, fails with an error that is not retryable, or has been tried
+// maxSendRetries times, backing off between attempts.
+func withRetry(fn func() error) error {
 	var lastErr error
 	for attempt := 1; attempt <= maxSendRetries; attempt++ {
-		switch channelType {
-		case "telegram":
-			lastErr = sendTelegram(configJSON, title, body, isRecovery)
-		case "lark":
-			lastErr = sendLark(configJSON, title, body, isRecovery)
-		default:
-			return fmt.Errorf("unsupported channel type: %s", channelType)
-		}
+		lastErr = fn()
 		if lastErr == nil {
 			return nil
 		}
+		if !isRetryable(lastErr, statusCodeOf(lastErr)) {
+			return lastErr
+		}
 		if attempt < maxSendRetries {
-			log.Printf("[sender] send failed (attempt %d/%d): %v; retrying in %v", attempt, maxSendRetries, lastErr, retryDelay*time.Duration(attempt))
-			time.Sleep(retryDelay * time.Duration(attempt))
+			delay := backoffDelay(attempt)
+			log.Printf("[sender] send failed (attempt %d/%d): %v; retrying in %v", attempt, maxSendRetries, lastErr, delay)
+			time.Sleep(delay)
 		}
 	}
 	return fmt.Errorf("send failed after %d attempts: %w", maxSendRetries, lastErr)
 }
 
-func sendTelegram(configJSON, _ string, body string, isRecovery bool) error {
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// truncate shortens s to at most n bytes for logging.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+func parseTelegramConfig(configJSON string) (TelegramConfig, error) {
 	var cfg TelegramConfig
 	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil || cfg.Token == "" || cfg.ChatID == "" {
-		return fmt.Errorf("invalid telegram config: %w", err)
+		return cfg, fmt.Errorf("invalid telegram config: token and chat_id required (%v)", err)
+	}
+	if cfg.ParseMode != "" && cfg.ParseMode != parseModeMarkdownV2 && cfg.ParseMode != parseModeHTML {
+		return cfg, fmt.Errorf("invalid telegram config: parse_mode must be MarkdownV2 or HTML, got %q", cfg.ParseMode)
+	}
+	return cfg, nil
+}
+
+func sendTelegram(configJSON string, msg Message) (Receipt, error) {
+	cfg, err := parseTelegramConfig(configJSON)
+	if err != nil {
+		return Receipt{}, &permanentError{err}
+	}
+	var rc Receipt
+	chunks := telegramChunks(cfg, msg)
+	id, err := postTelegram(cfg, chunks[0])
+	if err != nil {
+		return rc, err
+	}
+	if id != 0 {
+		// The first message carries the header; it stands for the notification.
+		rc.MessageID = strconv.FormatInt(id, 10)
+	}
+	// Later parts are retried one by one: retrying the whole send would post the parts already delivered again.
+	for i, text := range chunks[1:] {
+		if err := withRetry(func() error { _, err := postTelegram(cfg, text); return err }); err != nil {
+			return rc, &permanentError{fmt.Errorf("telegram part %d of %d: %w", i+2, len(chunks), err)}
+		}
 	}
+	return rc, nil
+}
+
+// telegramChunks is msg as Telegram texts: a bold header and the escaped body, split to fit the message limit.
+func telegramChunks(cfg TelegramConfig, msg Message) []string {
 	header := "告警通知"
-	if isRecovery {
+	if msg.IsRecovery {
 		header = "恢复通知"
 	}
-	text := header
-	if body != "" {
-		text = header + "\n" + strings.TrimLeft(body, "\n\r\t ")
+	escape := func(s string) string { return telegramEscape(cfg.ParseMode, s) }
+	headerText := telegramBold(cfg.ParseMode, header) + "\n"
+	chunks := splitMessage(strings.TrimLeft(msg.Body, "\n\r\t "), telegramMaxMessage-len(headerText), escape)
+	if len(chunks) == 0 {
+		chunks = []string{""}
+	}
+	// Header goes on the first message only; bodies over the limit are sent as several messages
+	chunks[0] = strings.TrimSuffix(headerText+chunks[0], "\n")
+	return chunks
+}
+
+// editTelegram replaces the text of a message sent by sendTelegram (editMessageText). Only the first part
+// of a body over the message limit fits.
+func editTelegram(configJSON, messageID string, msg Message) (Receipt, error) {
+	cfg, err := parseTelegramConfig(configJSON)
+	if err != nil {
+		return Receipt{}, err
 	}
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", cfg.Token)
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return Receipt{}, fmt.Errorf("invalid telegram message id %q", messageID)
+	}
+	payload := map[string]interface{}{
+		"chat_id":    cfg.ChatID,
+		"message_id": id,
+		"text":       telegramChunks(cfg, msg)[0],
+	}
+	if cfg.ParseMode != "" {
+		payload["parse_mode"] = cfg.ParseMode
+	}
+	_, err = telegramCall(cfg, "editMessageText", payload)
+	return Receipt{}, err
+}
+
+// postTelegram calls sendMessage with one chunk of text and returns the new message's ID.
+func postTelegram(cfg TelegramConfig, text string) (int64, error) {
 	payload := map[string]interface{}{
 		"chat_id": cfg.ChatID,
 		"text":    text,
 	}
+	if cfg.ParseMode != "" {
+		payload["parse_mode"] = cfg.ParseMode
+	}
+	if cfg.ThreadID != 0 {
+		payload["message_thread_id"] = cfg.ThreadID
+	}
+	return telegramCall(cfg, "sendMessage", payload)
+}
+
+// telegramCall calls a Bot API method and returns the message_id of the message in its result.
+func telegramCall(cfg TelegramConfig, method string, payload map[string]interface{}) (int64, error) {
+	url := fmt.Sprintf("%s/bot%s/%s", telegramAPIBase, cfg.Token, method)
 	b, _ := json.Marshal(payload)
 	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
 	if err != nil {
-		return err
+		return 0, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := httpclient.Default.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
+	bb, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
 	if resp.StatusCode != http.StatusOK {
-		bb, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("telegram api %d: %s", resp.StatusCode, string(bb))
+		return 0, &apiError{Service: "telegram", StatusCode: resp.StatusCode, Body: string(bb)}
 	}
-	return nil
+	var out struct {
+		Result struct {
+			MessageID int64 `json:"message_id"`
+		} `json:"result"`
+	}
+	_ = json.Unmarshal(bb, &out)
+	return out.Result.MessageID, nil
 }
 
-func sendLark(configJSON, title, body string, isRecovery bool) error {
+// larkCodeRateLimited is the in-body code Lark returns when a webhook is over its frequency limit.
+const larkCodeRateLimited = 11232
+
+// parseLarkConfig accepts either a JSON config or the bare webhook URL.
+func parseLarkConfig(configJSON string) (LarkConfig, error) {
 	var cfg LarkConfig
 	raw := strings.TrimSpace(configJSON)
 	if strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://") {
 		cfg.WebhookURL = raw
 	} else if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil || cfg.WebhookURL == "" {
-		return fmt.Errorf("invalid lark config: use JSON {\"webhook_url\":\"...\"} or paste the webhook URL directly: %w", err)
+		return cfg, fmt.Errorf("invalid lark config: use JSON {\"webhook_url\":\"...\"} or paste the webhook URL directly (%v)", err)
+	}
+	if cfg.HeaderColor != "" && !larkHeaderColors[cfg.HeaderColor] {
+		return cfg, fmt.Errorf("invalid lark config: unknown header_color %q", cfg.HeaderColor)
+	}
+	return cfg, nil
+}
+
+func sendLark(configJSON string, msg Message) error {
+	cfg, err := parseLarkConfig(configJSON)
+	if err != nil {
+		return &permanentError{err}
 	}
 
-	log.Printf("[lark] waiting for rate limiter, webhook: %s...", cfg.WebhookURL[:50])
-	larkLimiter.acquire()
+	log.Printf("[lark] waiting for rate limiter, webhook: %s...", truncate(cfg.WebhookURL, 50))
+	larkWebhookLimiter(cfg).acquire()
 	log.Printf("[lark] rate limiter acquired, sending message")
 
 	// Use interactive card so alert=red header, recovery=green header for visual distinction
 	headerTemplate := "red"
+	if cfg.HeaderColor != "" {
+		headerTemplate = cfg.HeaderColor
+	}
 	headerTitle := "告警通知"
-	if isRecovery {
+	if msg.IsRecovery {
 		headerTemplate = "green"
 		headerTitle = "恢复通知"
 	}
 	// Card header already shows "告警通知"/"恢复"; body content only, trim leading blank lines
-	content := strings.TrimLeft(body, "\n\r\t ")
+	content := strings.TrimLeft(msg.Body, "\n\r\t ")
 	if content == "" {
-		content = title
+		content = msg.Title
+	}
+	elements := []map[string]interface{}{
+		{"tag": "div", "text": map[string]interface{}{"tag": "lark_md", "content": content}},
+	}
+	if cfg.shouldMention(msg) {
+		if at := cfg.larkAtContent(); at != "" {
+			elements = append(elements, map[string]interface{}{"tag": "div", "text": map[string]interface{}{"tag": "lark_md", "content": at}})
+		}
 	}
 	payload := map[string]interface{}{
 		"msg_type": "interactive",
@@ -224,9 +561,7 @@ func sendLark(configJSON, title, body string, isRecovery bool) error {
 				"template": headerTemplate,
 				"title":    map[string]interface{}{"tag": "plain_text", "content": headerTitle},
 			},
-			"elements": []map[string]interface{}{
-				{"tag": "div", "text": map[string]interface{}{"tag": "lark_md", "content": content}},
-			},
+			"elements": elements,
 		},
 	}
 	b, _ := json.Marshal(payload)
@@ -235,8 +570,7 @@ func sendLark(configJSON, title, body string, isRecovery bool) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := httpclient.Default.Do(req)
 	if err != nil {
 		return err
 	}
@@ -246,7 +580,7 @@ func sendLark(configJSON, title, body string, isRecovery bool) error {
 		return fmt.Errorf("lark read body: %w", err)
 	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("lark api %d: %s", resp.StatusCode, string(bb))
+		return &apiError{Service: "lark", StatusCode: resp.StatusCode, Body: string(bb)}
 	}
 	// Lark/Feishu returns HTTP 200 even on failure; real result is in body: {"code":0,"msg":"success"} or {"code":19001,"msg":"..."}
 	var larkResp struct {
@@ -254,7 +588,10 @@ func sendLark(configJSON, title, body string, isRecovery bool) error {
 		Msg  string `json:"msg"`
 	}
 	if err := json.Unmarshal(bb, &larkResp); err == nil && larkResp.Code != 0 {
-		return fmt.Errorf("lark api error: code=%d msg=%s", larkResp.Code, larkResp.Msg)
+		if larkResp.Code == larkCodeRateLimited {
+			return &apiError{Service: "lark", StatusCode: http.StatusTooManyRequests, Body: larkResp.Msg}
+		}
+		return &permanentError{fmt.Errorf("lark api error: code=%d msg=%s", larkResp.Code, larkResp.Msg)}
 	}
 	return nil
 }
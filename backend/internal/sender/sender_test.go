@@ -0,0 +1,632 @@
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		want   bool
+	}{
+		{"network error", errors.New("dial tcp: connection refused"), 0, true},
+		{"server error", &apiError{Service: "lark", StatusCode: 502}, 502, true},
+		{"rate limited", &apiError{Service: "lark", StatusCode: 429}, 429, true},
+		{"bad request", &apiError{Service: "telegram", StatusCode: 400}, 400, false},
+		{"unauthorized", &apiError{Service: "telegram", StatusCode: 401}, 401, false},
+		{"not found", &apiError{Service: "lark", StatusCode: 404}, 404, false},
+		{"invalid config", &permanentError{errors.New("invalid lark config")}, 0, false},
+		{"wrapped permanent", fmt.Errorf("send: %w", &permanentError{errors.New("x")}), 0, false},
+		{"no error", nil, 0, false},
+	}
+	for _, tc := range cases {
+		if got := isRetryable(tc.err, tc.status); got != tc.want {
+			t.Errorf("%s: isRetryable = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBackoffDelayGrowsWithJitter(t *testing.T) {
+	defer setRetryPolicy(3, 100*time.Millisecond)()
+	for attempt := 1; attempt <= 4; attempt++ {
+		full := 100 * time.Millisecond << (attempt - 1)
+		for i := 0; i < 20; i++ {
+			d := backoffDelay(attempt)
+			if d < full/2 || d > full {
+				t.Fatalf("attempt %d: delay %v outside [%v, %v]", attempt, d, full/2, full)
+			}
+		}
+	}
+	if d := backoffDelay(64); d > maxRetryDelay {
+		t.Errorf("expected cap %v, got %v", maxRetryDelay, d)
+	}
+}
+
+func TestSendRetriesServerErrors(t *testing.T) {
+	defer setRetryPolicy(3, time.Millisecond)()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"msg":"success"}`))
+	}))
+	defer srv.Close()
+
+	if err := Send("lark", srv.URL, Message{Title: "t", Body: "b"}); err != nil {
+		t.Fatalf("expected success on third attempt, got %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+}
+
+func TestSendDoesNotRetryClientErrors(t *testing.T) {
+	defer setRetryPolicy(3, time.Millisecond)()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	err := Send("lark", srv.URL, Message{Title: "t", Body: "b"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected a single attempt for 404, got %d", n)
+	}
+	if statusCodeOf(err) != http.StatusNotFound {
+		t.Errorf("expected status 404 in error chain, got %v", err)
+	}
+}
+
+func TestSendDoesNotRetryInvalidConfig(t *testing.T) {
+	defer setRetryPolicy(3, time.Millisecond)()
+	if err := Send("telegram", `{}`, Message{Title: "t", Body: "b"}); err == nil || isRetryable(err, statusCodeOf(err)) {
+		t.Errorf("expected permanent error for invalid config, got %v", err)
+	}
+}
+
+func TestCircuitBreakerOpensAndHalfOpens(t *testing.T) {
+	defer setRetryPolicy(1, time.Millisecond)()
+	oldThreshold, oldCooldown := breakerThreshold, breakerCooldown
+	breakerThreshold, breakerCooldown = 2, 50*time.Millisecond
+	defer func() { breakerThreshold, breakerCooldown = oldThreshold, oldCooldown }()
+
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0}`))
+	}))
+	defer srv.Close()
+
+	for i := 0; i < 2; i++ {
+		_ = Send("lark", srv.URL, Message{Title: "t", Body: "b"})
+	}
+	if state, _ := BreakerState("lark", srv.URL); state != BreakerOpen {
+		t.Fatalf("expected open after threshold, got %s", state)
+	}
+	if err := Send("lark", srv.URL, Message{Title: "t", Body: "b"}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected no request while open, got %d calls", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if state, _ := BreakerState("lark", srv.URL); state != BreakerHalfOpen {
+		t.Fatalf("expected half_open after cooldown, got %s", state)
+	}
+	healthy.Store(true)
+	if err := Send("lark", srv.URL, Message{Title: "t", Body: "b"}); err != nil {
+		t.Fatalf("trial send: %v", err)
+	}
+	if state, failures := BreakerState("lark", srv.URL); state != BreakerClosed || failures != 0 {
+		t.Errorf("expected closed after successful trial, got %s (%d)", state, failures)
+	}
+}
+
+func TestSplitMessageBoundary(t *testing.T) {
+	plain := func(s string) string { return s }
+	exact := strings.Repeat("a", telegramMaxMessage)
+	if chunks := splitMessage(exact, telegramMaxMessage, plain); len(chunks) != 1 {
+		t.Errorf("%d bytes: expected 1 chunk, got %d", len(exact), len(chunks))
+	}
+	over := exact + "b"
+	chunks := splitMessage(over, telegramMaxMessage, plain)
+	if len(chunks) != 2 || len(chunks[0]) != telegramMaxMessage || chunks[1] != "b" {
+		t.Errorf("%d bytes: expected chunks of 4096 and 1, got %d chunks", len(over), len(chunks))
+	}
+	if strings.Join(chunks, "") != over {
+		t.Error("chunks do not reassemble to the original text")
+	}
+}
+
+func TestSplitMessagePrefersLineBreaks(t *testing.T) {
+	plain := func(s string) string { return s }
+	line := strings.Repeat("x", 9) + "\n" // 10 bytes
+	chunks := splitMessage(strings.Repeat(line, 5), 25, plain)
+	if len(chunks) != 3 || chunks[0] != line+line || chunks[2] != line {
+		t.Errorf("expected whole lines per chunk, got %q", chunks)
+	}
+}
+
+func TestSplitMessageKeepsRunesAndEscapes(t *testing.T) {
+	// 3-byte runes: a 10-byte limit must cut after 3 runes, not inside the 4th
+	for _, c := range splitMessage(strings.Repeat("告", 7), 10, func(s string) string { return s }) {
+		if !utf8.ValidString(c) || len(c) > 10 {
+			t.Errorf("invalid chunk %q", c)
+		}
+	}
+	// Escaped length counts toward the limit and escape pairs stay together
+	md := func(s string) string { return telegramEscape(parseModeMarkdownV2, s) }
+	for _, c := range splitMessage(strings.Repeat("a_", 10), 5, md) {
+		if len(c) > 5 || strings.HasSuffix(c, "\\") {
+			t.Errorf("bad escaped chunk %q", c)
+		}
+	}
+}
+
+func TestTelegramEscape(t *testing.T) {
+	if got := telegramEscape(parseModeHTML, "<b>a & b</b>"); got != "&lt;b&gt;a &amp; b&lt;/b&gt;" {
+		t.Errorf("html escape: %q", got)
+	}
+	if got := telegramEscape(parseModeMarkdownV2, "cpu_usage > 90.5!"); got != `cpu\_usage \> 90\.5\!` {
+		t.Errorf("markdown escape: %q", got)
+	}
+	if got := telegramEscape("", "a_b"); got != "a_b" {
+		t.Errorf("plain text must be unchanged: %q", got)
+	}
+}
+
+func TestSendTelegramSplitsLongBody(t *testing.T) {
+	defer setRetryPolicy(1, time.Millisecond)()
+	var texts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p struct {
+			Text      string `json:"text"`
+			ParseMode string `json:"parse_mode"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		if p.ParseMode != "HTML" {
+			t.Errorf("expected parse_mode HTML, got %q", p.ParseMode)
+		}
+		texts = append(texts, p.Text)
+	}))
+	defer srv.Close()
+	old := telegramAPIBase
+	telegramAPIBase = srv.URL
+	defer func() { telegramAPIBase = old }()
+
+	body := strings.Repeat("host-01 <down>\n", 600) // ~9000 bytes once escaped
+	if err := Send("telegram", `{"token":"t","chat_id":"1","parse_mode":"HTML"}`, Message{Body: body}); err != nil {
+		t.Fatal(err)
+	}
+	if len(texts) < 3 {
+		t.Fatalf("expected body split into several messages, got %d", len(texts))
+	}
+	for i, text := range texts {
+		if len(text) > telegramMaxMessage {
+			t.Errorf("message %d is %d bytes", i, len(text))
+		}
+	}
+	if !strings.HasPrefix(texts[0], "<b>告警通知</b>\n") || strings.Contains(texts[1], "告警通知") {
+		t.Errorf("header must be on the first message only")
+	}
+}
+
+func TestSendTelegramRetriesOnlyFailedPart(t *testing.T) {
+	defer setRetryPolicy(3, time.Millisecond)()
+	var texts []string
+	failSecond := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		if len(texts) == 1 && failSecond > 0 {
+			failSecond--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		texts = append(texts, p.Text)
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":` + strconv.Itoa(len(texts)) + `}}`))
+	}))
+	defer srv.Close()
+	old := telegramAPIBase
+	telegramAPIBase = srv.URL
+	defer func() { telegramAPIBase = old }()
+
+	body := strings.Repeat("host-01 down\n", 500)
+	cfg := `{"token":"t","chat_id":"2"}`
+	rc, err := SendReceipt("telegram", cfg, Message{Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(texts) != 2 || !strings.HasPrefix(texts[0], "告警通知") || rc.MessageID != "1" {
+		t.Errorf("the first part must be posted once and the second retried: %d texts, message_id %q", len(texts), rc.MessageID)
+	}
+
+	// A part that keeps failing ends the send without posting the first part again.
+	texts, failSecond = nil, 10
+	if _, err := SendReceipt("telegram", cfg, Message{Body: body}); err == nil || !strings.Contains(err.Error(), "part 2 of 2") {
+		t.Fatalf("expected the failed part in the error, got %v", err)
+	}
+	if len(texts) != 1 {
+		t.Errorf("first part posted %d times, want 1", len(texts))
+	}
+}
+
+func TestMentionGatedBySeverity(t *testing.T) {
+	m := MentionConfig{AtMobiles: []string{"13800000000"}}
+	if !m.shouldMention(Message{Severity: "critical"}) {
+		t.Error("critical should mention by default")
+	}
+	if m.shouldMention(Message{Severity: "warning"}) {
+		t.Error("warning should stay quiet by default")
+	}
+	if m.shouldMention(Message{Severity: "critical", IsRecovery: true}) {
+		t.Error("recovery should never mention")
+	}
+	m.MentionSeverity = "warning"
+	if !m.shouldMention(Message{Severity: "warning"}) || m.shouldMention(Message{Severity: "info"}) {
+		t.Error("mention_severity warning should mention warning and above only")
+	}
+	if (MentionConfig{}).shouldMention(Message{Severity: "critical"}) {
+		t.Error("no targets configured should not mention")
+	}
+}
+
+func TestSendWeChatMentions(t *testing.T) {
+	defer setRetryPolicy(1, time.Millisecond)()
+	var got map[string]map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer srv.Close()
+
+	cfg := `{"webhook_url":"` + srv.URL + `","at_mobiles":["13800000000"],"at_all":true}`
+	if err := Send("wechat", cfg, Message{Title: "t", Body: "disk full", Severity: "critical"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["text"]["mentioned_mobile_list"] == nil || fmt.Sprint(got["text"]["mentioned_list"]) != "[@all]" {
+		t.Errorf("expected mentions in payload, got %v", got["text"])
+	}
+	got = nil
+	if err := Send("wechat", cfg, Message{Title: "t", Body: "disk full", Severity: "warning"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["text"]["mentioned_mobile_list"]; ok {
+		t.Errorf("warning must not mention, got %v", got["text"])
+	}
+}
+
+func TestSendMSTeams(t *testing.T) {
+	defer setRetryPolicy(1, time.Millisecond)()
+	var got map[string]interface{}
+	reply := "1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(reply))
+	}))
+	defer srv.Close()
+
+	cfg := `{"webhook_url":"` + srv.URL + `"}`
+	if err := Send("msteams", cfg, Message{Title: "disk", Body: "disk full", Severity: "critical"}); err != nil {
+		t.Fatal(err)
+	}
+	card := got["attachments"].([]interface{})[0].(map[string]interface{})["content"].(map[string]interface{})
+	header := card["body"].([]interface{})[0].(map[string]interface{})
+	if card["type"] != "AdaptiveCard" || header["style"] != "attention" {
+		t.Errorf("unexpected adaptive card %v", card)
+	}
+
+	legacy := `{"webhook_url":"` + srv.URL + `","format":"messagecard"}`
+	if err := Send("msteams", legacy, Message{Title: "disk", Body: "ok", IsRecovery: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got["@type"] != "MessageCard" || got["themeColor"] != "2EB886" {
+		t.Errorf("unexpected message card %v", got)
+	}
+
+	reply = "Webhook message delivery failed with error: Microsoft Teams endpoint returned HTTP error 400"
+	if err := Send("msteams", cfg, Message{Body: "x"}); err == nil || !strings.Contains(err.Error(), "delivery failed") {
+		t.Errorf("error body on HTTP 200 must fail the send, got %v", err)
+	}
+}
+
+func TestSendSlackReceipt(t *testing.T) {
+	defer setRetryPolicy(1, time.Millisecond)()
+	var got map[string]string
+	reply := `{"ok":true,"channel":"C123","ts":"1700000000.000100"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-1" || r.URL.Path != "/chat.postMessage" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		got = nil
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(reply))
+	}))
+	defer srv.Close()
+	old := slackAPIBase
+	slackAPIBase = srv.URL
+	defer func() { slackAPIBase = old }()
+
+	cfg := `{"bot_token":"xoxb-1","channel":"#alerts"}`
+	rc, err := SendReceipt("slack", cfg, Message{Title: "disk", Body: "a <b> & c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.MessageID != "C123/1700000000.000100" {
+		t.Errorf("message id = %q", rc.MessageID)
+	}
+	if got["channel"] != "#alerts" || got["text"] != "*告警通知 · disk*\na &lt;b&gt; &amp; c" {
+		t.Errorf("unexpected payload %v", got)
+	}
+
+	rc, err = SendReceipt("slack", cfg, Message{Body: "ok", IsRecovery: true, OriginalMessageID: "C123/1699999999.000100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["thread_ts"] != "1699999999.000100" || got["channel"] != "C123" || !strings.Contains(rc.Detail, "thread reply") {
+		t.Errorf("recovery should reply in the firing message's thread: payload %v, receipt %+v", got, rc)
+	}
+
+	reply = `{"ok":false,"error":"channel_not_found"}`
+	if _, err := SendReceipt("slack", cfg, Message{Body: "x"}); err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Errorf("ok=false must fail the send, got %v", err)
+	}
+}
+
+func TestSendTelegramReceipt(t *testing.T) {
+	defer setRetryPolicy(1, time.Millisecond)()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":42}}`))
+	}))
+	defer srv.Close()
+	old := telegramAPIBase
+	telegramAPIBase = srv.URL
+	defer func() { telegramAPIBase = old }()
+
+	rc, err := SendReceipt("telegram", `{"token":"t","chat_id":"1"}`, Message{Body: "x"})
+	if err != nil || rc.MessageID != "42" {
+		t.Errorf("receipt = %+v, err = %v", rc, err)
+	}
+}
+
+func TestEditOriginalOnRecovery(t *testing.T) {
+	defer setRetryPolicy(1, time.Millisecond)()
+	var calls []string
+	editFails := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, path.Base(r.URL.Path))
+		if path.Base(r.URL.Path) == "editMessageText" && editFails {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"ok":false,"description":"Bad Request: message to edit not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":7}}`))
+	}))
+	defer srv.Close()
+	old := telegramAPIBase
+	telegramAPIBase = srv.URL
+	defer func() { telegramAPIBase = old }()
+
+	cfg := `{"token":"t","chat_id":"1"}`
+	msg := Message{Body: "ok", IsRecovery: true, OriginalMessageID: "5", EditOriginal: true}
+	rc, err := SendReceipt("telegram", cfg, msg)
+	if err != nil || len(calls) != 1 || calls[0] != "editMessageText" || rc.MessageID != "5" {
+		t.Fatalf("edit: calls=%v receipt=%+v err=%v", calls, rc, err)
+	}
+
+	calls, editFails = nil, true
+	rc, err = SendReceipt("telegram", cfg, msg)
+	if err != nil || len(calls) != 2 || calls[1] != "sendMessage" || rc.MessageID != "7" {
+		t.Errorf("failed edit should fall back to a new message: calls=%v receipt=%+v err=%v", calls, rc, err)
+	}
+
+	calls = nil
+	if _, err := SendReceipt("telegram", cfg, Message{Body: "ok", IsRecovery: true, OriginalMessageID: "5"}); err != nil || len(calls) != 1 || calls[0] != "sendMessage" {
+		t.Errorf("without EditOriginal a new message is sent: calls=%v err=%v", calls, err)
+	}
+}
+
+func TestSendSMS(t *testing.T) {
+	defer setRetryPolicy(1, time.Millisecond)()
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "AC1" || pass != "tok" || r.URL.Path != "/2010-04-01/Accounts/AC1/Messages.json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = r.ParseForm()
+		bodies = append(bodies, r.PostForm.Get("To")+"|"+r.PostForm.Get("Body"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	oldBase := twilioAPIBase
+	twilioAPIBase = srv.URL
+	defer func() { twilioAPIBase = oldBase }()
+
+	cfg := `{"account_sid":"AC1","auth_token":"tok","from":"+15550000000","to":["+15551111111","+15552222222"]}`
+	labels := map[string]string{"instance": "db-1:9100", "job": "node"}
+	rc, err := SendReceipt("sms", cfg, Message{Title: "warning only", Body: "long body", Severity: "warning", Labels: labels})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 0 || !rc.Skipped {
+		t.Fatalf("below min_severity must be skipped, not texted: skipped=%v texts=%v", rc.Skipped, bodies)
+	}
+	if err := Send("sms", cfg, Message{Title: "Disk full", Body: strings.Repeat("x", 500), Severity: "critical", Labels: labels}); err != nil {
+		t.Fatal(err)
+	}
+	want := "[FIRING critical] Disk full instance=db-1:9100"
+	if len(bodies) != 2 || bodies[0] != "+15551111111|"+want || bodies[1] != "+15552222222|"+want {
+		t.Errorf("unexpected texts %q", bodies)
+	}
+	long := smsText(TwilioConfig{}, Message{Title: strings.Repeat("磁盘", 100), Severity: "critical"})
+	if n := len([]rune(long)); n != 70 {
+		t.Errorf("UCS-2 text must fit one 70-char segment, got %d", n)
+	}
+}
+
+func TestSendSMSPartialFailureIsNotRetried(t *testing.T) {
+	defer setRetryPolicy(3, time.Millisecond)()
+	var texted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if to := r.PostForm.Get("To"); to == "+15552222222" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		texted = append(texted, r.PostForm.Get("To"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	oldBase := twilioAPIBase
+	twilioAPIBase = srv.URL
+	defer func() { twilioAPIBase = oldBase }()
+
+	cfg := `{"account_sid":"AC2","auth_token":"tok","from":"+15550000000","to":["+15551111111","+15552222222"]}`
+	rc, err := SendReceipt("sms", cfg, Message{Title: "Disk full", Severity: "critical"})
+	if err == nil || !strings.Contains(err.Error(), "+15552222222") {
+		t.Fatalf("expected the failed number in the error, got %v", err)
+	}
+	if len(texted) != 1 || rc.Detail != "sms +15551111111" {
+		t.Errorf("the first number must be texted exactly once: texted=%v detail=%q", texted, rc.Detail)
+	}
+}
+
+func TestSendVoice(t *testing.T) {
+	defer setRetryPolicy(1, time.Millisecond)()
+	var twimls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2010-04-01/Accounts/AC1/Calls.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = r.ParseForm()
+		twimls = append(twimls, r.PostForm.Get("Twiml"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"sid":"CA` + strconv.Itoa(len(twimls)) + `"}`))
+	}))
+	defer srv.Close()
+	oldBase := twilioAPIBase
+	twilioAPIBase = srv.URL
+	defer func() { twilioAPIBase = oldBase }()
+
+	cfg := `{"account_sid":"AC1","auth_token":"tok","from":"+15550000000","to":["+15551111111","+15552222222"]}`
+	rc, err := SendReceipt("voice", cfg, Message{Title: "DB <down>", Severity: "warning"})
+	if err != nil || len(twimls) != 0 || !strings.HasPrefix(rc.Detail, "no call") {
+		t.Fatalf("warning must not call: %v %q %v", err, rc.Detail, twimls)
+	}
+	rc, err = SendReceipt("voice", cfg, Message{Title: "DB <down>", Severity: "critical"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.Detail != "call +15551111111=CA1, +15552222222=CA2" {
+		t.Errorf("detail = %q", rc.Detail)
+	}
+	if len(twimls) != 2 || !strings.Contains(twimls[0], "Critical alert. DB &lt;down&gt;.") {
+		t.Errorf("unexpected twiml %q", twimls)
+	}
+	if err := ValidateConfig("voice", `{"provider":"pager","to":["+1"]}`); err == nil {
+		t.Error("unknown provider must be rejected")
+	}
+}
+
+// setRetryPolicy overrides the retry settings and returns a func restoring them.
+func setRetryPolicy(retries int, base time.Duration) func() {
+	oldRetries, oldBase := maxSendRetries, retryBaseDelay
+	maxSendRetries, retryBaseDelay = retries, base
+	return func() { maxSendRetries, retryBaseDelay = oldRetries, oldBase }
+}
+
+func TestValidateConfig(t *testing.T) {
+	cases := []struct {
+		typ, config string
+		ok          bool
+	}{
+		{"telegram", `{"token":"t","chat_id":"1"}`, true},
+		{"telegram", `{"webhook_url":"https://open.larksuite.com/hook/x"}`, false},
+		{"telegram", `{"token":"t","chat_id":"1","parse_mode":"Markdown"}`, false},
+		{"lark", `https://open.larksuite.com/hook/x`, true},
+		{"lark", `{"webhook_url":"https://open.larksuite.com/hook/x"}`, true},
+		{"lark", `{"token":"t","chat_id":"1"}`, false},
+		{"wechat", `{"webhook_url":"https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=x"}`, true},
+		{"wechat", `not json`, false},
+		{"msteams", `{"webhook_url":"https://example.webhook.office.com/webhookb2/x"}`, true},
+		{"msteams", `{"webhook_url":"https://example.webhook.office.com/webhookb2/x","format":"html"}`, false},
+		{"sms", `{"account_sid":"AC1","auth_token":"t","from":"+1555","to":["+1556"]}`, true},
+		{"sms", `{"account_sid":"AC1","auth_token":"t","from":"+1555","to":[]}`, false},
+		{"email", `{}`, false},
+	}
+	for _, c := range cases {
+		err := ValidateConfig(c.typ, c.config)
+		if (err == nil) != c.ok {
+			t.Errorf("ValidateConfig(%s, %s) = %v, want ok=%v", c.typ, c.config, err, c.ok)
+		}
+	}
+}
+
+func TestLintTemplate(t *testing.T) {
+	if issues := LintTemplate("{{.Title}} {{range $k, $v := .Labels}}{{$k}}={{$v}}{{end}}", AlertTemplateData{}); len(issues) != 0 {
+		t.Errorf("valid template: got issues %+v", issues)
+	}
+	issues := LintTemplate("ok\n  {{.Sevrity}}", AlertTemplateData{})
+	if len(issues) != 1 || issues[0].Field != "Sevrity" || issues[0].Line != 2 {
+		t.Errorf("typo: got %+v", issues)
+	}
+	issues = LintTemplate("{{.Labels.host}}", AlertTemplateData{})
+	if len(issues) != 1 || issues[0].Line != 1 || issues[0].Column == 0 {
+		t.Errorf("missing label: got %+v", issues)
+	}
+	if issues := LintTemplate("{{if}}", AlertTemplateData{}); len(issues) != 1 || issues[0].Line != 1 {
+		t.Errorf("parse error: got %+v", issues)
+	}
+}
+
+func TestRenderTemplateMissingKeys(t *testing.T) {
+	data := AlertTemplateData{Title: "disk full", Labels: map[string]string{"host": "web-1"}}
+
+	out, err := RenderTemplate("{{.Title}} on {{.Labels.host}} in [{{.Labels.region}}]", data)
+	if err != nil || out != "disk full on web-1 in []" {
+		t.Errorf("missing label: got %q, %v", out, err)
+	}
+	if _, err := RenderTemplateStrict("{{.Labels.region}}", data); err == nil {
+		t.Error("strict mode: expected error for missing label")
+	}
+	if out, err := RenderTemplate("{{.Labels.region}}", AlertTemplateData{}); err != nil || out != "" {
+		t.Errorf("nil labels: got %q, %v", out, err)
+	}
+
+	for _, render := range []func(string, AlertTemplateData) (string, error){RenderTemplate, RenderTemplateStrict} {
+		if _, err := render("{{.Sevrity}}", data); err == nil {
+			t.Error("missing top-level field: expected error")
+		}
+	}
+}
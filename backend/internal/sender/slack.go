@@ -0,0 +1,169 @@
+package sender
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kk-alert/backend/internal/httpclient"
+)
+
+// SlackConfig from channel config JSON. With a bot token the message is posted through chat.postMessage and
+// its channel/ts is recorded, which replies and edits need; an incoming webhook is simpler to set up but
+// Slack reports nothing back for it.
+type SlackConfig struct {
+	BotToken   string `json:"bot_token,omitempty"`   // xoxb-..., needs chat:write
+	Channel    string `json:"channel,omitempty"`     // channel ID (C...) or name, required with bot_token
+	WebhookURL string `json:"webhook_url,omitempty"` // incoming webhook, used when bot_token is empty
+	// ReplyBroadcast also shows a recovery posted as a thread reply in the channel (reply_broadcast).
+	ReplyBroadcast bool `json:"reply_broadcast,omitempty"`
+}
+
+// slackAPIBase is the Web API endpoint (overridden in tests).
+var slackAPIBase = "https://slack.com/api"
+
+// slackMaxText keeps the text under Slack's 40000-character message limit.
+const slackMaxText = 39000
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func parseSlackConfig(configJSON string) (SlackConfig, error) {
+	var cfg SlackConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid slack config: %v", err)
+	}
+	if cfg.BotToken == "" && cfg.WebhookURL == "" {
+		return cfg, errors.New("invalid slack config: bot_token and channel, or webhook_url, required")
+	}
+	if cfg.BotToken != "" && cfg.Channel == "" {
+		return cfg, errors.New("invalid slack config: channel required with bot_token")
+	}
+	return cfg, nil
+}
+
+// slackText is the message in Slack mrkdwn: a bold header line, then the body with &, < and > escaped so
+// label values cannot form links or mentions.
+func slackText(msg Message) string {
+	header := "告警通知"
+	if msg.IsRecovery {
+		header = "恢复通知"
+	}
+	if msg.Title != "" {
+		header += " · " + msg.Title
+	}
+	body := strings.TrimLeft(msg.Body, "\n\r\t ")
+	return truncateUTF8("*"+slackEscaper.Replace(header)+"*\n"+slackEscaper.Replace(body), slackMaxText)
+}
+
+func sendSlack(configJSON string, msg Message) (Receipt, error) {
+	cfg, err := parseSlackConfig(configJSON)
+	if err != nil {
+		return Receipt{}, &permanentError{err}
+	}
+	text := slackText(msg)
+	if cfg.BotToken == "" {
+		return Receipt{}, postSlackWebhook(cfg.WebhookURL, text)
+	}
+	payload := map[string]interface{}{"channel": cfg.Channel, "text": text}
+	// A recovery goes into the thread of the firing message, keeping an incident's messages together.
+	if origChannel, origTS, ok := strings.Cut(msg.OriginalMessageID, "/"); ok && msg.IsRecovery {
+		reply := map[string]interface{}{"channel": origChannel, "text": text, "thread_ts": origTS}
+		if cfg.ReplyBroadcast {
+			reply["reply_broadcast"] = true
+		}
+		channel, ts, err := slackAPI(cfg.BotToken, "chat.postMessage", reply)
+		var perm *permanentError
+		if !errors.As(err, &perm) {
+			if err != nil {
+				return Receipt{}, err
+			}
+			return Receipt{MessageID: channel + "/" + ts, Detail: "thread reply to " + msg.OriginalMessageID}, nil
+		}
+		// e.g. the firing message was deleted: post the recovery on its own
+		log.Printf("[slack] thread reply to %s failed, posting to the channel: %v", msg.OriginalMessageID, err)
+	}
+	channel, ts, err := slackAPI(cfg.BotToken, "chat.postMessage", payload)
+	if err != nil {
+		return Receipt{}, err
+	}
+	return Receipt{MessageID: channel + "/" + ts}, nil
+}
+
+// editSlack replaces the text of a message posted with a bot token (chat.update). Webhook messages cannot
+// be edited.
+func editSlack(configJSON, messageID string, msg Message) (Receipt, error) {
+	cfg, err := parseSlackConfig(configJSON)
+	if err != nil {
+		return Receipt{}, err
+	}
+	if cfg.BotToken == "" {
+		return Receipt{}, errors.New("slack webhook messages cannot be edited")
+	}
+	channel, ts, ok := strings.Cut(messageID, "/")
+	if !ok {
+		return Receipt{}, fmt.Errorf("invalid slack message id %q", messageID)
+	}
+	_, _, err = slackAPI(cfg.BotToken, "chat.update", map[string]interface{}{"channel": channel, "ts": ts, "text": slackText(msg)})
+	return Receipt{}, err
+}
+
+// slackAPI calls a Web API chat method and returns the channel ID and ts of the message it acted on.
+func slackAPI(token, method string, payload map[string]interface{}) (channel, ts string, err error) {
+	b, _ := json.Marshal(payload)
+	req, err := http.NewRequest(http.MethodPost, slackAPIBase+"/"+method, bytes.NewReader(b))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := httpclient.Default.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	bb, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", "", &apiError{Service: "slack", StatusCode: resp.StatusCode, Body: string(bb)}
+	}
+	// The Web API answers 200 with {"ok":false,"error":"channel_not_found"} on failure.
+	var out struct {
+		OK      bool   `json:"ok"`
+		Error   string `json:"error"`
+		Channel string `json:"channel"`
+		TS      string `json:"ts"`
+	}
+	if err := json.Unmarshal(bb, &out); err != nil {
+		return "", "", fmt.Errorf("slack api: invalid response: %s", truncate(string(bb), 200))
+	}
+	if !out.OK {
+		if out.Error == "ratelimited" {
+			return "", "", &apiError{Service: "slack", StatusCode: http.StatusTooManyRequests, Body: out.Error}
+		}
+		return "", "", &permanentError{fmt.Errorf("slack api error: %s", out.Error)}
+	}
+	return out.Channel, out.TS, nil
+}
+
+func postSlackWebhook(webhookURL, text string) error {
+	b, _ := json.Marshal(map[string]string{"text": text})
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpclient.Default.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bb, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &apiError{Service: "slack", StatusCode: resp.StatusCode, Body: string(bb)}
+	}
+	return nil
+}
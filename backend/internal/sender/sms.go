@@ -0,0 +1,155 @@
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kk-alert/backend/internal/httpclient"
+)
+
+// TwilioConfig from channel config JSON (SMS via the Twilio Messages API).
+type TwilioConfig struct {
+	AccountSID string   `json:"account_sid"`
+	AuthToken  string   `json:"auth_token"`
+	From       string   `json:"from"` // Twilio number (E.164) or messaging service SID (MG...)
+	To         []string `json:"to"`   // E.164 numbers, each gets its own message
+	// MinSeverity is the lowest severity that is texted (info < warning < critical); default critical, so a
+	// noisy rule routed here by mistake does not run up the bill. Recoveries follow the same gate; messages
+	// without a severity (channel tests, scheduled reports) are always sent.
+	MinSeverity string `json:"min_severity,omitempty"`
+	// KeyLabel is the one label appended to the text (default instance).
+	KeyLabel string `json:"key_label,omitempty"`
+}
+
+// twilioAPIBase is the Twilio REST endpoint (overridden in tests).
+var twilioAPIBase = "https://api.twilio.com"
+
+func parseTwilioConfig(configJSON string) (TwilioConfig, error) {
+	var cfg TwilioConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid sms config: %v", err)
+	}
+	if cfg.AccountSID == "" || cfg.AuthToken == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return cfg, errors.New("invalid sms config: account_sid, auth_token, from and to required")
+	}
+	if cfg.MinSeverity != "" && severityRank[strings.ToLower(cfg.MinSeverity)] == 0 {
+		return cfg, fmt.Errorf("invalid sms config: unknown min_severity %q", cfg.MinSeverity)
+	}
+	return cfg, nil
+}
+
+// smsText is the whole SMS: status, severity, title and one key label, cut to a single segment (160 GSM
+// characters, or 70 when the text needs UCS-2, e.g. Chinese).
+func smsText(cfg TwilioConfig, msg Message) string {
+	status := "FIRING"
+	if msg.IsRecovery {
+		status = "RESOLVED"
+	}
+	title := msg.Title
+	if title == "" {
+		title = msg.Labels["alertname"]
+	}
+	text := "[" + status
+	if msg.Severity != "" {
+		text += " " + msg.Severity
+	}
+	text += "] " + title
+	key := cfg.KeyLabel
+	if key == "" {
+		key = "instance"
+	}
+	if v := msg.Labels[key]; v != "" {
+		text += " " + key + "=" + v
+	}
+	limit := 160
+	for _, r := range text {
+		if r > 0x7f {
+			limit = 70
+			break
+		}
+	}
+	if utf8.RuneCountInString(text) > limit {
+		text = string([]rune(text)[:limit-1]) + "…"
+	}
+	return text
+}
+
+func sendSMS(configJSON string, msg Message) (Receipt, error) {
+	cfg, err := parseTwilioConfig(configJSON)
+	if err != nil {
+		return Receipt{}, &permanentError{err}
+	}
+	min := cfg.MinSeverity
+	if min == "" {
+		min = "critical"
+	}
+	if msg.Severity != "" && severityRank[strings.ToLower(msg.Severity)] < severityRank[strings.ToLower(min)] {
+		log.Printf("[sms] not texting %q: severity %q below min_severity %s", msg.Title, msg.Severity, min)
+		return Receipt{Skipped: true, Detail: "no sms: severity " + msg.Severity + " below min_severity " + min}, nil
+	}
+	text := smsText(cfg, msg)
+	endpoint := twilioAPIBase + "/2010-04-01/Accounts/" + url.PathEscape(cfg.AccountSID) + "/Messages.json"
+	var sent []string
+	var errs []error
+	for _, to := range cfg.To {
+		if err := postTwilio(cfg, endpoint, to, text); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", to, err))
+			continue
+		}
+		sent = append(sent, to)
+	}
+	rc := Receipt{Detail: "sms " + strings.Join(sent, ", ")}
+	err = errors.Join(errs...)
+	if err != nil && len(sent) > 0 {
+		// Some numbers were already texted; a retry would text (and bill) them again.
+		err = &permanentError{err}
+	}
+	return rc, err
+}
+
+func postTwilio(cfg TwilioConfig, endpoint, to, text string) error {
+	form := url.Values{"To": {to}, "Body": {text}}
+	if strings.HasPrefix(cfg.From, "MG") {
+		form.Set("MessagingServiceSid", cfg.From)
+	} else {
+		form.Set("From", cfg.From)
+	}
+	_, err := twilioRequest(cfg.AccountSID, cfg.AuthToken, endpoint, form)
+	return err
+}
+
+// twilioRequest POSTs form to a Twilio REST endpoint and returns the response body of a 2xx answer.
+func twilioRequest(accountSID, authToken, endpoint string, form url.Values) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(accountSID, authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpclient.Default.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bb, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Twilio errors are {"code":21211,"message":"The 'To' number ... is not a valid phone number.",...}
+		var te struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		body := string(bb)
+		if json.Unmarshal(bb, &te) == nil && te.Message != "" {
+			body = fmt.Sprintf("code=%d %s", te.Code, te.Message)
+		}
+		return nil, &apiError{Service: "twilio", StatusCode: resp.StatusCode, Body: body}
+	}
+	return bb, nil
+}
@@ -0,0 +1,88 @@
+package sender
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// telegramMaxMessage is Telegram's sendMessage text limit. It is counted in characters after entity parsing;
+// splitting on bytes keeps every chunk under it.
+const telegramMaxMessage = 4096
+
+// Telegram parse modes accepted in TelegramConfig.ParseMode.
+const (
+	parseModeMarkdownV2 = "MarkdownV2"
+	parseModeHTML       = "HTML"
+)
+
+// telegramMarkdownV2Special are the characters MarkdownV2 requires to be escaped in plain text.
+const telegramMarkdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+var telegramHTMLEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// telegramEscape escapes text so Telegram shows it literally under parseMode ("" = plain text, unchanged).
+func telegramEscape(parseMode, text string) string {
+	switch parseMode {
+	case parseModeHTML:
+		return telegramHTMLEscaper.Replace(text)
+	case parseModeMarkdownV2:
+		var b strings.Builder
+		b.Grow(len(text))
+		for _, r := range text {
+			if strings.ContainsRune(telegramMarkdownV2Special, r) {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+	return text
+}
+
+// telegramBold formats a (plain) header as bold for parseMode.
+func telegramBold(parseMode, text string) string {
+	switch parseMode {
+	case parseModeHTML:
+		return "<b>" + telegramEscape(parseMode, text) + "</b>"
+	case parseModeMarkdownV2:
+		return "*" + telegramEscape(parseMode, text) + "*"
+	}
+	return text
+}
+
+// splitMessage escapes text with escape and splits it into chunks of at most limit bytes. It breaks at
+// line ends where possible; a single longer line is split between runes, never inside a rune or an
+// escape sequence.
+func splitMessage(text string, limit int, escape func(string) string) []string {
+	var chunks []string
+	var cur strings.Builder
+	flush := func() {
+		if strings.TrimSpace(cur.String()) != "" {
+			chunks = append(chunks, cur.String())
+		}
+		cur.Reset()
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		e := escape(line)
+		if cur.Len()+len(e) <= limit {
+			cur.WriteString(e)
+			continue
+		}
+		flush()
+		if len(e) <= limit {
+			cur.WriteString(e)
+			continue
+		}
+		for len(line) > 0 {
+			r, size := utf8.DecodeRuneInString(line)
+			er := escape(string(r))
+			if cur.Len()+len(er) > limit {
+				flush()
+			}
+			cur.WriteString(er)
+			line = line[size:]
+		}
+	}
+	flush()
+	return chunks
+}
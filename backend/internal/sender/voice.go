@@ -0,0 +1,168 @@
+package sender
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kk-alert/backend/internal/httpclient"
+)
+
+// VoiceConfig from channel config JSON: a phone call reading a short text-to-speech message, for alerts that
+// must wake someone up. Only firing critical alerts are called. There is no escalation chain; to make a call
+// the last resort, put the channel in a rule's fallback channels.
+type VoiceConfig struct {
+	Provider string   `json:"provider,omitempty"` // twilio (default) or webhook
+	To       []string `json:"to"`                 // E.164 numbers, each is called
+	// twilio: Twilio Voice with TwiML <Say>.
+	AccountSID string `json:"account_sid,omitempty"`
+	AuthToken  string `json:"auth_token,omitempty"`
+	From       string `json:"from,omitempty"`
+	Language   string `json:"language,omitempty"` // TTS language, e.g. en-US (default) or zh-CN
+	// webhook: POSTs {"to","message","title","severity"} to WebhookURL, for any other provider behind a small
+	// bridge. An "id" in the JSON response is recorded as the call ID.
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+// voiceProvider places one call reading text to a number and returns the provider's call ID.
+type voiceProvider struct {
+	validate func(cfg VoiceConfig) error
+	call     func(cfg VoiceConfig, to, text string, msg Message) (string, error)
+}
+
+var voiceProviders = map[string]voiceProvider{
+	"twilio":  {validate: validateTwilioVoice, call: callTwilio},
+	"webhook": {validate: validateVoiceWebhook, call: callVoiceWebhook},
+}
+
+func parseVoiceConfig(configJSON string) (VoiceConfig, error) {
+	var cfg VoiceConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid voice config: %v", err)
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = "twilio"
+	}
+	p, ok := voiceProviders[cfg.Provider]
+	if !ok {
+		return cfg, fmt.Errorf("invalid voice config: unknown provider %q", cfg.Provider)
+	}
+	if len(cfg.To) == 0 {
+		return cfg, errors.New("invalid voice config: to required")
+	}
+	return cfg, p.validate(cfg)
+}
+
+// voiceText is what the call reads out: a fixed lead-in, the title and the instance when present.
+func voiceText(msg Message) string {
+	title := msg.Title
+	if title == "" {
+		title = msg.Labels["alertname"]
+	}
+	text := "Critical alert. " + title + "."
+	if inst := msg.Labels["instance"]; inst != "" {
+		text += " Instance " + inst + "."
+	}
+	if r := []rune(text); len(r) > 300 {
+		text = string(r[:300])
+	}
+	return text
+}
+
+func sendVoice(configJSON string, msg Message) (Receipt, error) {
+	cfg, err := parseVoiceConfig(configJSON)
+	if err != nil {
+		return Receipt{}, &permanentError{err}
+	}
+	if msg.IsRecovery || !strings.EqualFold(msg.Severity, "critical") {
+		return Receipt{Skipped: true, Detail: "no call: only firing critical alerts are called"}, nil
+	}
+	p := voiceProviders[cfg.Provider]
+	text := voiceText(msg)
+	var ids []string
+	var errs []error
+	for _, to := range cfg.To {
+		id, err := p.call(cfg, to, text, msg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", to, err))
+			continue
+		}
+		ids = append(ids, to+"="+id)
+	}
+	rc := Receipt{Detail: "call " + strings.Join(ids, ", ")}
+	err = errors.Join(errs...)
+	if err != nil && len(ids) > 0 {
+		// Some numbers were already called; a retry would ring them again.
+		err = &permanentError{err}
+	}
+	return rc, err
+}
+
+func validateTwilioVoice(cfg VoiceConfig) error {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" || cfg.From == "" {
+		return errors.New("invalid voice config: account_sid, auth_token and from required for twilio")
+	}
+	return nil
+}
+
+func callTwilio(cfg VoiceConfig, to, text string, _ Message) (string, error) {
+	lang := cfg.Language
+	if lang == "" {
+		lang = "en-US"
+	}
+	var esc bytes.Buffer
+	_ = xml.EscapeText(&esc, []byte(text))
+	twiml := `<Response><Say language="` + xmlAttr(lang) + `" loop="2">` + esc.String() + `</Say></Response>`
+	endpoint := twilioAPIBase + "/2010-04-01/Accounts/" + url.PathEscape(cfg.AccountSID) + "/Calls.json"
+	bb, err := twilioRequest(cfg.AccountSID, cfg.AuthToken, endpoint, url.Values{"To": {to}, "From": {cfg.From}, "Twiml": {twiml}})
+	if err != nil {
+		return "", err
+	}
+	var call struct {
+		SID string `json:"sid"`
+	}
+	_ = json.Unmarshal(bb, &call)
+	return call.SID, nil
+}
+
+func xmlAttr(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func validateVoiceWebhook(cfg VoiceConfig) error {
+	if cfg.WebhookURL == "" {
+		return errors.New("invalid voice config: webhook_url required for webhook provider")
+	}
+	return nil
+}
+
+func callVoiceWebhook(cfg VoiceConfig, to, text string, msg Message) (string, error) {
+	b, _ := json.Marshal(map[string]string{"to": to, "message": text, "title": msg.Title, "severity": msg.Severity})
+	req, err := http.NewRequest(http.MethodPost, cfg.WebhookURL, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpclient.Default.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	bb, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", &apiError{Service: "voice", StatusCode: resp.StatusCode, Body: string(bb)}
+	}
+	var out struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(bb, &out)
+	return out.ID, nil
+}
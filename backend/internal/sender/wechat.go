@@ -0,0 +1,100 @@
+package sender
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kk-alert/backend/internal/httpclient"
+)
+
+// WeChatConfig from channel config JSON (WeCom group robot webhook).
+type WeChatConfig struct {
+	WebhookURL string `json:"webhook_url"`
+	MentionConfig
+}
+
+// wechatMaxContent is the WeCom robot text message limit in bytes.
+const wechatMaxContent = 2048
+
+// wechatCodeRateLimited is the errcode WeCom returns when a robot exceeds 20 messages per minute.
+const wechatCodeRateLimited = 45009
+
+func parseWeChatConfig(configJSON string) (WeChatConfig, error) {
+	var cfg WeChatConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil || cfg.WebhookURL == "" {
+		return cfg, fmt.Errorf("invalid wechat config: webhook_url required (%v)", err)
+	}
+	return cfg, nil
+}
+
+func sendWeChat(configJSON string, msg Message) error {
+	cfg, err := parseWeChatConfig(configJSON)
+	if err != nil {
+		return &permanentError{err}
+	}
+	header := "告警通知"
+	if msg.IsRecovery {
+		header = "恢复通知"
+	}
+	content := strings.TrimLeft(msg.Body, "\n\r\t ")
+	if content == "" {
+		content = msg.Title
+	}
+	text := map[string]interface{}{"content": truncateUTF8(header+"\n"+content, wechatMaxContent)}
+	if cfg.shouldMention(msg) {
+		users := append([]string(nil), cfg.AtUserIDs...)
+		if cfg.AtAll {
+			users = append(users, "@all")
+		}
+		if len(users) > 0 {
+			text["mentioned_list"] = users
+		}
+		if len(cfg.AtMobiles) > 0 {
+			text["mentioned_mobile_list"] = cfg.AtMobiles
+		}
+	}
+	b, _ := json.Marshal(map[string]interface{}{"msgtype": "text", "text": text})
+	req, err := http.NewRequest(http.MethodPost, cfg.WebhookURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpclient.Default.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	bb, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return &apiError{Service: "wechat", StatusCode: resp.StatusCode, Body: string(bb)}
+	}
+	// WeCom returns HTTP 200 with {"errcode":0,"errmsg":"ok"} on success
+	var wr struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(bb, &wr); err == nil && wr.ErrCode != 0 {
+		if wr.ErrCode == wechatCodeRateLimited {
+			return &apiError{Service: "wechat", StatusCode: http.StatusTooManyRequests, Body: wr.ErrMsg}
+		}
+		return &permanentError{fmt.Errorf("wechat api error: errcode=%d errmsg=%s", wr.ErrCode, wr.ErrMsg)}
+	}
+	return nil
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -18,21 +18,60 @@ type DB struct {
 func migrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(
 		&models.User{},
+		&models.Team{},
 		&models.Datasource{},
 		&models.Channel{},
 		&models.Template{},
 		&models.Rule{},
 		&models.Alert{},
 		&models.AlertSendRecord{},
+		&models.FailedNotification{},
 		&models.AlertSilence{},
 		&models.JiraCreated{},
 		&models.SystemConfig{},
+		&models.RuleSeriesState{},
+		&models.ScheduledReport{},
+		&models.RuleRevision{},
+		&models.InhibitRule{},
+		&models.AggregationState{},
 	); err != nil {
 		return err
 	}
+	if err := migrateUniqueFiringAlerts(db); err != nil {
+		return err
+	}
 	return migrateAlertSuppressionsToSilences(db)
 }
 
+// migrateUniqueFiringAlerts enforces at most one firing alert per (source_id, external_id) so concurrent
+// inbound deliveries (e.g. Alertmanager retries) cannot create duplicates. Existing duplicates are
+// resolved first, keeping the most recently updated row firing.
+func migrateUniqueFiringAlerts(db *gorm.DB) error {
+	var dups []struct {
+		SourceID   uint
+		ExternalID string
+	}
+	if err := db.Model(&models.Alert{}).Select("source_id, external_id").
+		Where("status = ? AND external_id <> ?", "firing", "").
+		Group("source_id, external_id").Having("count(*) > 1").Scan(&dups).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, d := range dups {
+		var ids []string
+		db.Model(&models.Alert{}).Where("source_id = ? AND external_id = ? AND status = ?", d.SourceID, d.ExternalID, "firing").
+			Order("updated_at desc").Pluck("id", &ids)
+		if len(ids) < 2 {
+			continue
+		}
+		if err := db.Model(&models.Alert{}).Where("id IN ?", ids[1:]).
+			Updates(map[string]interface{}{"status": "resolved", "resolved_at": now}).Error; err != nil {
+			return err
+		}
+	}
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_firing_external ON alerts (source_id, external_id) WHERE status = 'firing' AND external_id <> ''").Error
+}
+
 // migrateAlertSuppressionsToSilences one-time: copy alert_suppressions -> alert_silences, drop old table.
 func migrateAlertSuppressionsToSilences(db *gorm.DB) error {
 	if res := db.Exec("SELECT 1 FROM alert_suppressions LIMIT 1"); res.Error != nil {
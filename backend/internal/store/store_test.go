@@ -18,3 +18,13 @@ func TestNewSQLite(t *testing.T) {
 	}
 	_ = os.Remove(path)
 }
+
+func TestAlertStatusLabelsIndex(t *testing.T) {
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Migrator().HasIndex("alerts", "idx_alerts_status_labels") {
+		t.Error("alerts should have the (status, labels) index used by inhibition")
+	}
+}
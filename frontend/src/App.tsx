@@ -50,6 +50,7 @@ export default function App() {
         <Route index element={<Navigate to="/dashboard" replace />} />
         <Route path="dashboard" element={<Dashboard />} />
         <Route path="alerts" element={<Alerts />} />
+        <Route path="alerts/:id" element={<Alerts />} />
         <Route path="reports" element={<Reports />} />
         <Route path="datasources" element={<Datasources />} />
         <Route path="channels" element={<Channels />} />
@@ -51,6 +51,8 @@ export default function Layout() {
   const { logout, user, token } = useAuth()
   const navigate = useNavigate()
   const { pathname } = useLocation()
+  // Detail routes such as /alerts/:id belong to their list page's menu item
+  const navKey = '/' + pathname.split('/')[1]
   const { message } = App.useApp()
 
   const navItems = useMemo(() => {
@@ -201,7 +203,7 @@ export default function Layout() {
         <Menu
           theme="dark"
           mode="inline"
-          selectedKeys={[pathname]}
+          selectedKeys={[navKey]}
           items={menuItems}
           style={{
             marginTop: 12,
@@ -282,7 +284,7 @@ export default function Layout() {
         >
           <div style={{ display: 'flex', alignItems: 'center', gap: 16 }}>
             <Text type="secondary" style={{ fontSize: 14 }}>
-              {allNavItems.find(item => item.key === pathname)?.label || 'Dashboard'}
+              {allNavItems.find(item => item.key === navKey)?.label || 'Dashboard'}
             </Text>
           </div>
 
@@ -415,7 +417,7 @@ export default function Layout() {
           }}
         >
           <motion.div
-            key={pathname}
+            key={navKey}
             initial={{ opacity: 0, y: 10 }}
             animate={{ opacity: 1, y: 0 }}
             transition={{ duration: 0.3 }}
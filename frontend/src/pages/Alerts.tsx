@@ -2,6 +2,7 @@ import { useEffect, useState } from 'react'
 import { App, Table, Button, Select, Space, Modal, Card, Tag, Typography, Row, Col, Input, Tooltip, Drawer } from 'antd'
 const { Search } = Input
 import { motion } from 'framer-motion'
+import { useNavigate, useParams } from 'react-router-dom'
 import { 
   ReloadOutlined, 
   EyeOutlined, 
@@ -112,6 +113,9 @@ const SILENCE_DURATIONS = [
 
 export default function Alerts() {
   const { message } = App.useApp()
+  // /alerts/:id (the link in notifications) opens that alert's detail
+  const { id: routeAlertId } = useParams()
+  const navigate = useNavigate()
   const [list, setList] = useState<Alert[]>([])
   const [total, setTotal] = useState(0)
   const [loading, setLoading] = useState(true)
@@ -268,9 +272,22 @@ export default function Alerts() {
   }, [page, pageSize, severity, status, datasourceId, alertIdSearch, titleSearch])
 
   const loadDetail = (id: string) => {
-    fetch(`/api/v1/alerts/${id}`, { headers: authHeaders() })
-      .then((r) => r.json())
+    fetch(`/api/v1/alerts/${encodeURIComponent(id)}`, { headers: authHeaders() })
+      .then((r) => {
+        if (!r.ok) throw new Error('not found')
+        return r.json()
+      })
       .then(setDetail)
+      .catch(() => message.error('告警不存在或无权查看'))
+  }
+
+  useEffect(() => {
+    if (routeAlertId) loadDetail(routeAlertId)
+  }, [routeAlertId])
+
+  const closeDetail = () => {
+    setDetail(null)
+    if (routeAlertId) navigate('/alerts', { replace: true })
   }
 
   const clearFilters = () => {
@@ -634,7 +651,7 @@ export default function Alerts() {
             </Space>
           }
           open 
-          onCancel={() => setDetail(null)} 
+          onCancel={closeDetail} 
           footer={null} 
           width={720}
           className="alert-detail-modal"